@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminToken guards the /api/admin routes; admin access is disabled when it is empty
+var adminToken string
+
+// isAdmin reports whether the request carries the admin token
+func isAdmin(c *gin.Context) bool {
+	given := c.GetHeader("X-Admin-Token")
+	return adminToken != "" && subtle.ConstantTimeCompare([]byte(given), []byte(adminToken)) == 1
+}
+
+// requireAdmin rejects requests that don't carry the admin token
+func requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminToken == "" {
+			respond(c, 403, gin.H{"error": "admin API is disabled (no admin token configured)"})
+			c.Abort()
+			return
+		}
+		if !isAdmin(c) {
+			respond(c, 401, gin.H{"error": "missing or invalid X-Admin-Token header"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
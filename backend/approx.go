@@ -0,0 +1,126 @@
+package main
+
+// approxBucketWidth is the rating span of each bucket in the running histogram
+// used to estimate deep ranks
+const approxBucketWidth = 10
+
+// exactRankTop is how many of the best ranks are always computed exactly; ranks
+// past it may be estimated when a client asks for approximate=true
+var exactRankTop = 1000
+
+// ratingHistogram counts ratings per fixed-width bucket. It is kept up to date
+// alongside the rating moments, so a rank can be estimated without a re-rank.
+type ratingHistogram struct {
+	width  int
+	counts map[int]int
+}
+
+func newRatingHistogram(width int) ratingHistogram {
+	return ratingHistogram{width: width, counts: make(map[int]int)}
+}
+
+func (h ratingHistogram) bucket(rating int) int {
+	return floorDiv(rating, h.width)
+}
+
+func (h ratingHistogram) add(rating int) {
+	h.counts[h.bucket(rating)]++
+}
+
+func (h ratingHistogram) remove(rating int) {
+	bucket := h.bucket(rating)
+	if h.counts[bucket]--; h.counts[bucket] <= 0 {
+		delete(h.counts, bucket)
+	}
+}
+
+// estimateRank counts the users in better buckets and assumes ratings are
+// spread evenly inside the rating's own bucket
+func (h ratingHistogram) estimateRank(rating int, lowerIsBetter bool) int {
+	own := h.bucket(rating)
+	ahead := 0.0
+	for bucket, count := range h.counts {
+		if bucket == own {
+			offset := float64(rating - own*h.width)
+			share := (float64(h.width) - 1 - offset) / float64(h.width)
+			if lowerIsBetter {
+				share = offset / float64(h.width)
+			}
+			ahead += share * float64(count-1)
+			continue
+		}
+		if (bucket > own) != lowerIsBetter {
+			ahead += float64(count)
+		}
+	}
+	return int(ahead) + 1
+}
+
+// rankedByRating reports whether rating alone decides the order, which the
+// histogram estimate relies on
+func (lm *LeaderboardManager) rankedByRating() bool {
+	return lm.config.SortKeys[0].Field == RatingField
+}
+
+// GetLeaderboardApprox returns a page like GetLeaderboard, except that pages
+// starting past the exact top skip the re-rank: users come in the order of the
+// last re-rank and their ranks are estimated from the rating histogram. It
+// reports whether the ranks are estimates. Banded boards already rank from the
+// histogram, so they never estimate.
+func (lm *LeaderboardManager) GetLeaderboardApprox(page, pageSize int, paths FeaturePaths) ([]User, bool) {
+	start := (page - 1) * pageSize
+	if start < exactRankTop || !lm.rankedByRating() || lm.config.RankBand > 0 {
+		return lm.GetLeaderboard(page, pageSize, UnrankedExclude, paths), false
+	}
+
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	users := lm.ranked()
+	if start >= len(users) {
+		return []User{}, true
+	}
+	end := start + pageSize
+	if end > len(users) {
+		end = len(users)
+	}
+
+	result := make([]User, end-start)
+	for i := start; i < end; i++ {
+		result[i-start] = users[i].snapshot()
+		result[i-start].Rank = lm.moments.histogram.estimateRank(result[i-start].Rating, lm.config.LowerIsBetter)
+	}
+	return result, true
+}
+
+// GetRankApprox estimates a user's rank from the histogram without re-ranking,
+// falling back to an exact lookup when the estimate lands in the exact top
+func (lm *LeaderboardManager) GetRankApprox(username string, paths FeaturePaths) (RankInfo, bool) {
+	if !lm.MightExist(username) {
+		return RankInfo{}, false
+	}
+	if !lm.rankedByRating() || lm.config.RankBand > 0 {
+		return lm.GetRank(username, paths)
+	}
+
+	lm.mu.RLock()
+	user, exists := lm.users[username]
+	if !exists {
+		lm.mu.RUnlock()
+		return RankInfo{}, false
+	}
+	info := RankInfo{
+		Username:    user.Username,
+		Rank:        lm.moments.histogram.estimateRank(user.Rating, lm.config.LowerIsBetter),
+		Rating:      user.Rating,
+		TotalUsers:  int(lm.moments.count),
+		Approximate: true,
+	}
+	unranked := user.Unranked != ""
+	lm.mu.RUnlock()
+
+	if info.Rank <= exactRankTop || unranked {
+		return lm.GetRank(username, paths)
+	}
+	return info, true
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAuditEntries bounds the in-memory audit log; the oldest entries drop off first
+const maxAuditEntries = 10000
+
+// AuditEntry records one administrative action
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"`
+	Client  string    `json:"client,omitempty"`
+	Action  string    `json:"action"`
+	Target  string    `json:"target"`
+	Details gin.H     `json:"details,omitempty"`
+}
+
+// AuditLog keeps recent admin actions, oldest first
+type AuditLog struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+var auditLog = &AuditLog{}
+
+// Record logs an action taken by the request's client
+func (al *AuditLog) Record(c *gin.Context, action, target string, details gin.H) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	al.entries = append(al.entries, AuditEntry{
+		Time:    time.Now(),
+		Actor:   clientID(c),
+		Client:  clientName(c),
+		Action:  action,
+		Target:  target,
+		Details: details,
+	})
+	if len(al.entries) > maxAuditEntries {
+		al.entries = al.entries[len(al.entries)-maxAuditEntries:]
+	}
+}
+
+// Recent returns up to limit entries, newest first
+func (al *AuditLog) Recent(limit int) []AuditEntry {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	if limit > len(al.entries) {
+		limit = len(al.entries)
+	}
+	recent := make([]AuditEntry, 0, limit)
+	for i := len(al.entries) - 1; i >= len(al.entries)-limit; i-- {
+		recent = append(recent, al.entries[i])
+	}
+	return recent
+}
+
+// Handler: Get recent admin actions
+func getAuditLog(c *gin.Context) {
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		fmt.Sscanf(l, "%d", &limit)
+	}
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	entries := auditLog.Recent(limit)
+	respond(c, 200, gin.H{"entries": entries, "count": len(entries)})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxCachedPrefixLength is the longest prefix whose suggestions are cached;
+	// these short prefixes are typed on every keystroke and dominate traffic
+	maxCachedPrefixLength = 3
+	defaultSuggestions    = 10
+	maxSuggestions        = 25
+)
+
+// Autocomplete returns up to limit users whose usernames start with prefix (case-insensitive), in board order
+func (lm *LeaderboardManager) Autocomplete(prefix string, limit int) []User {
+	lm.rLockRanked()
+	defer lm.mu.RUnlock()
+
+	prefixLower := strings.ToLower(prefix)
+	suggestions := make([]User, 0, limit)
+	for _, user := range lm.sortedUsers {
+		if strings.HasPrefix(strings.ToLower(user.Username), prefixLower) {
+			suggestions = append(suggestions, user.snapshot())
+			if len(suggestions) == limit {
+				break
+			}
+		}
+	}
+	return suggestions
+}
+
+// suggestionCache holds autocomplete results for short prefixes at the current board version
+var suggestionCache = newVersionedCache[[]User]()
+
+// Handler: Autocomplete usernames
+func autocompleteUsers(c *gin.Context) {
+	prefix := c.Query("q")
+	if prefix == "" {
+		respond(c, 400, gin.H{"error": "query parameter 'q' is required"})
+		return
+	}
+
+	limit := defaultSuggestions
+	if l := c.Query("limit"); l != "" {
+		fmt.Sscanf(l, "%d", &limit)
+	}
+	if limit < 1 || limit > maxSuggestions {
+		limit = defaultSuggestions
+	}
+
+	prefixLower := strings.ToLower(prefix)
+	if len([]rune(prefixLower)) > maxCachedPrefixLength {
+		suggestions := leaderboard.Autocomplete(prefixLower, limit)
+		respond(c, 200, gin.H{"suggestions": suggestions, "count": len(suggestions)})
+		return
+	}
+
+	// Read the version before computing so an entry is never served after a change it may have missed
+	version := leaderboard.Version()
+	key := fmt.Sprintf("%s|%d", prefixLower, limit)
+	suggestions, cached := suggestionCache.get(key, version)
+	if !cached {
+		suggestions = leaderboard.Autocomplete(prefixLower, limit)
+		suggestionCache.put(key, version, suggestions)
+	}
+
+	respond(c, 200, gin.H{"suggestions": suggestions, "count": len(suggestions)})
+}
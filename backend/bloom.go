@@ -0,0 +1,78 @@
+package main
+
+import (
+	"hash/maphash"
+	"math"
+	"sync"
+)
+
+// bloomFalsePositiveRate is the target false positive rate for the username filter
+const bloomFalsePositiveRate = 0.01
+
+// bloomFilter answers "definitely not present" for usernames without touching
+// the leaderboard's maps. It has its own lock so lookups of unknown names never
+// wait on rating updates.
+type bloomFilter struct {
+	mu       sync.RWMutex
+	seed     maphash.Seed
+	bits     []uint64
+	hashes   int
+	count    int
+	capacity int
+}
+
+// newBloomFilter sizes a filter for capacity items at the target false positive rate
+func newBloomFilter(capacity int) *bloomFilter {
+	if capacity < 1024 {
+		capacity = 1024
+	}
+	m := math.Ceil(-float64(capacity) * math.Log(bloomFalsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := int(math.Round(m / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{
+		seed:     maphash.MakeSeed(),
+		bits:     make([]uint64, (int(m)+63)/64),
+		hashes:   k,
+		capacity: capacity,
+	}
+}
+
+// positions derives the filter's bit positions for a name by double hashing
+func (bf *bloomFilter) positions(name string, fn func(pos uint64) bool) {
+	h := maphash.String(bf.seed, name)
+	h1, h2 := h&0xffffffff, h>>32|1
+	size := uint64(len(bf.bits)) * 64
+	for i := 0; i < bf.hashes; i++ {
+		if !fn((h1 + uint64(i)*h2) % size) {
+			return
+		}
+	}
+}
+
+// add records a name; it reports false once the filter is over capacity and should be rebuilt
+func (bf *bloomFilter) add(name string) bool {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+
+	bf.positions(name, func(pos uint64) bool {
+		bf.bits[pos/64] |= 1 << (pos % 64)
+		return true
+	})
+	bf.count++
+	return bf.count <= bf.capacity
+}
+
+// mightContain reports whether name may have been added; false is definitive
+func (bf *bloomFilter) mightContain(name string) bool {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	found := true
+	bf.positions(name, func(pos uint64) bool {
+		found = bf.bits[pos/64]&(1<<(pos%64)) != 0
+		return found
+	})
+	return found
+}
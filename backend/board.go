@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScoreMode controls how a submitted score is applied to a user's rating
+type ScoreMode string
+
+const (
+	// ScoreModeReplace overwrites the user's rating with each submission
+	ScoreModeReplace ScoreMode = "replace"
+	// ScoreModeCumulative adds each submission to the user's running total
+	ScoreModeCumulative ScoreMode = "cumulative"
+	// ScoreModeEWMA moves the rating part of the way towards each submission,
+	// so it tracks an exponentially weighted average of recent scores and a
+	// one-off spike only counts for a fraction
+	ScoreModeEWMA ScoreMode = "ewma"
+)
+
+// defaultEWMAAlpha is the weight an ewma board gives each new submission
+const defaultEWMAAlpha = 0.3
+
+// ParseScoreMode validates a score mode name
+func ParseScoreMode(s string) (ScoreMode, error) {
+	switch ScoreMode(s) {
+	case ScoreModeReplace, ScoreModeCumulative, ScoreModeEWMA:
+		return ScoreMode(s), nil
+	}
+	return "", fmt.Errorf("unknown score mode %q (expected %q, %q or %q)", s, ScoreModeReplace, ScoreModeCumulative, ScoreModeEWMA)
+}
+
+// BoardConfig holds the scoring rules of a leaderboard
+type BoardConfig struct {
+	ScoreMode ScoreMode
+	// EWMAAlpha is the weight of each new submission in ewma mode, in (0, 1]
+	EWMAAlpha float64
+	// MinRating and MaxRating bound ratings; nil leaves that side unbounded
+	MinRating     *int
+	MaxRating     *int
+	LowerIsBetter bool
+	SortKeys      []SortKey
+	Tiebreaks     []SortKey
+	// RankBand ranks users only to bands this many rating points wide,
+	// read from counters instead of a sort; 0 ranks every user exactly
+	RankBand int
+	// MinGames is the activity a user needs before being ranked; 0 ranks everyone
+	MinGames int
+	// ScoreWindow is how long a submitted score counts; 0 keeps scores forever
+	ScoreWindow time.Duration
+	// ScoreFormat is how ratings are displayed; empty means integer
+	ScoreFormat ScoreFormat
+	// SearchEngine is how usernames are indexed for search; empty means trigram
+	SearchEngine SearchEngine
+}
+
+// DefaultBoardConfig returns the classic rating board: replace mode, 100-5000, highest rating first
+func DefaultBoardConfig() BoardConfig {
+	minRating, maxRating := 100, 5000
+	return BoardConfig{
+		ScoreMode: ScoreModeReplace,
+		EWMAAlpha: defaultEWMAAlpha,
+		MinRating: &minRating,
+		MaxRating: &maxRating,
+		SortKeys:  []SortKey{{Field: RatingField}},
+	}
+}
+
+// ParseRatingBound parses a rating bound flag; "none" (or empty) means
+// unbounded. A bound is any integer an int holds (int64 on 64-bit builds) or
+// a decimal in the board's display units, so on a decimal2 board 12.5 is a
+// rating of 1250. Decimals finer than the board stores are rejected.
+func ParseRatingBound(s string, format ScoreFormat) (*int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.EqualFold(s, "none") {
+		return nil, nil
+	}
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if strings.Trim(fraction, "0123456789") != "" {
+		return nil, fmt.Errorf("invalid rating bound %q: expected a number or \"none\"", s)
+	}
+	fraction = strings.TrimRight(fraction, "0")
+	board := BoardConfig{ScoreFormat: format}
+	decimals := board.Display().Decimals
+	if len(fraction) > decimals {
+		return nil, fmt.Errorf("rating bound %q has more decimal places than %s ratings store (%d)", s, board.scoreFormat(), decimals)
+	}
+	digits := whole + fraction + strings.Repeat("0", decimals-len(fraction))
+	bound, err := strconv.ParseInt(digits, 10, strconv.IntSize)
+	if errors.Is(err, strconv.ErrRange) {
+		return nil, fmt.Errorf("rating bound %q is out of range", s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid rating bound %q: expected a number or \"none\"", s)
+	}
+	rating := int(bound)
+	return &rating, nil
+}
+
+// Validate checks that the board's rules are consistent
+func (cfg BoardConfig) Validate() error {
+	if cfg.MinRating != nil && cfg.MaxRating != nil && *cfg.MinRating > *cfg.MaxRating {
+		return fmt.Errorf("min rating %d is greater than max rating %d", *cfg.MinRating, *cfg.MaxRating)
+	}
+	if len(cfg.SortKeys) == 0 {
+		return fmt.Errorf("at least one sort key is required")
+	}
+	if first := cfg.SortKeys[0]; first.Field == RatingField && first.Ascending != cfg.LowerIsBetter {
+		return fmt.Errorf("lower-is-better must match the direction of the rating sort key")
+	}
+	if cfg.ScoreMode == ScoreModeEWMA && (cfg.EWMAAlpha <= 0 || cfg.EWMAAlpha > 1) {
+		return fmt.Errorf("ewma alpha must be greater than 0 and at most 1")
+	}
+	if cfg.ScoreWindow < 0 {
+		return fmt.Errorf("score window must not be negative")
+	}
+	if cfg.MinGames < 0 {
+		return fmt.Errorf("min games must not be negative")
+	}
+	return cfg.validateRankBand()
+}
+
+// clampRating keeps a rating inside the board's bounds
+func (cfg BoardConfig) clampRating(rating int) int {
+	if cfg.MinRating != nil && rating < *cfg.MinRating {
+		return *cfg.MinRating
+	}
+	if cfg.MaxRating != nil && rating > *cfg.MaxRating {
+		return *cfg.MaxRating
+	}
+	return rating
+}
+
+// applyScore returns a user's new rating after a score submission
+func (cfg BoardConfig) applyScore(current, score int) int {
+	switch cfg.ScoreMode {
+	case ScoreModeCumulative:
+		return cfg.clampRating(addSaturating(current, score))
+	case ScoreModeEWMA:
+		smoothed := cfg.EWMAAlpha*float64(score) + (1-cfg.EWMAAlpha)*float64(current)
+		return cfg.clampRating(int(math.Round(smoothed)))
+	}
+	return cfg.clampRating(score)
+}
+
+// addSaturating adds two ints, pinning the result at the int limits instead of wrapping
+func addSaturating(a, b int) int {
+	if b > 0 && a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	if b < 0 && a < math.MinInt-b {
+		return math.MinInt
+	}
+	return a + b
+}
+
+// Built-in sort key names that refer to User fields rather than custom scores
+const (
+	RatingField      = "rating"
+	GamesPlayedField = "gamesPlayed"
+	WinsField        = "wins"
+)
+
+// SortKey is one component of a board's composite ordering
+type SortKey struct {
+	Field     string `json:"field"`
+	Ascending bool   `json:"ascending"`
+}
+
+// ParseSortKeys parses a composite ordering such as "wins:desc,games:asc,time:asc"
+func ParseSortKeys(s string) ([]SortKey, error) {
+	keys := make([]SortKey, 0)
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		field, direction, _ := strings.Cut(part, ":")
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, fmt.Errorf("sort key %q has no field name", part)
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("sort key %q is listed twice", field)
+		}
+		seen[field] = true
+
+		key := SortKey{Field: field}
+		switch strings.ToLower(strings.TrimSpace(direction)) {
+		case "", "desc":
+		case "asc":
+			key.Ascending = true
+		default:
+			return nil, fmt.Errorf("sort key %q has unknown direction %q (expected asc or desc)", field, direction)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one sort key is required")
+	}
+	return keys, nil
+}
+
+// scoreValue returns the value of a sort key field for a user
+func scoreValue(user *User, field string) int {
+	switch field {
+	case RatingField:
+		return user.Rating
+	case GamesPlayedField:
+		return user.GamesPlayed
+	case WinsField:
+		return user.Wins
+	}
+	return user.Scores[field]
+}
+
+// compareUsers orders two users by the board's sort keys, then its tiebreaks.
+// It returns a negative number when a ranks ahead of b and 0 when they are tied.
+func (cfg BoardConfig) compareUsers(a, b *User) int {
+	if cmp := compareByKeys(cfg.SortKeys, a, b); cmp != 0 {
+		return cmp
+	}
+	return compareByKeys(cfg.Tiebreaks, a, b)
+}
+
+// compareByKeys compares two users on each key in turn
+func compareByKeys(keys []SortKey, a, b *User) int {
+	for _, key := range keys {
+		av, bv := scoreValue(a, key.Field), scoreValue(b, key.Field)
+		if av == bv {
+			continue
+		}
+		if (av > bv) != key.Ascending {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestParseRatingBound(t *testing.T) {
+	tests := []struct {
+		input  string
+		format ScoreFormat
+		want   *int
+		err    bool
+	}{
+		{input: "none", want: nil},
+		{input: "", want: nil},
+		{input: "-20", want: intPtr(-20)},
+		{input: "5000", want: intPtr(5000)},
+		{input: "10.0", want: intPtr(10)},
+		{input: "10.5", err: true},
+		{input: "12.5", format: ScoreFormatDecimal2, want: intPtr(1250)},
+		{input: "-0.75", format: ScoreFormatDecimal2, want: intPtr(-75)},
+		{input: "3", format: ScoreFormatDecimal2, want: intPtr(300)},
+		{input: "1.005", format: ScoreFormatDecimal2, err: true},
+		{input: "90", format: ScoreFormatTime, want: intPtr(90)},
+		{input: strconv.Itoa(math.MinInt), want: intPtr(math.MinInt)},
+		{input: strconv.Itoa(math.MaxInt), want: intPtr(math.MaxInt)},
+		{input: strconv.Itoa(math.MaxInt), format: ScoreFormatDecimal2, err: true},
+		{input: "1.-5", err: true},
+		{input: "abc", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRatingBound(tt.input, tt.format)
+		switch {
+		case tt.err && err == nil:
+			t.Errorf("ParseRatingBound(%q, %q) = %v, want an error", tt.input, tt.format, deref(got))
+		case !tt.err && err != nil:
+			t.Errorf("ParseRatingBound(%q, %q) failed: %v", tt.input, tt.format, err)
+		case !tt.err && (got == nil) != (tt.want == nil):
+			t.Errorf("ParseRatingBound(%q, %q) = %v, want %v", tt.input, tt.format, deref(got), deref(tt.want))
+		case !tt.err && got != nil && *got != *tt.want:
+			t.Errorf("ParseRatingBound(%q, %q) = %d, want %d", tt.input, tt.format, *got, *tt.want)
+		}
+	}
+}
+
+func TestLowerIsBetterMatchesRatingKey(t *testing.T) {
+	config := DefaultBoardConfig()
+	config.LowerIsBetter = true
+	if err := config.Validate(); err == nil {
+		t.Error("lower-is-better with a descending rating key passed validation")
+	}
+	config.SortKeys = []SortKey{{Field: RatingField, Ascending: true}}
+	if err := config.Validate(); err != nil {
+		t.Errorf("lower-is-better with an ascending rating key: %v", err)
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func deref(n *int) any {
+	if n == nil {
+		return "none"
+	}
+	return *n
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// bulkBatchSize is how many users a bulk job changes per hold of the
+	// board lock, so reads and writes keep flowing during large jobs
+	bulkBatchSize = 500
+	// bulkSampleSize is how many matched usernames a job reports
+	bulkSampleSize = 20
+	// maxBulkJobs caps how many finished jobs are kept for status queries
+	maxBulkJobs = 50
+)
+
+// BulkOperation is a change applied to every user a filter matches
+type BulkOperation string
+
+const (
+	// BulkDelete tombstones the users, restorable during the grace period
+	BulkDelete BulkOperation = "delete"
+	// BulkDecay unranks the users as decayed
+	BulkDecay BulkOperation = "decay"
+	// BulkTag adds a tag to the users
+	BulkTag BulkOperation = "tag"
+	// BulkRecalc re-clamps ratings to the board's bounds and re-checks
+	// provisional status, e.g. after the board's config changed
+	BulkRecalc BulkOperation = "recalc"
+)
+
+// ParseBulkOperation validates a bulk operation
+func ParseBulkOperation(s string) (BulkOperation, error) {
+	switch BulkOperation(s) {
+	case BulkDelete, BulkDecay, BulkTag, BulkRecalc:
+		return BulkOperation(s), nil
+	}
+	return "", fmt.Errorf("unknown operation %q (expected %q, %q, %q or %q)", s, BulkDelete, BulkDecay, BulkTag, BulkRecalc)
+}
+
+// BulkJob is a bulk operation running in the background
+type BulkJob struct {
+	ID        string        `json:"id"`
+	Operation BulkOperation `json:"operation"`
+	Filter    UserFilter    `json:"filter"`
+	Tag       string        `json:"tag,omitempty"`
+	DryRun    bool          `json:"dryRun"`
+	// Status is running until every matched user has been processed, then done
+	Status  string `json:"status"`
+	Matched int    `json:"matched"`
+	// Processed counts matched users handled so far, and Changed those the
+	// operation actually changed; users deleted in the meantime are skipped
+	Processed  int        `json:"processed"`
+	Changed    int        `json:"changed"`
+	Sample     []string   `json:"sample"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// bulkJobs holds running and recently finished jobs, keyed by id
+type bulkJobs struct {
+	mu    sync.Mutex
+	jobs  map[string]*BulkJob
+	order []string
+}
+
+var bulk = &bulkJobs{jobs: make(map[string]*BulkJob)}
+
+// add registers a new job, dropping the oldest finished ones over the cap
+func (bj *bulkJobs) add(job *BulkJob) error {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	job.ID = hex.EncodeToString(raw)
+
+	bj.mu.Lock()
+	defer bj.mu.Unlock()
+	bj.jobs[job.ID] = job
+	bj.order = append(bj.order, job.ID)
+	for i := 0; len(bj.jobs) > maxBulkJobs && i < len(bj.order); {
+		if old := bj.jobs[bj.order[i]]; old.Status != "running" {
+			delete(bj.jobs, old.ID)
+			bj.order = append(bj.order[:i], bj.order[i+1:]...)
+			continue
+		}
+		i++
+	}
+	return nil
+}
+
+// get returns a copy of a job's current state
+func (bj *bulkJobs) get(id string) (BulkJob, bool) {
+	bj.mu.Lock()
+	defer bj.mu.Unlock()
+	job, ok := bj.jobs[id]
+	if !ok {
+		return BulkJob{}, false
+	}
+	return *job, true
+}
+
+// progress records a finished batch
+func (bj *bulkJobs) progress(job *BulkJob, processed, changed int) {
+	bj.mu.Lock()
+	defer bj.mu.Unlock()
+	job.Processed += processed
+	job.Changed += changed
+}
+
+func (bj *bulkJobs) finish(job *BulkJob) {
+	bj.mu.Lock()
+	defer bj.mu.Unlock()
+	now := time.Now()
+	job.Status = "done"
+	job.FinishedAt = &now
+}
+
+// StartBulkJob matches users against the job's filter and processes them in
+// the background. A dry run stops after matching, counting how many users
+// the job would change.
+func (lm *LeaderboardManager) StartBulkJob(job *BulkJob) error {
+	matched := lm.MatchUsers(&job.Filter)
+	sort.Strings(matched)
+
+	job.Status = "running"
+	job.Matched = len(matched)
+	job.Sample = matched[:min(len(matched), bulkSampleSize)]
+	job.StartedAt = time.Now()
+	if job.DryRun {
+		job.Processed = job.Matched
+		job.Changed = lm.previewBulk(job, matched)
+		job.Status = "done"
+		job.FinishedAt = &job.StartedAt
+	}
+	if err := bulk.add(job); err != nil {
+		return err
+	}
+	if job.DryRun {
+		return nil
+	}
+
+	go func() {
+		for start := 0; start < len(matched); start += bulkBatchSize {
+			batch := matched[start:min(start+bulkBatchSize, len(matched))]
+			bulk.progress(job, len(batch), lm.applyBulk(job, batch))
+		}
+		bulk.finish(job)
+		log.Printf("🧹 Bulk %s changed %d of %d matched users", job.Operation, job.Changed, job.Matched)
+	}()
+	return nil
+}
+
+// applyBulk runs a job's operation on one batch and returns how many users
+// it changed. Users are matched again under the lock, so anyone who no longer
+// passes the filter is left alone.
+func (lm *LeaderboardManager) applyBulk(job *BulkJob, batch []string) int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	// A freeze stops jobs already running from changing anyone else
+	if job.Operation != BulkTag && freeze.active() {
+		return 0
+	}
+	lm.flushPendingLocked()
+
+	now := time.Now()
+	changed := 0
+	for _, username := range batch {
+		user, exists := lm.users[username]
+		if !exists || !job.Filter.Matches(user, now) {
+			continue
+		}
+		if lm.applyBulkTo(job, user, now) {
+			changed++
+		}
+	}
+	if changed > 0 {
+		lm.markChanged()
+	}
+	return changed
+}
+
+// applyBulkTo changes one user; lm.mu must be held
+func (lm *LeaderboardManager) applyBulkTo(job *BulkJob, user *User, now time.Time) bool {
+	switch job.Operation {
+	case BulkDelete:
+		lm.tombstoneLocked(user, now)
+		return true
+	case BulkDecay:
+		return lm.setUnrankedLocked(user, UnrankedDecayed)
+	case BulkTag:
+		for _, tag := range user.Tags {
+			if tag == job.Tag {
+				return false
+			}
+		}
+		user.Tags = append(user.Tags, job.Tag)
+		lm.persist(OpTags, user, 0, now)
+		return true
+	case BulkRecalc:
+		before := user.Unranked
+		if rating := lm.config.clampRating(user.Rating); rating != user.Rating {
+			lm.setRating(user, rating)
+			lm.recordRating(user, rating, now)
+			lm.updateProvisional(user)
+			return true
+		}
+		lm.updateProvisional(user)
+		return user.Unranked != before
+	}
+	return false
+}
+
+// Handler: Start a bulk operation on the users matching a filter
+func startBulkJob(c *gin.Context) {
+	var req struct {
+		Operation string     `json:"operation"`
+		Filter    UserFilter `json:"filter"`
+		Tag       string     `json:"tag"`
+		DryRun    bool       `json:"dryRun"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, 400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	operation, err := ParseBulkOperation(req.Operation)
+	if err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Filter.Validate(); err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+	tag := strings.TrimSpace(req.Tag)
+	if (operation == BulkTag) != (tag != "") {
+		respond(c, 400, gin.H{"error": "tag is required for the tag operation and only allowed with it"})
+		return
+	}
+
+	// dryRun may come in the body or, like other endpoints, the query string
+	dryRun, ok := isDryRun(c)
+	if !ok {
+		return
+	}
+	req.DryRun = req.DryRun || dryRun
+	if !req.DryRun && operation != BulkTag && respondFrozen(c) {
+		return
+	}
+
+	job := &BulkJob{Operation: operation, Filter: req.Filter, Tag: tag, DryRun: req.DryRun}
+	if err := leaderboard.StartBulkJob(job); err != nil {
+		respond(c, 500, gin.H{"error": err.Error()})
+		return
+	}
+	if !job.DryRun {
+		auditLog.Record(c, "bulk."+string(operation), job.ID, gin.H{"filter": job.Filter, "tag": tag, "matched": job.Matched})
+	}
+	status, _ := bulk.get(job.ID)
+	if job.DryRun {
+		respond(c, 200, status)
+		return
+	}
+	respond(c, 202, status)
+}
+
+// Handler: Report a bulk job's progress
+func getBulkJob(c *gin.Context) {
+	job, ok := bulk.get(c.Param("id"))
+	if !ok {
+		respond(c, 404, gin.H{"error": "bulk job not found"})
+		return
+	}
+	respond(c, 200, job)
+}
@@ -0,0 +1,66 @@
+package main
+
+import "sync"
+
+// versionedCache holds computed responses for one board version. Any change
+// to the board bumps the version, and the first lookup at a new version
+// empties the cache.
+type versionedCache[T any] struct {
+	mu      sync.Mutex
+	version uint64
+	entries map[string]T
+	hits    uint64
+	misses  uint64
+}
+
+// CacheStats reports how well a cache is doing
+type CacheStats struct {
+	Entries int     `json:"entries"`
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hitRate"`
+}
+
+func newVersionedCache[T any]() *versionedCache[T] {
+	return &versionedCache[T]{entries: make(map[string]T)}
+}
+
+// get returns the entry for key if it was computed at the given version
+func (vc *versionedCache[T]) get(key string, version uint64) (T, bool) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if vc.version != version {
+		vc.version = version
+		vc.entries = make(map[string]T)
+	}
+	value, ok := vc.entries[key]
+	if ok {
+		vc.hits++
+	} else {
+		vc.misses++
+	}
+	return value, ok
+}
+
+// put stores an entry computed at the given version
+func (vc *versionedCache[T]) put(key string, version uint64, value T) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if vc.version == version {
+		vc.entries[key] = value
+	}
+}
+
+// stats returns the current entry count and lifetime hit rate
+func (vc *versionedCache[T]) stats() CacheStats {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	stats := CacheStats{Entries: len(vc.entries), Hits: vc.hits, Misses: vc.misses}
+	if lookups := vc.hits + vc.misses; lookups > 0 {
+		stats.HitRate = roundTo(float64(vc.hits)/float64(lookups), 4)
+	}
+	return stats
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// mimeCBOR is the media type for CBOR (RFC 8949) responses
+const mimeCBOR = "application/cbor"
+
+// CBOR major types
+const (
+	cborUnsigned byte = 0
+	cborNegative byte = 1
+	cborText     byte = 3
+	cborArray    byte = 4
+	cborMap      byte = 5
+)
+
+// cborResponse renders any JSON-encodable value as CBOR for clients with
+// small parsers. It encodes the JSON form of the value, so field names and
+// shapes match the JSON responses; integers stay integers.
+type cborResponse struct {
+	data any
+}
+
+func (r cborResponse) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", mimeCBOR)
+}
+
+func (r cborResponse) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+
+	value, err := jsonValue(r.data)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	encodeCBOR(&buf, value)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// writeCBORHead writes a major type with its argument in the shortest form
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
+
+// encodeCBOR writes one decoded JSON value
+func encodeCBOR(buf *bytes.Buffer, value any) {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case string:
+		writeCBORHead(buf, cborText, uint64(len(v)))
+		buf.WriteString(v)
+	case json.Number:
+		if n, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			if n >= 0 {
+				writeCBORHead(buf, cborUnsigned, uint64(n))
+			} else {
+				writeCBORHead(buf, cborNegative, uint64(-1-n))
+			}
+			return
+		}
+		f, _ := v.Float64()
+		buf.WriteByte(0xfb)
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+	case []any:
+		writeCBORHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			encodeCBOR(buf, item)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		writeCBORHead(buf, cborMap, uint64(len(v)))
+		for _, key := range keys {
+			encodeCBOR(buf, key)
+			encodeCBOR(buf, v[key])
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxClientNameLength bounds an X-Client-Name value
+	maxClientNameLength = 64
+	// maxTrackedClients bounds the client names metrics are kept for; further
+	// names are counted together under otherClients
+	maxTrackedClients = 1000
+	unnamedClient     = "(unnamed)"
+	otherClients      = "(other)"
+)
+
+// clientName returns the request's X-Client-Name, or "" when it is missing
+// or not a plain name of letters, digits, dots, dashes and underscores
+func clientName(c *gin.Context) string {
+	name := strings.TrimSpace(c.GetHeader("X-Client-Name"))
+	if name == "" || len(name) > maxClientNameLength {
+		return ""
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return ""
+		}
+	}
+	return name
+}
+
+// ClientMetrics is the traffic one consuming application has sent
+type ClientMetrics struct {
+	Client       string `json:"client"`
+	Requests     uint64 `json:"requests"`
+	ClientErrors uint64 `json:"clientErrors"`
+	ServerErrors uint64 `json:"serverErrors"`
+	// RateLimited counts 429s, whether from rate limiting or load shedding
+	RateLimited  uint64    `json:"rateLimited"`
+	AvgLatencyMs float64   `json:"avgLatencyMs"`
+	LastSeen     time.Time `json:"lastSeen"`
+
+	totalLatency time.Duration
+}
+
+// clientStats attributes requests to the applications that sent them
+type clientStats struct {
+	mu      sync.Mutex
+	clients map[string]*ClientMetrics
+}
+
+var clientMetrics = &clientStats{clients: make(map[string]*ClientMetrics)}
+
+func (cs *clientStats) record(name string, status int, latency time.Duration, now time.Time) {
+	if name == "" {
+		name = unnamedClient
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	m, ok := cs.clients[name]
+	if !ok {
+		if len(cs.clients) >= maxTrackedClients {
+			name = otherClients
+			m = cs.clients[name]
+		}
+		if m == nil {
+			m = &ClientMetrics{Client: name}
+			cs.clients[name] = m
+		}
+	}
+	m.Requests++
+	m.totalLatency += latency
+	m.LastSeen = now
+	switch {
+	case status == 429:
+		m.RateLimited++
+	case status >= 500:
+		m.ServerErrors++
+	case status >= 400:
+		m.ClientErrors++
+	}
+}
+
+// top returns up to limit clients, busiest first
+func (cs *clientStats) top(limit int) []ClientMetrics {
+	cs.mu.Lock()
+	all := make([]ClientMetrics, 0, len(cs.clients))
+	for _, m := range cs.clients {
+		copied := *m
+		copied.AvgLatencyMs = roundTo(float64(m.totalLatency.Microseconds())/1000/float64(m.Requests), 2)
+		all = append(all, copied)
+	}
+	cs.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Requests != all[j].Requests {
+			return all[i].Requests > all[j].Requests
+		}
+		return all[i].Client < all[j].Client
+	})
+	if limit > 0 && len(all) > limit {
+		all = all[:limit]
+	}
+	return all
+}
+
+// tagClients attributes every request, including ones shed or rate limited
+// further down the chain, to its X-Client-Name
+func tagClients() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		clientMetrics.record(clientName(c), c.Writer.Status(), time.Since(start), time.Now())
+	}
+}
+
+// Handler: Traffic per consuming application
+func getClientMetrics(c *gin.Context) {
+	clients := clientMetrics.top(0)
+	respond(c, 200, gin.H{"clients": clients, "count": len(clients)})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// applyRating gives a user a new rating and records it in their history;
+// lm.mu must be held. With write coalescing on, the rating is parked until
+// the next flush, so a burst of updates to one user costs one mutation of
+// the ranking structure.
+func (lm *LeaderboardManager) applyRating(user *User, rating int) {
+	user.LastActive = time.Now()
+	user.Updates++
+	lm.updateProvisional(user)
+	lm.recordRating(user, rating, user.LastActive)
+	if lm.pending != nil {
+		lm.pending[user] = rating
+		return
+	}
+	lm.setRating(user, rating)
+	lm.markChanged()
+}
+
+// markChangedSoon marks the board changed now, or at the next flush when
+// writes are coalesced; lm.mu must be held
+func (lm *LeaderboardManager) markChangedSoon() {
+	if lm.pending != nil {
+		lm.pendingChange = true
+		return
+	}
+	lm.markChanged()
+}
+
+// currentRating is the user's latest rating, including one waiting to flush
+func (lm *LeaderboardManager) currentRating(user *User) int {
+	if rating, ok := lm.pending[user]; ok {
+		return rating
+	}
+	return user.Rating
+}
+
+// flushPendingLocked applies coalesced ratings to the board; lm.mu must be held
+func (lm *LeaderboardManager) flushPendingLocked() {
+	if len(lm.pending) == 0 && !lm.pendingChange {
+		return
+	}
+	for user, rating := range lm.pending {
+		lm.setRating(user, rating)
+	}
+	clear(lm.pending)
+	lm.pendingChange = false
+	lm.markChanged()
+}
+
+// CoalesceWrites batches rating updates and applies them every interval.
+// Call it before any writes start.
+func (lm *LeaderboardManager) CoalesceWrites(interval time.Duration) {
+	lm.mu.Lock()
+	lm.pending = make(map[*User]int)
+	lm.mu.Unlock()
+
+	job := backgroundJobs.register("write coalescing", interval)
+	ticker := time.NewTicker(interval)
+	go func() {
+		for now := range ticker.C {
+			lm.mu.Lock()
+			lm.flushPendingLocked()
+			lm.mu.Unlock()
+			job.ran(now)
+		}
+	}()
+	log.Printf("🧺 Coalescing rating updates every %s", interval)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// brotliQuality trades ratio for speed; 5 suits per-request JSON well
+const brotliQuality = 5
+
+// negotiateEncoding picks br or gzip from an Accept-Encoding header, preferring
+// br at equal weight. It returns "" when neither is acceptable.
+func negotiateEncoding(header string) string {
+	weights := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if name == "*" {
+			wildcard = q
+		} else {
+			weights[name] = q
+		}
+	}
+
+	weight := func(name string) float64 {
+		if q, ok := weights[name]; ok {
+			return q
+		}
+		return wildcard
+	}
+	br, gz := weight("br"), weight("gzip")
+	switch {
+	case br > 0 && br >= gz:
+		return "br"
+	case gz > 0:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressWriter compresses the response body. The encoder and the
+// Content-Encoding header are only set up on the first write, so bodiless
+// responses go out untouched.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	encoder  io.WriteCloser
+}
+
+func (w *compressWriter) start() {
+	if w.encoder != nil {
+		return
+	}
+	header := w.Header()
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	if w.encoding == "br" {
+		w.encoder = brotli.NewWriterLevel(w.ResponseWriter, brotliQuality)
+	} else {
+		w.encoder = gzip.NewWriter(w.ResponseWriter)
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	w.start()
+	return w.encoder.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush pushes compressed data to the client, keeping NDJSON streams incremental
+func (w *compressWriter) Flush() {
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) close() {
+	if w.encoder != nil {
+		w.encoder.Close()
+	}
+}
+
+// compressResponses encodes response bodies with Brotli or gzip according to Accept-Encoding
+func compressResponses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == "HEAD" {
+			c.Next()
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: c.Writer, encoding: encoding}
+		c.Writer = writer
+		defer writer.close()
+		c.Next()
+	}
+}
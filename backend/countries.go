@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultCountryTopK = 10
+	maxCountryTopK     = 100
+)
+
+// countryRollup keeps an exact rating histogram per country for ranked users,
+// updated alongside the rating moments, so country standings never scan users
+type countryRollup map[string]ratingHistogram
+
+func (cr countryRollup) add(user *User) {
+	if user.Country == "" {
+		return
+	}
+	h, exists := cr[user.Country]
+	if !exists {
+		h = newRatingHistogram(1)
+		cr[user.Country] = h
+	}
+	h.add(user.Rating)
+}
+
+func (cr countryRollup) remove(user *User) {
+	h, exists := cr[user.Country]
+	if !exists {
+		return
+	}
+	h.remove(user.Rating)
+	if len(h.counts) == 0 {
+		delete(cr, user.Country)
+	}
+}
+
+// ParseCountry normalizes an ISO 3166-1 alpha-2 country code; empty clears it
+func ParseCountry(s string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(s))
+	if code == "" {
+		return "", nil
+	}
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return "", fmt.Errorf("invalid country %q: expected a two-letter ISO code", s)
+	}
+	return code, nil
+}
+
+// SetCountry records which country a user plays for
+func (lm *LeaderboardManager) SetCountry(username, country string) (User, bool) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.flushPendingLocked()
+
+	user, exists := lm.users[username]
+	if !exists {
+		return User{}, false
+	}
+	from := user.regionPath()
+	lm.setCountryLocked(user, country)
+	lm.moveRegion(user, from, user.regionPath())
+	lm.persist(OpPlacement, user, 0, time.Now())
+	lm.markChanged()
+	return user.snapshot(), true
+}
+
+// setCountryLocked moves a user to another country in the rollup, dropping
+// a region that belongs to their old country. lm.mu must be held and the
+// caller updates the region indexes.
+func (lm *LeaderboardManager) setCountryLocked(user *User, country string) {
+	if user.Unranked == "" {
+		lm.countries.remove(user)
+	}
+	user.Country = country
+	if user.Unranked == "" {
+		lm.countries.add(user)
+	}
+	if regionCountry, _, _ := strings.Cut(user.Region, "/"); regionCountry != country {
+		user.Region = ""
+	}
+}
+
+// best sums the k best ratings, reporting how many there were
+func (h ratingHistogram) best(k int, lowerIsBetter bool) (sum, n int) {
+	ratings := make([]int, 0, len(h.counts))
+	for rating := range h.counts {
+		ratings = append(ratings, rating)
+	}
+	sort.Slice(ratings, func(i, j int) bool { return (ratings[i] > ratings[j]) != lowerIsBetter })
+	for _, rating := range ratings {
+		take := min(h.counts[rating], k-n)
+		sum += take * rating
+		if n += take; n == k {
+			break
+		}
+	}
+	return sum, n
+}
+
+// atLeast counts ratings at or better than the threshold
+func (h ratingHistogram) atLeast(threshold int, lowerIsBetter bool) int {
+	count := 0
+	for rating, n := range h.counts {
+		if rating == threshold || (rating > threshold) != lowerIsBetter {
+			count += n
+		}
+	}
+	return count
+}
+
+// CountryStanding is one country's place in the country rollup
+type CountryStanding struct {
+	Country    string  `json:"country"`
+	Rank       int     `json:"rank"`
+	Players    int     `json:"players"`
+	TopAverage float64 `json:"topAverage"`
+	// AboveThreshold counts players rated at or better than the requested threshold
+	AboveThreshold *int `json:"aboveThreshold,omitempty"`
+}
+
+// CountryMetric is what countries are ranked by
+type CountryMetric string
+
+const (
+	// CountryTopAverage ranks by the average rating of each country's top K
+	// players; countries with fewer than K ranked players are left out
+	CountryTopAverage CountryMetric = "topAverage"
+	// CountryAboveThreshold ranks by how many players reach the threshold
+	CountryAboveThreshold CountryMetric = "aboveThreshold"
+)
+
+// CountryStandings ranks countries by the chosen metric. threshold may be
+// nil unless ranking by CountryAboveThreshold.
+func (lm *LeaderboardManager) CountryStandings(metric CountryMetric, k int, threshold *int) []CountryStanding {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	lowerIsBetter := lm.config.LowerIsBetter
+	standings := make([]CountryStanding, 0, len(lm.countries))
+	for country, h := range lm.countries {
+		sum, n := h.best(k, lowerIsBetter)
+		if metric == CountryTopAverage && n < k {
+			continue
+		}
+		players := 0
+		for _, count := range h.counts {
+			players += count
+		}
+		standing := CountryStanding{
+			Country:    country,
+			Players:    players,
+			TopAverage: roundTo(float64(sum)/float64(n), 2),
+		}
+		if threshold != nil {
+			above := h.atLeast(*threshold, lowerIsBetter)
+			standing.AboveThreshold = &above
+		}
+		standings = append(standings, standing)
+	}
+
+	value := func(s CountryStanding) float64 {
+		if metric == CountryAboveThreshold {
+			return float64(*s.AboveThreshold)
+		}
+		if lowerIsBetter {
+			return -s.TopAverage
+		}
+		return s.TopAverage
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		if vi, vj := value(standings[i]), value(standings[j]); vi != vj {
+			return vi > vj
+		}
+		return standings[i].Country < standings[j].Country
+	})
+	for i := range standings {
+		standings[i].Rank = i + 1
+		if i > 0 && value(standings[i]) == value(standings[i-1]) {
+			standings[i].Rank = standings[i-1].Rank
+		}
+	}
+	return standings
+}
+
+// Handler: Rank countries by the strength of their players
+func getCountryLeaderboard(c *gin.Context) {
+	metric := CountryMetric(c.DefaultQuery("metric", string(CountryTopAverage)))
+	if metric != CountryTopAverage && metric != CountryAboveThreshold {
+		respond(c, 400, gin.H{"error": fmt.Sprintf("metric must be %q or %q", CountryTopAverage, CountryAboveThreshold)})
+		return
+	}
+
+	k := defaultCountryTopK
+	if s := c.Query("k"); s != "" {
+		var err error
+		if k, err = strconv.Atoi(s); err != nil || k < 1 || k > maxCountryTopK {
+			respond(c, 400, gin.H{"error": fmt.Sprintf("k must be between 1 and %d", maxCountryTopK)})
+			return
+		}
+	}
+
+	var threshold *int
+	if s := c.Query("threshold"); s != "" {
+		t, err := strconv.Atoi(s)
+		if err != nil {
+			respond(c, 400, gin.H{"error": "threshold must be an integer rating"})
+			return
+		}
+		threshold = &t
+	}
+	if metric == CountryAboveThreshold && threshold == nil {
+		respond(c, 400, gin.H{"error": "metric=aboveThreshold requires a threshold"})
+		return
+	}
+
+	standings := leaderboard.CountryStandings(metric, k, threshold)
+	respond(c, 200, gin.H{
+		"countries": standings,
+		"metric":    metric,
+		"k":         k,
+		"threshold": threshold,
+		"count":     len(standings),
+	})
+}
+
+// Handler: Set the country a user plays for
+func setUserCountry(c *gin.Context) {
+	var req struct {
+		Country string `json:"country"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, 400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	country, err := ParseCountry(req.Country)
+	if err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := leaderboard.SetCountry(c.Param("username"), country)
+	if !ok {
+		respond(c, 404, gin.H{"error": "user not found"})
+		return
+	}
+	auditLog.Record(c, "user.country", user.Username, gin.H{"country": country})
+	respond(c, 200, user)
+}
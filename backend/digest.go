@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// minDigestEvery keeps digests from turning into a notification stream
+	minDigestEvery = time.Hour
+	// digestTop is how many leaders and movers a digest lists
+	digestTop = 10
+	// maxDigestRecords is how many records a digest holds between sends
+	maxDigestRecords = 100
+)
+
+// Digest is a periodic summary of the board
+type Digest struct {
+	Name    string       `json:"name"`
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	Top     []EmbedEntry `json:"top"`
+	Movers  []Climber    `json:"movers"`
+	Records []Event      `json:"records"`
+}
+
+var digestTemplate = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Leaderboard digest: {{.Name}}</title></head>
+<body style="font-family: sans-serif">
+<h1>Leaderboard digest</h1>
+<p>{{.From.UTC.Format "Jan 2 15:04"}} to {{.To.UTC.Format "Jan 2 15:04 MST"}}</p>
+<h2>Top {{len .Top}}</h2>
+<table>
+<tr><th>Rank</th><th>User</th><th>Rating</th></tr>
+{{range .Top}}<tr><td>#{{.Rank}}</td><td>{{.Username}}</td><td>{{.Display}}</td></tr>
+{{end}}</table>
+<h2>Biggest movers</h2>
+{{if .Movers}}<table>
+<tr><th>User</th><th>Rank</th><th>Change</th></tr>
+{{range .Movers}}<tr><td>{{.Username}}</td><td>#{{.Rank}}</td><td>{{if gt .Change 0}}+{{end}}{{.Change}}</td></tr>
+{{end}}</table>{{else}}<p>No rank changes.</p>{{end}}
+<h2>New records</h2>
+{{if .Records}}<ul>
+{{range .Records}}<li>{{.Message}}</li>
+{{end}}</ul>{{else}}<p>No new records.</p>{{end}}
+</body>
+</html>
+`))
+
+// html renders the digest as an HTML page
+func (d *Digest) html() (string, error) {
+	var buf bytes.Buffer
+	if err := digestTemplate.Execute(&buf, d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// DigestSinkConfig declares where a digest goes: a webhook, which receives
+// the digest as JSON or HTML, or an email, which is always HTML
+type DigestSinkConfig struct {
+	Type   string `json:"type"`
+	URL    string `json:"url,omitempty"`
+	Format string `json:"format,omitempty"`
+
+	SMTPAddr string   `json:"smtpAddr,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+}
+
+// digestSink delivers a rendered digest
+type digestSink interface {
+	deliver(d *Digest) error
+}
+
+type webhookDigestSink struct {
+	url  string
+	html bool
+}
+
+func (s webhookDigestSink) deliver(d *Digest) error {
+	if !s.html {
+		return postJSON(s.url, d)
+	}
+	page, err := d.html()
+	if err != nil {
+		return err
+	}
+	return postBody(s.url, "text/html; charset=utf-8", []byte(page))
+}
+
+type emailDigestSink struct {
+	email emailNotifier
+}
+
+func (s emailDigestSink) deliver(d *Digest) error {
+	page, err := d.html()
+	if err != nil {
+		return err
+	}
+	return s.email.send("Leaderboard digest: "+d.Name, "text/html; charset=utf-8", page)
+}
+
+// build turns the config into a digestSink
+func (sc DigestSinkConfig) build() (digestSink, error) {
+	switch sc.Type {
+	case "webhook":
+		if sc.URL == "" {
+			return nil, fmt.Errorf("webhook sink needs a url")
+		}
+		if sc.Format != "" && sc.Format != "json" && sc.Format != "html" {
+			return nil, fmt.Errorf("webhook format must be json or html")
+		}
+		return webhookDigestSink{url: sc.URL, html: sc.Format == "html"}, nil
+	case "email":
+		if sc.SMTPAddr == "" || sc.From == "" || len(sc.To) == 0 {
+			return nil, fmt.Errorf("email sink needs smtpAddr, from and to")
+		}
+		return emailDigestSink{email: emailNotifier{
+			addr:     sc.SMTPAddr,
+			username: sc.Username,
+			password: os.ExpandEnv(sc.Password),
+			from:     sc.From,
+			to:       sc.To,
+		}}, nil
+	}
+	return nil, fmt.Errorf("unknown sink type %q (want webhook or email)", sc.Type)
+}
+
+// DigestSchedule is one recurring digest from the --digests file
+type DigestSchedule struct {
+	Name  string             `json:"name"`
+	Every string             `json:"every"`
+	Sinks []DigestSinkConfig `json:"sinks"`
+
+	every time.Duration
+	sinks []digestSink
+
+	mu        sync.Mutex
+	records   []Event
+	sends     uint64
+	lastSent  time.Time
+	lastError string
+	errorAt   time.Time
+}
+
+// build assembles the digest covering the time since the last send
+func (ds *DigestSchedule) build(now time.Time) *Digest {
+	ds.mu.Lock()
+	from := ds.lastSent
+	if from.IsZero() {
+		from = now.Add(-ds.every)
+	}
+	records := make([]Event, 0, len(ds.records))
+	for _, event := range ds.records {
+		if event.Time.After(from) && !event.Time.After(now) {
+			records = append(records, event)
+		}
+	}
+	ds.mu.Unlock()
+
+	users := leaderboard.GetLeaderboard(1, digestTop, UnrankedExclude, features.For(""))
+	top := make([]EmbedEntry, len(users))
+	for i, user := range users {
+		top[i] = EmbedEntry{Rank: user.Rank, Username: user.Username, Rating: user.Rating, Display: leaderboard.FormatRating(user.Rating)}
+	}
+	return &Digest{
+		Name:    ds.Name,
+		From:    from,
+		To:      now,
+		Top:     top,
+		Movers:  leaderboard.TopChurn(now.Sub(from), digestTop),
+		Records: records,
+	}
+}
+
+// send builds the digest and delivers it to every sink. Records stay queued
+// for the next digest unless every sink took this one.
+func (ds *DigestSchedule) send(now time.Time) error {
+	digest := ds.build(now)
+	var failed error
+	for _, sink := range ds.sinks {
+		if err := sink.deliver(digest); err != nil {
+			failed = err
+		}
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if failed != nil {
+		ds.lastError, ds.errorAt = failed.Error(), now
+		log.Printf("⚠️  Digest %s failed: %v", ds.Name, failed)
+		return failed
+	}
+	ds.sends++
+	ds.lastSent, ds.lastError = now, ""
+	kept := ds.records[:0]
+	for _, event := range ds.records {
+		if event.Time.After(now) {
+			kept = append(kept, event)
+		}
+	}
+	ds.records = kept
+	return nil
+}
+
+// DigestStatus is how a digest has been doing
+type DigestStatus struct {
+	Name           string     `json:"name"`
+	Every          string     `json:"every"`
+	Sinks          int        `json:"sinks"`
+	Sends          uint64     `json:"sends"`
+	LastSent       *time.Time `json:"lastSent,omitempty"`
+	PendingRecords int        `json:"pendingRecords"`
+	LastError      string     `json:"lastError,omitempty"`
+	ErrorAt        *time.Time `json:"errorAt,omitempty"`
+}
+
+func (ds *DigestSchedule) status() DigestStatus {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	status := DigestStatus{
+		Name:           ds.Name,
+		Every:          ds.every.String(),
+		Sinks:          len(ds.sinks),
+		Sends:          ds.sends,
+		PendingRecords: len(ds.records),
+		LastError:      ds.lastError,
+	}
+	if ds.sends > 0 {
+		lastSent := ds.lastSent
+		status.LastSent = &lastSent
+	}
+	if ds.lastError != "" {
+		errorAt := ds.errorAt
+		status.ErrorAt = &errorAt
+	}
+	return status
+}
+
+// digestSchedules are the configured digests
+type digestSchedules struct {
+	schedules []*DigestSchedule
+}
+
+var digests *digestSchedules
+
+// LoadDigests reads a JSON file of the form {"digests": [...]}
+func LoadDigests(path string) (*digestSchedules, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Digests []*DigestSchedule `json:"digests"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for i, ds := range file.Digests {
+		if ds.Name == "" {
+			return nil, fmt.Errorf("digest %d: name is required", i)
+		}
+		if seen[ds.Name] {
+			return nil, fmt.Errorf("digest %q is listed twice", ds.Name)
+		}
+		seen[ds.Name] = true
+		if ds.every, err = ParseRetention(ds.Every); err != nil || ds.every < minDigestEvery {
+			return nil, fmt.Errorf("digest %q: every must be a duration of at least %s, e.g. 1d or 7d", ds.Name, minDigestEvery)
+		}
+		if len(ds.Sinks) == 0 {
+			return nil, fmt.Errorf("digest %q has no sinks", ds.Name)
+		}
+		for j, sc := range ds.Sinks {
+			sink, err := sc.build()
+			if err != nil {
+				return nil, fmt.Errorf("digest %q sink %d: %w", ds.Name, j, err)
+			}
+			ds.sinks = append(ds.sinks, sink)
+		}
+	}
+	return &digestSchedules{schedules: file.Digests}, nil
+}
+
+// observe keeps new records for the next digests; it is a no-op when no
+// digests are configured
+func (d *digestSchedules) observe(event Event) {
+	if d == nil || event.Type != EventRecord {
+		return
+	}
+	for _, ds := range d.schedules {
+		ds.mu.Lock()
+		ds.records = append(ds.records, event)
+		if extra := len(ds.records) - maxDigestRecords; extra > 0 {
+			ds.records = ds.records[extra:]
+		}
+		ds.mu.Unlock()
+	}
+}
+
+func (d *digestSchedules) get(name string) (*DigestSchedule, bool) {
+	if d == nil {
+		return nil, false
+	}
+	for _, ds := range d.schedules {
+		if ds.Name == name {
+			return ds, true
+		}
+	}
+	return nil, false
+}
+
+// Run sends each digest on its own ticker and reports them as a
+// dependency, degraded while any last send failed
+func (d *digestSchedules) Run() {
+	for _, ds := range d.schedules {
+		ds := ds
+		job := backgroundJobs.register("digest "+ds.Name, ds.every)
+		ticker := time.NewTicker(ds.every)
+		go func() {
+			for now := range ticker.C {
+				ds.send(now)
+				job.ran(now)
+			}
+		}()
+	}
+
+	dependencies.register("digests", func() DependencyStatus {
+		status := DependencyStatus{Status: DependencyOK, Detail: fmt.Sprintf("%d digest(s)", len(d.schedules))}
+		for _, ds := range d.schedules {
+			if s := ds.status(); s.LastError != "" {
+				status.Status = DependencyDegraded
+				status.LastError = s.Name + ": " + s.LastError
+				status.LastErrorAt = s.ErrorAt
+			}
+		}
+		return status
+	})
+	log.Printf("📰 Sending %d digest(s)", len(d.schedules))
+}
+
+// Handler: List digests and how their last sends went
+func getDigests(c *gin.Context) {
+	statuses := make([]DigestStatus, 0)
+	if digests != nil {
+		for _, ds := range digests.schedules {
+			statuses = append(statuses, ds.status())
+		}
+	}
+	respond(c, 200, gin.H{"digests": statuses, "count": len(statuses)})
+}
+
+// Handler: Render a digest as it would be sent now, without sending it
+func previewDigest(c *gin.Context) {
+	ds, ok := digests.get(c.Param("name"))
+	if !ok {
+		respond(c, 404, gin.H{"error": "digest not found"})
+		return
+	}
+	digest := ds.build(time.Now())
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		respond(c, 200, digest)
+	case "html":
+		page, err := digest.html()
+		if err != nil {
+			respond(c, 500, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(200, "text/html; charset=utf-8", []byte(page))
+	default:
+		respond(c, 400, gin.H{"error": "format must be 'json' or 'html'"})
+	}
+}
+
+// Handler: Send a digest now
+func sendDigest(c *gin.Context) {
+	ds, ok := digests.get(c.Param("name"))
+	if !ok {
+		respond(c, 404, gin.H{"error": "digest not found"})
+		return
+	}
+	if err := ds.send(time.Now()); err != nil {
+		respond(c, 502, gin.H{"error": err.Error()})
+		return
+	}
+	auditLog.Record(c, "digest.send", ds.Name, nil)
+	respond(c, 200, ds.status())
+}
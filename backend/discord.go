@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Discord interaction and response types used by slash commands
+const (
+	discordPing               = 1
+	discordApplicationCommand = 2
+	discordPong               = 1
+	discordChannelMessage     = 4
+	discordEmbedColor         = 0xF1C40F
+	// discordEphemeral hides error replies from everyone but the caller
+	discordEphemeral = 1 << 6
+)
+
+// discordPublicKey verifies interaction signatures; the endpoint is disabled without it
+var discordPublicKey ed25519.PublicKey
+
+// ParseDiscordPublicKey decodes the hex public key from the Discord developer portal
+func ParseDiscordPublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("discord public key must be %d hex-encoded bytes", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+type discordInteraction struct {
+	Type int `json:"type"`
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string `json:"name"`
+			Value any    `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+}
+
+// option returns a command option's value as a string
+func (i discordInteraction) option(name string) string {
+	for _, opt := range i.Data.Options {
+		if opt.Name == name {
+			return fmt.Sprint(opt.Value)
+		}
+	}
+	return ""
+}
+
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type discordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Color       int                 `json:"color"`
+	Fields      []discordEmbedField `json:"fields,omitempty"`
+}
+
+func discordMessage(embed discordEmbed) gin.H {
+	return gin.H{"type": discordChannelMessage, "data": gin.H{"embeds": []discordEmbed{embed}}}
+}
+
+func discordError(message string) gin.H {
+	return gin.H{"type": discordChannelMessage, "data": gin.H{"content": message, "flags": discordEphemeral}}
+}
+
+// discordTop renders the top 10 as an embed
+func discordTop() gin.H {
+	lines := make([]string, 0, 10)
+	for _, user := range leaderboard.GetLeaderboard(1, 10, UnrankedExclude, features.For("")) {
+		lines = append(lines, fmt.Sprintf("**#%d** %s — %s", user.Rank, user.Username, leaderboard.FormatRating(user.Rating)))
+	}
+	return discordMessage(discordEmbed{
+		Title:       "🏆 Top 10",
+		Description: strings.Join(lines, "\n"),
+		Color:       discordEmbedColor,
+	})
+}
+
+// discordRank renders one user's standing as an embed
+func discordRank(username string) gin.H {
+	if username == "" {
+		return discordError("Usage: /rank username:<name>")
+	}
+	info, ok := leaderboard.GetRank(username, features.For(""))
+	if !ok {
+		return discordError(fmt.Sprintf("No player named %s on the board.", username))
+	}
+	return discordMessage(discordEmbed{
+		Title: info.Username,
+		Color: discordEmbedColor,
+		Fields: []discordEmbedField{
+			{Name: "Rank", Value: info.standing(), Inline: true},
+			{Name: "Rating", Value: leaderboard.FormatRating(info.Rating), Inline: true},
+		},
+	})
+}
+
+// Handler: Discord interactions endpoint for the /top and /rank slash commands
+func discordInteractions(c *gin.Context) {
+	if discordPublicKey == nil {
+		c.JSON(404, gin.H{"error": "discord integration is not configured"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "could not read request body"})
+		return
+	}
+	signature, err := hex.DecodeString(c.GetHeader("X-Signature-Ed25519"))
+	timestamp := c.GetHeader("X-Signature-Timestamp")
+	if err != nil || timestamp == "" || !ed25519.Verify(discordPublicKey, append([]byte(timestamp), body...), signature) {
+		c.JSON(401, gin.H{"error": "invalid request signature"})
+		return
+	}
+
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		c.JSON(400, gin.H{"error": "invalid interaction payload"})
+		return
+	}
+
+	switch interaction.Type {
+	case discordPing:
+		c.JSON(200, gin.H{"type": discordPong})
+	case discordApplicationCommand:
+		switch interaction.Data.Name {
+		case "top":
+			c.JSON(200, discordTop())
+		case "rank":
+			c.JSON(200, discordRank(interaction.option("username")))
+		default:
+			c.JSON(200, discordError(fmt.Sprintf("Unknown command /%s", interaction.Data.Name)))
+		}
+	default:
+		c.JSON(400, gin.H{"error": "unsupported interaction type"})
+	}
+}
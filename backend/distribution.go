@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultBucketWidth = 100
+	// maxBuckets keeps a tiny width over an unbounded range from producing a huge response
+	maxBuckets = 1000
+)
+
+// Bucket counts the users whose rating lies in [Min, Max)
+type Bucket struct {
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+	Count int `json:"count"`
+}
+
+// Distribution is a rating histogram. With explicit edges, ratings outside
+// the first and last edge are counted in Below and Above.
+type Distribution struct {
+	Buckets []Bucket `json:"buckets"`
+	Below   int      `json:"below"`
+	Above   int      `json:"above"`
+	Version uint64   `json:"version"`
+}
+
+// ratings returns a copy of every user's rating
+func (lm *LeaderboardManager) ratings() []int {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	ratings := make([]int, 0, len(lm.users))
+	for _, user := range lm.users {
+		ratings = append(ratings, user.Rating)
+	}
+	return ratings
+}
+
+// floorDiv divides rounding toward negative infinity, so negative ratings bucket correctly
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// histogramByWidth buckets ratings into equal-width bins aligned to multiples of width
+func histogramByWidth(ratings []int, width int) ([]Bucket, error) {
+	if len(ratings) == 0 {
+		return []Bucket{}, nil
+	}
+
+	first, last := floorDiv(ratings[0], width), floorDiv(ratings[0], width)
+	for _, r := range ratings {
+		b := floorDiv(r, width)
+		if b < first {
+			first = b
+		}
+		if b > last {
+			last = b
+		}
+	}
+	if last-first+1 > maxBuckets {
+		return nil, fmt.Errorf("width %d would produce more than %d buckets", width, maxBuckets)
+	}
+
+	buckets := make([]Bucket, last-first+1)
+	for i := range buckets {
+		buckets[i].Min = (first + i) * width
+		buckets[i].Max = (first + i + 1) * width
+	}
+	for _, r := range ratings {
+		buckets[floorDiv(r, width)-first].Count++
+	}
+	return buckets, nil
+}
+
+// histogramByEdges buckets ratings between consecutive ascending edges
+func histogramByEdges(ratings []int, edges []int) ([]Bucket, int, int) {
+	buckets := make([]Bucket, len(edges)-1)
+	for i := range buckets {
+		buckets[i].Min = edges[i]
+		buckets[i].Max = edges[i+1]
+	}
+
+	below, above := 0, 0
+	for _, r := range ratings {
+		switch {
+		case r < edges[0]:
+			below++
+		case r >= edges[len(edges)-1]:
+			above++
+		default:
+			// First edge strictly greater than r closes r's bucket
+			i := sort.SearchInts(edges, r+1)
+			buckets[i-1].Count++
+		}
+	}
+	return buckets, below, above
+}
+
+// parseBucketEdges parses a comma-separated list of strictly ascending edges
+func parseBucketEdges(s string) ([]int, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) < 2 || len(parts) > maxBuckets+1 {
+		return nil, fmt.Errorf("edges must list between 2 and %d values", maxBuckets+1)
+	}
+
+	edges := make([]int, len(parts))
+	for i, part := range parts {
+		edge, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid edge %q", part)
+		}
+		if i > 0 && edge <= edges[i-1] {
+			return nil, fmt.Errorf("edges must be strictly ascending")
+		}
+		edges[i] = edge
+	}
+	return edges, nil
+}
+
+// distributionCache holds histograms per bucketing spec at the current board version
+var distributionCache = newVersionedCache[Distribution]()
+
+// Handler: Get rating distribution
+func getDistribution(c *gin.Context) {
+	edgesParam := c.Query("edges")
+	width := defaultBucketWidth
+	if w := c.Query("width"); w != "" {
+		if _, err := fmt.Sscanf(w, "%d", &width); err != nil || width < 1 {
+			respond(c, 400, gin.H{"error": "width must be a positive integer"})
+			return
+		}
+	}
+
+	var edges []int
+	if edgesParam != "" {
+		var err error
+		if edges, err = parseBucketEdges(edgesParam); err != nil {
+			respond(c, 400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	key := fmt.Sprintf("width=%d", width)
+	if edges != nil {
+		key = "edges=" + strings.Trim(fmt.Sprint(edges), "[]")
+	}
+
+	version := leaderboard.Version()
+	if dist, cached := distributionCache.get(key, version); cached {
+		respond(c, 200, dist)
+		return
+	}
+
+	dist := Distribution{Version: version}
+	ratings := leaderboard.ratings()
+	if edges != nil {
+		dist.Buckets, dist.Below, dist.Above = histogramByEdges(ratings, edges)
+	} else {
+		var err error
+		if dist.Buckets, err = histogramByWidth(ratings, width); err != nil {
+			respond(c, 400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	distributionCache.put(key, version, dist)
+	respond(c, 200, dist)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RatingChange previews what a write would do to one user. A rank of 0
+// means unranked, or not on the board yet.
+type RatingChange struct {
+	Username  string `json:"username"`
+	OldRating int    `json:"oldRating"`
+	NewRating int    `json:"newRating"`
+	OldRank   int    `json:"oldRank"`
+	NewRank   int    `json:"newRank"`
+}
+
+// isDryRun reports whether a request asked to validate without committing.
+// It takes the usual boolean spellings (true, 1, ...). A value it can't read
+// is answered with 400 and ok is false, so a typo neither commits a write
+// nor passes for a preview.
+func isDryRun(c *gin.Context) (dryRun, ok bool) {
+	value, present := c.GetQuery("dryRun")
+	if !present {
+		return false, true
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		respond(c, 400, gin.H{"error": "dryRun must be true or false"})
+		return false, false
+	}
+	return dryRun, true
+}
+
+// projectedRank works out the rank a user would hold after a change, without
+// touching the board, using the rank tree or, on banded boards, the band
+// counters. lm.mu must be held.
+func (lm *LeaderboardManager) projectedRank(changed *User) int {
+	if changed.Unranked != "" {
+		return 0
+	}
+	var rank int
+	if lm.config.RankBand > 0 {
+		rank = lm.moments.histogram.bandRank(changed.Rating, lm.config.LowerIsBetter)
+	} else {
+		rank = lm.rankTree.countAhead(lm.rankTree.keyOf(changed)) + 1
+	}
+	// The user's current standing is counted too, unless it's tied or behind
+	if current, ok := lm.users[changed.Username]; ok && lm.rankTree.has(current) && lm.rankedAhead(current, changed) {
+		rank--
+	}
+	return rank
+}
+
+// currentRank is a user's rank right now, without waiting for a re-rank;
+// lm.mu must be held
+func (lm *LeaderboardManager) currentRank(user *User) int {
+	if lm.config.RankBand > 0 {
+		return lm.bandRankInfo(user).Rank
+	}
+	return lm.rankTree.rank(user)
+}
+
+// rankedAhead reports whether a ranks ahead of b, by band on banded boards
+func (lm *LeaderboardManager) rankedAhead(a, b *User) bool {
+	if lm.config.RankBand > 0 {
+		ba, bb := lm.moments.histogram.bucket(a.Rating), lm.moments.histogram.bucket(b.Rating)
+		return ba != bb && (ba > bb) != lm.config.LowerIsBetter
+	}
+	return lm.config.compareUsers(a, b) < 0
+}
+
+// previewProvisional sets what a changed copy's provisional status would
+// become, as updateProvisional would; it never touches the board
+func (lm *LeaderboardManager) previewProvisional(changed *User) {
+	if lm.config.MinGames == 0 {
+		return
+	}
+	provisional := changed.activity() < lm.config.MinGames
+	switch {
+	case provisional && changed.Unranked == "":
+		changed.Unranked = UnrankedProvisional
+	case !provisional && changed.Unranked == UnrankedProvisional:
+		changed.Unranked = ""
+	}
+}
+
+// preview reports the difference between a user and a changed copy of them;
+// lm.mu must be held. Previews never flush coalesced ratings, so ranks are
+// worked out from the ratings as of the last flush, while the old rating
+// includes one still waiting.
+func (lm *LeaderboardManager) preview(user, changed *User) RatingChange {
+	return RatingChange{
+		Username:  user.Username,
+		OldRating: lm.currentRating(user),
+		NewRating: changed.Rating,
+		OldRank:   lm.currentRank(user),
+		NewRank:   lm.projectedRank(changed),
+	}
+}
+
+// previewRating reports what setting a user's rating would change; lm.mu
+// must be held
+func (lm *LeaderboardManager) previewRating(user *User, rating int) RatingChange {
+	changed := user.snapshot()
+	changed.Rating = rating
+	return lm.preview(user, &changed)
+}
+
+// previewUnranked reports what moving a user in or out of the ranking would
+// change; lm.mu must be held
+func (lm *LeaderboardManager) previewUnranked(user *User, reason UnrankedReason) RatingChange {
+	changed := user.snapshot()
+	changed.Rating = lm.currentRating(user)
+	changed.Unranked = reason
+	return lm.preview(user, &changed)
+}
+
+// PreviewUnranked is SetUnranked without committing
+func (lm *LeaderboardManager) PreviewUnranked(username string, reason UnrankedReason) (RatingChange, bool) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	user, exists := lm.users[username]
+	if !exists {
+		return RatingChange{}, false
+	}
+	return lm.previewUnranked(user, reason), true
+}
+
+// previewBulk counts how many matched users a job would change, without
+// changing them
+func (lm *LeaderboardManager) previewBulk(job *BulkJob, matched []string) int {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	now := time.Now()
+	changed := 0
+	for _, username := range matched {
+		user, exists := lm.users[username]
+		if exists && job.Filter.Matches(user, now) && lm.bulkWouldChange(job, user) {
+			changed++
+		}
+	}
+	return changed
+}
+
+// bulkWouldChange mirrors applyBulkTo without side effects; lm.mu must be held
+func (lm *LeaderboardManager) bulkWouldChange(job *BulkJob, user *User) bool {
+	switch job.Operation {
+	case BulkDelete:
+		return true
+	case BulkDecay:
+		return user.Unranked != UnrankedDecayed
+	case BulkTag:
+		for _, tag := range user.Tags {
+			if tag == job.Tag {
+				return false
+			}
+		}
+		return true
+	case BulkRecalc:
+		if lm.config.clampRating(user.Rating) != user.Rating {
+			return true
+		}
+		changed := user.snapshot()
+		lm.previewProvisional(&changed)
+		return changed.Unranked != user.Unranked
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultEmbedLimit and maxEmbedLimit bound the embeddable top list
+	defaultEmbedLimit = 10
+	maxEmbedLimit     = 50
+	// embedRefresh is how often an embed body is rebuilt from the board,
+	// however fast the board changes
+	embedRefresh = 30 * time.Second
+	// embedCacheControl lets browsers keep the list a minute and CDNs five,
+	// serving stale copies while they revalidate or when the origin is down
+	embedCacheControl = "public, max-age=60, s-maxage=300, stale-while-revalidate=600, stale-if-error=86400"
+)
+
+// EmbedEntry is one row of the embeddable top list, kept deliberately small
+type EmbedEntry struct {
+	Rank     int    `json:"rank"`
+	Username string `json:"username"`
+	Rating   int    `json:"rating"`
+	// Display is the rating in the board's display format
+	Display string `json:"display"`
+}
+
+// embedBody is an encoded top list ready to serve
+type embedBody struct {
+	body    []byte
+	etag    string
+	builtAt time.Time
+}
+
+// embedBodies holds the encoded top list per limit
+type embedBodies struct {
+	mu     sync.Mutex
+	bodies map[int]*embedBody
+}
+
+var embeds = &embedBodies{bodies: make(map[int]*embedBody)}
+
+// get returns the top list for a limit, rebuilding it at most once per
+// embedRefresh so embed traffic never reaches the board more often than that
+func (eb *embedBodies) get(limit int) (*embedBody, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	if cached, ok := eb.bodies[limit]; ok && time.Since(cached.builtAt) < embedRefresh {
+		return cached, nil
+	}
+
+	users := leaderboard.GetLeaderboard(1, limit, UnrankedExclude, features.For(""))
+	entries := make([]EmbedEntry, len(users))
+	for i, user := range users {
+		entries[i] = EmbedEntry{Rank: user.Rank, Username: user.Username, Rating: user.Rating, Display: leaderboard.FormatRating(user.Rating)}
+	}
+	now := time.Now()
+	body, err := json.Marshal(gin.H{"top": entries, "updatedAt": now.Unix()})
+	if err != nil {
+		return nil, err
+	}
+
+	// The ETag covers the entries only, so an unchanged top list revalidates
+	// with a 304 even though updatedAt moved on
+	h := fnv.New64a()
+	for _, entry := range entries {
+		fmt.Fprintf(h, "%d:%s:%d\n", entry.Rank, entry.Username, entry.Rating)
+	}
+	built := &embedBody{body: body, etag: fmt.Sprintf(`"%x"`, h.Sum64()), builtAt: now}
+	eb.bodies[limit] = built
+	return built, nil
+}
+
+// Handler: Top of the board for embedding in other pages, made for CDN caching
+func getEmbedTop(c *gin.Context) {
+	limit := defaultEmbedLimit
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxEmbedLimit {
+			respond(c, 400, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxEmbedLimit)})
+			return
+		}
+		limit = n
+	}
+
+	embed, err := embeds.get(limit)
+	if err != nil {
+		respond(c, 500, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", embedCacheControl)
+	c.Header("ETag", embed.etag)
+	if c.GetHeader("If-None-Match") == embed.etag {
+		c.Status(304)
+		return
+	}
+	c.Data(200, "application/json; charset=utf-8", embed.body)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// split estimates how many ratings lie strictly above and strictly below
+// rating, assuming ratings are spread evenly inside each bucket
+func (h ratingHistogram) split(rating int) (above, below float64) {
+	own := h.bucket(rating)
+	for bucket, count := range h.counts {
+		switch {
+		case bucket > own:
+			above += float64(count)
+		case bucket < own:
+			below += float64(count)
+		default:
+			offset := float64(rating - own*h.width)
+			above += float64(count) * (float64(h.width) - 1 - offset) / float64(h.width)
+			below += float64(count) * offset / float64(h.width)
+		}
+	}
+	return above, below
+}
+
+// RatingEstimate answers where a rating sits on the board from the running
+// histogram alone. The counts are estimates, since the histogram only knows
+// ratings to bucket granularity.
+type RatingEstimate struct {
+	Rating int `json:"rating"`
+	Above  int `json:"above"`
+	Below  int `json:"below"`
+	// Percentile is the estimated share of the board ranked below the rating
+	Percentile  float64 `json:"percentile"`
+	TotalUsers  int     `json:"totalUsers"`
+	BucketWidth int     `json:"bucketWidth"`
+	Approximate bool    `json:"approximate"`
+}
+
+// EstimateRating places a rating on the board without re-ranking or scanning users
+func (lm *LeaderboardManager) EstimateRating(rating int) RatingEstimate {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	above, below := lm.moments.histogram.split(rating)
+	total := int(lm.moments.count)
+	behind := below
+	if lm.config.LowerIsBetter {
+		behind = above
+	}
+
+	estimate := RatingEstimate{
+		Rating:      rating,
+		Above:       int(math.Round(above)),
+		Below:       int(math.Round(below)),
+		TotalUsers:  total,
+		BucketWidth: lm.moments.histogram.width,
+		Approximate: true,
+	}
+	if total > 0 {
+		estimate.Percentile = roundTo(100*behind/float64(total), 2)
+	}
+	return estimate
+}
+
+// ratingParam reads the required integer rating query parameter
+func ratingParam(c *gin.Context) (int, bool) {
+	rating, err := strconv.Atoi(c.Query("rating"))
+	if err != nil {
+		respond(c, 400, gin.H{"error": "query parameter 'rating' must be an integer"})
+		return 0, false
+	}
+	return rating, true
+}
+
+// Handler: Estimate how many users are rated above a rating
+func getEstimatedAbove(c *gin.Context) {
+	rating, ok := ratingParam(c)
+	if !ok {
+		return
+	}
+	estimate := leaderboard.EstimateRating(rating)
+	respond(c, 200, gin.H{
+		"rating":      estimate.Rating,
+		"above":       estimate.Above,
+		"totalUsers":  estimate.TotalUsers,
+		"bucketWidth": estimate.BucketWidth,
+		"approximate": estimate.Approximate,
+	})
+}
+
+// Handler: Estimate the percentile a rating would have
+func getEstimatedPercentile(c *gin.Context) {
+	rating, ok := ratingParam(c)
+	if !ok {
+		return
+	}
+	estimate := leaderboard.EstimateRating(rating)
+	respond(c, 200, gin.H{
+		"rating":      estimate.Rating,
+		"percentile":  estimate.Percentile,
+		"totalUsers":  estimate.TotalUsers,
+		"bucketWidth": estimate.BucketWidth,
+		"approximate": estimate.Approximate,
+	})
+}
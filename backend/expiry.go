@@ -0,0 +1,143 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// scoreExpiryInterval is how often expired score contributions are dropped
+const scoreExpiryInterval = time.Minute
+
+// contribution is one submitted score that still counts towards a user's
+// rating. Value is the rating change it made on cumulative boards and the
+// submitted score on replace boards.
+type contribution struct {
+	user  *User
+	value int
+	at    time.Time
+}
+
+// scoreContributions tracks live submissions on boards with a score window.
+// Submissions arrive in time order, so the queue is oldest first and expiry
+// only ever pops from the front.
+type scoreContributions struct {
+	queue []contribution
+	live  map[*User]int
+}
+
+// recordContribution tracks a submission that moved a user's rating from
+// before to after, and brings a decayed user back into the ranking; lm.mu
+// must be held
+func (lm *LeaderboardManager) recordContribution(user *User, before, after int) {
+	if lm.config.ScoreWindow == 0 {
+		return
+	}
+	value := after
+	if lm.config.ScoreMode == ScoreModeCumulative {
+		value = after - before
+	}
+	now := time.Now()
+	lm.contributions.queue = append(lm.contributions.queue, contribution{user: user, value: value, at: now})
+	lm.contributions.live[user]++
+	lm.persist(OpContribution, user, value, now)
+
+	if user.Unranked == UnrankedDecayed {
+		user.Unranked = ""
+		lm.rankIn(user)
+		lm.updateProvisional(user)
+		lm.persist(OpUnranked, user, 0, time.Now())
+		lm.markChanged()
+	}
+}
+
+// ExpireScores drops contributions older than the board's score window. On
+// cumulative boards each one is taken back off the user's rating; on replace
+// boards a user whose latest score expires is unranked as decayed.
+func (lm *LeaderboardManager) ExpireScores(now time.Time) int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	// Expiry catches up once the freeze lifts
+	if freeze.active() {
+		return 0
+	}
+	lm.flushPendingLocked()
+
+	cutoff := now.Add(-lm.config.ScoreWindow)
+	expired := 0
+	for _, c := range lm.contributions.queue {
+		if !c.at.Before(cutoff) {
+			break
+		}
+		expired++
+		user := c.user
+		if lm.contributions.live[user]--; lm.contributions.live[user] <= 0 {
+			delete(lm.contributions.live, user)
+		}
+
+		onBoard := lm.users[user.Username] == user
+		switch {
+		case lm.config.ScoreMode == ScoreModeCumulative:
+			rating := lm.config.clampRating(addSaturating(user.Rating, -c.value))
+			if onBoard {
+				lm.setRating(user, rating)
+				lm.recordRating(user, rating, now)
+			} else {
+				user.Rating = rating
+			}
+		case lm.contributions.live[user] == 0 && user.Unranked == "":
+			if onBoard {
+				lm.rankOut(user)
+			}
+			user.Unranked = UnrankedDecayed
+			if onBoard {
+				lm.persist(OpUnranked, user, 0, now)
+			}
+		}
+	}
+	lm.contributions.queue = lm.contributions.queue[expired:]
+	if expired > 0 {
+		if lm.storage != nil {
+			lm.appendStoredLocked(StoredUpdate{Op: OpExpire, Before: cutoff, At: now})
+		}
+		lm.markChanged()
+	}
+	return expired
+}
+
+// dropContributionsLocked forgets the contributions made before cutoff
+// without touching ratings, when replaying an expiry whose effects were
+// logged on their own; lm.mu must be held
+func (lm *LeaderboardManager) dropContributionsLocked(cutoff time.Time) {
+	expired := 0
+	for _, c := range lm.contributions.queue {
+		if !c.at.Before(cutoff) {
+			break
+		}
+		expired++
+		if lm.contributions.live[c.user]--; lm.contributions.live[c.user] <= 0 {
+			delete(lm.contributions.live, c.user)
+		}
+	}
+	lm.contributions.queue = lm.contributions.queue[expired:]
+}
+
+// ExpireScoresEvery runs score expiry on a schedule. It does nothing unless
+// the board has a score window.
+func (lm *LeaderboardManager) ExpireScoresEvery(interval time.Duration) {
+	if lm.config.ScoreWindow == 0 {
+		return
+	}
+	interval = min(interval, lm.config.ScoreWindow)
+
+	job := backgroundJobs.register("score expiry", interval)
+	ticker := time.NewTicker(interval)
+	go func() {
+		for now := range ticker.C {
+			if expired := lm.ExpireScores(now); expired > 0 {
+				log.Printf("⌛ Expired %d score contributions older than %s", expired, lm.config.ScoreWindow)
+			}
+			job.ran(now)
+		}
+	}()
+	log.Printf("⌛ Scores count for %s", lm.config.ScoreWindow)
+}
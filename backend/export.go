@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// exportSnapshotTTL is how long an interrupted export can be resumed
+	exportSnapshotTTL = 30 * time.Minute
+	// maxExportSnapshots caps how many board copies exports may hold at once
+	maxExportSnapshots = 4
+	// exportFlushEvery is how many records are written between flushes
+	exportFlushEvery = 1000
+)
+
+// exportSnapshot is a frozen copy of the ranked board that an export reads
+// from, so resumed downloads continue over exactly the same rows
+type exportSnapshot struct {
+	users     []User
+	version   uint64
+	createdAt time.Time
+}
+
+// exportSnapshots holds the snapshots behind in-progress exports, keyed by token
+type exportSnapshots struct {
+	mu        sync.Mutex
+	snapshots map[string]*exportSnapshot
+}
+
+var exports = &exportSnapshots{snapshots: make(map[string]*exportSnapshot)}
+
+// create stores a new snapshot and returns its token
+func (es *exportSnapshots) create(users []User, version uint64) (string, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	es.expireLocked()
+	if len(es.snapshots) >= maxExportSnapshots {
+		return "", fmt.Errorf("too many exports in progress, try again later")
+	}
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+	es.snapshots[token] = &exportSnapshot{users: users, version: version, createdAt: time.Now()}
+	return token, nil
+}
+
+// get returns the snapshot for a token if it hasn't expired
+func (es *exportSnapshots) get(token string) (*exportSnapshot, bool) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	es.expireLocked()
+	snapshot, ok := es.snapshots[token]
+	return snapshot, ok
+}
+
+// release frees a snapshot once its export has been written in full
+func (es *exportSnapshots) release(token string) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	delete(es.snapshots, token)
+}
+
+// count returns how many exports can currently be resumed
+func (es *exportSnapshots) count() int {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	es.expireLocked()
+	return len(es.snapshots)
+}
+
+func (es *exportSnapshots) expireLocked() {
+	for token, snapshot := range es.snapshots {
+		if time.Since(snapshot.createdAt) > exportSnapshotTTL {
+			delete(es.snapshots, token)
+		}
+	}
+}
+
+// AllUsers returns a copy of the whole ranked board
+func (lm *LeaderboardManager) AllUsers() ([]User, uint64) {
+	lm.rLockRanked()
+	defer lm.mu.RUnlock()
+
+	users := make([]User, len(lm.sortedUsers))
+	for i, user := range lm.sortedUsers {
+		users[i] = user.snapshot()
+	}
+	return users, lm.Version()
+}
+
+// parseRecordRange reads a "Range: records=N-" header; only open-ended ranges
+// are supported. Ranges in other units, like the bytes=0- download managers
+// send, are ignored and the whole export is served.
+func parseRecordRange(header string) (int, bool, error) {
+	spec, found := strings.CutPrefix(header, "records=")
+	if !found {
+		return 0, false, nil
+	}
+	if !strings.HasSuffix(spec, "-") {
+		return 0, false, fmt.Errorf("only open-ended record ranges are supported, e.g. Range: records=1000-")
+	}
+	offset, err := strconv.Atoi(strings.TrimSuffix(spec, "-"))
+	if err != nil || offset < 0 {
+		return 0, false, fmt.Errorf("invalid record range %q", header)
+	}
+	return offset, true, nil
+}
+
+// Handler: Export the whole board as CSV or NDJSON, resumable by token and record offset
+func exportBoard(c *gin.Context) {
+	format := c.DefaultQuery("format", "ndjson")
+	if format != "ndjson" && format != "csv" {
+		respond(c, 400, gin.H{"error": "format must be 'ndjson' or 'csv'"})
+		return
+	}
+
+	offset, ranged, err := parseRecordRange(c.GetHeader("Range"))
+	if err != nil {
+		respond(c, 416, gin.H{"error": err.Error()})
+		return
+	}
+	if o := c.Query("offset"); o != "" {
+		if offset, err = strconv.Atoi(o); err != nil || offset < 0 {
+			respond(c, 400, gin.H{"error": "offset must be a non-negative integer"})
+			return
+		}
+	}
+
+	// Resuming requires the token of the snapshot the export started from
+	token := c.Query("token")
+	var snapshot *exportSnapshot
+	if token != "" {
+		var ok bool
+		if snapshot, ok = exports.get(token); !ok {
+			respond(c, 410, gin.H{"error": "export token expired or unknown; start a new export without a token"})
+			return
+		}
+	} else {
+		if offset > 0 {
+			respond(c, 400, gin.H{"error": "resuming at an offset requires the token from the original export"})
+			return
+		}
+		users, version := leaderboard.AllUsers()
+		if token, err = exports.create(users, version); err != nil {
+			respond(c, 503, gin.H{"error": err.Error()})
+			return
+		}
+		snapshot, _ = exports.get(token)
+	}
+
+	total := len(snapshot.users)
+	if offset > 0 && offset >= total {
+		respond(c, 416, gin.H{"error": fmt.Sprintf("offset %d is past the end of the export (%d records)", offset, total)})
+		return
+	}
+
+	c.Header("X-Export-Token", token)
+	c.Header("X-Board-Version", strconv.FormatUint(snapshot.version, 10))
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.Header("Accept-Ranges", "records")
+	status := 200
+	if ranged || offset > 0 {
+		status = 206
+		c.Header("Content-Range", fmt.Sprintf("records %d-%d/%d", offset, total-1, total))
+	}
+
+	var complete bool
+	if format == "csv" {
+		complete = writeCSVExport(c, status, snapshot.users, offset)
+	} else {
+		complete = writeNDJSONExport(c, status, snapshot.users, offset)
+	}
+	// Only an interrupted export needs its snapshot to resume from
+	if complete {
+		exports.release(token)
+	}
+}
+
+// writeNDJSONExport streams users from offset, reporting whether it reached the end
+func writeNDJSONExport(c *gin.Context, status int, users []User, offset int) bool {
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(status)
+
+	encoder := json.NewEncoder(c.Writer)
+	for i := offset; i < len(users); i++ {
+		if err := encoder.Encode(users[i]); err != nil {
+			return false
+		}
+		if (i+1)%exportFlushEvery == 0 {
+			c.Writer.Flush()
+			if expired(c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// csvRank leaves the rank column empty for unranked users
+func csvRank(rank int) string {
+	if rank == 0 {
+		return ""
+	}
+	return strconv.Itoa(rank)
+}
+
+// csvHeader names the columns of csvRecord
+var csvHeader = []string{"rank", "username", "rating", "gamesPlayed", "wins", "lastActive"}
+
+// csvRecord is one user's row in a CSV export
+func csvRecord(user User) []string {
+	return []string{
+		csvRank(user.Rank),
+		user.Username,
+		strconv.Itoa(user.Rating),
+		strconv.Itoa(user.GamesPlayed),
+		strconv.Itoa(user.Wins),
+		user.LastActive.UTC().Format(time.RFC3339),
+	}
+}
+
+// writeCSVExport streams users from offset, reporting whether it reached the end
+func writeCSVExport(c *gin.Context, status int, users []User, offset int) bool {
+	c.Header("Content-Type", "text/csv")
+	c.Status(status)
+
+	writer := csv.NewWriter(c.Writer)
+	if offset == 0 {
+		writer.Write(csvHeader)
+	}
+	for i := offset; i < len(users); i++ {
+		writer.Write(csvRecord(users[i]))
+		if (i+1)%exportFlushEvery == 0 {
+			writer.Flush()
+			if writer.Error() != nil {
+				return false
+			}
+			c.Writer.Flush()
+			if expired(c) {
+				return false
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error() == nil
+}
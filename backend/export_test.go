@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// exportedUsernames reads the usernames from an NDJSON export body
+func exportedUsernames(t *testing.T, body string) []string {
+	t.Helper()
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		var user User
+		if err := json.Unmarshal([]byte(line), &user); err != nil {
+			t.Fatalf("decoding export line %q: %v", line, err)
+		}
+		names = append(names, user.Username)
+	}
+	return names
+}
+
+func TestExportResume(t *testing.T) {
+	ts := newTestServer(t, DefaultBoardConfig())
+	ts.createUsers(map[string]int{"ann": 1400, "ben": 1300, "cat": 1200, "dan": 1100, "eve": 1000})
+	board := []string{"ann", "ben", "cat", "dan", "eve"}
+
+	t.Run("full export", func(t *testing.T) {
+		recorder := ts.in(t).do(request{method: http.MethodGet, path: "/api/admin/export?format=ndjson", admin: true})
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("got status %d, want 200; body: %s", recorder.Code, recorder.Body.String())
+		}
+		if total := recorder.Header().Get("X-Total-Count"); total != "5" {
+			t.Errorf("X-Total-Count is %q, want 5", total)
+		}
+		if got := exportedUsernames(t, recorder.Body.String()); !equalStrings(got, board) {
+			t.Errorf("exported %v, want %v", got, board)
+		}
+		// A finished export frees its snapshot, so its token can't resume
+		token := recorder.Header().Get("X-Export-Token")
+		ts.in(t).expect(request{method: http.MethodGet, path: "/api/admin/export?token=" + token, admin: true, headers: map[string]string{"Range": "records=2-"}}, http.StatusGone)
+	})
+
+	t.Run("resume an interrupted export", func(t *testing.T) {
+		// Stand in for an export cut off part way: its snapshot is still held
+		users, version := leaderboard.AllUsers()
+		token, err := exports.create(users, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Changes since the export started must not show up when it resumes
+		ts.in(t).expect(request{method: http.MethodPut, path: "/api/users/eve/rating", body: map[string]int{"rating": 2000}, admin: true}, http.StatusOK)
+
+		recorder := ts.in(t).do(request{method: http.MethodGet, path: "/api/admin/export?token=" + token, admin: true, headers: map[string]string{"Range": "records=2-"}})
+		if recorder.Code != http.StatusPartialContent {
+			t.Fatalf("got status %d, want 206; body: %s", recorder.Code, recorder.Body.String())
+		}
+		if contentRange := recorder.Header().Get("Content-Range"); contentRange != "records 2-4/5" {
+			t.Errorf("Content-Range is %q, want records 2-4/5", contentRange)
+		}
+		if got, want := exportedUsernames(t, recorder.Body.String()), board[2:]; !equalStrings(got, want) {
+			t.Errorf("resumed export returned %v, want %v", got, want)
+		}
+		if exports.count() != 0 {
+			t.Errorf("%d export snapshots still held after the export finished", exports.count())
+		}
+	})
+
+	t.Run("byte ranges are ignored", func(t *testing.T) {
+		// Download managers send these; the whole export is served, and
+		// finished exports never use up the snapshot limit
+		for i := 0; i < maxExportSnapshots+2; i++ {
+			recorder := ts.in(t).do(request{method: http.MethodGet, path: "/api/admin/export", admin: true, headers: map[string]string{"Range": "bytes=0-"}})
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("export %d: got status %d, want 200; body: %s", i+1, recorder.Code, recorder.Body.String())
+			}
+		}
+	})
+
+	t.Run("malformed record range", func(t *testing.T) {
+		ts.in(t).expect(request{method: http.MethodGet, path: "/api/admin/export", admin: true, headers: map[string]string{"Range": "records=1-3"}}, http.StatusRequestedRangeNotSatisfiable)
+	})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Feature names. Each gates a risky code path so it can be rolled out per
+// environment, or to a percentage of traffic, and switched off at runtime.
+const (
+	// FeatureSearchIndex narrows searches with the search index instead of scanning the board
+	FeatureSearchIndex = "search_index"
+	// FeatureRankTree serves pages and rank lookups from the rank tree instead of a re-rank
+	FeatureRankTree = "rank_tree"
+	// FeatureApproxRanks estimates deep ranks from the rating histogram for approximate=true
+	FeatureApproxRanks = "approx_ranks"
+	// FeatureBandRanks reads ranks on banded boards from the band counters instead of a re-rank
+	FeatureBandRanks = "band_ranks"
+)
+
+// defaultFeatures lists every known feature and the percentage of traffic it starts enabled for
+var defaultFeatures = map[string]int{
+	FeatureSearchIndex: 100,
+	FeatureRankTree:    100,
+	FeatureApproxRanks: 100,
+	FeatureBandRanks:   100,
+}
+
+// FeaturePaths is which gated code paths one client's reads take
+type FeaturePaths struct {
+	SearchIndex bool
+	RankTree    bool
+	BandRanks   bool
+}
+
+// FeatureFlag is a feature's rollout state
+type FeatureFlag struct {
+	Name    string `json:"name"`
+	Percent int    `json:"percent"`
+}
+
+// FeatureFlags holds the rollout percentage of each known feature
+type FeatureFlags struct {
+	mu       sync.RWMutex
+	percents map[string]int
+}
+
+// NewFeatureFlags starts every known feature at its default
+func NewFeatureFlags() *FeatureFlags {
+	ff := &FeatureFlags{percents: make(map[string]int, len(defaultFeatures))}
+	for name, percent := range defaultFeatures {
+		ff.percents[name] = percent
+	}
+	return ff
+}
+
+// Set changes a feature's rollout percentage, returning the previous one
+func (ff *FeatureFlags) Set(name string, percent int) (int, error) {
+	if _, known := defaultFeatures[name]; !known {
+		return 0, fmt.Errorf("unknown feature %q", name)
+	}
+	if percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("percent for %s must be between 0 and 100", name)
+	}
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	previous := ff.percents[name]
+	ff.percents[name] = percent
+	return previous, nil
+}
+
+// Enabled decides whether a client takes the feature's code path. Partially
+// rolled out features hash the client into one of 100 slots, so each client
+// stays on the same side of the rollout from request to request; background
+// work passes an empty client.
+func (ff *FeatureFlags) Enabled(name, client string) bool {
+	ff.mu.RLock()
+	percent := ff.percents[name]
+	ff.mu.RUnlock()
+
+	switch {
+	case percent >= 100:
+		return true
+	case percent <= 0:
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(client))
+	return int(h.Sum32()%100) < percent
+}
+
+// For resolves every board read feature for a client
+func (ff *FeatureFlags) For(client string) FeaturePaths {
+	return FeaturePaths{
+		SearchIndex: ff.Enabled(FeatureSearchIndex, client),
+		RankTree:    ff.Enabled(FeatureRankTree, client),
+		BandRanks:   ff.Enabled(FeatureBandRanks, client),
+	}
+}
+
+// List returns every feature's state, sorted by name
+func (ff *FeatureFlags) List() []FeatureFlag {
+	ff.mu.RLock()
+	defer ff.mu.RUnlock()
+
+	flags := make([]FeatureFlag, 0, len(ff.percents))
+	for name, percent := range ff.percents {
+		flags = append(flags, FeatureFlag{Name: name, Percent: percent})
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags
+}
+
+// ParseFeatures applies a spec like "search_index=off,other=25" where each
+// value is on, off or a percentage of traffic
+func (ff *FeatureFlags) ParseFeatures(spec string) error {
+	for _, part := range strings.Split(spec, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return fmt.Errorf("feature %q must be written as name=on|off|percent", part)
+		}
+		var percent int
+		switch value = strings.TrimSuffix(strings.TrimSpace(value), "%"); value {
+		case "on":
+			percent = 100
+		case "off":
+			percent = 0
+		default:
+			var err error
+			if percent, err = strconv.Atoi(value); err != nil {
+				return fmt.Errorf("feature %s: %q is not on, off or a percentage", name, value)
+			}
+		}
+		if _, err := ff.Set(strings.TrimSpace(name), percent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var features = NewFeatureFlags()
+
+// Handler: List feature flags
+func getFeatures(c *gin.Context) {
+	respond(c, 200, gin.H{"features": features.List()})
+}
+
+// Handler: Change a feature's rollout percentage
+func setFeature(c *gin.Context) {
+	var req struct {
+		Percent *int `json:"percent"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Percent == nil {
+		respond(c, 400, gin.H{"error": "body must be {\"percent\": 0-100}"})
+		return
+	}
+
+	name := c.Param("name")
+	previous, err := features.Set(name, *req.Percent)
+	if err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+	auditLog.Record(c, "feature.set", name, gin.H{"from": previous, "to": *req.Percent})
+	respond(c, 200, FeatureFlag{Name: name, Percent: *req.Percent})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestFeatureRolloutIsSticky(t *testing.T) {
+	ff := NewFeatureFlags()
+	if _, err := ff.Set(FeatureRankTree, 30); err != nil {
+		t.Fatal(err)
+	}
+
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		client := fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+		first := ff.Enabled(FeatureRankTree, client)
+		for j := 0; j < 10; j++ {
+			if ff.Enabled(FeatureRankTree, client) != first {
+				t.Fatalf("client %s switched variants between calls", client)
+			}
+		}
+		if first {
+			enabled++
+		}
+	}
+	if enabled < 200 || enabled > 400 {
+		t.Errorf("%d of 1000 clients enabled at 30%%", enabled)
+	}
+}
+
+func TestRankTreeSwitchedOff(t *testing.T) {
+	ts := newTestServer(t, DefaultBoardConfig())
+	ts.createUsers(map[string]int{"ann": 1400, "ben": 1300, "cat": 1200})
+
+	previous := features
+	features = NewFeatureFlags()
+	features.Set(FeatureRankTree, 0)
+	t.Cleanup(func() { features = previous })
+
+	// With the tree off, reads fall back to re-ranking and agree with it
+	ts.run([]step{
+		{
+			name:    "cat overtakes everyone",
+			request: request{method: http.MethodPut, path: "/api/users/cat/rating", body: map[string]int{"rating": 1500}, admin: true},
+			status:  http.StatusOK,
+		},
+		{
+			name:    "page",
+			request: request{method: http.MethodGet, path: "/api/leaderboard"},
+			status:  http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				want := []string{"cat", "ann", "ben"}
+				if got := usernames(t, body["users"]); !equalStrings(got, want) {
+					t.Errorf("board is %v, want %v", got, want)
+				}
+			},
+		},
+		{
+			name:    "rank",
+			request: request{method: http.MethodGet, path: "/api/rank?username=ann"},
+			status:  http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				if rank := number(t, body, "rank"); rank != 2 {
+					t.Errorf("ann is at rank %d, want 2", rank)
+				}
+			},
+		},
+		{
+			name:    "profile",
+			request: request{method: http.MethodGet, path: "/api/users/cat"},
+			status:  http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				if rank := number(t, body, "rank"); rank != 1 {
+					t.Errorf("cat is at rank %d, want 1", rank)
+				}
+			},
+		},
+	})
+}
+
+func TestSetFeatureIsAudited(t *testing.T) {
+	ts := newTestServer(t, DefaultBoardConfig())
+	previous := features
+	features = NewFeatureFlags()
+	features.Set(FeatureRankTree, 100)
+	t.Cleanup(func() { features = previous })
+
+	ts.run([]step{
+		{
+			name:    "roll back the rank tree",
+			request: request{method: http.MethodPut, path: "/api/admin/features/" + FeatureRankTree, body: map[string]int{"percent": 40}, admin: true},
+			status:  http.StatusOK,
+		},
+		{
+			name:    "change is in the audit log",
+			request: request{method: http.MethodGet, path: "/api/admin/audit", admin: true},
+			status:  http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				entries, _ := body["entries"].([]any)
+				if len(entries) == 0 {
+					t.Fatal("audit log is empty")
+				}
+				latest := entries[0].(map[string]any)
+				if latest["action"] != "feature.set" || latest["target"] != FeatureRankTree {
+					t.Fatalf("latest audit entry is %v, want feature.set on %s", latest, FeatureRankTree)
+				}
+				if from, to := number(t, latest["details"], "from"), number(t, latest["details"], "to"); from != 100 || to != 40 {
+					t.Errorf("audit entry records %d%% to %d%%, want 100%% to 40%%", from, to)
+				}
+			},
+		},
+	})
+}
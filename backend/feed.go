@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// EventTopTen fires when a user enters the top 10
+	EventTopTen EventType = "top_ten"
+	// EventRecord fires when a user beats the best rating the board has seen
+	EventRecord EventType = "record"
+)
+
+const (
+	// feedSize is how many recent events the feed keeps
+	feedSize = 50
+	// feedTopN is how deep the top-entry milestone looks
+	feedTopN = 10
+)
+
+// eventFeed keeps the most recent board events, whether or not any
+// notifier is configured, for /feed.xml
+type eventFeed struct {
+	mu     sync.Mutex
+	events []feedEvent
+	seq    uint64
+}
+
+type feedEvent struct {
+	Event
+	seq uint64
+}
+
+var recentEvents = &eventFeed{}
+
+// add records an event, dropping the oldest past feedSize
+func (ef *eventFeed) add(event Event) {
+	ef.mu.Lock()
+	defer ef.mu.Unlock()
+	ef.seq++
+	ef.events = append(ef.events, feedEvent{Event: event, seq: ef.seq})
+	if extra := len(ef.events) - feedSize; extra > 0 {
+		ef.events = ef.events[extra:]
+	}
+}
+
+// latest returns the recorded events, newest first
+func (ef *eventFeed) latest() []feedEvent {
+	ef.mu.Lock()
+	defer ef.mu.Unlock()
+	latest := make([]feedEvent, len(ef.events))
+	for i, event := range ef.events {
+		latest[len(ef.events)-1-i] = event
+	}
+	return latest
+}
+
+// milestones remembers what the last re-rank saw, so the next one can tell
+// who is new to the top and whether the record moved
+type milestones struct {
+	top    map[string]bool
+	record int
+	seeded bool
+}
+
+// checkMilestones publishes top_ten and record events. The first run after
+// startup only takes note of the board. It runs after every rerank; lm.mu
+// must be held.
+func (lm *LeaderboardManager) checkMilestones() {
+	ranked := lm.ranked()
+	if len(ranked) == 0 {
+		return
+	}
+	ms := &lm.milestones
+	top := ranked[:min(len(ranked), feedTopN)]
+
+	best := top[0]
+	better := best.Rating > ms.record
+	if lm.config.LowerIsBetter {
+		better = best.Rating < ms.record
+	}
+	if ms.seeded && better {
+		notifications.Publish(EventRecord,
+			fmt.Sprintf("📈 %s set a new board record with a rating of %s, beating %s", best.Username, lm.FormatRating(best.Rating), lm.FormatRating(ms.record)))
+	}
+	if !ms.seeded || better {
+		ms.record = best.Rating
+	}
+
+	current := make(map[string]bool, len(top))
+	for _, user := range top {
+		current[user.Username] = true
+		// A newcomer straight to #1 is already announced as the new leader
+		if ms.seeded && !ms.top[user.Username] && user.Rank > 1 {
+			notifications.Publish(EventTopTen,
+				fmt.Sprintf("🔟 %s entered the top %d at #%d with a rating of %s", user.Username, feedTopN, user.Rank, lm.FormatRating(user.Rating)))
+		}
+	}
+	ms.top = current
+	ms.seeded = true
+}
+
+// atomFeed and atomEntry are the parts of RFC 4287 the feed uses
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title    string       `xml:"title"`
+	ID       string       `xml:"id"`
+	Updated  string       `xml:"updated"`
+	Category atomCategory `xml:"category"`
+	Summary  string       `xml:"summary"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// Handler: Atom feed of notable board events
+func getFeed(c *gin.Context) {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	self := scheme + "://" + c.Request.Host + "/feed.xml"
+
+	events := recentEvents.latest()
+	feed := atomFeed{
+		Title:   "Leaderboard events",
+		ID:      self,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Link:    atomLink{Href: self, Rel: "self"},
+		Author:  atomAuthor{Name: "Leaderboard"},
+		Entries: make([]atomEntry, len(events)),
+	}
+	if len(events) > 0 {
+		feed.Updated = events[0].Time.UTC().Format(time.RFC3339)
+	}
+	for i, event := range events {
+		feed.Entries[i] = atomEntry{
+			Title:    strings.ReplaceAll(string(event.Type), "_", " "),
+			ID:       fmt.Sprintf("%s#%d-%d", self, event.Time.Unix(), event.seq),
+			Updated:  event.Time.UTC().Format(time.RFC3339),
+			Category: atomCategory{Term: string(event.Type)},
+			Summary:  event.Message,
+		}
+	}
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		respond(c, 500, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(200, "application/atom+xml; charset=utf-8", append([]byte(xml.Header), body...))
+}
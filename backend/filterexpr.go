@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxFilterLength and maxFilterClauses bound how much work one filter
+	// expression can ask for
+	maxFilterLength  = 512
+	maxFilterClauses = 16
+)
+
+var (
+	filterAnd    = regexp.MustCompile(`(?i)\s+AND\s+`)
+	filterClause = regexp.MustCompile(`^([A-Za-z_]+)\s*(>=|<=|!=|=|>|<|:)\s*(\S+)$`)
+)
+
+// filterNumbers are the numeric fields a filter can compare
+var filterNumbers = map[string]func(*User) int{
+	"rating":  func(u *User) int { return u.Rating },
+	"rank":    func(u *User) int { return u.Rank },
+	"games":   func(u *User) int { return u.GamesPlayed },
+	"wins":    func(u *User) int { return u.Wins },
+	"updates": func(u *User) int { return u.Updates },
+}
+
+// filterTexts are the text fields a filter can test for equality
+var filterTexts = map[string]bool{"country": true, "region": true, "tag": true, "unranked": true}
+
+// clause is one condition of a filter expression
+type clause struct {
+	field  string
+	op     string
+	number int
+	text   string
+	within time.Duration
+}
+
+// FilterExpr is a parsed filter such as
+// "rating>2500 AND country=IN AND active_within:7d". Clauses are joined by
+// AND; there is deliberately no OR, grouping or free-form evaluation, so every
+// expression is a bounded conjunction of field tests.
+type FilterExpr struct {
+	clauses []clause
+}
+
+// ParseFilterExpr parses a filter expression. Numeric fields (rating, rank,
+// games, wins, updates) take =, !=, >, >=, < and <=; text fields (country,
+// region, tag, unranked) take = and !=; active_within:<duration> and
+// inactive_for:<duration> test when the user was last active. A region
+// matches everything inside it, and unranked=none matches ranked users.
+func ParseFilterExpr(s string) (*FilterExpr, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("filter is empty")
+	}
+	if len(s) > maxFilterLength {
+		return nil, fmt.Errorf("filter is longer than %d characters", maxFilterLength)
+	}
+	parts := filterAnd.Split(s, -1)
+	if len(parts) > maxFilterClauses {
+		return nil, fmt.Errorf("filter has more than %d clauses", maxFilterClauses)
+	}
+
+	expr := &FilterExpr{clauses: make([]clause, 0, len(parts))}
+	for _, part := range parts {
+		c, err := parseClause(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		expr.clauses = append(expr.clauses, c)
+	}
+	return expr, nil
+}
+
+func parseClause(s string) (clause, error) {
+	m := filterClause.FindStringSubmatch(s)
+	if m == nil {
+		return clause{}, fmt.Errorf("can't parse filter clause %q (expected e.g. rating>2500 or active_within:7d)", s)
+	}
+	c := clause{field: strings.ToLower(m[1]), op: m[2]}
+	value := m[3]
+
+	switch {
+	case c.field == "active_within" || c.field == "inactive_for":
+		if c.op != ":" {
+			return clause{}, fmt.Errorf("%s takes a duration, e.g. %s:7d", c.field, c.field)
+		}
+		d, err := ParseRetention(value)
+		if err != nil {
+			return clause{}, fmt.Errorf("invalid duration in %q (use e.g. 7d or 12h)", s)
+		}
+		c.within = d
+	case filterNumbers[c.field] != nil:
+		if c.op == ":" {
+			return clause{}, fmt.Errorf("%s needs a comparison, e.g. %s>=100", c.field, c.field)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return clause{}, fmt.Errorf("%s must be compared to a whole number, got %q", c.field, value)
+		}
+		c.number = n
+	case filterTexts[c.field]:
+		if c.op != "=" && c.op != "!=" {
+			return clause{}, fmt.Errorf("%s only supports = and !=", c.field)
+		}
+		text, err := normalizeFilterText(c.field, value)
+		if err != nil {
+			return clause{}, err
+		}
+		c.text = text
+	default:
+		return clause{}, fmt.Errorf("unknown filter field %q", c.field)
+	}
+	return c, nil
+}
+
+func normalizeFilterText(field, value string) (string, error) {
+	switch field {
+	case "country":
+		return ParseCountry(value)
+	case "region":
+		region, err := ParseRegion(value)
+		return regionKey(region), err
+	case "unranked":
+		if value == "none" {
+			return "", nil
+		}
+		reason, err := ParseUnrankedReason(strings.ToLower(value))
+		return string(reason), err
+	}
+	return value, nil
+}
+
+// Matches reports whether a user passes every clause at the given time
+func (expr *FilterExpr) Matches(user *User, now time.Time) bool {
+	for _, c := range expr.clauses {
+		if !c.matches(user, now) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c clause) matches(user *User, now time.Time) bool {
+	switch c.field {
+	case "active_within":
+		return now.Sub(user.LastActive) <= c.within
+	case "inactive_for":
+		return now.Sub(user.LastActive) >= c.within
+	case "country":
+		return (user.Country == c.text) == (c.op == "=")
+	case "region":
+		path := user.regionPath()
+		return (path != "" && regionContains(c.text, path)) == (c.op == "=")
+	case "unranked":
+		return (string(user.Unranked) == c.text) == (c.op == "=")
+	case "tag":
+		has := false
+		for _, tag := range user.Tags {
+			has = has || tag == c.text
+		}
+		return has == (c.op == "=")
+	}
+
+	// Unranked users have no rank to compare
+	if c.field == "rank" && user.Unranked != "" {
+		return false
+	}
+	value := filterNumbers[c.field](user)
+	switch c.op {
+	case "=":
+		return value == c.number
+	case "!=":
+		return value != c.number
+	case ">":
+		return value > c.number
+	case ">=":
+		return value >= c.number
+	case "<":
+		return value < c.number
+	}
+	return value <= c.number
+}
+
+// timeDependent reports whether matches change with the clock
+func (expr *FilterExpr) timeDependent() bool {
+	for _, c := range expr.clauses {
+		if c.field == "active_within" || c.field == "inactive_for" {
+			return true
+		}
+	}
+	return false
+}
+
+// scope returns the narrowest region an "=" clause confines matches to
+func (expr *FilterExpr) scope() string {
+	scope := ""
+	for _, c := range expr.clauses {
+		if c.op != "=" || (c.field != "country" && c.field != "region") {
+			continue
+		}
+		key := regionKey(c.text)
+		if strings.Count(key, "/") >= strings.Count(scope, "/") {
+			scope = key
+		}
+	}
+	return scope
+}
+
+// ratingBounds returns the inclusive rating range the clauses allow
+func (expr *FilterExpr) ratingBounds() (lo, hi int, bounded bool) {
+	lo, hi = math.MinInt, math.MaxInt
+	for _, c := range expr.clauses {
+		if c.field != "rating" {
+			continue
+		}
+		switch c.op {
+		case "=":
+			lo, hi = max(lo, c.number), min(hi, c.number)
+		case ">":
+			lo = max(lo, addSaturating(c.number, 1))
+		case ">=":
+			lo = max(lo, c.number)
+		case "<":
+			hi = min(hi, addSaturating(c.number, -1))
+		case "<=":
+			hi = min(hi, c.number)
+		default:
+			continue
+		}
+		bounded = true
+	}
+	return lo, hi, bounded
+}
+
+// candidates returns the users a filter could match in board order, narrowed
+// through the indexes: a region index when the filter names a country or
+// region, and a binary search of the ranked users when it bounds the rating
+// on a board ordered by rating. lm.mu must be held and ranks current.
+func (lm *LeaderboardManager) candidates(expr *FilterExpr, filter UnrankedFilter) []*User {
+	if scope := expr.scope(); scope != "" {
+		idx := lm.regionIndex(scope)
+		switch filter {
+		case UnrankedInclude:
+			return idx.sorted
+		case UnrankedOnly:
+			return idx.sorted[idx.rankedCount:]
+		}
+		return idx.sorted[:idx.rankedCount]
+	}
+
+	lo, hi, bounded := expr.ratingBounds()
+	if !bounded || filter == UnrankedOnly || !lm.rankedByRating() {
+		return lm.view(filter)
+	}
+	ranked := lm.ranked()
+	ascending := lm.config.SortKeys[0].Ascending
+	first := sort.Search(len(ranked), func(i int) bool {
+		if ascending {
+			return ranked[i].Rating >= lo
+		}
+		return ranked[i].Rating <= hi
+	})
+	end := sort.Search(len(ranked), func(i int) bool {
+		if ascending {
+			return ranked[i].Rating > hi
+		}
+		return ranked[i].Rating < lo
+	})
+	end = max(end, first)
+	if filter == UnrankedInclude {
+		// Unranked users aren't in rating order, so they are scanned
+		users := make([]*User, 0, end-first+len(lm.sortedUsers)-lm.rankedCount)
+		users = append(users, ranked[first:end]...)
+		return append(users, lm.sortedUsers[lm.rankedCount:]...)
+	}
+	return ranked[first:end]
+}
+
+// GetFilteredLeaderboard returns a page of the users matching a filter
+// expression, in board order, and how many match in total
+func (lm *LeaderboardManager) GetFilteredLeaderboard(expr *FilterExpr, page, pageSize int, filter UnrankedFilter) ([]User, int) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.recalculateRanks()
+
+	now := time.Now()
+	start := (page - 1) * pageSize
+	result := make([]User, 0, pageSize)
+	total := 0
+	for _, user := range lm.candidates(expr, filter) {
+		if !expr.Matches(user, now) {
+			continue
+		}
+		if total >= start && len(result) < pageSize {
+			result = append(result, user.snapshot())
+		}
+		total++
+	}
+	return result, total
+}
+
+// filterExprParam reads the filter query parameter, responding with a 400
+// and returning false when it is invalid. It returns nil when there is none.
+func filterExprParam(c *gin.Context) (*FilterExpr, bool) {
+	s := c.Query("filter")
+	if s == "" {
+		return nil, true
+	}
+	expr, err := ParseFilterExpr(s)
+	if err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return expr, true
+}
+
+// getFilteredLeaderboard serves /api/leaderboard with ?filter=; a ?region=
+// scope is added to the expression
+func getFilteredLeaderboard(c *gin.Context, expr *FilterExpr, page, pageSize int, filter UnrankedFilter) {
+	if c.Query("region") != "" {
+		region, err := ParseRegion(c.Query("region"))
+		if err != nil {
+			respond(c, 400, gin.H{"error": err.Error()})
+			return
+		}
+		expr.clauses = append(expr.clauses, clause{field: "region", op: "=", text: regionKey(region)})
+	}
+
+	version := leaderboard.Version()
+	users, total := leaderboard.GetFilteredLeaderboard(expr, page, pageSize, filter)
+	setListHeaders(c, total, version)
+
+	response := gin.H{
+		"users":      users,
+		"totalUsers": total,
+		"filter":     c.Query("filter"),
+		"ordering":   leaderboard.Ordering(),
+		"display":    leaderboard.Display(),
+	}
+	addPagination(response, c, page, pageSize, total)
+	respond(c, 200, response)
+}
+
+// filterSearchResults keeps the search results matching an expression, in order
+func filterSearchResults(results []SearchResult, expr *FilterExpr) []SearchResult {
+	now := time.Now()
+	matched := make([]SearchResult, 0, len(results))
+	for i := range results {
+		if expr.Matches(&results[i].User, now) {
+			matched = append(matched, results[i])
+		}
+	}
+	return matched
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// UserFilter selects users by rating range, inactivity and country. Every
+// criterion that is set must match.
+type UserFilter struct {
+	MinRating *int `json:"minRating,omitempty"`
+	MaxRating *int `json:"maxRating,omitempty"`
+	// InactiveFor matches users not active for at least this long, e.g. 30d
+	InactiveFor string `json:"inactiveFor,omitempty"`
+	Country     string `json:"country,omitempty"`
+
+	inactiveFor time.Duration
+}
+
+// Validate checks the filter and normalizes it. A filter must set at least
+// one criterion, so an empty body can't select the whole board by accident.
+func (f *UserFilter) Validate() error {
+	if f.MinRating == nil && f.MaxRating == nil && f.InactiveFor == "" && f.Country == "" {
+		return fmt.Errorf("filter must set at least one of minRating, maxRating, inactiveFor or country")
+	}
+	if f.MinRating != nil && f.MaxRating != nil && *f.MinRating > *f.MaxRating {
+		return fmt.Errorf("minRating %d is greater than maxRating %d", *f.MinRating, *f.MaxRating)
+	}
+	if f.InactiveFor != "" {
+		d, err := ParseRetention(f.InactiveFor)
+		if err != nil {
+			return fmt.Errorf("invalid inactiveFor %q (use e.g. 30d or 12h)", f.InactiveFor)
+		}
+		f.inactiveFor = d
+	}
+	if f.Country != "" {
+		country, err := ParseCountry(f.Country)
+		if err != nil {
+			return err
+		}
+		f.Country = country
+	}
+	return nil
+}
+
+// Matches reports whether a user passes the filter at the given time
+func (f *UserFilter) Matches(user *User, now time.Time) bool {
+	if f.MinRating != nil && user.Rating < *f.MinRating {
+		return false
+	}
+	if f.MaxRating != nil && user.Rating > *f.MaxRating {
+		return false
+	}
+	if f.InactiveFor != "" && now.Sub(user.LastActive) < f.inactiveFor {
+		return false
+	}
+	if f.Country != "" && user.Country != f.Country {
+		return false
+	}
+	return true
+}
+
+// MatchUsers returns the names of users passing the filter, in no particular order
+func (lm *LeaderboardManager) MatchUsers(filter *UserFilter) []string {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	now := time.Now()
+	matched := make([]string, 0)
+	for username, user := range lm.users {
+		if filter.Matches(user, now) {
+			matched = append(matched, username)
+		}
+	}
+	return matched
+}
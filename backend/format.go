@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ScoreFormat is how a board's ratings are meant to be shown. Ratings are
+// always stored and sent as integers; the format says what they stand for.
+type ScoreFormat string
+
+const (
+	// ScoreFormatInteger shows ratings as they are
+	ScoreFormatInteger ScoreFormat = "integer"
+	// ScoreFormatDecimal2 stores ratings in hundredths and shows two decimals
+	ScoreFormatDecimal2 ScoreFormat = "decimal2"
+	// ScoreFormatTime stores ratings in seconds and shows them as m:ss, or
+	// h:mm:ss from an hour up
+	ScoreFormatTime ScoreFormat = "time"
+)
+
+// ParseScoreFormat validates a --score-format value
+func ParseScoreFormat(s string) (ScoreFormat, error) {
+	switch format := ScoreFormat(s); format {
+	case ScoreFormatInteger, ScoreFormatDecimal2, ScoreFormatTime:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown score format %q (expected %q, %q or %q)", s, ScoreFormatInteger, ScoreFormatDecimal2, ScoreFormatTime)
+}
+
+// DisplayFormat describes how clients should render the board's ratings
+type DisplayFormat struct {
+	Format ScoreFormat `json:"format"`
+	// Scale is what a rating is divided by before showing it
+	Scale         int  `json:"scale"`
+	Decimals      int  `json:"decimals"`
+	LowerIsBetter bool `json:"lowerIsBetter"`
+}
+
+// Display returns the board's rating display descriptor
+func (cfg BoardConfig) Display() DisplayFormat {
+	display := DisplayFormat{Format: cfg.scoreFormat(), Scale: 1, LowerIsBetter: cfg.LowerIsBetter}
+	if display.Format == ScoreFormatDecimal2 {
+		display.Scale, display.Decimals = 100, 2
+	}
+	return display
+}
+
+func (cfg BoardConfig) scoreFormat() ScoreFormat {
+	if cfg.ScoreFormat == "" {
+		return ScoreFormatInteger
+	}
+	return cfg.ScoreFormat
+}
+
+// FormatRating renders a rating the way the board's format describes, for
+// text the server writes itself: chat replies, feeds and digests
+func (cfg BoardConfig) FormatRating(rating int) string {
+	switch cfg.scoreFormat() {
+	case ScoreFormatDecimal2:
+		sign, abs := "", int64(rating)
+		if abs < 0 {
+			sign, abs = "-", -abs
+		}
+		return fmt.Sprintf("%s%d.%02d", sign, abs/100, abs%100)
+	case ScoreFormatTime:
+		sign, secs := "", int64(rating)
+		if secs < 0 {
+			sign, secs = "-", -secs
+		}
+		if secs >= 3600 {
+			return fmt.Sprintf("%s%d:%02d:%02d", sign, secs/3600, secs/60%60, secs%60)
+		}
+		return fmt.Sprintf("%s%d:%02d", sign, secs/60, secs%60)
+	}
+	return strconv.Itoa(rating)
+}
+
+// Display returns the rating display descriptor for API responses
+func (lm *LeaderboardManager) Display() DisplayFormat {
+	return lm.config.Display()
+}
+
+// FormatRating renders a rating in the board's display format
+func (lm *LeaderboardManager) FormatRating(rating int) string {
+	return lm.config.FormatRating(rating)
+}
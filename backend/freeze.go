@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFreezeReason bounds the reason shown with a freeze
+const maxFreezeReason = 500
+
+var errBoardFrozen = errors.New("ratings are frozen")
+
+// FreezeState is whether rating changes are frozen, and why
+type FreezeState struct {
+	Frozen bool       `json:"frozen"`
+	Reason string     `json:"reason,omitempty"`
+	Since  *time.Time `json:"since,omitempty"`
+	By     string     `json:"by,omitempty"`
+}
+
+// boardFreeze holds the freeze state. It is read on every write, so it is
+// swapped atomically rather than locked.
+type boardFreeze struct {
+	state atomic.Pointer[FreezeState]
+}
+
+var freeze = &boardFreeze{}
+
+// active reports whether ratings are frozen
+func (bf *boardFreeze) active() bool {
+	state := bf.state.Load()
+	return state != nil && state.Frozen
+}
+
+// current returns the freeze state
+func (bf *boardFreeze) current() FreezeState {
+	if state := bf.state.Load(); state != nil {
+		return *state
+	}
+	return FreezeState{}
+}
+
+// respondFrozen rejects a rating change with 423 Locked while frozen,
+// reporting whether it did
+func respondFrozen(c *gin.Context) bool {
+	if !freeze.active() {
+		return false
+	}
+	state := freeze.current()
+	respond(c, 423, gin.H{"error": errBoardFrozen.Error(), "reason": state.Reason, "since": state.Since})
+	return true
+}
+
+// Handler: Freeze rating changes; reads carry on as normal
+func freezeBoard(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, 400, gin.H{"error": "a reason is required"})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" || len(reason) > maxFreezeReason {
+		respond(c, 400, gin.H{"error": "reason must be between 1 and 500 characters"})
+		return
+	}
+
+	now := time.Now()
+	state := &FreezeState{Frozen: true, Reason: reason, Since: &now, By: clientID(c)}
+	freeze.state.Store(state)
+	auditLog.Record(c, "board.freeze", "*", gin.H{"reason": reason})
+	respond(c, 200, state)
+}
+
+// Handler: Let rating changes through again
+func unfreezeBoard(c *gin.Context) {
+	if !freeze.active() {
+		respond(c, 409, gin.H{"error": "ratings are not frozen"})
+		return
+	}
+	previous := freeze.current()
+	freeze.state.Store(nil)
+	auditLog.Record(c, "board.unfreeze", "*", gin.H{"reason": previous.Reason, "frozenFor": time.Since(*previous.Since).Round(time.Second).String()})
+	respond(c, 200, freeze.current())
+}
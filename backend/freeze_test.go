@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFreezeBlocksStandingChanges(t *testing.T) {
+	ts := newTestServer(t, DefaultBoardConfig())
+	t.Cleanup(func() { freeze.state.Store(nil) })
+	ts.createUsers(map[string]int{"ann": 1400, "ben": 1300, "cat": 1200, "dan": 1100})
+	ts.expect(request{method: http.MethodDelete, path: "/api/admin/users/dan", admin: true}, http.StatusOK)
+	ts.expect(request{method: http.MethodPut, path: "/api/admin/users/cat/unranked", body: gin.H{"reason": "banned"}, admin: true}, http.StatusOK)
+
+	frozen := func(name string, req request) step {
+		req.admin = true
+		return step{name: name, request: req, status: http.StatusLocked}
+	}
+	ts.run([]step{
+		{
+			name:    "freeze",
+			request: request{method: http.MethodPut, path: "/api/admin/freeze", body: gin.H{"reason": "finals"}, admin: true},
+			status:  http.StatusOK,
+		},
+		frozen("soft delete", request{method: http.MethodDelete, path: "/api/admin/users/ann"}),
+		frozen("hard delete", request{method: http.MethodDelete, path: "/api/users/ann"}),
+		frozen("restore", request{method: http.MethodPost, path: "/api/admin/users/dan/restore"}),
+		frozen("unrank", request{method: http.MethodPut, path: "/api/admin/users/ben/unranked", body: gin.H{"reason": "banned"}}),
+		frozen("rerank", request{method: http.MethodDelete, path: "/api/admin/users/cat/unranked"}),
+		frozen("set rating", request{method: http.MethodPut, path: "/api/users/ann/rating", body: gin.H{"rating": 1000}}),
+		{
+			name:    "dry runs still preview",
+			request: request{method: http.MethodPut, path: "/api/admin/users/ben/unranked?dryRun=true", body: gin.H{"reason": "banned"}, admin: true},
+			status:  http.StatusOK,
+		},
+		{
+			name:    "standings are unchanged",
+			request: request{method: http.MethodGet, path: "/api/leaderboard"},
+			status:  http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				want := []string{"ann", "ben"}
+				if got := usernames(t, body["users"]); !equalStrings(got, want) {
+					t.Errorf("board is %v, want %v", got, want)
+				}
+			},
+		},
+	})
+
+	t.Run("record game", func(t *testing.T) {
+		if err := leaderboard.RecordGame("ann", true); err != errBoardFrozen {
+			t.Errorf("RecordGame during a freeze returned %v, want %v", err, errBoardFrozen)
+		}
+	})
+
+	ts.run([]step{
+		{
+			name:    "unfreeze",
+			request: request{method: http.MethodDelete, path: "/api/admin/freeze", admin: true},
+			status:  http.StatusOK,
+		},
+		{
+			name:    "restore once unfrozen",
+			request: request{method: http.MethodPost, path: "/api/admin/users/dan/restore", admin: true},
+			status:  http.StatusOK,
+		},
+		{
+			name:    "rerank once unfrozen",
+			request: request{method: http.MethodDelete, path: "/api/admin/users/cat/unranked", admin: true},
+			status:  http.StatusOK,
+		},
+	})
+	if err := leaderboard.RecordGame("ann", true); err != nil {
+		t.Errorf("RecordGame after the freeze: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// simulatorJob is the background job name the score simulator runs under
+const simulatorJob = "score simulator"
+
+// Dependency statuses; disabled means the dependency isn't configured
+const (
+	DependencyOK       = "ok"
+	DependencyDegraded = "degraded"
+	DependencyDown     = "down"
+	DependencyDisabled = "disabled"
+)
+
+// DependencyStatus is the health of one thing the server relies on
+type DependencyStatus struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	Detail      string     `json:"detail,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+type dependencyCheck struct {
+	name  string
+	check func() DependencyStatus
+}
+
+// dependencyRegistry lists the dependencies the health endpoint reports on
+type dependencyRegistry struct {
+	mu     sync.Mutex
+	checks []dependencyCheck
+}
+
+var dependencies = &dependencyRegistry{}
+
+// register adds a dependency; check is called on every health request and
+// needn't fill in the name
+func (r *dependencyRegistry) register(name string, check func() DependencyStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, dependencyCheck{name: name, check: check})
+}
+
+// statuses checks every dependency in registration order and sums them up:
+// down if any dependency is down, degraded if any is degraded, else healthy
+func (r *dependencyRegistry) statuses() ([]DependencyStatus, string) {
+	r.mu.Lock()
+	checks := append([]dependencyCheck(nil), r.checks...)
+	r.mu.Unlock()
+
+	overall := "healthy"
+	statuses := make([]DependencyStatus, len(checks))
+	for i, dc := range checks {
+		statuses[i] = dc.check()
+		statuses[i].Name = dc.name
+		switch statuses[i].Status {
+		case DependencyDown:
+			overall = DependencyDown
+		case DependencyDegraded:
+			if overall != DependencyDown {
+				overall = DependencyDegraded
+			}
+		}
+	}
+	return statuses, overall
+}
+
+// registerDependencies sets up the built-in health checks
+func registerDependencies() {
+	dependencies.register("storage", func() DependencyStatus { return persistence.health() })
+	dependencies.register("event bus", func() DependencyStatus { return notifications.health() })
+	dependencies.register("push", func() DependencyStatus { return pushes.health() })
+	dependencies.register("scheduler", schedulerHealth)
+	dependencies.register("simulator", simulatorHealth)
+}
+
+// health reports on notification delivery: degraded while any sink's latest
+// delivery failed or events are being dropped for a full queue
+func (n *Notifications) health() DependencyStatus {
+	if n == nil {
+		return DependencyStatus{Status: DependencyDisabled}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	status := DependencyStatus{
+		Status: DependencyOK,
+		Detail: fmt.Sprintf("%d sink(s), %d/%d queued, %d dropped", len(n.sinks), len(n.queue), cap(n.queue), n.dropped),
+	}
+	if len(n.queue) == cap(n.queue) {
+		status.Status = DependencyDegraded
+	}
+	for _, h := range n.deliveries {
+		if h.failing {
+			status.Status = DependencyDegraded
+		}
+		if h.lastError != "" && (status.LastErrorAt == nil || h.lastErrorAt.After(*status.LastErrorAt)) {
+			at := h.lastErrorAt
+			status.LastError, status.LastErrorAt = h.lastError, &at
+		}
+	}
+	return status
+}
+
+// schedulerHealth is degraded while any background job is overdue
+func schedulerHealth() DependencyStatus {
+	status := DependencyStatus{Status: DependencyOK}
+	jobs := 0
+	for _, job := range backgroundJobs.statuses() {
+		if job.Name == simulatorJob {
+			continue
+		}
+		jobs++
+		if job.Overdue {
+			status.Status = DependencyDegraded
+			status.LastError = fmt.Sprintf("%s is overdue (every %s)", job.Name, job.Interval)
+			status.LastErrorAt = job.LastRun
+		}
+	}
+	status.Detail = fmt.Sprintf("%d job(s)", jobs)
+	return status
+}
+
+// simulatorHealth is degraded when the score simulator stops ticking
+func simulatorHealth() DependencyStatus {
+	job, running := backgroundJobs.status(simulatorJob)
+	if !running {
+		return DependencyStatus{Status: DependencyDisabled}
+	}
+	state, since := simulator.status()
+	status := DependencyStatus{Status: DependencyOK, Detail: fmt.Sprintf("%s, %d ticks", state, job.Runs)}
+	if state != SimulatorRunning && state != "" {
+		status.Detail += fmt.Sprintf(" (since %s)", since.Format(time.RFC3339))
+	}
+	if job.Overdue {
+		status.Status = DependencyDegraded
+		status.LastError = fmt.Sprintf("no update since %s", job.LastRun.Format(time.RFC3339))
+		status.LastErrorAt = job.LastRun
+	}
+	return status
+}
+
+// Handler: Health of the server and each of its dependencies
+func getHealth(c *gin.Context) {
+	statuses, overall := dependencies.statuses()
+	code := 200
+	if overall == DependencyDown {
+		code = 503
+	}
+	respond(c, code, gin.H{
+		"status":       overall,
+		"dependencies": statuses,
+	})
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRatingHistory is how many rating changes are kept per user
+const maxRatingHistory = 100
+
+// RatingEntry is a rating a user held from a point in time onwards
+type RatingEntry struct {
+	Rating  int       `json:"rating"`
+	At      time.Time `json:"at"`
+	Version uint64    `json:"version"`
+}
+
+// ratingLog is one user's rating history, oldest first
+type ratingLog struct {
+	entries []RatingEntry
+	// trimmed is set once older entries have been dropped, after which the
+	// first entry is no longer the rating the user joined with
+	trimmed bool
+	// rollups downsample every recorded rating per resolution name, and
+	// reach back much further than the raw entries
+	rollups map[string][]RatingRollup
+}
+
+// recordRating appends to a user's rating history, logs the change to
+// storage and queues local changes for peer regions; lm.mu must be held.
+// The entry carries the board version the change will produce once marked.
+func (lm *LeaderboardManager) recordRating(user *User, rating int, at time.Time) {
+	lm.appendRating(user.Username, RatingEntry{
+		Rating:  rating,
+		At:      at,
+		Version: lm.Version() + 1,
+	})
+	lm.persist(OpRating, user, rating, at)
+	lm.replicateLocked(ReplicatedRating, user.Username, rating, at)
+}
+
+// appendRating adds an entry to a user's rating history and rollups,
+// dropping the oldest past maxRatingHistory; lm.mu must be held
+func (lm *LeaderboardManager) appendRating(username string, entry RatingEntry) {
+	rl, exists := lm.ratingHistory[username]
+	if !exists {
+		rl = &ratingLog{}
+		lm.ratingHistory[username] = rl
+	}
+	rl.entries = append(rl.entries, entry)
+	if extra := len(rl.entries) - maxRatingHistory; extra > 0 {
+		rl.entries = rl.entries[extra:]
+		rl.trimmed = true
+	}
+	rl.addRollups(entry.Rating, entry.At)
+}
+
+// RatingHistory returns a user's recorded ratings, oldest first
+func (lm *LeaderboardManager) RatingHistory(username string) ([]RatingEntry, bool) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	if _, exists := lm.users[username]; !exists {
+		return nil, false
+	}
+	history := make([]RatingEntry, 0)
+	if rl, ok := lm.ratingHistory[username]; ok {
+		history = append(history, rl.entries...)
+	}
+	return history, true
+}
+
+// RollbackTarget picks a point in a user's rating history, by time or board version
+type RollbackTarget struct {
+	At      time.Time
+	Version uint64
+}
+
+// ParseRollbackTarget reads a board version number or an RFC 3339 timestamp
+func ParseRollbackTarget(s string) (RollbackTarget, error) {
+	if version, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return RollbackTarget{Version: version}, nil
+	}
+	at, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return RollbackTarget{}, fmt.Errorf("'to' must be a board version or an RFC 3339 timestamp")
+	}
+	return RollbackTarget{At: at}, nil
+}
+
+// covers reports whether an entry was already in effect at the target
+func (t RollbackTarget) covers(entry RatingEntry) bool {
+	return t.coversPoint(entry.At, entry.Version)
+}
+
+// coversSnapshot reports whether a snapshot was taken by the target
+func (t RollbackTarget) coversSnapshot(snapshot *BoardSnapshot) bool {
+	return t.coversPoint(snapshot.TakenAt, snapshot.Version)
+}
+
+// coversPoint reports whether a change made at a time, producing a board
+// version, happened by the target
+func (t RollbackTarget) coversPoint(at time.Time, version uint64) bool {
+	if t.At.IsZero() {
+		return version <= t.Version
+	}
+	return !at.After(t.At)
+}
+
+// at finds the entry in effect at the target; false means the target
+// predates the history
+func (rl *ratingLog) at(target RollbackTarget) (RatingEntry, bool) {
+	if rl == nil {
+		return RatingEntry{}, false
+	}
+	i := sort.Search(len(rl.entries), func(i int) bool { return !target.covers(rl.entries[i]) })
+	if i == 0 {
+		return RatingEntry{}, false
+	}
+	return rl.entries[i-1], true
+}
+
+// RollbackRating restores the rating a user held at the target, returning
+// the change and the history entry restored. It fails when the target
+// predates the retained history. With dryRun it only reports the change.
+func (lm *LeaderboardManager) RollbackRating(username string, target RollbackTarget, dryRun bool) (RatingChange, RatingEntry, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if !dryRun && freeze.active() {
+		return RatingChange{}, RatingEntry{}, errBoardFrozen
+	}
+	user, exists := lm.users[username]
+	if !exists {
+		return RatingChange{}, RatingEntry{}, errUserNotFound
+	}
+	if !dryRun {
+		lm.flushPendingLocked()
+	}
+
+	restored, ok := lm.ratingHistory[username].at(target)
+	if !ok {
+		return RatingChange{}, RatingEntry{}, fmt.Errorf("no rating recorded for %s at or before that point", username)
+	}
+
+	change := lm.previewRating(user, restored.Rating)
+	if dryRun {
+		return change, restored, nil
+	}
+	lm.setRating(user, restored.Rating)
+	lm.recordRating(user, user.Rating, time.Now())
+	lm.markChanged()
+	return change, restored, nil
+}
+
+// Handler: Get a user's rating history, raw or rolled up by hour or day
+func getRatingHistory(c *gin.Context) {
+	res, err := ParseRollupResolution(c.Query("resolution"))
+	if err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+	if res != nil {
+		rollups, ok := leaderboard.RatingRollups(c.Param("username"), res)
+		if !ok {
+			respond(c, 404, gin.H{"error": "user not found"})
+			return
+		}
+		respond(c, 200, gin.H{"rollups": rollups, "resolution": res.name, "count": len(rollups)})
+		return
+	}
+
+	history, ok := leaderboard.RatingHistory(c.Param("username"))
+	if !ok {
+		respond(c, 404, gin.H{"error": "user not found"})
+		return
+	}
+	respond(c, 200, gin.H{"history": history, "count": len(history)})
+}
+
+// Handler: Restore a user's rating to what it was at a time or board version
+func rollbackRating(c *gin.Context) {
+	to := c.Query("to")
+	if to == "" {
+		respond(c, 400, gin.H{"error": "query parameter 'to' is required"})
+		return
+	}
+	target, err := ParseRollbackTarget(to)
+	if err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	username := c.Param("username")
+	dryRun, ok := isDryRun(c)
+	if !ok {
+		return
+	}
+	change, restored, err := leaderboard.RollbackRating(username, target, dryRun)
+	if err == errUserNotFound {
+		respond(c, 404, gin.H{"error": "user not found"})
+		return
+	}
+	if err == errBoardFrozen {
+		respondFrozen(c)
+		return
+	}
+	if err != nil {
+		respond(c, 409, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !dryRun {
+		auditLog.Record(c, "rating.rollback", username, gin.H{
+			"to":             to,
+			"previousRating": change.OldRating,
+			"restoredRating": restored.Rating,
+			"restoredFrom":   restored.At,
+		})
+	}
+	respond(c, 200, gin.H{
+		"username":       username,
+		"previousRating": change.OldRating,
+		"rating":         restored.Rating,
+		"previousRank":   change.OldRank,
+		"rank":           change.NewRank,
+		"restoredFrom":   restored,
+		"dryRun":         dryRun,
+	})
+}
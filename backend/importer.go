@@ -0,0 +1,407 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxImportHandles caps how many handles one import job may fetch
+	maxImportHandles = 10000
+	// maxImportErrors caps how many per-handle errors a job reports
+	maxImportErrors = 50
+	// maxImportJobs caps how many finished imports are kept for status queries
+	maxImportJobs = 50
+	// maxUsernameLength bounds usernames created by imports
+	maxUsernameLength = 64
+)
+
+var (
+	codeforcesAPI = "https://codeforces.com/api"
+	chessComAPI   = "https://api.chess.com/pub"
+)
+
+var importClient = &http.Client{Timeout: 15 * time.Second}
+
+// ratingSource fetches current ratings for handles on an external platform
+type ratingSource interface {
+	// batchSize is how many handles one request can look up
+	batchSize() int
+	// interval is the least time between requests, per the platform's rate limits
+	interval() time.Duration
+	// fetch returns the rating of each handle found; unknown or unrated
+	// handles are missing from the result
+	fetch(handles []string) (map[string]int, error)
+}
+
+// getJSON fetches a URL and decodes the JSON response into v
+func getJSON(rawURL string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	// chess.com rejects requests without a descriptive user agent
+	req.Header.Set("User-Agent", "leaderboard-backend rating importer")
+	resp, err := importClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errHandleNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+var errHandleNotFound = errors.New("handle not found")
+
+// codeforcesSource reads ratings from Codeforces' user.info, which asks
+// clients to make at most one request every two seconds
+type codeforcesSource struct{}
+
+func (codeforcesSource) batchSize() int          { return 100 }
+func (codeforcesSource) interval() time.Duration { return 2 * time.Second }
+
+func (codeforcesSource) fetch(handles []string) (map[string]int, error) {
+	var body struct {
+		Status  string `json:"status"`
+		Comment string `json:"comment"`
+		Result  []struct {
+			Handle string `json:"handle"`
+			Rating *int   `json:"rating"`
+		} `json:"result"`
+	}
+	if err := getJSON(codeforcesAPI+"/user.info?handles="+url.QueryEscape(strings.Join(handles, ";")), &body); err != nil {
+		return nil, err
+	}
+	if body.Status != "OK" {
+		if strings.Contains(body.Comment, "not found") {
+			return nil, errHandleNotFound
+		}
+		return nil, fmt.Errorf("codeforces: %s", body.Comment)
+	}
+	ratings := make(map[string]int, len(body.Result))
+	for _, user := range body.Result {
+		if user.Rating != nil {
+			ratings[strings.ToLower(user.Handle)] = *user.Rating
+		}
+	}
+	return ratings, nil
+}
+
+// chessComSource reads one time control's latest rating from chess.com's
+// player stats, one handle per request
+type chessComSource struct {
+	category string
+}
+
+func (chessComSource) batchSize() int          { return 1 }
+func (chessComSource) interval() time.Duration { return 250 * time.Millisecond }
+
+func (s chessComSource) fetch(handles []string) (map[string]int, error) {
+	ratings := make(map[string]int, len(handles))
+	for _, handle := range handles {
+		var stats map[string]struct {
+			Last struct {
+				Rating int `json:"rating"`
+			} `json:"last"`
+		}
+		if err := getJSON(chessComAPI+"/player/"+url.PathEscape(strings.ToLower(handle))+"/stats", &stats); err != nil {
+			return nil, err
+		}
+		if stat, ok := stats["chess_"+s.category]; ok && stat.Last.Rating > 0 {
+			ratings[strings.ToLower(handle)] = stat.Last.Rating
+		}
+	}
+	return ratings, nil
+}
+
+// ratingSourceFor builds a source by name; option is the chess.com time control
+func ratingSourceFor(name, option string) (ratingSource, error) {
+	switch name {
+	case "codeforces":
+		return codeforcesSource{}, nil
+	case "chesscom":
+		switch option {
+		case "":
+			option = "rapid"
+		case "rapid", "blitz", "bullet", "daily":
+		default:
+			return nil, fmt.Errorf("unknown chess.com category %q (expected rapid, blitz, bullet or daily)", option)
+		}
+		return chessComSource{category: option}, nil
+	}
+	return nil, fmt.Errorf("unknown source %q (expected codeforces or chesscom)", name)
+}
+
+// HandleMapping links an external handle to a username on the board;
+// Username defaults to the handle
+type HandleMapping struct {
+	Handle   string `json:"handle"`
+	Username string `json:"username,omitempty"`
+}
+
+// ImportJob is an import running in the background
+type ImportJob struct {
+	ID       string `json:"id"`
+	Source   string `json:"source"`
+	Category string `json:"category,omitempty"`
+	// CreateMissing adds users who aren't on the board yet; otherwise they are skipped
+	CreateMissing bool   `json:"createMissing"`
+	Status        string `json:"status"`
+	Total         int    `json:"total"`
+	Processed     int    `json:"processed"`
+	Created       int    `json:"created"`
+	Updated       int    `json:"updated"`
+	// Skipped counts handles without a rating and users not on the board
+	Skipped    int        `json:"skipped"`
+	Failed     int        `json:"failed"`
+	Errors     []string   `json:"errors"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// importJobs holds running and recently finished imports, keyed by id
+type importJobs struct {
+	mu    sync.Mutex
+	jobs  map[string]*ImportJob
+	order []string
+}
+
+var imports = &importJobs{jobs: make(map[string]*ImportJob)}
+
+// add registers a new job, dropping the oldest finished ones over the cap
+func (ij *importJobs) add(job *ImportJob) error {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	job.ID = hex.EncodeToString(raw)
+
+	ij.mu.Lock()
+	defer ij.mu.Unlock()
+	ij.jobs[job.ID] = job
+	ij.order = append(ij.order, job.ID)
+	for i := 0; len(ij.jobs) > maxImportJobs && i < len(ij.order); {
+		if old := ij.jobs[ij.order[i]]; old.Status != "running" {
+			delete(ij.jobs, old.ID)
+			ij.order = append(ij.order[:i], ij.order[i+1:]...)
+			continue
+		}
+		i++
+	}
+	return nil
+}
+
+// get returns a copy of a job's current state
+func (ij *importJobs) get(id string) (ImportJob, bool) {
+	ij.mu.Lock()
+	defer ij.mu.Unlock()
+	job, ok := ij.jobs[id]
+	if !ok {
+		return ImportJob{}, false
+	}
+	copied := *job
+	copied.Errors = append([]string(nil), job.Errors...)
+	return copied, true
+}
+
+// update changes a job under the registry lock
+func (ij *importJobs) update(job *ImportJob, change func(*ImportJob)) {
+	ij.mu.Lock()
+	defer ij.mu.Unlock()
+	change(job)
+}
+
+// fail records a handle that couldn't be imported
+func (job *ImportJob) fail(handle string, err error) {
+	job.Failed++
+	if len(job.Errors) < maxImportErrors {
+		job.Errors = append(job.Errors, fmt.Sprintf("%s: %v", handle, err))
+	}
+}
+
+// ImportRatings sets fetched ratings on the board, adding users when create
+// is set. It returns how many users were created and updated, and which
+// usernames were skipped for not being on the board.
+func (lm *LeaderboardManager) ImportRatings(ratings map[string]int, create bool) (created, updated int, skipped []string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if freeze.active() {
+		for username := range ratings {
+			skipped = append(skipped, username)
+		}
+		return 0, 0, skipped
+	}
+	lm.flushPendingLocked()
+
+	for username, rating := range ratings {
+		user, exists := lm.users[username]
+		switch {
+		case exists:
+			lm.applyRating(user, lm.config.clampRating(rating))
+			updated++
+		case create && lm.addUserLocked(username, rating) == nil:
+			created++
+		default:
+			skipped = append(skipped, username)
+		}
+	}
+	return created, updated, skipped
+}
+
+// runImport fetches ratings batch by batch, waiting out the source's rate
+// limit between requests. A failed batch is retried one handle at a time,
+// so one bad handle doesn't sink the rest.
+func (lm *LeaderboardManager) runImport(job *ImportJob, source ratingSource, mappings []HandleMapping) {
+	var last time.Time
+	throttle := func() {
+		if wait := source.interval() - time.Since(last); wait > 0 {
+			time.Sleep(wait)
+		}
+		last = time.Now()
+	}
+
+	for start := 0; start < len(mappings); start += source.batchSize() {
+		batch := mappings[start:min(start+source.batchSize(), len(mappings))]
+		handles := make([]string, len(batch))
+		for i, m := range batch {
+			handles[i] = m.Handle
+		}
+
+		throttle()
+		found, err := source.fetch(handles)
+		failed := make(map[string]error)
+		if err != nil && len(batch) > 1 {
+			found = make(map[string]int)
+			for _, handle := range handles {
+				throttle()
+				one, err := source.fetch([]string{handle})
+				if err != nil {
+					failed[handle] = err
+				}
+				for h, rating := range one {
+					found[h] = rating
+				}
+			}
+		} else if err != nil {
+			failed[handles[0]] = err
+		}
+
+		ratings := make(map[string]int, len(found))
+		for _, m := range batch {
+			if rating, ok := found[strings.ToLower(m.Handle)]; ok {
+				ratings[m.Username] = rating
+			}
+		}
+		created, updated, skipped := lm.ImportRatings(ratings, job.CreateMissing)
+
+		imports.update(job, func(job *ImportJob) {
+			job.Processed += len(batch)
+			job.Created += created
+			job.Updated += updated
+			job.Skipped += len(batch) - len(ratings) - len(failed) + len(skipped)
+			for _, handle := range handles {
+				if err, ok := failed[handle]; ok {
+					job.fail(handle, err)
+				}
+			}
+		})
+	}
+
+	imports.update(job, func(job *ImportJob) {
+		now := time.Now()
+		job.Status = "done"
+		job.FinishedAt = &now
+	})
+	log.Printf("📥 Imported %s ratings: %d created, %d updated, %d failed", job.Source, job.Created, job.Updated, job.Failed)
+}
+
+// Handler: Start importing ratings from an external platform
+func startImport(c *gin.Context) {
+	var req struct {
+		Source        string          `json:"source"`
+		Category      string          `json:"category"`
+		CreateMissing bool            `json:"createMissing"`
+		Mappings      []HandleMapping `json:"mappings"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, 400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	source, err := ratingSourceFor(req.Source, req.Category)
+	if err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+	if respondFrozen(c) {
+		return
+	}
+	if len(req.Mappings) == 0 || len(req.Mappings) > maxImportHandles {
+		respond(c, 400, gin.H{"error": fmt.Sprintf("between 1 and %d mappings are required", maxImportHandles)})
+		return
+	}
+	seen := make(map[string]bool, 2*len(req.Mappings))
+	for i := range req.Mappings {
+		m := &req.Mappings[i]
+		m.Handle = strings.TrimSpace(m.Handle)
+		if m.Username = strings.TrimSpace(m.Username); m.Username == "" {
+			m.Username = m.Handle
+		}
+		if m.Handle == "" || len(m.Username) > maxUsernameLength {
+			respond(c, 400, gin.H{"error": fmt.Sprintf("mapping %d needs a handle and a username of at most %d characters", i, maxUsernameLength)})
+			return
+		}
+		handleKey, userKey := "handle:"+strings.ToLower(m.Handle), "user:"+m.Username
+		if seen[handleKey] || seen[userKey] {
+			respond(c, 400, gin.H{"error": fmt.Sprintf("mapping %d repeats a handle or username", i)})
+			return
+		}
+		seen[handleKey], seen[userKey] = true, true
+	}
+
+	job := &ImportJob{
+		Source:        req.Source,
+		CreateMissing: req.CreateMissing,
+		Status:        "running",
+		Total:         len(req.Mappings),
+		Errors:        []string{},
+		StartedAt:     time.Now(),
+	}
+	if chess, ok := source.(chessComSource); ok {
+		job.Category = chess.category
+	}
+	if err := imports.add(job); err != nil {
+		respond(c, 500, gin.H{"error": err.Error()})
+		return
+	}
+	go leaderboard.runImport(job, source, req.Mappings)
+
+	auditLog.Record(c, "import.start", job.ID, gin.H{"source": job.Source, "handles": job.Total, "createMissing": job.CreateMissing})
+	status, _ := imports.get(job.ID)
+	respond(c, 202, status)
+}
+
+// Handler: Report an import's progress
+func getImport(c *gin.Context) {
+	job, ok := imports.get(c.Param("id"))
+	if !ok {
+		respond(c, 404, gin.H{"error": "import not found"})
+		return
+	}
+	respond(c, 200, job)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// backgroundJob tracks one periodic goroutine so operators can see it is alive
+type backgroundJob struct {
+	mu           sync.Mutex
+	name         string
+	interval     time.Duration
+	runs         uint64
+	lastRun      time.Time
+	lastDuration time.Duration
+}
+
+// JobStatus is a background job's state as reported by the admin overview
+type JobStatus struct {
+	Name           string     `json:"name"`
+	Interval       string     `json:"interval"`
+	Runs           uint64     `json:"runs"`
+	LastRun        *time.Time `json:"lastRun"`
+	LastDurationMs float64    `json:"lastDurationMs"`
+	// Overdue is set when the job has missed several runs in a row
+	Overdue bool `json:"overdue"`
+}
+
+// jobRegistry lists every background job started by this process
+type jobRegistry struct {
+	mu   sync.Mutex
+	jobs []*backgroundJob
+}
+
+var backgroundJobs = &jobRegistry{}
+
+// register adds a job that is expected to run every interval
+func (r *jobRegistry) register(name string, interval time.Duration) *backgroundJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job := &backgroundJob{name: name, interval: interval}
+	r.jobs = append(r.jobs, job)
+	return job
+}
+
+// ran records one completed run that began at start
+func (j *backgroundJob) ran(start time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.runs++
+	j.lastRun = start
+	j.lastDuration = time.Since(start)
+}
+
+// statuses reports every job in registration order
+func (r *jobRegistry) statuses() []JobStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(r.jobs))
+	for _, job := range r.jobs {
+		job.mu.Lock()
+		status := JobStatus{
+			Name:           job.name,
+			Interval:       job.interval.String(),
+			Runs:           job.runs,
+			LastDurationMs: roundTo(float64(job.lastDuration.Microseconds())/1000, 3),
+		}
+		if job.runs > 0 {
+			lastRun := job.lastRun
+			status.LastRun = &lastRun
+			status.Overdue = time.Since(lastRun) > 3*job.interval
+		}
+		job.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// status reports the first job registered under name
+func (r *jobRegistry) status(name string) (JobStatus, bool) {
+	for _, status := range r.statuses() {
+		if status.Name == name {
+			return status, true
+		}
+	}
+	return JobStatus{}, false
+}
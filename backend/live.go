@@ -0,0 +1,762 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// maxLiveClients caps concurrent /ws/leaderboard connections
+	maxLiveClients = 1000
+	// liveClientBuffer is how many replies may wait for a slow client before
+	// it is disconnected
+	liveClientBuffer = 16
+	// liveWriteTimeout bounds how long one update may take to send
+	liveWriteTimeout = 5 * time.Second
+	// maxLiveUsernames caps how many users one subscription may follow
+	maxLiveUsernames = 100
+	// liveSnapshotTop is how many top users a snapshot lists for a client
+	// following the whole board
+	liveSnapshotTop = 100
+	// maxLiveSnapshot caps how many users one snapshot lists
+	maxLiveSnapshot = 1000
+	// liveResumeWindow is how long broadcast changes are kept for clients
+	// resuming after a dropped connection; changes keep being collected for
+	// this long after the last client leaves
+	liveResumeWindow = 5 * time.Minute
+	// maxLiveHistory caps how many broadcasts are kept for resuming
+	maxLiveHistory = 1200
+)
+
+// LiveLimits shape the stream each /ws/leaderboard client receives. Changes
+// are collected every FlushEvery, with a user changed several times in
+// between appearing once. A client is sent at most MaxRate messages of
+// changes a second, with changes merged per user while it waits; once more
+// than MaxPending users' changes are waiting, they are dropped and the
+// client gets a snapshot of where its users stand instead.
+type LiveLimits struct {
+	FlushEvery time.Duration
+	MaxRate    float64
+	MaxPending int
+}
+
+// Validate checks that the limits are usable
+func (ll LiveLimits) Validate() error {
+	if ll.FlushEvery <= 0 {
+		return fmt.Errorf("live flush interval must be positive")
+	}
+	if ll.MaxRate < 0 {
+		return fmt.Errorf("live message rate must not be negative")
+	}
+	if ll.MaxPending < 1 {
+		return fmt.Errorf("live pending limit must be at least 1")
+	}
+	return nil
+}
+
+// gap is the least time between two messages of changes to one client
+func (ll LiveLimits) gap() time.Duration {
+	if ll.MaxRate == 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / ll.MaxRate)
+}
+
+var liveLimits = LiveLimits{FlushEvery: 250 * time.Millisecond, MaxRate: 2, MaxPending: 1000}
+
+// liveToken, when set, is the token /ws/leaderboard connections must present
+var liveToken string
+
+// RankDelta is a user whose rank or rating changed since the last update.
+// Users ranked between OldRank and NewRank shift one place to make room; a
+// rank of 0 means unranked or off the board.
+type RankDelta struct {
+	Username  string `json:"username"`
+	OldRank   int    `json:"oldRank"`
+	NewRank   int    `json:"newRank"`
+	OldRating int    `json:"oldRating"`
+	Rating    int    `json:"rating"`
+}
+
+// LiveStanding is where a user stands in a snapshot; a rank of 0 means unranked
+type LiveStanding struct {
+	Username string `json:"username"`
+	Rank     int    `json:"rank"`
+	Rating   int    `json:"rating"`
+}
+
+// liveUpdate is one message on /ws/leaderboard. A "snapshot" replaces what
+// the client knows of the users it follows; changes after it carry absolute
+// ranks and ratings, so one the snapshot already reflects applies cleanly.
+// ID is the resume token of the latest changes the client has been sent.
+type liveUpdate struct {
+	Type      string         `json:"type"`
+	ID        string         `json:"id,omitempty"`
+	Version   uint64         `json:"version"`
+	At        time.Time      `json:"at"`
+	Changes   []RankDelta    `json:"changes,omitempty"`
+	Users     []LiveStanding `json:"users,omitempty"`
+	Truncated bool           `json:"truncated,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// liveSubscription is a message a client sends to choose the changes it
+// receives. Each one replaces the last; one with no filters receives all.
+// Resume, if set, is the token of the last message the client saw on an
+// earlier connection, and replays what it missed under the new filters.
+type liveSubscription struct {
+	Type      string   `json:"type"`
+	Usernames []string `json:"usernames"`
+	Top       int      `json:"top"`
+	MinRating *int     `json:"minRating"`
+	MaxRating *int     `json:"maxRating"`
+	Resume    string   `json:"resume"`
+}
+
+// liveFilter picks the changes a client subscribed to. A change passes when
+// it matches any of the filters given: one of the usernames, a rank in the
+// top N before or after, or a rating in the band before or after.
+type liveFilter struct {
+	usernames map[string]bool
+	top       int
+	band      bool
+	minRating *int
+	maxRating *int
+}
+
+// parseLiveSubscription reads a subscribe message and its resume token; a
+// nil filter receives every change
+func parseLiveSubscription(raw string) (*liveFilter, string, error) {
+	var sub liveSubscription
+	if err := json.Unmarshal([]byte(raw), &sub); err != nil {
+		return nil, "", errors.New("messages must be JSON subscriptions")
+	}
+	if sub.Type != "subscribe" {
+		return nil, "", fmt.Errorf("unknown message type %q (expected \"subscribe\")", sub.Type)
+	}
+	if len(sub.Usernames) > maxLiveUsernames {
+		return nil, "", fmt.Errorf("a subscription may follow at most %d usernames", maxLiveUsernames)
+	}
+	if sub.Top < 0 {
+		return nil, "", errors.New("top must not be negative")
+	}
+	if sub.MinRating != nil && sub.MaxRating != nil && *sub.MinRating > *sub.MaxRating {
+		return nil, "", errors.New("minRating must not be above maxRating")
+	}
+	if sub.Resume != "" {
+		if _, _, err := parseResumeToken(sub.Resume); err != nil {
+			return nil, "", err
+		}
+	}
+
+	filter := &liveFilter{
+		top:       sub.Top,
+		band:      sub.MinRating != nil || sub.MaxRating != nil,
+		minRating: sub.MinRating,
+		maxRating: sub.MaxRating,
+	}
+	if len(sub.Usernames) > 0 {
+		filter.usernames = make(map[string]bool, len(sub.Usernames))
+		for _, username := range sub.Usernames {
+			filter.usernames[username] = true
+		}
+	}
+	if filter.usernames == nil && filter.top == 0 && !filter.band {
+		return nil, sub.Resume, nil
+	}
+	return filter, sub.Resume, nil
+}
+
+// parseResumeToken splits a resume token into the run of the server that
+// issued it and the broadcast it stands for
+func parseResumeToken(token string) (run string, seq uint64, err error) {
+	run, s, found := strings.Cut(token, ".")
+	if found {
+		seq, err = strconv.ParseUint(s, 10, 64)
+	}
+	if !found || run == "" || err != nil {
+		return "", 0, fmt.Errorf("resume token %q is not one /ws/leaderboard issued", token)
+	}
+	return run, seq, nil
+}
+
+// inBand reports whether a rating lies in the subscribed band
+func (f *liveFilter) inBand(rating int) bool {
+	return (f.minRating == nil || rating >= *f.minRating) && (f.maxRating == nil || rating <= *f.maxRating)
+}
+
+// inTop reports whether a rank lies in the subscribed top N
+func (f *liveFilter) inTop(rank int) bool {
+	return rank > 0 && rank <= f.top
+}
+
+func (f *liveFilter) matches(change RankDelta) bool {
+	return f.usernames[change.Username] ||
+		f.inTop(change.OldRank) || f.inTop(change.NewRank) ||
+		f.band && (f.inBand(change.OldRating) || f.inBand(change.Rating))
+}
+
+// apply returns the changes that pass the filter
+func (f *liveFilter) apply(changes []RankDelta) []RankDelta {
+	passed := make([]RankDelta, 0, len(changes))
+	for _, change := range changes {
+		if f.matches(change) {
+			passed = append(passed, change)
+		}
+	}
+	return passed
+}
+
+// liveTouch is where a user stood before their first change since the last
+// update went out
+type liveTouch struct {
+	rank   int
+	rating int
+}
+
+// touchLive notes a user's standing before a change that may move them;
+// lm.mu must be held. It is a no-op while nobody is connected.
+func (lm *LeaderboardManager) touchLive(user *User) {
+	if lm.liveTouched == nil {
+		return
+	}
+	if _, ok := lm.liveTouched[user]; ok {
+		return
+	}
+	touch := liveTouch{rating: user.Rating}
+	if lm.rankTree.has(user) {
+		touch.rank = lm.currentRank(user)
+	}
+	lm.liveTouched[user] = touch
+}
+
+// takeLiveChanges returns the users touched since the last call whose rank or
+// rating actually changed, and starts collecting afresh; lm.mu must be held
+func (lm *LeaderboardManager) takeLiveChanges() []RankDelta {
+	changes := make([]RankDelta, 0, len(lm.liveTouched))
+	for user, before := range lm.liveTouched {
+		rank := 0
+		if lm.users[user.Username] == user && lm.rankTree.has(user) {
+			rank = lm.currentRank(user)
+		}
+		if rank != before.rank || user.Rating != before.rating {
+			changes = append(changes, RankDelta{Username: user.Username, OldRank: before.rank, NewRank: rank, OldRating: before.rating, Rating: user.Rating})
+		}
+	}
+	lm.liveTouched = make(map[*User]liveTouch)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Username < changes[j].Username })
+	return changes
+}
+
+// liveStandings lists where the users a filter follows stand now, best
+// first: the top liveSnapshotTop for a nil filter. It reports true when
+// maxLiveSnapshot cut the list short.
+func (lm *LeaderboardManager) liveStandings(filter *liveFilter) ([]LiveStanding, bool) {
+	lm.rLockRanked()
+	defer lm.mu.RUnlock()
+
+	top := liveSnapshotTop
+	if filter != nil {
+		top = filter.top
+	}
+	standings := make([]LiveStanding, 0)
+	listed := make(map[*User]bool)
+	for _, user := range lm.sortedUsers {
+		rank := 0
+		if lm.rankTree.has(user) {
+			rank = lm.currentRank(user)
+		}
+		banded := filter != nil && filter.band
+		// Past the top N, only a rating band can still match
+		if rank > top && !banded {
+			break
+		}
+		if (rank == 0 || rank > top) && !(banded && filter.inBand(user.Rating)) {
+			continue
+		}
+		if len(standings) == maxLiveSnapshot {
+			return standings, true
+		}
+		standings = append(standings, LiveStanding{Username: user.Username, Rank: rank, Rating: user.Rating})
+		listed[user] = true
+	}
+	if filter == nil {
+		return standings, false
+	}
+	for username := range filter.usernames {
+		user, exists := lm.users[username]
+		if !exists || listed[user] {
+			continue
+		}
+		if len(standings) == maxLiveSnapshot {
+			return standings, true
+		}
+		rank := 0
+		if lm.rankTree.has(user) {
+			rank = lm.currentRank(user)
+		}
+		standings = append(standings, LiveStanding{Username: username, Rank: rank, Rating: user.Rating})
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if a.Rank != b.Rank {
+			return sortableRank(a.Rank) < sortableRank(b.Rank)
+		}
+		return a.Username < b.Username
+	})
+	return standings, false
+}
+
+// liveClient is one WebSocket connection and what is waiting for it. The
+// hub's lock guards everything but the channels.
+type liveClient struct {
+	// wake tells the client's writer something is waiting
+	wake chan struct{}
+	// done is closed when the client leaves
+	done chan struct{}
+	// filter is what the client subscribed to; nil receives every change
+	filter *liveFilter
+	// replies answer the client's own messages and go out as they are
+	replies [][]byte
+	// pending holds the changes not sent yet, one per user, from where the
+	// user stood before the first to where they stand after the latest
+	pending map[string]RankDelta
+	version uint64
+	// seq is the latest broadcast merged into pending or already sent
+	seq uint64
+	// behind is set once too many changes were pending; the client is sent
+	// a snapshot in place of them
+	behind bool
+}
+
+// liveOutbox is what a client's writer takes to send
+type liveOutbox struct {
+	replies [][]byte
+	changes []RankDelta
+	version uint64
+	id      string
+	// resync asks for a snapshot of the users filter follows
+	resync bool
+	filter *liveFilter
+}
+
+// liveBroadcast is one flush of changes, kept for resuming clients
+type liveBroadcast struct {
+	seq     uint64
+	version uint64
+	at      time.Time
+	changes []RankDelta
+}
+
+// liveHub fans rank changes out to every connected WebSocket client
+type liveHub struct {
+	mu      sync.Mutex
+	clients map[*liveClient]bool
+	sent    uint64
+	resyncs uint64
+	dropped uint64
+	// run tells this server's resume tokens from an earlier run's, whose
+	// sequence numbers started over
+	run     string
+	seq     uint64
+	history []liveBroadcast
+	// keep caps the length of history
+	keep     int
+	lastLeft time.Time
+}
+
+var live = newLiveHub()
+
+func newLiveHub() *liveHub {
+	return &liveHub{
+		clients: make(map[*liveClient]bool),
+		run:     strconv.FormatInt(time.Now().UnixNano(), 36),
+		keep:    maxLiveHistory,
+	}
+}
+
+// tokenLocked is the resume token for a broadcast; h.mu must be held
+func (h *liveHub) tokenLocked(seq uint64) string {
+	return h.run + "." + strconv.FormatUint(seq, 10)
+}
+
+// join registers a client, failing when the hub is full, and returns the
+// token its hello carries. A resume token replays the changes the client
+// missed since it was issued.
+func (h *liveHub) join(resume string) (*liveClient, string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.clients) >= maxLiveClients {
+		return nil, "", false
+	}
+	client := &liveClient{
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		pending: make(map[string]RankDelta),
+		seq:     h.seq,
+	}
+	h.clients[client] = true
+	// A resuming client stays where it was until the replay reaches it
+	id := h.tokenLocked(client.seq)
+	if resume != "" {
+		h.resumeLocked(client, resume)
+		id = resume
+	}
+	return client, id, true
+}
+
+// resumeLocked replaces what a client has pending with the changes after a
+// resume token under its filter, or with a snapshot when the token is from
+// another run or older than the kept history; h.mu must be held
+func (h *liveHub) resumeLocked(client *liveClient, token string) {
+	client.pending = make(map[string]RankDelta)
+	client.behind = false
+	client.seq = h.seq
+	run, seq, err := parseResumeToken(token)
+	reachable := err == nil && run == h.run && seq <= h.seq &&
+		(seq == h.seq || len(h.history) > 0 && h.history[0].seq <= seq+1)
+	if !reachable {
+		client.behind = true
+		h.resyncs++
+		client.notify()
+		return
+	}
+	for _, broadcast := range h.history {
+		if broadcast.seq > seq {
+			h.mergeLocked(client, broadcast)
+		}
+	}
+	client.seq = h.seq
+	client.notify()
+}
+
+// listening reports whether changes should be collected: while a client is
+// connected, and for liveResumeWindow after the last one left so that it
+// can resume
+func (h *liveHub) listening(now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients) > 0 || now.Sub(h.lastLeft) < liveResumeWindow
+}
+
+// leave unregisters a client and stops its writer, once
+func (h *liveHub) leave(client *liveClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leaveLocked(client)
+}
+
+func (h *liveHub) leaveLocked(client *liveClient) {
+	if h.clients[client] {
+		delete(h.clients, client)
+		close(client.done)
+		h.lastLeft = time.Now()
+	}
+}
+
+func (h *liveHub) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// notify tells a client's writer there is something to send
+func (client *liveClient) notify() {
+	select {
+	case client.wake <- struct{}{}:
+	default:
+	}
+}
+
+// broadcast numbers a flush of changes, keeps it for resuming clients and
+// merges it into what each client has pending
+func (h *liveHub) broadcast(version uint64, at time.Time, changes []RankDelta) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	broadcast := liveBroadcast{seq: h.seq, version: version, at: at, changes: changes}
+	h.history = append(h.history, broadcast)
+	drop := max(len(h.history)-h.keep, 0)
+	for drop < len(h.history) && at.Sub(h.history[drop].at) > liveResumeWindow {
+		drop++
+	}
+	h.history = h.history[drop:]
+
+	for client := range h.clients {
+		if h.mergeLocked(client, broadcast) {
+			client.notify()
+		}
+		client.seq = broadcast.seq
+	}
+}
+
+// mergeLocked adds the changes of a broadcast a client's subscription
+// follows to what it has pending, reporting whether there were any. A
+// client with too many pending is marked for a snapshot instead; h.mu must
+// be held.
+func (h *liveHub) mergeLocked(client *liveClient, broadcast liveBroadcast) bool {
+	followed := broadcast.changes
+	if client.filter != nil {
+		followed = client.filter.apply(followed)
+	}
+	if len(followed) == 0 || client.behind {
+		return false
+	}
+	for _, change := range followed {
+		if earlier, ok := client.pending[change.Username]; ok {
+			change.OldRank, change.OldRating = earlier.OldRank, earlier.OldRating
+		}
+		client.pending[change.Username] = change
+	}
+	client.version = broadcast.version
+	if len(client.pending) > liveLimits.MaxPending {
+		client.behind = true
+		client.pending = make(map[string]RankDelta)
+		h.resyncs++
+	}
+	return true
+}
+
+// take hands a client's writer its replies and, when changesDue, its
+// pending changes or snapshot request. It also reports whether changes are
+// still waiting for their turn.
+func (h *liveHub) take(client *liveClient, changesDue bool) (liveOutbox, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := liveOutbox{replies: client.replies, version: client.version, id: h.tokenLocked(client.seq), filter: client.filter}
+	client.replies = nil
+	h.sent += uint64(len(out.replies))
+	if !changesDue {
+		return out, client.behind || len(client.pending) > 0
+	}
+
+	switch {
+	case client.behind:
+		out.resync = true
+		client.behind = false
+		h.sent++
+	case len(client.pending) > 0:
+		for _, change := range client.pending {
+			// Users who moved and came back have nothing to report
+			if change.OldRank != change.NewRank || change.OldRating != change.Rating {
+				out.changes = append(out.changes, change)
+			}
+		}
+		client.pending = make(map[string]RankDelta)
+		sort.Slice(out.changes, func(i, j int) bool { return out.changes[i].Username < out.changes[j].Username })
+		if len(out.changes) > 0 {
+			h.sent++
+		}
+	}
+	return out, false
+}
+
+// reply queues a message for one client, if it is still connected,
+// disconnecting it if it has stopped reading its replies
+func (h *liveHub) reply(client *liveClient, update liveUpdate) {
+	body, err := json.Marshal(update)
+	if err != nil {
+		log.Printf("⚠️  Encoding live update failed: %v", err)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.clients[client] {
+		return
+	}
+	if len(client.replies) >= liveClientBuffer {
+		h.dropped++
+		h.leaveLocked(client)
+		return
+	}
+	client.replies = append(client.replies, body)
+	client.notify()
+}
+
+// subscribe replaces a client's filter and confirms it, so the client knows
+// which updates follow the new subscription. Changes pending under the old
+// filter are dropped, and with a resume token replaced by those missed
+// since it under the new one.
+func (h *liveHub) subscribe(client *liveClient, filter *liveFilter, resume string) {
+	h.mu.Lock()
+	client.filter = filter
+	client.pending = make(map[string]RankDelta)
+	if resume != "" {
+		h.resumeLocked(client, resume)
+	}
+	h.mu.Unlock()
+	h.reply(client, liveUpdate{Type: "subscribed", Version: leaderboard.Version(), At: time.Now()})
+}
+
+// LiveStats describes the WebSocket hub for the admin overview
+type LiveStats struct {
+	Clients int    `json:"clients"`
+	Sent    uint64 `json:"sent"`
+	Resyncs uint64 `json:"resyncs"`
+	Dropped uint64 `json:"dropped"`
+}
+
+func (h *liveHub) stats() LiveStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return LiveStats{Clients: len(h.clients), Sent: h.sent, Resyncs: h.resyncs, Dropped: h.dropped}
+}
+
+// RunLiveUpdates collects the users whose rank or rating changed and hands
+// them to live clients, every liveLimits.FlushEvery. Changes are only
+// collected while someone is connected or may still resume.
+func (lm *LeaderboardManager) RunLiveUpdates() {
+	job := backgroundJobs.register("live updates", liveLimits.FlushEvery)
+	ticker := time.NewTicker(liveLimits.FlushEvery)
+	go func() {
+		for now := range ticker.C {
+			lm.flushLive()
+			job.ran(now)
+		}
+	}()
+}
+
+// flushLive broadcasts the changes collected since the last flush, starting
+// or stopping collection as clients come and go
+func (lm *LeaderboardManager) flushLive() {
+	now := time.Now()
+	listening := live.listening(now)
+	lm.mu.Lock()
+	var changes []RankDelta
+	switch {
+	case !listening:
+		lm.liveTouched = nil
+	case lm.liveTouched == nil:
+		lm.liveTouched = make(map[*User]liveTouch)
+	default:
+		changes = lm.takeLiveChanges()
+	}
+	lm.mu.Unlock()
+	if len(changes) > 0 {
+		live.broadcast(lm.Version(), now, changes)
+	}
+}
+
+// serveLive streams updates to one client until it disconnects or falls
+// behind on its replies. Changes go out at most liveLimits.MaxRate times a
+// second; replies go out straight away.
+func serveLive(ws *websocket.Conn) {
+	defer ws.Close()
+	client, id, ok := live.join(liveResume(ws.Request()))
+	if !ok {
+		return
+	}
+	defer live.leave(client)
+
+	// Clients only send subscriptions; reading also notices when they go away
+	go func() {
+		var raw string
+		for websocket.Message.Receive(ws, &raw) == nil {
+			filter, resume, err := parseLiveSubscription(raw)
+			if err != nil {
+				live.reply(client, liveUpdate{Type: "error", Version: leaderboard.Version(), At: time.Now(), Error: err.Error()})
+				continue
+			}
+			live.subscribe(client, filter, resume)
+		}
+		live.leave(client)
+	}()
+
+	ws.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+	if websocket.JSON.Send(ws, liveUpdate{Type: "hello", ID: id, Version: leaderboard.Version(), At: time.Now()}) != nil {
+		return
+	}
+	gap := liveLimits.gap()
+	var nextChanges time.Time
+	var turn <-chan time.Time
+	for {
+		select {
+		case <-client.done:
+			return
+		case <-client.wake:
+		case <-turn:
+		}
+		now := time.Now()
+		out, waiting := live.take(client, !now.Before(nextChanges))
+		for _, body := range out.replies {
+			ws.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			if websocket.Message.Send(ws, string(body)) != nil {
+				return
+			}
+		}
+		if out.resync || len(out.changes) > 0 {
+			update := liveUpdate{Type: "changes", ID: out.id, Version: out.version, At: now, Changes: out.changes}
+			if out.resync {
+				update = liveUpdate{Type: "snapshot", ID: out.id, Version: leaderboard.Version(), At: now}
+				update.Users, update.Truncated = leaderboard.liveStandings(out.filter)
+			}
+			ws.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			if websocket.JSON.Send(ws, update) != nil {
+				return
+			}
+			nextChanges = now.Add(gap)
+		}
+		turn = nil
+		if waiting {
+			turn = time.After(time.Until(nextChanges))
+		}
+	}
+}
+
+// liveResume is the resume token a connection carries, in the resume query
+// parameter or, as SSE clients send it, the Last-Event-ID header
+func liveResume(r *http.Request) string {
+	if token := r.URL.Query().Get("resume"); token != "" {
+		return token
+	}
+	return r.Header.Get("Last-Event-ID")
+}
+
+// liveServer accepts any origin, as the REST API does with CORS
+var liveServer = websocket.Server{Handler: serveLive}
+
+// liveAuthorized reports whether a request may open a live connection: any
+// may when no live token is set, otherwise those carrying it in
+// X-Live-Token or, for browsers that can't set headers on a WebSocket, the
+// token query parameter. The admin token is always accepted.
+func liveAuthorized(c *gin.Context) bool {
+	if liveToken == "" || isAdmin(c) {
+		return true
+	}
+	given := c.GetHeader("X-Live-Token")
+	if given == "" {
+		given = c.Query("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(liveToken)) == 1
+}
+
+// Handler: Live rank changes over a WebSocket
+func liveLeaderboard(c *gin.Context) {
+	if !liveAuthorized(c) {
+		respond(c, 401, gin.H{"error": "missing or invalid live token"})
+		return
+	}
+	if resume := liveResume(c.Request); resume != "" {
+		if _, _, err := parseResumeToken(resume); err != nil {
+			respond(c, 400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if live.count() >= maxLiveClients {
+		respond(c, 503, gin.H{"error": "too many live connections, try again later"})
+		return
+	}
+	liveServer.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// liveTestServer serves the test router on a real listener with a fresh
+// live hub, and returns the /ws/leaderboard URL
+func liveTestServer(t *testing.T) (*testServer, string) {
+	t.Helper()
+	ts := newTestServer(t, DefaultBoardConfig())
+	previousHub, previousToken, previousLimits := live, liveToken, liveLimits
+	live = newLiveHub()
+	t.Cleanup(func() { live, liveToken, liveLimits = previousHub, previousToken, previousLimits })
+
+	server := httptest.NewServer(ts.router)
+	t.Cleanup(server.Close)
+	return ts, "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/leaderboard"
+}
+
+// dialLive opens a live connection, closed when the test ends, and reads
+// its hello
+func dialLive(t *testing.T, url string, header http.Header) *websocket.Conn {
+	t.Helper()
+	config, err := websocket.NewConfig(url, "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Header = header
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatalf("dialing %s: %v", url, err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	if hello := receiveLive(t, ws); hello.Type != "hello" {
+		t.Fatalf("first message is %+v, want hello", hello)
+	}
+	return ws
+}
+
+// receiveLive reads the next message from a live connection
+func receiveLive(t *testing.T, ws *websocket.Conn) liveUpdate {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var update liveUpdate
+	if err := websocket.JSON.Receive(ws, &update); err != nil {
+		t.Fatalf("reading live update: %v", err)
+	}
+	return update
+}
+
+// subscribeLive sends a subscription and waits for it to be confirmed
+func subscribeLive(t *testing.T, ws *websocket.Conn, sub liveSubscription) {
+	t.Helper()
+	sub.Type = "subscribe"
+	if err := websocket.JSON.Send(ws, sub); err != nil {
+		t.Fatal(err)
+	}
+	if reply := receiveLive(t, ws); reply.Type != "subscribed" {
+		t.Fatalf("subscribing got %+v", reply)
+	}
+}
+
+// expectNoLive fails if a message arrives shortly; the connection can't be
+// read from afterwards
+func expectNoLive(t *testing.T, ws *websocket.Conn) {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	var update liveUpdate
+	if err := websocket.JSON.Receive(ws, &update); err == nil {
+		t.Fatalf("got %+v, want nothing", update)
+	}
+}
+
+// changedUsers lists the usernames in an update, in order
+func changedUsers(update liveUpdate) []string {
+	names := make([]string, len(update.Changes))
+	for i, change := range update.Changes {
+		names[i] = change.Username
+	}
+	return names
+}
+
+func TestLiveSubscriptions(t *testing.T) {
+	ts, url := liveTestServer(t)
+	ts.createUsers(map[string]int{"ann": 1000, "ben": 1200, "cat": 1400, "dan": 1600})
+
+	everything := dialLive(t, url, nil)
+	named := dialLive(t, url, nil)
+	subscribeLive(t, named, liveSubscription{Usernames: []string{"ann"}})
+	top := dialLive(t, url, nil)
+	subscribeLive(t, top, liveSubscription{Top: 1})
+	low, high := 1050, 1150
+	band := dialLive(t, url, nil)
+	subscribeLive(t, band, liveSubscription{MinRating: &low, MaxRating: &high})
+	quiet := dialLive(t, url, nil)
+	subscribeLive(t, quiet, liveSubscription{Usernames: []string{"cat"}})
+
+	// Start collecting, then move ann within the band and ben to the top
+	leaderboard.flushLive()
+	if err := leaderboard.UpdateRating("ann", 1100); err != nil {
+		t.Fatal(err)
+	}
+	if err := leaderboard.UpdateRating("ben", 1650); err != nil {
+		t.Fatal(err)
+	}
+	leaderboard.flushLive()
+
+	for _, c := range []struct {
+		name string
+		ws   *websocket.Conn
+		want []string
+	}{
+		{"no subscription", everything, []string{"ann", "ben"}},
+		{"usernames", named, []string{"ann"}},
+		{"top 1", top, []string{"ben"}},
+		{"rating band", band, []string{"ann"}},
+	} {
+		update := receiveLive(t, c.ws)
+		if got := changedUsers(update); update.Type != "changes" || !equalStrings(got, c.want) {
+			t.Errorf("%s: got %s %v, want changes %v", c.name, update.Type, got, c.want)
+		}
+	}
+	expectNoLive(t, quiet)
+}
+
+func TestLiveSubscriptionErrors(t *testing.T) {
+	_, url := liveTestServer(t)
+	ws := dialLive(t, url, nil)
+
+	for _, raw := range []string{
+		`not json`,
+		`{"type":"unsubscribe"}`,
+		`{"type":"subscribe","top":-1}`,
+		`{"type":"subscribe","minRating":2000,"maxRating":1000}`,
+	} {
+		if err := websocket.Message.Send(ws, raw); err != nil {
+			t.Fatal(err)
+		}
+		if reply := receiveLive(t, ws); reply.Type != "error" || reply.Error == "" {
+			t.Errorf("%s: got %+v, want an error", raw, reply)
+		}
+	}
+	// The connection stays usable after a bad message
+	subscribeLive(t, ws, liveSubscription{Top: 10})
+}
+
+func TestLiveToken(t *testing.T) {
+	ts, url := liveTestServer(t)
+	liveToken = "live-secret"
+
+	for _, path := range []string{"/ws/leaderboard", "/ws/leaderboard?token=wrong"} {
+		ts.expect(request{method: http.MethodGet, path: path}, http.StatusUnauthorized)
+	}
+	dialLive(t, url+"?token=live-secret", nil)
+	dialLive(t, url, http.Header{"X-Live-Token": {"live-secret"}})
+	dialLive(t, url, http.Header{"X-Admin-Token": {testAdminToken}})
+}
+
+func TestLiveRateCapMergesChanges(t *testing.T) {
+	ts, url := liveTestServer(t)
+	liveLimits.MaxRate = 2
+	ts.createUsers(map[string]int{"ann": 1000, "ben": 1200})
+	ws := dialLive(t, url, nil)
+	leaderboard.flushLive()
+
+	leaderboard.UpdateRating("ann", 1100)
+	leaderboard.flushLive()
+	sent := time.Now()
+	if first := receiveLive(t, ws); !equalStrings(changedUsers(first), []string{"ann"}) {
+		t.Fatalf("first update is %+v, want ann", first)
+	}
+
+	// Several flushes inside the gap go out together, one change per user
+	leaderboard.UpdateRating("ann", 1300)
+	leaderboard.flushLive()
+	leaderboard.UpdateRating("ann", 1400)
+	leaderboard.flushLive()
+	leaderboard.UpdateRating("ben", 1000)
+	leaderboard.flushLive()
+
+	merged := receiveLive(t, ws)
+	if gap := time.Since(sent); gap < liveLimits.gap()*9/10 {
+		t.Errorf("second update came %s after the first, want at least %s", gap, liveLimits.gap())
+	}
+	if got := changedUsers(merged); !equalStrings(got, []string{"ann", "ben"}) {
+		t.Fatalf("merged update lists %v, want ann and ben", got)
+	}
+	if ann := merged.Changes[0]; ann.OldRating != 1100 || ann.Rating != 1400 || ann.OldRank != 2 || ann.NewRank != 1 {
+		t.Errorf("ann's merged change is %+v, want 1100 at rank 2 to 1400 at rank 1", ann)
+	}
+}
+
+func TestLiveResyncsWhenBehind(t *testing.T) {
+	ts, url := liveTestServer(t)
+	liveLimits.MaxPending = 2
+	ts.createUsers(map[string]int{"ann": 1000, "ben": 1200, "cat": 1400, "dan": 1600})
+	ws := dialLive(t, url, nil)
+	leaderboard.flushLive()
+
+	leaderboard.UpdateRating("ann", 1100)
+	leaderboard.flushLive()
+	receiveLive(t, ws)
+
+	// Three users pending is past the limit, so a snapshot replaces them
+	leaderboard.UpdateRating("ann", 1700)
+	leaderboard.UpdateRating("ben", 1300)
+	leaderboard.UpdateRating("cat", 1500)
+	leaderboard.flushLive()
+	snapshot := receiveLive(t, ws)
+	if snapshot.Type != "snapshot" {
+		t.Fatalf("got %s %+v, want a snapshot", snapshot.Type, snapshot)
+	}
+	want := []LiveStanding{{"ann", 1, 1700}, {"dan", 2, 1600}, {"cat", 3, 1500}, {"ben", 4, 1300}}
+	if len(snapshot.Users) != len(want) {
+		t.Fatalf("snapshot lists %+v, want %+v", snapshot.Users, want)
+	}
+	for i := range want {
+		if snapshot.Users[i] != want[i] {
+			t.Errorf("snapshot entry %d is %+v, want %+v", i, snapshot.Users[i], want[i])
+		}
+	}
+
+	// Deltas carry on after the snapshot
+	leaderboard.UpdateRating("dan", 1800)
+	leaderboard.flushLive()
+	if next := receiveLive(t, ws); next.Type != "changes" || !equalStrings(changedUsers(next), []string{"dan"}) {
+		t.Errorf("after the snapshot got %s %v, want changes for dan", next.Type, changedUsers(next))
+	}
+	if stats := live.stats(); stats.Resyncs != 1 {
+		t.Errorf("hub counted %d resyncs, want 1", stats.Resyncs)
+	}
+}
+
+func TestLiveResume(t *testing.T) {
+	ts, url := liveTestServer(t)
+	liveLimits.MaxRate = 0
+	ts.createUsers(map[string]int{"ann": 1000, "ben": 1200, "cat": 1400, "dan": 1600})
+	ws := dialLive(t, url, nil)
+	leaderboard.flushLive()
+
+	leaderboard.UpdateRating("ann", 1100)
+	leaderboard.flushLive()
+	seen := receiveLive(t, ws)
+	if seen.ID == "" {
+		t.Fatalf("changes carry no resume token: %+v", seen)
+	}
+	ws.Close()
+
+	// Changes keep being collected while nobody is connected
+	leaderboard.UpdateRating("ben", 1300)
+	leaderboard.flushLive()
+	leaderboard.UpdateRating("cat", 1500)
+	leaderboard.UpdateRating("ann", 1150)
+	leaderboard.flushLive()
+
+	for name, resumed := range map[string]*websocket.Conn{
+		"resume parameter":    dialLive(t, url+"?resume="+seen.ID, nil),
+		"Last-Event-ID":       dialLive(t, url, http.Header{"Last-Event-ID": {seen.ID}}),
+		"filtered subscriber": dialLive(t, url, nil),
+	} {
+		want := []string{"ann", "ben", "cat"}
+		if name == "filtered subscriber" {
+			subscribeLive(t, resumed, liveSubscription{Usernames: []string{"ben"}, Resume: seen.ID})
+			want = []string{"ben"}
+		}
+		missed := receiveLive(t, resumed)
+		if missed.Type != "changes" || !equalStrings(changedUsers(missed), want) {
+			t.Errorf("%s: replayed %s %v, want changes %v", name, missed.Type, changedUsers(missed), want)
+		}
+		if missed.ID == seen.ID {
+			t.Errorf("%s: replay carries the token it resumed from", name)
+		}
+	}
+
+	ts.expect(request{method: http.MethodGet, path: "/ws/leaderboard?resume=garbage"}, http.StatusBadRequest)
+}
+
+func TestLiveResumeFallsBackToSnapshot(t *testing.T) {
+	ts, url := liveTestServer(t)
+	liveLimits.MaxRate = 0
+	live.keep = 2
+	ts.createUsers(map[string]int{"ann": 1000, "ben": 1200})
+	ws := dialLive(t, url, nil)
+	leaderboard.flushLive()
+
+	leaderboard.UpdateRating("ann", 1100)
+	leaderboard.flushLive()
+	seen := receiveLive(t, ws)
+	for _, rating := range []int{1300, 1400, 1500} {
+		leaderboard.UpdateRating("ann", rating)
+		leaderboard.flushLive()
+	}
+
+	for name, token := range map[string]string{
+		"older than the kept history": seen.ID,
+		"from another run":            "0." + strings.SplitN(seen.ID, ".", 2)[1],
+	} {
+		resumed := dialLive(t, url+"?resume="+token, nil)
+		if got := receiveLive(t, resumed); got.Type != "snapshot" || len(got.Users) != 2 || got.Users[0].Username != "ann" {
+			t.Errorf("%s: got %s %+v, want a snapshot led by ann", name, got.Type, got.Users)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoadLimits caps concurrent work. Requests beyond MaxInFlight wait in a
+// queue of up to MaxQueue for at most QueueWait; anything more is shed.
+type LoadLimits struct {
+	MaxInFlight int
+	MaxQueue    int
+	QueueWait   time.Duration
+}
+
+// Validate checks that the limits are usable
+func (ll LoadLimits) Validate() error {
+	if ll.MaxInFlight < 0 || ll.MaxQueue < 0 {
+		return fmt.Errorf("in-flight and queue limits must not be negative")
+	}
+	if ll.QueueWait < 0 {
+		return fmt.Errorf("queue wait must not be negative")
+	}
+	return nil
+}
+
+var loadLimits = LoadLimits{MaxInFlight: 256, MaxQueue: 512, QueueWait: time.Second}
+
+// loadShedRetryAfter is the Retry-After hint, in seconds, sent with a 429
+const loadShedRetryAfter = 1
+
+// exemptFromShedding reports whether a request bypasses the limiter: health
+// checks must keep answering and admins need a way in during an incident.
+// Live WebSocket connections would hold a slot for good, so the hub caps
+// them itself.
+func exemptFromShedding(c *gin.Context) bool {
+	path := c.FullPath()
+	return path == "/" || path == "/api/health" || path == "/ws/leaderboard" || strings.HasPrefix(path, "/api/admin/")
+}
+
+// LoadShedder limits in-flight requests and rejects the excess with 429
+type LoadShedder struct {
+	limits LoadLimits
+	slots  chan struct{}
+	queued atomic.Int64
+	shed   atomic.Uint64
+	// latency is a moving average of request handling time in nanoseconds
+	latency atomic.Int64
+}
+
+// maxObservedLatency caps one request's weight in the latency average, so a
+// single long download doesn't read as the whole API slowing down
+const maxObservedLatency = 5 * time.Second
+
+// observe folds one request's handling time into the moving average. Two
+// requests finishing at once may lose one sample, which an average shrugs off.
+func (ls *LoadShedder) observe(d time.Duration) {
+	d = min(d, maxObservedLatency)
+	old := ls.latency.Load()
+	ls.latency.Store(old + (int64(d)-old)/8)
+}
+
+// Latency returns the moving average of request handling time
+func (ls *LoadShedder) Latency() time.Duration {
+	return time.Duration(ls.latency.Load())
+}
+
+// NewLoadShedder creates a limiter; a MaxInFlight of 0 lets everything through
+func NewLoadShedder(limits LoadLimits) *LoadShedder {
+	return &LoadShedder{limits: limits, slots: make(chan struct{}, limits.MaxInFlight)}
+}
+
+// LoadStats is the limiter's current queue depth and lifetime rejections
+type LoadStats struct {
+	InFlight    int    `json:"inFlight"`
+	Queued      int64  `json:"queued"`
+	MaxInFlight int    `json:"maxInFlight"`
+	MaxQueue    int    `json:"maxQueue"`
+	Shed        uint64 `json:"shed"`
+	// LatencyMs is the moving average of request handling time
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+// Stats reports current load
+func (ls *LoadShedder) Stats() LoadStats {
+	return LoadStats{
+		InFlight:    len(ls.slots),
+		Queued:      ls.queued.Load(),
+		MaxInFlight: ls.limits.MaxInFlight,
+		MaxQueue:    ls.limits.MaxQueue,
+		Shed:        ls.shed.Load(),
+		LatencyMs:   roundTo(float64(ls.Latency().Microseconds())/1000, 3),
+	}
+}
+
+func (ls *LoadShedder) reject(c *gin.Context) {
+	ls.shed.Add(1)
+	c.Header("Retry-After", fmt.Sprint(loadShedRetryAfter))
+	respond(c, 429, gin.H{"error": "server is busy, retry shortly"})
+	c.Abort()
+}
+
+// Middleware admits requests while there is capacity and sheds the rest
+func (ls *LoadShedder) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if exemptFromShedding(c) {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		defer func() { ls.observe(time.Since(start)) }()
+		if ls.limits.MaxInFlight == 0 {
+			c.Next()
+			return
+		}
+
+		select {
+		case ls.slots <- struct{}{}:
+		default:
+			if ls.queued.Add(1) > int64(ls.limits.MaxQueue) {
+				ls.queued.Add(-1)
+				ls.reject(c)
+				return
+			}
+			timer := time.NewTimer(ls.limits.QueueWait)
+			select {
+			case ls.slots <- struct{}{}:
+				timer.Stop()
+				ls.queued.Add(-1)
+			case <-timer.C:
+				ls.queued.Add(-1)
+				ls.reject(c)
+				return
+			case <-c.Request.Context().Done():
+				timer.Stop()
+				ls.queued.Add(-1)
+				c.Abort()
+				return
+			}
+		}
+
+		defer func() { <-ls.slots }()
+		c.Next()
+	}
+}
+
+var loadShedder *LoadShedder
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
+	"os"
+	"os/signal"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -15,9 +23,39 @@ import (
 
 // User represents a user in the leaderboard
 type User struct {
-	Username string `json:"username"`
-	Rating   int    `json:"rating"`
-	Rank     int    `json:"rank"`
+	Username    string         `json:"username"`
+	Rating      int            `json:"rating"`
+	Rank        int            `json:"rank,omitempty"`
+	GamesPlayed int            `json:"gamesPlayed"`
+	Wins        int            `json:"wins"`
+	Updates     int            `json:"updates"`
+	Country     string         `json:"country,omitempty"`
+	Region      string         `json:"region,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	Scores      map[string]int `json:"scores,omitempty"`
+	LastActive  time.Time      `json:"lastActive"`
+	// Unranked says why the user is out of the ranking; such users have no Rank
+	Unranked UnrankedReason `json:"unranked,omitempty"`
+	// Percentile is the share of the board ranked below this user, and
+	// NormalizedScore the rating scaled to 0-100 (best) across the board;
+	// both are refreshed on every re-rank
+	Percentile      float64 `json:"percentile"`
+	NormalizedScore float64 `json:"normalizedScore"`
+}
+
+// snapshot returns a copy of the user that is safe to use outside the lock
+func (u *User) snapshot() User {
+	copied := *u
+	if u.Scores != nil {
+		copied.Scores = make(map[string]int, len(u.Scores))
+		for field, value := range u.Scores {
+			copied.Scores[field] = value
+		}
+	}
+	if u.Tags != nil {
+		copied.Tags = append([]string(nil), u.Tags...)
+	}
+	return copied
 }
 
 // LeaderboardManager manages the leaderboard with efficient ranking
@@ -28,63 +66,312 @@ type LeaderboardManager struct {
 	needsRerank   bool
 	rankCache     map[int]int
 	usernameLower map[string]string
+	config        BoardConfig
+	rankHistory   *rankTimeline
+	knownNames    atomic.Pointer[bloomFilter]
+	searchIndex   usernameIndex
+	version       atomic.Uint64
+	moments       ratingMoments
+	leader        string
+	ratingHistory map[string]*ratingLog
+	tombstones    map[string]*tombstone
+	writeLimiter  *RateLimiter
+	pending       map[*User]int
+	pendingChange bool
+	rankedCount   int
+	countries     countryRollup
+	regions       regionIndexes
+	contributions scoreContributions
+	milestones    milestones
+	// replicating is set while applying changes from peer regions
+	replicating bool
+	// rankEvery is the background ranking interval, or 0 to rank on demand
+	rankEvery time.Duration
+	// rankMoves collects rank changes for the next summary, when enabled
+	rankMoves *rankMoves
+	// rankTree keeps the ranked users ordered as they change, for rank
+	// lookups and pages that don't wait for a re-rank
+	rankTree *rankTree
+	// positions indexes sortedUsers, so users leave it in constant time
+	positions map[*User]int
+	// liveTouched collects users changed since the last live update, while
+	// WebSocket clients are connected
+	liveTouched map[*User]liveTouch
+	// storage keeps the board across restarts, when --data-dir is set, and
+	// storageSeq numbers the updates appended to it
+	storage    Storage
+	storageSeq uint64
+	// snapshotSeq is the last update the latest snapshot holds. Once
+	// compactAfter updates have been logged since, compactSoon asks for a
+	// snapshot ahead of the interval.
+	snapshotSeq  uint64
+	compactAfter int
+	compactSoon  chan struct{}
 }
 
 // NewLeaderboardManager creates a new leaderboard manager
-func NewLeaderboardManager() *LeaderboardManager {
-	return &LeaderboardManager{
+func NewLeaderboardManager(config BoardConfig) *LeaderboardManager {
+	lm := &LeaderboardManager{
 		users:         make(map[string]*User),
 		sortedUsers:   make([]*User, 0),
+		positions:     make(map[*User]int),
 		needsRerank:   false,
 		rankCache:     make(map[int]int),
 		usernameLower: make(map[string]string),
+		config:        config,
+		rankHistory:   newRankTimeline(),
+		searchIndex:   newUsernameIndex(config.SearchEngine),
+		ratingHistory: make(map[string]*ratingLog),
+		tombstones:    make(map[string]*tombstone),
+		moments:       ratingMoments{histogram: newRatingHistogram(config.histogramWidth())},
+		countries:     make(countryRollup),
+		regions:       make(regionIndexes),
+		contributions: scoreContributions{live: make(map[*User]int)},
 	}
+	lm.rankTree = newRankTree(lm.Ordering())
+	lm.knownNames.Store(newBloomFilter(0))
+	return lm
 }
 
-// AddUser adds a new user to the leaderboard
-func (lm *LeaderboardManager) AddUser(username string, rating int) {
+var errUserNotFound = errors.New("user not found")
+
+// AddUser adds a new user to the leaderboard, replacing any user with the
+// same name. It fails while the name is reserved by a deleted user.
+func (lm *LeaderboardManager) AddUser(username string, rating int) error {
 	lm.mu.Lock()
 	defer lm.mu.Unlock()
+	return lm.addUserLocked(username, rating)
+}
 
-	if rating < 100 {
-		rating = 100
-	}
-	if rating > 5000 {
-		rating = 5000
+// addUserLocked is AddUser with lm.mu already held
+func (lm *LeaderboardManager) addUserLocked(username string, rating int) error {
+	if _, deleted := lm.tombstones[username]; deleted {
+		return errNameReserved
 	}
 
 	user := &User{
-		Username: username,
-		Rating:   rating,
-		Rank:     0,
+		Username:   username,
+		Rating:     lm.config.clampRating(rating),
+		Rank:       0,
+		LastActive: time.Now(),
 	}
 
+	if existing, exists := lm.users[username]; exists {
+		lm.unlinkUser(existing)
+	}
+	lm.rankIn(user)
+	lm.updateProvisional(user)
+	lm.recordRating(user, user.Rating, user.LastActive)
+
 	lm.users[username] = user
 	lm.usernameLower[strings.ToLower(username)] = username
+	lm.appendSorted(user)
+	lm.searchIndex.add(user)
+	lm.markChanged()
+
+	if !lm.knownNames.Load().add(username) {
+		lm.rebuildNameFilter()
+	}
+	return nil
+}
+
+// unlinkUser takes a user off the board and out of the search index and
+// rating moments; lm.mu must be held and the caller marks the change
+func (lm *LeaderboardManager) unlinkUser(user *User) {
+	delete(lm.users, user.Username)
+	if lower := strings.ToLower(user.Username); lm.usernameLower[lower] == user.Username {
+		delete(lm.usernameLower, lower)
+	}
+	lm.removeSorted(user)
+	lm.searchIndex.remove(user)
+	lm.moveRegion(user, user.regionPath(), "")
+	if user.Unranked == "" {
+		lm.rankOut(user)
+	}
+	delete(lm.pending, user)
+}
+
+// appendSorted adds a user at the end of sortedUsers, where the next
+// re-rank picks them up; lm.mu must be held
+func (lm *LeaderboardManager) appendSorted(user *User) {
+	lm.positions[user] = len(lm.sortedUsers)
 	lm.sortedUsers = append(lm.sortedUsers, user)
+}
+
+// removeSorted takes a user out of sortedUsers in constant time: the last
+// ranked user fills their slot and the last user that one's, so ranked
+// users stay ahead of unranked ones. The order among them is restored at
+// the next re-rank, which the caller's change triggers. lm.mu must be held.
+func (lm *LeaderboardManager) removeSorted(user *User) {
+	i, ok := lm.positions[user]
+	if !ok {
+		return
+	}
+	delete(lm.positions, user)
+	last := len(lm.sortedUsers) - 1
+	if i < lm.rankedCount {
+		lm.rankedCount--
+		lm.moveSorted(lm.rankedCount, i)
+		i = lm.rankedCount
+	}
+	lm.moveSorted(last, i)
+	lm.sortedUsers[last] = nil
+	lm.sortedUsers = lm.sortedUsers[:last]
+}
+
+// moveSorted moves the user in one slot of sortedUsers to another
+func (lm *LeaderboardManager) moveSorted(from, to int) {
+	if from == to {
+		return
+	}
+	user := lm.sortedUsers[from]
+	lm.sortedUsers[to] = user
+	lm.positions[user] = to
+}
+
+// markChanged flags the board for re-ranking and bumps its version
+func (lm *LeaderboardManager) markChanged() {
 	lm.needsRerank = true
+	lm.version.Add(1)
+}
+
+// Version returns a counter that changes whenever the board changes
+func (lm *LeaderboardManager) Version() uint64 {
+	return lm.version.Load()
+}
+
+// rebuildNameFilter replaces the username Bloom filter with one sized for twice the current users
+func (lm *LeaderboardManager) rebuildNameFilter() {
+	filter := newBloomFilter(2 * len(lm.users))
+	for username := range lm.users {
+		filter.add(username)
+	}
+	lm.knownNames.Store(filter)
+}
+
+// MightExist reports whether a username may be on the board without taking the
+// leaderboard lock; false means the user definitely doesn't exist
+func (lm *LeaderboardManager) MightExist(username string) bool {
+	return lm.knownNames.Load().mightContain(username)
+}
+
+// writableUser looks up a user about to be written to, enforcing the
+// freeze and the per-user write limit; lm.mu must be held
+func (lm *LeaderboardManager) writableUser(username string) (*User, error) {
+	if freeze.active() {
+		return nil, errBoardFrozen
+	}
+	user, exists := lm.users[username]
+	if !exists {
+		return nil, errUserNotFound
+	}
+	if lm.writeLimiter != nil {
+		if allowed, _, _ := lm.writeLimiter.Allow(username, time.Now()); !allowed {
+			return nil, errUserWriteLimited
+		}
+	}
+	return user, nil
 }
 
 // UpdateRating updates a user's rating
-func (lm *LeaderboardManager) UpdateRating(username string, newRating int) bool {
+func (lm *LeaderboardManager) UpdateRating(username string, newRating int) error {
 	lm.mu.Lock()
 	defer lm.mu.Unlock()
 
+	user, err := lm.writableUser(username)
+	if err != nil {
+		return err
+	}
+
+	lm.applyRating(user, lm.config.clampRating(newRating))
+	return nil
+}
+
+// SubmitScore applies a score submission according to the board's score mode
+func (lm *LeaderboardManager) SubmitScore(username string, score int) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	user, err := lm.writableUser(username)
+	if err != nil {
+		return err
+	}
+
+	before := lm.currentRating(user)
+	after := lm.config.applyScore(before, score)
+	lm.applyRating(user, after)
+	lm.recordContribution(user, before, after)
+	return nil
+}
+
+// UpdateScores sets additional score fields used by the board's composite ordering
+func (lm *LeaderboardManager) UpdateScores(username string, scores map[string]int) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	user, err := lm.writableUser(username)
+	if err != nil {
+		return err
+	}
+
+	if user.Scores == nil {
+		user.Scores = make(map[string]int, len(scores))
+	}
+	// A rating set here supersedes any coalesced rating still waiting to flush
+	if _, ok := scores[RatingField]; ok {
+		delete(lm.pending, user)
+	}
+	for field, value := range scores {
+		if field == RatingField {
+			lm.setRating(user, lm.config.clampRating(value))
+			continue
+		}
+		user.Scores[field] = value
+	}
+	lm.touchLive(user)
+	lm.rankTree.reposition(user)
+	user.LastActive = time.Now()
+	lm.persist(OpScores, user, 0, user.LastActive)
+	if _, ok := scores[RatingField]; ok {
+		user.Updates++
+		lm.updateProvisional(user)
+		lm.recordRating(user, user.Rating, user.LastActive)
+	}
+	lm.markChanged()
+	return nil
+}
+
+// RecordGame counts a finished game (and a win, if won) for a user
+func (lm *LeaderboardManager) RecordGame(username string, won bool) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if freeze.active() {
+		return errBoardFrozen
+	}
 	user, exists := lm.users[username]
 	if !exists {
-		return false
+		return errUserNotFound
 	}
 
-	if newRating < 100 {
-		newRating = 100
-	}
-	if newRating > 5000 {
-		newRating = 5000
+	user.GamesPlayed++
+	if won {
+		user.Wins++
 	}
+	lm.touchLive(user)
+	lm.rankTree.reposition(user)
+	user.LastActive = time.Now()
+	lm.updateProvisional(user)
+	lm.persist(OpGame, user, 0, user.LastActive)
+	lm.markChangedSoon()
+	return nil
+}
 
-	user.Rating = newRating
-	lm.needsRerank = true
-	return true
+// Ordering returns the composite sort keys used to rank the board, tiebreaks included
+func (lm *LeaderboardManager) Ordering() []SortKey {
+	ordering := make([]SortKey, 0, len(lm.config.SortKeys)+len(lm.config.Tiebreaks))
+	ordering = append(ordering, lm.config.SortKeys...)
+	return append(ordering, lm.config.Tiebreaks...)
 }
 
 // recalculateRanks recalculates ranks for all users
@@ -93,12 +380,15 @@ func (lm *LeaderboardManager) recalculateRanks() {
 		return
 	}
 
-	// Sort users by rating (descending), then by username
-	sort.Slice(lm.sortedUsers, func(i, j int) bool {
-		if lm.sortedUsers[i].Rating == lm.sortedUsers[j].Rating {
-			return lm.sortedUsers[i].Username < lm.sortedUsers[j].Username
+	// Sort users by the board's sort keys and tiebreaks, unranked users last; username only keeps fully tied users in a stable order
+	sortUsers(lm.sortedUsers, func(a, b *User) bool {
+		if (a.Unranked == "") != (b.Unranked == "") {
+			return a.Unranked == ""
+		}
+		if cmp := lm.config.compareUsers(a, b); cmp != 0 {
+			return cmp < 0
 		}
-		return lm.sortedUsers[i].Rating > lm.sortedUsers[j].Rating
+		return a.Username < b.Username
 	})
 
 	// Clear rank cache
@@ -106,69 +396,311 @@ func (lm *LeaderboardManager) recalculateRanks() {
 
 	// Assign ranks (handle ties)
 	currentRank := 1
+	lm.rankedCount = 0
 	for i, user := range lm.sortedUsers {
-		if i > 0 && lm.sortedUsers[i-1].Rating != user.Rating {
+		lm.positions[user] = i
+		oldRank := user.Rank
+		if user.Unranked != "" {
+			user.Rank = 0
+			lm.noteRankMove(user, oldRank)
+			continue
+		}
+		lm.rankedCount++
+		if i > 0 && lm.rankBoundary(lm.sortedUsers[i-1], user) {
 			currentRank = i + 1
 		}
 		user.Rank = currentRank
+		lm.noteRankMove(user, oldRank)
 
 		if _, exists := lm.rankCache[user.Rating]; !exists {
 			lm.rankCache[user.Rating] = currentRank
 		}
 	}
 
+	lm.assignPercentiles()
+	lm.checkLeader()
+	lm.checkMilestones()
+	lm.checkPushes()
 	lm.needsRerank = false
 }
 
-// GetLeaderboard returns paginated leaderboard
-func (lm *LeaderboardManager) GetLeaderboard(page, pageSize int) []User {
-	lm.mu.Lock()
-	lm.recalculateRanks()
-	lm.mu.Unlock()
+// GetLeaderboard returns a page of the users the filter selects, in board
+// order. Pages of ranked users come straight from the rank tree, so they
+// never wait for a re-rank, unless the client is outside the rank_tree rollout.
+func (lm *LeaderboardManager) GetLeaderboard(page, pageSize int, filter UnrankedFilter, paths FeaturePaths) []User {
+	if filter == UnrankedExclude && lm.config.RankBand == 0 && paths.RankTree {
+		lm.mu.RLock()
+		defer lm.mu.RUnlock()
+		ranked := lm.rankTree.slice((page-1)*pageSize, pageSize)
+		result := make([]User, len(ranked))
+		for i, user := range ranked {
+			result[i] = lm.rankTree.placed(user, lm.config.LowerIsBetter)
+		}
+		return result
+	}
 
-	lm.mu.RLock()
+	lm.rLockRanked()
 	defer lm.mu.RUnlock()
 
+	users := lm.view(filter)
 	start := (page - 1) * pageSize
 	end := start + pageSize
 
-	if start >= len(lm.sortedUsers) {
+	if start >= len(users) {
 		return []User{}
 	}
 
-	if end > len(lm.sortedUsers) {
-		end = len(lm.sortedUsers)
+	if end > len(users) {
+		end = len(users)
 	}
 
 	result := make([]User, end-start)
 	for i := start; i < end; i++ {
-		result[i-start] = *lm.sortedUsers[i]
+		result[i-start] = users[i].snapshot()
 	}
 
 	return result
 }
 
-// SearchUser searches for users by username (case-insensitive)
-func (lm *LeaderboardManager) SearchUser(searchTerm string) []User {
-	lm.mu.Lock()
-	lm.recalculateRanks()
-	lm.mu.Unlock()
+// RankInfo is the minimal rank lookup result
+type RankInfo struct {
+	Username   string `json:"username"`
+	Rank       int    `json:"rank,omitempty"`
+	Rating     int    `json:"rating"`
+	TotalUsers int    `json:"totalUsers"`
+	// Unranked says why the user has no rank
+	Unranked UnrankedReason `json:"unranked,omitempty"`
+	// Approximate marks a rank estimated from the rating histogram
+	Approximate bool `json:"approximate,omitempty"`
+	// Band is the rating band the rank covers on banded boards
+	Band *Bucket `json:"band,omitempty"`
+}
 
+// GetRank looks up one user's rank without copying any page of the board
+func (lm *LeaderboardManager) GetRank(username string, paths FeaturePaths) (RankInfo, bool) {
+	if !lm.MightExist(username) {
+		return RankInfo{}, false
+	}
+
+	lm.rLockRanks(paths)
+	defer lm.mu.RUnlock()
+
+	user, exists := lm.users[username]
+	if !exists {
+		return RankInfo{}, false
+	}
+	return lm.rankInfo(user, paths), true
+}
+
+// liveRanks reports whether a client's rank lookups read the band counters
+// or the rank tree, rather than the ranks of the last re-rank
+func (lm *LeaderboardManager) liveRanks(paths FeaturePaths) bool {
+	if lm.config.RankBand > 0 {
+		return paths.BandRanks
+	}
+	return paths.RankTree
+}
+
+// rLockRanks takes the read lock for rank lookups, re-ranking first only
+// for clients that read the ranks of the last re-rank
+func (lm *LeaderboardManager) rLockRanks(paths FeaturePaths) {
+	if lm.liveRanks(paths) {
+		lm.mu.RLock()
+		return
+	}
+	lm.rLockRanked()
+}
+
+// rankInfo looks up a user's rank the way the client's features say; lm.mu
+// must be held, via rLockRanks
+func (lm *LeaderboardManager) rankInfo(user *User, paths FeaturePaths) RankInfo {
+	switch {
+	case !lm.liveRanks(paths):
+		return lm.rerankedRankInfo(user)
+	case lm.config.RankBand > 0:
+		return lm.bandRankInfo(user)
+	}
+	return lm.treeRankInfo(user)
+}
+
+// rLockPlacing takes the read lock for reads that place only single users.
+// Unbanded boards place them from the rank tree without a re-rank; banded
+// boards re-rank first, since their percentiles come from one, as do
+// clients outside the rank_tree rollout.
+func (lm *LeaderboardManager) rLockPlacing(paths FeaturePaths) {
+	if lm.config.RankBand > 0 || !paths.RankTree {
+		lm.rLockRanked()
+		return
+	}
 	lm.mu.RLock()
+}
+
+// placedUser is a user with their current rank, percentile and normalized
+// score; lm.mu must be held, via rLockPlacing
+func (lm *LeaderboardManager) placedUser(user *User, paths FeaturePaths) User {
+	switch {
+	case lm.config.RankBand > 0 || !paths.RankTree:
+		return user.snapshot()
+	case !lm.rankTree.has(user):
+		placed := user.snapshot()
+		placed.Rank, placed.Percentile, placed.NormalizedScore = 0, 0, 0
+		return placed
+	}
+	return lm.rankTree.placed(user, lm.config.LowerIsBetter)
+}
+
+// treeRankInfo reads a user's rank from the rank tree, so lookups never wait
+// for a re-rank; lm.mu must be held
+func (lm *LeaderboardManager) treeRankInfo(user *User) RankInfo {
+	return RankInfo{
+		Username:   user.Username,
+		Rank:       lm.rankTree.rank(user),
+		Rating:     user.Rating,
+		TotalUsers: lm.rankTree.len(),
+		Unranked:   user.Unranked,
+	}
+}
+
+// rerankedRankInfo reads a user's rank as of the last re-rank; lm.mu must be
+// held, via rLockRanked
+func (lm *LeaderboardManager) rerankedRankInfo(user *User) RankInfo {
+	info := RankInfo{
+		Username:   user.Username,
+		Rank:       user.Rank,
+		Rating:     user.Rating,
+		TotalUsers: lm.rankedCount,
+		Unranked:   user.Unranked,
+	}
+	if lm.config.RankBand > 0 && user.Unranked == "" {
+		info.Band = lm.moments.histogram.band(user.Rating)
+	}
+	return info
+}
+
+// GetRanks looks up several users' ranks under a single read lock, in the order given.
+// Usernames that aren't on the board are returned separately.
+func (lm *LeaderboardManager) GetRanks(usernames []string, paths FeaturePaths) ([]RankInfo, []string) {
+	lm.rLockRanks(paths)
 	defer lm.mu.RUnlock()
 
+	ranks := make([]RankInfo, 0, len(usernames))
+	notFound := make([]string, 0)
+	for _, username := range usernames {
+		user, exists := lm.users[username]
+		if !exists {
+			notFound = append(notFound, username)
+			continue
+		}
+		ranks = append(ranks, lm.rankInfo(user, paths))
+	}
+	return ranks, notFound
+}
+
+// SearchUser searches for users by username (case-insensitive), best matches first
+func (lm *LeaderboardManager) SearchUser(searchTerm string, paths FeaturePaths) []SearchResult {
 	searchLower := strings.ToLower(searchTerm)
-	results := make([]User, 0)
 
-	for _, user := range lm.sortedUsers {
-		if strings.Contains(strings.ToLower(user.Username), searchLower) {
-			results = append(results, *user)
+	// Consult the search index under its own lock before touching the board,
+	// so index lookups never wait on rating writes
+	var indexed []*User
+	useIndex := false
+	if paths.SearchIndex {
+		indexed, useIndex = lm.searchIndex.candidates(searchLower)
+	}
+
+	lm.rLockRanked()
+	defer lm.mu.RUnlock()
+
+	candidates := lm.sortedUsers
+	if useIndex {
+		// Index postings come out in map order; put them in board order so
+		// results within a match type rank by rating, the same on every call
+		sortBoardOrder(indexed)
+		candidates = indexed
+	}
+	results := make([]SearchResult, 0)
+	for _, user := range candidates {
+		// Skip users removed or replaced since the index lookup
+		if useIndex && lm.users[user.Username] != user {
+			continue
+		}
+		if matchType, start, end, ok := matchUsername(user.Username, searchLower); ok {
+			results = append(results, SearchResult{
+				User:       user.snapshot(),
+				MatchType:  matchType,
+				MatchStart: start,
+				MatchEnd:   end,
+			})
 		}
 	}
 
+	sortByRelevance(results)
 	return results
 }
 
+// searchCandidates returns the users that may match a lowercased term, in
+// board order. It uses the search index when it can answer the term and
+// the client has the search_index feature; the index is maintained either way.
+func (lm *LeaderboardManager) searchCandidates(searchLower string, paths FeaturePaths) []*User {
+	if !paths.SearchIndex {
+		return lm.sortedUsers
+	}
+	candidates, indexed := lm.searchIndex.candidates(searchLower)
+	if !indexed {
+		return lm.sortedUsers
+	}
+	sortBoardOrder(candidates)
+	return candidates
+}
+
+// sortBoardOrder sorts users by rank, then username; lm.mu must be held
+// for reading so ranks don't change underneath
+func sortBoardOrder(users []*User) {
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Rank == users[j].Rank {
+			return users[i].Username < users[j].Username
+		}
+		return sortableRank(users[i].Rank) < sortableRank(users[j].Rank)
+	})
+}
+
+// SearchRegex scans usernames with a regular expression until the deadline.
+// It reports false when the deadline cut the scan short.
+func (lm *LeaderboardManager) SearchRegex(re *regexp.Regexp, deadline time.Time) ([]SearchResult, bool) {
+	lm.rLockRanked()
+	defer lm.mu.RUnlock()
+
+	results := make([]SearchResult, 0)
+	for i, user := range lm.sortedUsers {
+		if i%1000 == 0 && time.Now().After(deadline) {
+			return results, false
+		}
+		if loc := re.FindStringIndex(user.Username); loc != nil {
+			results = append(results, SearchResult{
+				User:       user.snapshot(),
+				MatchType:  MatchRegex,
+				MatchStart: loc[0],
+				MatchEnd:   loc[1],
+			})
+		}
+	}
+	return results, true
+}
+
+// RebuildSearchIndex re-indexes every username from scratch, for recovery
+// if the incrementally maintained index is ever suspected to be wrong
+func (lm *LeaderboardManager) RebuildSearchIndex() (users int, grams int) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	indexed := make([]*User, 0, len(lm.users))
+	for _, user := range lm.users {
+		indexed = append(indexed, user)
+	}
+	lm.searchIndex.reindex(indexed)
+	return len(indexed), lm.searchIndex.size()
+}
+
 // GetTotalUsers returns total number of users
 func (lm *LeaderboardManager) GetTotalUsers() int {
 	lm.mu.RLock()
@@ -192,6 +724,8 @@ func (lm *LeaderboardManager) SeedUsers(count int) {
 		"pandey", "chauhan", "ghosh", "banerjee", "saxena", "trivedi",
 	}
 
+	countries := []string{"IN", "US", "GB", "CA", "AU", "SG", "AE", "DE"}
+
 	rand.Seed(time.Now().UnixNano())
 
 	fmt.Println("Starting to seed users...")
@@ -203,6 +737,7 @@ func (lm *LeaderboardManager) SeedUsers(count int) {
 		rating := rand.Intn(4901) + 100 // 100 to 5000
 
 		lm.AddUser(username, rating)
+		lm.SetCountry(username, countries[rand.Intn(len(countries))])
 
 		if (i+1)%1000 == 0 {
 			fmt.Printf("Seeded %d users...\n", i+1)
@@ -212,12 +747,31 @@ func (lm *LeaderboardManager) SeedUsers(count int) {
 	log.Printf("✅ Successfully seeded %d users!", count)
 }
 
-// SimulateScoreUpdates continuously updates random user scores
-func (lm *LeaderboardManager) SimulateScoreUpdates(updatesPerSecond int) {
-	ticker := time.NewTicker(time.Second / time.Duration(updatesPerSecond))
+// SimulateScoreUpdates continuously updates random user scores, backing off
+// while the API is under real load, until ctx is cancelled. The returned
+// channel closes once the simulator has stopped.
+func (lm *LeaderboardManager) SimulateScoreUpdates(ctx context.Context, updatesPerSecond int) <-chan struct{} {
+	interval := time.Second / time.Duration(updatesPerSecond)
+	job := backgroundJobs.register(simulatorJob, interval)
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
+		defer ticker.Stop()
 		updateCount := 0
-		for range ticker.C {
+		for {
+			var start time.Time
+			select {
+			case <-ctx.Done():
+				simulator.set(SimulatorStopped, time.Now())
+				return
+			case start = <-ticker.C:
+			}
+			if !simulator.allow(start) {
+				job.ran(start)
+				continue
+			}
+
 			lm.mu.RLock()
 			if len(lm.sortedUsers) == 0 {
 				lm.mu.RUnlock()
@@ -227,140 +781,760 @@ func (lm *LeaderboardManager) SimulateScoreUpdates(updatesPerSecond int) {
 			username := randomUser.Username
 			lm.mu.RUnlock()
 
-			// Random rating change between -50 and +50
-			change := rand.Intn(101) - 50
-			lm.mu.RLock()
-			user := lm.users[username]
-			currentRating := user.Rating
-			lm.mu.RUnlock()
+			if lm.config.ScoreMode == ScoreModeCumulative {
+				// Random points earned between 0 and 50
+				points := rand.Intn(51)
+				if lm.SubmitScore(username, points) == nil {
+					lm.RecordGame(username, points > 25)
+				}
+			} else {
+				// Random rating change between -50 and +50
+				change := rand.Intn(101) - 50
+				lm.mu.RLock()
+				user, exists := lm.users[username]
+				if !exists {
+					// Deleted since it was picked
+					lm.mu.RUnlock()
+					continue
+				}
+				currentRating := user.Rating
+				lm.mu.RUnlock()
 
-			newRating := currentRating + change
-			lm.UpdateRating(username, newRating)
+				if lm.SubmitScore(username, currentRating+change) == nil {
+					lm.RecordGame(username, change > 0)
+				}
+			}
 
+			job.ran(start)
 			updateCount++
 			if updateCount%100 == 0 {
 				log.Printf("📊 Processed %d score updates...", updateCount)
 			}
 		}
 	}()
+	return done
 }
 
 var leaderboard *LeaderboardManager
 
 func main() {
+	scoreMode := flag.String("score-mode", string(ScoreModeReplace), "how submitted scores apply: replace, cumulative or ewma (recency-weighted average)")
+	ewmaAlpha := flag.Float64("ewma-alpha", defaultEWMAAlpha, "in ewma mode, the weight of each new score against the running average (0-1]")
+	minRating := flag.String("min-rating", "100", "lowest allowed rating in display units, e.g. -20 or 12.5 on decimal2 boards, or \"none\" for no lower bound")
+	maxRating := flag.String("max-rating", "5000", "highest allowed rating in display units, or \"none\" for no upper bound")
+	lowerIsBetter := flag.Bool("lower-is-better", false, "rank lower ratings first (golf scores, penalties, times)")
+	sortKeys := flag.String("sort-keys", "", "composite ordering, e.g. wins:desc,games:asc,time:asc (default: rating)")
+	tiebreaks := flag.String("tiebreaks", "", "ordering among users tied on the sort keys, e.g. wins:desc,gamesPlayed:asc (default: tied users share a rank)")
+	flag.IntVar(&pageLimits.DefaultSize, "default-page-size", pageLimits.DefaultSize, "page size used when a request doesn't ask for one")
+	flag.IntVar(&pageLimits.MaxSize, "max-page-size", pageLimits.MaxSize, "largest page size a request may ask for")
+	flag.IntVar(&pageLimits.MaxOffset, "max-page-offset", pageLimits.MaxOffset, "deepest row a page may start at (0 for no limit)")
+	flag.StringVar(&adminToken, "admin-token", os.Getenv("ADMIN_TOKEN"), "token required in X-Admin-Token for /api/admin routes (default $ADMIN_TOKEN)")
+	flag.StringVar(&serverConfig.Addr, "addr", serverConfig.Addr, "address to listen on")
+	flag.StringVar(&serverConfig.TLSCert, "tls-cert", "", "TLS certificate file; enables HTTPS and HTTP/2")
+	flag.StringVar(&serverConfig.TLSKey, "tls-key", "", "TLS private key file")
+	flag.BoolVar(&serverConfig.H2C, "h2c", false, "accept cleartext HTTP/2 (h2c) from internal clients")
+	flag.DurationVar(&routeTimeouts.Default, "request-timeout", routeTimeouts.Default, "how long a request may run before it is cancelled (0 for no limit)")
+	exportTimeout := flag.Duration("export-timeout", routeTimeouts.Routes["/api/admin/export"], "how long a board export may run before it is cancelled (0 for no limit)")
+	flag.IntVar(&loadLimits.MaxInFlight, "max-in-flight", loadLimits.MaxInFlight, "requests served concurrently before new ones queue (0 for no limit)")
+	flag.IntVar(&loadLimits.MaxQueue, "max-queue", loadLimits.MaxQueue, "requests that may wait for a slot before new ones get 429")
+	flag.DurationVar(&loadLimits.QueueWait, "queue-wait", loadLimits.QueueWait, "how long a queued request waits for a slot before getting 429")
+	flag.DurationVar(&simulatorLatencyBudget, "simulator-latency-budget", simulatorLatencyBudget, "average API latency above which the score simulator pauses; it throttles past half of this")
+	exportScheduleFile := flag.String("export-schedule", "", "JSON file of recurring CSV/NDJSON exports of the board or saved views to s3://, gs:// or file:// destinations")
+	digestsFile := flag.String("digests", "", "JSON file of periodic board digests (top 10, biggest movers, new records) and the webhooks or emails they go to")
+	pushFile := flag.String("push", "", "JSON file of FCM/APNs credentials and rank tiers for pushing milestones to registered devices")
+	regionID := flag.String("region-id", "", "name of this instance's region when replicating with --peers")
+	peers := flag.String("peers", "", "comma-separated base URLs of the other regions to replicate rating updates with")
+	flag.DurationVar(&liveLimits.FlushEvery, "live-interval", liveLimits.FlushEvery, "how often rank changes are collected for /ws/leaderboard clients; a user changed several times in between appears once")
+	flag.Float64Var(&liveLimits.MaxRate, "live-max-rate", liveLimits.MaxRate, "messages of changes each /ws/leaderboard client is sent per second at most; changes in between are merged per user (0 for no limit)")
+	flag.IntVar(&liveLimits.MaxPending, "live-max-pending", liveLimits.MaxPending, "users' changes that may wait for a /ws/leaderboard client before it is sent a fresh snapshot instead")
+	flag.StringVar(&liveToken, "live-token", os.Getenv("LIVE_TOKEN"), "token /ws/leaderboard clients must present in X-Live-Token or ?token= (default $LIVE_TOKEN; empty allows anyone)")
+	replicationSecret := flag.String("replication-secret", os.Getenv("REPLICATION_SECRET"), "shared secret peers present in X-Replication-Secret (default $REPLICATION_SECRET)")
+	conflictResolution := flag.String("conflict-resolution", string(ConflictLatest), "how replicated updates to the same user resolve: latest or max")
+	notifiersFile := flag.String("notifiers", "", "JSON file of Slack, Discord and email notifiers for board events")
+	discordKey := flag.String("discord-public-key", os.Getenv("DISCORD_PUBLIC_KEY"), "Discord application public key; enables /api/integrations/discord (default $DISCORD_PUBLIC_KEY)")
+	flag.StringVar(&slackSigningSecret, "slack-signing-secret", os.Getenv("SLACK_SIGNING_SECRET"), "Slack app signing secret; enables /api/integrations/slack (default $SLACK_SIGNING_SECRET)")
+	flag.IntVar(&rateLimitPerMinute, "rate-limit", rateLimitPerMinute, "requests each client (API key or IP) may make per minute (0 for no limit)")
+	featureSpec := flag.String("features", "", "feature rollout (search_index, rank_tree, approx_ranks, band_ranks), e.g. rank_tree=off or search_index=25 for 25% of clients")
+	flag.Func("rating-history-retention", "how long rating history is kept, e.g. 90d (default: last 100 changes per user)", func(s string) (err error) {
+		retention.RatingHistory, err = ParseRetention(s)
+		return err
+	})
+	flag.Func("audit-retention", "how long admin audit entries are kept, e.g. 365d (default: last 10000 entries)", func(s string) (err error) {
+		retention.AuditLog, err = ParseRetention(s)
+		return err
+	})
+	flag.Func("tombstone-grace", "how long a deleted user can be restored before being purged, e.g. 30d (default 30d)", func(s string) (err error) {
+		tombstoneGrace, err = ParseRetention(s)
+		return err
+	})
+	userWriteLimit := flag.Int("user-write-limit", 0, "updates a single user may receive per minute; excess updates are rejected (0 for no limit)")
+	seedCount := flag.Int("seed", 1000, "how many demo users to seed at startup on an empty board")
+	noSeed := flag.Bool("no-seed", false, "start without demo users (same as --seed=0)")
+	coalesceWrites := flag.Duration("coalesce-writes", 0, "apply rating updates in batches at this interval, e.g. 100ms (0 applies each update immediately)")
+	minGames := flag.Int("min-games", 0, "games or rating updates a user needs before being ranked; until then they are provisional (0 ranks everyone)")
+	var scoreWindow time.Duration
+	flag.Func("score-window", "how long each submitted score counts, e.g. 7d; expired scores come off cumulative ratings and leave replace-mode users decayed (default: forever)", func(s string) (err error) {
+		scoreWindow, err = ParseRetention(s)
+		return err
+	})
+	rankBand := flag.Int("rank-band", 0, "rank users only to bands this many rating points wide, for very high write rates (0 ranks exactly)")
+	flag.IntVar(&exactRankTop, "exact-ranks", exactRankTop, "how many top ranks are always exact; deeper ranks may be estimated with approximate=true")
+	rankInterval := flag.Duration("rank-interval", 0, "re-rank in the background at this interval, e.g. 250ms, so reads never wait to re-rank and see ranks at most this old (0 re-ranks on demand)")
+	rankChangeInterval := flag.Duration("rank-change-interval", 0, "publish a rank_changes event at this interval listing who changed rank, e.g. 1s (0 disables)")
+	scoreFormat := flag.String("score-format", string(ScoreFormatInteger), "how ratings are displayed: integer, decimal2 (ratings in hundredths) or time (ratings in seconds, shown as m:ss)")
+	dataDir := flag.String("data-dir", "", "directory to keep the board in across restarts: periodic snapshots plus a log of updates since (default: in memory only)")
+	storageEngine := flag.String("storage", string(StorageBolt), "with --data-dir, how the board is stored: bolt (a BoltDB file) or file (a JSON snapshot and an NDJSON update log)")
+	snapshotInterval := flag.Duration("snapshot-interval", 5*time.Minute, "with --data-dir, how often to snapshot the board and compact the update log")
+	compactAfter := flag.Int("compact-after", 100000, "with --data-dir, fold the update log into a snapshot once it holds this many updates, ahead of --snapshot-interval (0 waits for the interval)")
+	keepSnapshots := flag.Int("keep-snapshots", 12, "with --data-dir, how many snapshots to keep, with the updates since the oldest, for point-in-time restores (1 keeps only the latest)")
+	searchEngine := flag.String("search-index", string(SearchTrigram), "how usernames are indexed for search: trigram (built-in trigram index) or bleve (in-memory bleve index)")
+	compress := flag.Bool("compress", true, "compress responses with Brotli or gzip when the client accepts it")
+	flag.Parse()
+	routeTimeouts.Routes["/api/admin/export"] = *exportTimeout
+
+	config := DefaultBoardConfig()
+	mode, err := ParseScoreMode(*scoreMode)
+	if err != nil {
+		log.Fatal("❌ Invalid configuration: ", err)
+	}
+	config.ScoreMode = mode
+	config.EWMAAlpha = *ewmaAlpha
+	if config.ScoreFormat, err = ParseScoreFormat(*scoreFormat); err != nil {
+		log.Fatal("❌ Invalid configuration: ", err)
+	}
+	if config.MinRating, err = ParseRatingBound(*minRating, config.ScoreFormat); err != nil {
+		log.Fatal("❌ Invalid configuration: ", err)
+	}
+	if config.MaxRating, err = ParseRatingBound(*maxRating, config.ScoreFormat); err != nil {
+		log.Fatal("❌ Invalid configuration: ", err)
+	}
+	config.LowerIsBetter = *lowerIsBetter
+	config.SortKeys = []SortKey{{Field: RatingField, Ascending: config.LowerIsBetter}}
+	if *sortKeys != "" {
+		if *lowerIsBetter {
+			log.Fatal("❌ Invalid configuration: --lower-is-better can't be combined with --sort-keys; give the rating key its direction instead, e.g. rating:asc")
+		}
+		if config.SortKeys, err = ParseSortKeys(*sortKeys); err != nil {
+			log.Fatal("❌ Invalid configuration: ", err)
+		}
+		// The first key's direction says whether lower ratings are better
+		config.LowerIsBetter = config.SortKeys[0].Field == RatingField && config.SortKeys[0].Ascending
+	}
+	if *tiebreaks != "" {
+		if config.Tiebreaks, err = ParseSortKeys(*tiebreaks); err != nil {
+			log.Fatal("❌ Invalid configuration: ", err)
+		}
+	}
+	config.RankBand = *rankBand
+	config.MinGames = *minGames
+	config.ScoreWindow = scoreWindow
+	if config.SearchEngine, err = ParseSearchEngine(*searchEngine); err != nil {
+		log.Fatal("❌ Invalid configuration: ", err)
+	}
+	if err := config.Validate(); err != nil {
+		log.Fatal("❌ Invalid configuration: ", err)
+	}
+	if err := pageLimits.Validate(); err != nil {
+		log.Fatal("❌ Invalid configuration: ", err)
+	}
+	if *seedCount < 0 {
+		log.Fatal("❌ Invalid configuration: --seed must not be negative")
+	}
+	if err := loadLimits.Validate(); err != nil {
+		log.Fatal("❌ Invalid configuration: ", err)
+	}
+	if err := liveLimits.Validate(); err != nil {
+		log.Fatal("❌ Invalid configuration: ", err)
+	}
+	// Created before the simulator starts, which watches it for load
+	loadShedder = NewLoadShedder(loadLimits)
+	if *featureSpec != "" {
+		if err := features.ParseFeatures(*featureSpec); err != nil {
+			log.Fatal("❌ Invalid configuration: ", err)
+		}
+	}
+	if *coalesceWrites < 0 {
+		log.Fatal("❌ Invalid configuration: --coalesce-writes must not be negative")
+	}
+	if *rankInterval < 0 {
+		log.Fatal("❌ Invalid configuration: --rank-interval must not be negative")
+	}
+	if *rankChangeInterval < 0 {
+		log.Fatal("❌ Invalid configuration: --rank-change-interval must not be negative")
+	}
+	if exactRankTop < 0 {
+		log.Fatal("❌ Invalid configuration: --exact-ranks must not be negative")
+	}
+	if *userWriteLimit < 0 {
+		log.Fatal("❌ Invalid configuration: --user-write-limit must not be negative")
+	}
+	if rateLimitPerMinute < 0 {
+		log.Fatal("❌ Invalid configuration: --rate-limit must not be negative")
+	}
+	if err := routeTimeouts.Validate(); err != nil {
+		log.Fatal("❌ Invalid configuration: ", err)
+	}
+	if err := serverConfig.Validate(); err != nil {
+		log.Fatal("❌ Invalid configuration: ", err)
+	}
+	if *discordKey != "" {
+		if discordPublicKey, err = ParseDiscordPublicKey(*discordKey); err != nil {
+			log.Fatal("❌ Invalid configuration: ", err)
+		}
+	}
+
 	fmt.Println("🏆 ========================================")
 	fmt.Println("🏆  SCALABLE LEADERBOARD SYSTEM - BACKEND")
 	fmt.Println("🏆 ========================================")
 	fmt.Println()
 
 	// Initialize leaderboard
-	leaderboard = NewLeaderboardManager()
+	leaderboard = NewLeaderboardManager(config)
+	leaderboard.LimitUserWrites(*userWriteLimit)
+	if *coalesceWrites > 0 {
+		leaderboard.CoalesceWrites(*coalesceWrites)
+	}
+	if *rankInterval > 0 {
+		leaderboard.RankEvery(*rankInterval)
+	}
+	leaderboard.RunLiveUpdates()
 
-	// Seed with 10,000 users
-	log.Println("📦 Seeding database with users...")
-	leaderboard.SeedUsers(1000)
-	fmt.Println()
+	var replicator *Replicator
+	if *peers != "" {
+		resolution, err := ParseConflictResolution(*conflictResolution)
+		if err != nil {
+			log.Fatal("❌ Invalid configuration: ", err)
+		}
+		if replicator, err = NewReplicator(*regionID, strings.Split(*peers, ","), *replicationSecret, resolution, config); err != nil {
+			log.Fatal("❌ Invalid configuration: ", err)
+		}
+	}
+
+	// Load the board from disk before anything writes to it
+	if *dataDir != "" {
+		if *snapshotInterval <= 0 {
+			log.Fatal("❌ Invalid configuration: --snapshot-interval must be positive")
+		}
+		if *keepSnapshots < 1 {
+			log.Fatal("❌ Invalid configuration: --keep-snapshots must be at least 1")
+		}
+		if *compactAfter < 0 {
+			log.Fatal("❌ Invalid configuration: --compact-after must not be negative")
+		}
+		engine, err := ParseStorageEngine(*storageEngine)
+		if err != nil {
+			log.Fatal("❌ Invalid configuration: ", err)
+		}
+		storage, err := OpenStorage(engine, *dataDir, *keepSnapshots)
+		if err == nil {
+			err = leaderboard.AttachStorage(storage, fmt.Sprintf("%s (%s)", *dataDir, engine))
+		}
+		if err != nil {
+			log.Fatal("❌ Failed to load board from ", *dataDir, ": ", err)
+		}
+	}
+
+	// Seed demo users, unless told not to or the board already has data
+	switch {
+	case *noSeed || *seedCount == 0:
+		log.Println("📦 Seeding disabled, starting with an empty board")
+	case leaderboard.GetTotalUsers() > 0:
+		log.Printf("📦 Board already has %d users, skipping seeding", leaderboard.GetTotalUsers())
+	default:
+		log.Println("📦 Seeding database with users...")
+		leaderboard.SeedUsers(*seedCount)
+		fmt.Println()
+	}
+	if *dataDir != "" {
+		if err := leaderboard.Snapshot(); err != nil {
+			log.Printf("⚠️  Snapshot failed: %v", err)
+		}
+		leaderboard.PersistEvery(*snapshotInterval, *compactAfter)
+	}
+	// Replicate from here on, so demo users stay local to each region
+	if replicator != nil {
+		replication = replicator
+		replication.Run()
+	}
 
 	// Start simulating score updates (10 updates per second)
 	log.Println("🔄 Starting real-time score update simulation...")
 	log.Println("   → 10 score updates per second")
-	leaderboard.SimulateScoreUpdates(10)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	simulatorDone := leaderboard.SimulateScoreUpdates(ctx, 10)
+	leaderboard.TrackRankHistory(5 * time.Minute)
+	boardUpdates.Track(leaderboard)
+	leaderboard.EnforceRetention(retention)
+	leaderboard.PurgeDeletedUsers()
+	leaderboard.ExpireScoresEvery(scoreExpiryInterval)
+	if *notifiersFile != "" {
+		if notifications, err = LoadNotifications(*notifiersFile); err != nil {
+			log.Fatal("❌ Invalid configuration: ", err)
+		}
+		log.Printf("🔔 Sending board events to %d notifier(s)", len(notifications.sinks))
+	}
+	if *pushFile != "" {
+		if pushes, err = LoadPush(*pushFile); err != nil {
+			log.Fatal("❌ Invalid configuration: ", err)
+		}
+		log.Printf("📱 Pushing rank milestones through %d provider(s)", len(pushes.providers))
+	}
+	if *digestsFile != "" {
+		if digests, err = LoadDigests(*digestsFile); err != nil {
+			log.Fatal("❌ Invalid configuration: ", err)
+		}
+		digests.Run()
+	}
+	if *exportScheduleFile != "" {
+		schedules, err := LoadExportSchedules(*exportScheduleFile)
+		if err != nil {
+			log.Fatal("❌ Invalid configuration: ", err)
+		}
+		RunExportSchedules(schedules)
+	}
+	if *rankChangeInterval > 0 {
+		leaderboard.SummarizeRankChanges(*rankChangeInterval)
+	}
+	// Events also feed /feed.xml, so watch for them even without notifiers
+	leaderboard.WatchLeader(30 * time.Second)
+	registerDependencies()
 	fmt.Println()
 
 	// Setup Gin router
 	gin.SetMode(gin.ReleaseMode)
-	router := gin.Default()
-
-	// CORS configuration
-	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{"*"}
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept"}
-	router.Use(cors.New(config))
-
-	// API Routes
-	router.GET("/api/leaderboard", getLeaderboard)
-	router.GET("/api/search", searchUsers)
-	router.GET("/api/stats", getStats)
-
-	// Health check
-	router.GET("/", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status":  "running",
-			"message": "Leaderboard API is live!",
-			"users":   leaderboard.GetTotalUsers(),
-		})
-	})
+	router := setupRouter(*compress)
 
 	// Start server
 	fmt.Println("🚀 ========================================")
 	fmt.Println("🚀  SERVER STARTED SUCCESSFULLY!")
 	fmt.Println("🚀 ========================================")
 	fmt.Println()
-	fmt.Println("📍 Server running on: http://localhost:8080")
+	fmt.Println("📍 Server running on:", serverConfig.URL())
 	fmt.Println()
 	fmt.Println("📌 Available Endpoints:")
-	fmt.Println("   GET  /api/leaderboard?page=1&pageSize=50")
+	fmt.Println("   GET  /api/leaderboard?page=1&pageSize=50&unranked=include")
 	fmt.Println("   GET  /api/search?q=username")
+	fmt.Println("   GET  /api/autocomplete?q=ra")
+	fmt.Println("   GET  /api/leaderboard?page=2&prefetch=true")
+	fmt.Println("   GET  /api/leaderboard?page=500&approximate=true")
+	fmt.Println("   GET  /api/leaderboard?region=IN/Karnataka")
+	fmt.Println("   GET  /api/leaderboard?filter=rating>2500 AND country=IN AND active_within:7d")
+	fmt.Println("   GET  /api/rank?username=X")
+	fmt.Println("   POST /api/rank/batch")
 	fmt.Println("   GET  /api/stats")
+	fmt.Println("   GET  /api/health")
+	fmt.Println("   GET  /api/stats/summary")
+	fmt.Println("   GET  /api/stats/distribution?width=50")
+	fmt.Println("   GET  /api/stats/estimate/above?rating=3000")
+	fmt.Println("   GET  /api/stats/estimate/percentile?rating=3000")
+	fmt.Println("   POST /api/users?dryRun=true (admin)")
+	fmt.Println("   GET  /api/users/:username")
+	fmt.Println("   PUT  /api/users/:username/rating?dryRun=true (admin)")
+	fmt.Println("   PUT  /api/users/:username/scores (admin)")
+	fmt.Println("   DELETE /api/users/:username?purge=true (admin)")
+	fmt.Println("   GET  /api/users/:username/velocity")
+	fmt.Println("   GET  /api/users/:username/rivals?range=100")
+	fmt.Println("   GET  /api/users/:username/history?resolution=day")
+	fmt.Println("   POST /api/users/:username/devices (admin)")
+	fmt.Println("   DELETE /api/users/:username/devices/:token (admin)")
+	fmt.Println("   GET  /api/leaderboard/climbers?window=hour")
+	fmt.Println("   GET  /api/rank-changes?after=<seq>")
+	fmt.Println("   GET  /api/leaderboard/countries?metric=topAverage&k=10")
+	fmt.Println("   GET  /api/views")
+	fmt.Println("   GET  /api/embed/top?limit=10")
+	fmt.Println("   GET  /feed.xml")
+	fmt.Println("   GET  /ws/leaderboard?token=<live token>&resume=<id> (WebSocket)")
+	fmt.Println("   GET  /api/views/:name?page=1&pageSize=50")
+	fmt.Println("   POST /api/integrations/discord")
+	fmt.Println("   POST /api/integrations/slack")
+	fmt.Println("   POST /api/internal/replicate (peer regions)")
+	fmt.Println("   GET  /api/admin/overview (admin)")
+	fmt.Println("   GET  /api/admin/search/top (admin)")
+	fmt.Println("   POST /api/admin/search/rebuild (admin)")
+	fmt.Println("   GET  /api/admin/export?format=ndjson (admin)")
+	fmt.Println("   GET  /api/admin/exports/scheduled (admin)")
+	fmt.Println("   POST /api/admin/exports/scheduled/:name/run (admin)")
+	fmt.Println("   GET  /api/admin/audit (admin)")
+	fmt.Println("   GET  /api/admin/clients (admin)")
+	fmt.Println("   POST /api/admin/users/:username/rollback?to=<timestamp|version>&dryRun=true (admin)")
+	fmt.Println("   DELETE /api/admin/users/:username (admin)")
+	fmt.Println("   POST /api/admin/users/:username/restore (admin)")
+	fmt.Println("   GET  /api/admin/users/deleted (admin)")
+	fmt.Println("   PUT  /api/admin/users/:username/unranked (admin)")
+	fmt.Println("   DELETE /api/admin/users/:username/unranked (admin)")
+	fmt.Println("   PUT  /api/admin/users/:username/country (admin)")
+	fmt.Println("   PUT  /api/admin/users/:username/region (admin)")
+	fmt.Println("   POST /api/admin/bulk (admin)")
+	fmt.Println("   GET  /api/admin/bulk/:id (admin)")
+	fmt.Println("   POST /api/admin/imports (admin)")
+	fmt.Println("   GET  /api/admin/imports/:id (admin)")
+	fmt.Println("   PUT  /api/admin/views/:name (admin)")
+	fmt.Println("   DELETE /api/admin/views/:name (admin)")
+	fmt.Println("   POST /api/admin/restore?to=<timestamp|version>&dryRun=true (admin)")
+	fmt.Println("   POST /api/admin/storage/compact (admin)")
+	fmt.Println("   GET  /api/admin/storage/verify (admin)")
+	fmt.Println("   GET  /api/admin/replication (admin)")
+	fmt.Println("   GET  /api/admin/digests (admin)")
+	fmt.Println("   GET  /api/admin/digests/:name/preview?format=html (admin)")
+	fmt.Println("   POST /api/admin/digests/:name/send (admin)")
+	fmt.Println("   PUT  /api/admin/freeze (admin)")
+	fmt.Println("   DELETE /api/admin/freeze (admin)")
+	fmt.Println("   GET  /api/admin/features (admin)")
+	fmt.Println("   PUT  /api/admin/features/:name (admin)")
 	fmt.Println()
 	fmt.Println("💡 Press Ctrl+C to stop the server")
 	fmt.Println()
 
-	if err := router.Run(":8080"); err != nil {
+	server := newServer(router, serverConfig)
+	go func() {
+		<-ctx.Done()
+		log.Println("🛑 Shutting down...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("⚠️  Shutdown: %v", err)
+		}
+	}()
+	if err := listen(server, serverConfig); err != nil {
 		log.Fatal("❌ Failed to start server:", err)
 	}
+	stop()
+	<-simulatorDone
+	leaderboard.CloseStorage()
+	log.Println("👋 Stopped")
 }
 
 // Handler: Get paginated leaderboard
 func getLeaderboard(c *gin.Context) {
-	page := 1
-	pageSize := 50
+	page, pageSize, ok := parsePageParams(c)
+	if !ok {
+		return
+	}
 
-	if p := c.Query("page"); p != "" {
-		fmt.Sscanf(p, "%d", &page)
+	filter, ok := unrankedFilterParam(c)
+	if !ok {
+		return
+	}
+	expr, ok := filterExprParam(c)
+	if !ok {
+		return
+	}
+	if expr != nil {
+		getFilteredLeaderboard(c, expr, page, pageSize, filter)
+		return
 	}
-	if ps := c.Query("pageSize"); ps != "" {
-		fmt.Sscanf(ps, "%d", &pageSize)
+	if c.Query("region") != "" {
+		getRegionalLeaderboard(c, page, pageSize, filter)
+		return
 	}
 
-	if page < 1 {
-		page = 1
+	version := leaderboard.Version()
+	paths := features.For(clientID(c))
+	var users []User
+	approximate := false
+	if c.Query("approximate") == "true" && filter == UnrankedExclude && features.Enabled(FeatureApproxRanks, clientID(c)) {
+		users, approximate = leaderboard.GetLeaderboardApprox(page, pageSize, paths)
+	} else {
+		users = cachedLeaderboardPage(page, pageSize, filter, version, paths)
 	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 50
+	totalUsers := leaderboard.CountUsers(filter)
+	setListHeaders(c, totalUsers, version)
+	if c.Query("prefetch") == "true" {
+		prefetchAdjacent(page, pageSize, totalUsers, filter, version, paths)
 	}
 
-	users := leaderboard.GetLeaderboard(page, pageSize)
+	response := gin.H{
+		"users":       users,
+		"totalUsers":  totalUsers,
+		"ordering":    leaderboard.Ordering(),
+		"display":     leaderboard.Display(),
+		"approximate": approximate,
+	}
+	addPagination(response, c, page, pageSize, totalUsers)
+	respond(c, 200, response)
+}
 
-	c.JSON(200, gin.H{
-		"users":      users,
-		"page":       page,
-		"pageSize":   pageSize,
-		"totalUsers": leaderboard.GetTotalUsers(),
-	})
+// Handler: Leaderboard size and version without a body
+func headLeaderboard(c *gin.Context) {
+	filter, err := ParseUnrankedFilter(c.Query("unranked"))
+	if err != nil {
+		c.Status(400)
+		return
+	}
+	setListHeaders(c, leaderboard.CountUsers(filter), leaderboard.Version())
+	c.Status(200)
 }
 
 // Handler: Search users
 func searchUsers(c *gin.Context) {
 	query := c.Query("q")
 	if query == "" {
-		c.JSON(400, gin.H{"error": "query parameter 'q' is required"})
+		respond(c, 400, gin.H{"error": "query parameter 'q' is required"})
 		return
 	}
 
-	results := leaderboard.SearchUser(query)
+	if c.Query("mode") == "regex" {
+		searchUsersByRegex(c, query)
+		return
+	}
+	if c.Query("stream") == "true" {
+		searchTrends.Record(query)
+		streamSearchResults(c, query)
+		return
+	}
+
+	page, pageSize, ok := parsePageParams(c)
+	if !ok {
+		return
+	}
+	expr, ok := filterExprParam(c)
+	if !ok {
+		return
+	}
 
-	c.JSON(200, gin.H{
-		"results": results,
+	searchTrends.Record(query)
+	version := leaderboard.Version()
+	results := leaderboard.SearchUser(query, features.For(clientID(c)))
+	if expr != nil {
+		results = filterSearchResults(results, expr)
+	}
+	setListHeaders(c, len(results), version)
+
+	response := gin.H{
+		"results": pageOf(results, page, pageSize),
 		"count":   len(results),
+	}
+	addPagination(response, c, page, pageSize, len(results))
+	respond(c, 200, response)
+}
+
+// Handler: Search result count and board version without a body
+func headSearch(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" || c.Query("mode") == "regex" {
+		c.Status(400)
+		return
+	}
+
+	version := leaderboard.Version()
+	setListHeaders(c, len(leaderboard.SearchUser(query, features.For(clientID(c)))), version)
+	c.Status(200)
+}
+
+// searchUsersByRegex handles the admin-only mode=regex search
+func searchUsersByRegex(c *gin.Context, pattern string) {
+	if !isAdmin(c) {
+		respond(c, 403, gin.H{"error": "mode=regex requires a valid X-Admin-Token header"})
+		return
+	}
+
+	re, err := compileSearchRegex(pattern)
+	if err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	deadline := time.Now().Add(regexSearchTimeout)
+	if d, ok := c.Request.Context().Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	results, complete := leaderboard.SearchRegex(re, deadline)
+	respond(c, 200, gin.H{
+		"results":  results,
+		"count":    len(results),
+		"timedOut": !complete,
+	})
+}
+
+// Handler: Rebuild the search index
+func rebuildSearchIndex(c *gin.Context) {
+	start := time.Now()
+	users, grams := leaderboard.RebuildSearchIndex()
+	log.Printf("🔎 Rebuilt search index: %d users, %d trigrams in %s", users, grams, time.Since(start))
+
+	respond(c, 200, gin.H{
+		"users":      users,
+		"trigrams":   grams,
+		"durationMs": time.Since(start).Milliseconds(),
+	})
+}
+
+// Handler: Get a single user's rank
+func getRank(c *gin.Context) {
+	username := c.Query("username")
+	if username == "" {
+		respond(c, 400, gin.H{"error": "query parameter 'username' is required"})
+		return
+	}
+
+	lookup := leaderboard.GetRank
+	if c.Query("approximate") == "true" && features.Enabled(FeatureApproxRanks, clientID(c)) {
+		lookup = leaderboard.GetRankApprox
+	}
+	info, ok := lookup(username, features.For(clientID(c)))
+	if !ok {
+		respond(c, 404, gin.H{"error": "user not found"})
+		return
+	}
+	respond(c, 200, info)
+}
+
+// maxBatchRankSize caps how many usernames one batch rank request may ask for
+const maxBatchRankSize = 100
+
+// Handler: Get several users' ranks in one call
+func getRanksBatch(c *gin.Context) {
+	var req struct {
+		Usernames []string `json:"usernames"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, 400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	if len(req.Usernames) == 0 {
+		respond(c, 400, gin.H{"error": "'usernames' must list at least one username"})
+		return
+	}
+	if len(req.Usernames) > maxBatchRankSize {
+		respond(c, 400, gin.H{"error": fmt.Sprintf("at most %d usernames per request", maxBatchRankSize)})
+		return
+	}
+
+	ranks, notFound := leaderboard.GetRanks(req.Usernames, features.For(clientID(c)))
+	respond(c, 200, gin.H{
+		"ranks":    ranks,
+		"notFound": notFound,
+		"count":    len(ranks),
 	})
 }
 
+// Handler: Get a single user's profile
+func getUser(c *gin.Context) {
+	profile, ok := leaderboard.GetProfile(c.Param("username"), features.For(clientID(c)))
+	if !ok {
+		respond(c, 404, gin.H{"error": "user not found"})
+		return
+	}
+	respond(c, 200, profile)
+}
+
 // Handler: Get stats
 func getStats(c *gin.Context) {
-	c.JSON(200, gin.H{
-		"totalUsers": leaderboard.GetTotalUsers(),
-		"status":     "healthy",
+	_, status := dependencies.statuses()
+	respond(c, 200, gin.H{
+		"totalUsers":     leaderboard.GetTotalUsers(),
+		"status":         status,
+		"uniqueVisitors": visitorStats.Daily(),
+		"freeze":         freeze.current(),
+		"display":        leaderboard.Display(),
 	})
-}
\ No newline at end of file
+}
+
+// setupRouter registers the middleware and every route on a new engine
+func setupRouter(compress bool) *gin.Engine {
+	router := gin.Default()
+
+	// CORS configuration
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowOrigins = []string{"*"}
+	corsConfig.AllowMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "X-Admin-Token", "X-API-Key", "X-Client-Name"}
+	corsConfig.ExposeHeaders = []string{"X-Total-Count", "X-Board-Version", "X-Export-Token", "Content-Range", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"}
+	router.Use(cors.New(corsConfig))
+	router.Use(tagClients())
+	router.Use(loadShedder.Middleware())
+	router.Use(trackVisitors())
+	if rateLimitPerMinute > 0 {
+		router.Use(limitRate(NewRateLimiter(rateLimitPerMinute)))
+	}
+	if compress {
+		router.Use(compressResponses())
+	}
+	router.Use(requestTimeouts())
+
+	// API Routes
+	router.GET("/api/leaderboard", getLeaderboard)
+	router.HEAD("/api/leaderboard", headLeaderboard)
+	router.GET("/api/search", searchUsers)
+	router.HEAD("/api/search", headSearch)
+	router.GET("/api/autocomplete", autocompleteUsers)
+	router.GET("/api/rank", getRank)
+	router.POST("/api/rank/batch", getRanksBatch)
+	router.GET("/api/stats", getStats)
+	router.GET("/api/health", getHealth)
+	router.GET("/api/stats/summary", getStatsSummary)
+	router.GET("/api/stats/distribution", getDistribution)
+	router.GET("/api/stats/estimate/above", getEstimatedAbove)
+	router.GET("/api/stats/estimate/percentile", getEstimatedPercentile)
+	router.POST("/api/users", requireAdmin(), createUser)
+	router.GET("/api/users/:username", getUser)
+	router.PUT("/api/users/:username/rating", requireAdmin(), setUserRating)
+	router.PUT("/api/users/:username/scores", requireAdmin(), setUserScores)
+	router.DELETE("/api/users/:username", requireAdmin(), removeUser)
+	router.GET("/api/users/:username/velocity", getUserVelocity)
+	router.GET("/api/users/:username/rivals", getUserRivals)
+	router.GET("/api/users/:username/history", getRatingHistory)
+	router.POST("/api/users/:username/devices", requireAdmin(), registerDevice)
+	router.DELETE("/api/users/:username/devices/:token", requireAdmin(), unregisterDevice)
+	router.GET("/api/leaderboard/climbers", getTopClimbers)
+	router.GET("/api/rank-changes", getRankChanges)
+	router.GET("/api/leaderboard/countries", getCountryLeaderboard)
+	router.GET("/api/views", listViews)
+	router.GET("/api/embed/top", getEmbedTop)
+	router.GET("/feed.xml", getFeed)
+	router.GET("/ws/leaderboard", liveLeaderboard)
+	router.GET("/api/views/:name", getView)
+
+	// Chat integrations
+	router.POST("/api/integrations/discord", discordInteractions)
+	router.POST("/api/internal/replicate", receiveReplication)
+	router.POST("/api/integrations/slack", slackCommand)
+
+	// Admin Routes
+	admin := router.Group("/api/admin", requireAdmin())
+	admin.GET("/overview", getAdminOverview)
+	admin.GET("/search/top", getTopSearches)
+	admin.POST("/search/rebuild", rebuildSearchIndex)
+	admin.GET("/export", exportBoard)
+	admin.GET("/exports/scheduled", getScheduledExports)
+	admin.POST("/exports/scheduled/:name/run", runScheduledExport)
+	admin.GET("/audit", getAuditLog)
+	admin.GET("/clients", getClientMetrics)
+	admin.POST("/users/:username/rollback", rollbackRating)
+	admin.DELETE("/users/:username", deleteUser)
+	admin.POST("/users/:username/restore", restoreUser)
+	admin.GET("/users/deleted", getDeletedUsers)
+	admin.PUT("/users/:username/unranked", unrankUser)
+	admin.DELETE("/users/:username/unranked", rerankUser)
+	admin.PUT("/users/:username/country", setUserCountry)
+	admin.PUT("/users/:username/region", setUserRegion)
+	admin.POST("/bulk", startBulkJob)
+	admin.PUT("/views/:name", saveView)
+	admin.DELETE("/views/:name", deleteView)
+	admin.GET("/bulk/:id", getBulkJob)
+	admin.POST("/imports", startImport)
+	admin.GET("/imports/:id", getImport)
+	admin.POST("/restore", restoreBoard)
+	admin.POST("/storage/compact", compactStorage)
+	admin.GET("/storage/verify", verifyStorage)
+	admin.PUT("/freeze", freezeBoard)
+	admin.DELETE("/freeze", unfreezeBoard)
+	admin.GET("/replication", getReplication)
+	admin.GET("/digests", getDigests)
+	admin.GET("/digests/:name/preview", previewDigest)
+	admin.POST("/digests/:name/send", sendDigest)
+	admin.GET("/features", getFeatures)
+	admin.PUT("/features/:name", setFeature)
+
+	// Health check
+	router.GET("/", func(c *gin.Context) {
+		respond(c, 200, gin.H{
+			"status":  "running",
+			"message": "Leaderboard API is live!",
+			"users":   leaderboard.GetTotalUsers(),
+		})
+	})
+
+	return router
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testAdminToken is the admin token every test server accepts
+const testAdminToken = "test-admin-token"
+
+// testServer is the full router over a fresh, empty board. Nothing runs in
+// the background: no seeding, simulator, re-ranking or jobs, so every
+// change a test sees is one it made.
+type testServer struct {
+	t      *testing.T
+	router *gin.Engine
+}
+
+// newTestServer installs a new board with the given config and builds the
+// router over it, restoring the globals it replaces when the test ends
+func newTestServer(t *testing.T, config BoardConfig) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	previousBoard, previousToken, previousShedder := leaderboard, adminToken, loadShedder
+	t.Cleanup(func() {
+		leaderboard, adminToken, loadShedder = previousBoard, previousToken, previousShedder
+	})
+
+	leaderboard = NewLeaderboardManager(config)
+	adminToken = testAdminToken
+	loadShedder = NewLoadShedder(LoadLimits{})
+	return &testServer{t: t, router: setupRouter(false)}
+}
+
+// in returns the same server reporting failures to a subtest
+func (ts *testServer) in(t *testing.T) *testServer {
+	return &testServer{t: t, router: ts.router}
+}
+
+// request is one call to the test server
+type request struct {
+	method  string
+	path    string
+	body    any
+	admin   bool
+	headers map[string]string
+}
+
+// do sends a request through the router and returns the recorded response
+func (ts *testServer) do(req request) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var body io.Reader
+	if req.body != nil {
+		raw, err := json.Marshal(req.body)
+		if err != nil {
+			ts.t.Fatalf("encoding %s %s body: %v", req.method, req.path, err)
+		}
+		body = bytes.NewReader(raw)
+	}
+	httpReq := httptest.NewRequest(req.method, req.path, body)
+	if req.body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if req.admin {
+		httpReq.Header.Set("X-Admin-Token", testAdminToken)
+	}
+	for name, value := range req.headers {
+		httpReq.Header.Set(name, value)
+	}
+	recorder := httptest.NewRecorder()
+	ts.router.ServeHTTP(recorder, httpReq)
+	return recorder
+}
+
+// createUsers adds users with the given ratings through the API
+func (ts *testServer) createUsers(ratings map[string]int) {
+	ts.t.Helper()
+	for username, rating := range ratings {
+		ts.expect(request{method: http.MethodPost, path: "/api/users", body: gin.H{"username": username, "rating": rating}, admin: true}, http.StatusCreated)
+	}
+}
+
+// expect sends a request, fails the test unless it gets the wanted status,
+// and decodes a JSON response body
+func (ts *testServer) expect(req request, status int) map[string]any {
+	ts.t.Helper()
+	recorder := ts.do(req)
+	if recorder.Code != status {
+		ts.t.Fatalf("%s %s: got status %d, want %d; body: %s", req.method, req.path, recorder.Code, status, recorder.Body.String())
+	}
+	var decoded map[string]any
+	if recorder.Body.Len() > 0 && bytes.HasPrefix(bytes.TrimSpace(recorder.Body.Bytes()), []byte("{")) {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &decoded); err != nil {
+			ts.t.Fatalf("%s %s: decoding response: %v", req.method, req.path, err)
+		}
+	}
+	return decoded
+}
+
+// step is one request in a scenario and what its response must look like
+type step struct {
+	name string
+	request
+	status int
+	// check, if set, inspects the decoded JSON response
+	check func(t *testing.T, body map[string]any)
+}
+
+// run plays a scenario's steps in order, each as a subtest, stopping at the
+// first failure since later steps build on earlier ones
+func (ts *testServer) run(steps []step) {
+	ts.t.Helper()
+	for _, s := range steps {
+		ok := ts.t.Run(s.name, func(t *testing.T) {
+			body := ts.in(t).expect(s.request, s.status)
+			if s.check != nil {
+				s.check(t, body)
+			}
+		})
+		if !ok {
+			ts.t.FailNow()
+		}
+	}
+}
+
+// usernames lists the usernames in a JSON array of users, in order
+func usernames(t *testing.T, list any) []string {
+	t.Helper()
+	items, ok := list.([]any)
+	if !ok {
+		t.Fatalf("expected a list of users, got %T", list)
+	}
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i], _ = item.(map[string]any)["username"].(string)
+	}
+	return names
+}
+
+// number reads a JSON number field
+func number(t *testing.T, object any, field string) int {
+	t.Helper()
+	value, ok := object.(map[string]any)[field].(float64)
+	if !ok {
+		t.Fatalf("field %q is not a number in %v", field, object)
+	}
+	return int(value)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
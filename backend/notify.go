@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType names something on the board worth telling people about
+type EventType string
+
+const (
+	// EventNewLeader fires when a different user takes rank #1
+	EventNewLeader EventType = "new_leader"
+)
+
+// Event is one notification, rendered as a single human-readable message
+type Event struct {
+	Type    EventType `json:"type"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Notifier delivers events to one external channel
+type Notifier interface {
+	Notify(event Event) error
+}
+
+// notifierTimeout bounds each outbound webhook or SMTP delivery
+const notifierTimeout = 10 * time.Second
+
+var notifierClient = &http.Client{Timeout: notifierTimeout}
+
+// postJSON sends payload to a webhook URL and treats any non-2xx as a failure
+func postJSON(url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return postBody(url, "application/json", body)
+}
+
+// postBody sends body to a webhook URL and treats any non-2xx as a failure
+func postBody(url, contentType string, body []byte) error {
+	resp, err := notifierClient.Post(url, contentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// slackNotifier posts to a Slack incoming webhook
+type slackNotifier struct {
+	url string
+}
+
+func (n slackNotifier) Notify(event Event) error {
+	return postJSON(n.url, map[string]string{"text": event.Message})
+}
+
+// discordNotifier posts to a Discord channel webhook
+type discordNotifier struct {
+	url string
+}
+
+func (n discordNotifier) Notify(event Event) error {
+	return postJSON(n.url, map[string]string{"content": event.Message})
+}
+
+// emailNotifier sends each event as a plain-text email over SMTP
+type emailNotifier struct {
+	addr     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func (n emailNotifier) Notify(event Event) error {
+	return n.send("Leaderboard: "+string(event.Type), "text/plain; charset=utf-8", event.Message)
+}
+
+// send delivers one message with the given subject and body type
+func (n emailNotifier) send(subject, contentType, body string) error {
+	var auth smtp.Auth
+	if n.username != "" {
+		host, _, _ := strings.Cut(n.addr, ":")
+		auth = smtp.PlainAuth("", n.username, n.password, host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: %s\r\n\r\n%s\r\n",
+		n.from, strings.Join(n.to, ", "), subject, contentType, body)
+	return smtp.SendMail(n.addr, auth, n.from, n.to, []byte(msg))
+}
+
+// NotifierConfig declares one sink in the --notifiers file. Events limits it
+// to the listed event types; an empty list subscribes to all of them except
+// rank_changes.
+type NotifierConfig struct {
+	Type   string      `json:"type"`
+	URL    string      `json:"url,omitempty"`
+	Events []EventType `json:"events,omitempty"`
+
+	SMTPAddr string   `json:"smtpAddr,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+}
+
+// build turns the config into a Notifier
+func (nc NotifierConfig) build() (Notifier, error) {
+	switch nc.Type {
+	case "slack", "discord":
+		if nc.URL == "" {
+			return nil, fmt.Errorf("%s notifier needs a url", nc.Type)
+		}
+		if nc.Type == "slack" {
+			return slackNotifier{url: nc.URL}, nil
+		}
+		return discordNotifier{url: nc.URL}, nil
+	case "email":
+		if nc.SMTPAddr == "" || nc.From == "" || len(nc.To) == 0 {
+			return nil, fmt.Errorf("email notifier needs smtpAddr, from and to")
+		}
+		return emailNotifier{
+			addr:     nc.SMTPAddr,
+			username: nc.Username,
+			password: os.ExpandEnv(nc.Password),
+			from:     nc.From,
+			to:       nc.To,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier type %q (want slack, discord or email)", nc.Type)
+}
+
+type notifierSink struct {
+	notifier Notifier
+	name     string
+	events   map[EventType]bool
+}
+
+// sinkHealth is how a sink's deliveries have been going
+type sinkHealth struct {
+	failing     bool
+	lastError   string
+	lastErrorAt time.Time
+}
+
+func (s notifierSink) wants(t EventType) bool {
+	if len(s.events) == 0 {
+		return t != EventRankChanges
+	}
+	return s.events[t]
+}
+
+// Notifications fans events out to the configured sinks from a background
+// worker, so publishing never blocks the board
+type Notifications struct {
+	sinks []notifierSink
+	queue chan Event
+
+	mu         sync.Mutex
+	deliveries []sinkHealth
+	dropped    uint64
+}
+
+// notifyQueueSize is how many undelivered events may wait before new ones are dropped
+const notifyQueueSize = 100
+
+// LoadNotifications reads a JSON file of the form {"notifiers": [...]}
+func LoadNotifications(path string) (*Notifications, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Notifiers []NotifierConfig `json:"notifiers"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	n := &Notifications{queue: make(chan Event, notifyQueueSize), deliveries: make([]sinkHealth, len(file.Notifiers))}
+	for i, nc := range file.Notifiers {
+		notifier, err := nc.build()
+		if err != nil {
+			return nil, fmt.Errorf("notifier %d: %w", i, err)
+		}
+		sink := notifierSink{notifier: notifier, name: nc.Type, events: make(map[EventType]bool)}
+		for _, t := range nc.Events {
+			sink.events[t] = true
+		}
+		n.sinks = append(n.sinks, sink)
+	}
+	go n.run()
+	return n, nil
+}
+
+// Publish records an event in the feed and queues it for delivery; delivery
+// is skipped when notifications are off
+func (n *Notifications) Publish(t EventType, message string) {
+	event := Event{Type: t, Message: message, Time: time.Now()}
+	if t != EventRankChanges {
+		recentEvents.add(event)
+	}
+	digests.observe(event)
+	if n == nil {
+		return
+	}
+	select {
+	case n.queue <- event:
+	default:
+		n.mu.Lock()
+		n.dropped++
+		n.mu.Unlock()
+		log.Printf("⚠️  Notification queue full, dropped %s event", t)
+	}
+}
+
+func (n *Notifications) run() {
+	for event := range n.queue {
+		for i, sink := range n.sinks {
+			if !sink.wants(event.Type) {
+				continue
+			}
+			err := sink.notifier.Notify(event)
+			if err != nil {
+				log.Printf("⚠️  %s notification failed: %v", sink.name, err)
+			}
+			n.mu.Lock()
+			n.deliveries[i].failing = err != nil
+			if err != nil {
+				n.deliveries[i].lastError = fmt.Sprintf("%s: %v", sink.name, err)
+				n.deliveries[i].lastErrorAt = time.Now()
+			}
+			n.mu.Unlock()
+		}
+	}
+}
+
+var notifications *Notifications
+
+// checkLeader publishes a new_leader event when rank #1 changes hands. It
+// runs after every rerank; lm.mu must be held.
+func (lm *LeaderboardManager) checkLeader() {
+	if lm.rankedCount == 0 {
+		return
+	}
+	top := lm.sortedUsers[0]
+	if lm.leader != "" && top.Username != lm.leader {
+		notifications.Publish(EventNewLeader,
+			fmt.Sprintf("🏆 %s is the new #1 with a rating of %s, overtaking %s", top.Username, lm.FormatRating(top.Rating), lm.leader))
+	}
+	lm.leader = top.Username
+}
+
+// WatchLeader reranks periodically so a change at #1 is noticed even when
+// nobody is reading the board
+func (lm *LeaderboardManager) WatchLeader(interval time.Duration) {
+	job := backgroundJobs.register("leader watch", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for start := range ticker.C {
+			lm.mu.Lock()
+			lm.recalculateRanks()
+			lm.mu.Unlock()
+			job.ran(start)
+		}
+	}()
+}
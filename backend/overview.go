@@ -0,0 +1,119 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// updateRateInterval is how often the board version is sampled for update rates
+	updateRateInterval = 10 * time.Second
+	// updateRateSamples covers the last minute of samples
+	updateRateSamples = 7
+)
+
+type versionSample struct {
+	at      time.Time
+	version uint64
+}
+
+// updateMeter derives the board's recent update rate from its version
+// counter, which every mutation bumps
+type updateMeter struct {
+	mu      sync.Mutex
+	samples []versionSample
+}
+
+var boardUpdates = &updateMeter{}
+
+// Track samples the board version in the background
+func (um *updateMeter) Track(lm *LeaderboardManager) {
+	job := backgroundJobs.register("update rate", updateRateInterval)
+	sample := func(now time.Time) {
+		um.mu.Lock()
+		um.samples = append(um.samples, versionSample{at: now, version: lm.Version()})
+		if len(um.samples) > updateRateSamples {
+			um.samples = um.samples[1:]
+		}
+		um.mu.Unlock()
+		job.ran(now)
+	}
+	sample(time.Now())
+
+	ticker := time.NewTicker(updateRateInterval)
+	go func() {
+		for now := range ticker.C {
+			sample(now)
+		}
+	}()
+}
+
+// PerSecond returns updates per second over the sampled window
+func (um *updateMeter) PerSecond() float64 {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if len(um.samples) < 2 {
+		return 0
+	}
+	first, last := um.samples[0], um.samples[len(um.samples)-1]
+	return roundTo(float64(last.version-first.version)/last.at.Sub(first.at).Seconds(), 2)
+}
+
+// BoardSizes describes how much the board holds in memory
+type BoardSizes struct {
+	Users            int    `json:"users"`
+	Version          uint64 `json:"version"`
+	SearchIndexGrams int    `json:"searchIndexGrams"`
+	RankSamples      int    `json:"rankSamples"`
+	TrackedRankUsers int    `json:"trackedRankUsers"`
+}
+
+// Sizes reports the size of the board and its supporting indexes
+func (lm *LeaderboardManager) Sizes() BoardSizes {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	return BoardSizes{
+		Users:            len(lm.users),
+		Version:          lm.Version(),
+		SearchIndexGrams: lm.searchIndex.size(),
+		RankSamples:      len(lm.rankHistory.times),
+		TrackedRankUsers: len(lm.rankHistory.ranks),
+	}
+}
+
+// Handler: One-payload operational overview for dashboards
+func getAdminOverview(c *gin.Context) {
+	queues := gin.H{
+		"load":              loadShedder.Stats(),
+		"exportsInProgress": exports.count(),
+	}
+	if notifications != nil {
+		queues["notifications"] = gin.H{
+			"depth":    len(notifications.queue),
+			"capacity": cap(notifications.queue),
+		}
+	}
+
+	respond(c, 200, gin.H{
+		"board": leaderboard.Sizes(),
+		"updates": gin.H{
+			"perSecond": boardUpdates.PerSecond(),
+		},
+		"topChurn": leaderboard.TopChurn(time.Hour, 10),
+		"queues":   queues,
+		"caches": gin.H{
+			"autocomplete": suggestionCache.stats(),
+			"distribution": distributionCache.stats(),
+			"views":        viewCache.stats(),
+			"pages":        pageCache.stats(),
+		},
+		"clients":   clientMetrics.top(10),
+		"live":      live.stats(),
+		"jobs":      backgroundJobs.statuses(),
+		"retention": purgeStats.Stats(),
+	})
+}
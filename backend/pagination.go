@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PageLimits bounds the pages list endpoints will serve
+type PageLimits struct {
+	DefaultSize int
+	MaxSize     int
+	// MaxOffset is the deepest row a page may start at; 0 means no limit
+	MaxOffset int
+}
+
+// Validate checks that the limits are usable
+func (pl PageLimits) Validate() error {
+	if pl.MaxSize < 1 {
+		return fmt.Errorf("max page size must be at least 1")
+	}
+	if pl.DefaultSize < 1 || pl.DefaultSize > pl.MaxSize {
+		return fmt.Errorf("default page size must be between 1 and the max page size (%d)", pl.MaxSize)
+	}
+	if pl.MaxOffset < 0 {
+		return fmt.Errorf("max page offset must not be negative")
+	}
+	return nil
+}
+
+var pageLimits = PageLimits{DefaultSize: 50, MaxSize: 100, MaxOffset: 100000}
+
+// parsePageParams reads page and pageSize from the query, falling back to
+// the defaults for missing or out-of-range values. Pages starting beyond the
+// configured max offset are rejected with a 400, and ok is false.
+func parsePageParams(c *gin.Context) (page, pageSize int, ok bool) {
+	page = 1
+	pageSize = pageLimits.DefaultSize
+
+	if p := c.Query("page"); p != "" {
+		fmt.Sscanf(p, "%d", &page)
+	}
+	if ps := c.Query("pageSize"); ps != "" {
+		fmt.Sscanf(ps, "%d", &pageSize)
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > pageLimits.MaxSize {
+		pageSize = pageLimits.DefaultSize
+	}
+
+	if pageLimits.MaxOffset > 0 && page-1 > pageLimits.MaxOffset/pageSize {
+		respond(c, 400, gin.H{
+			"error":     fmt.Sprintf("page %d starts beyond the deepest allowed offset (%d rows)", page, pageLimits.MaxOffset),
+			"maxOffset": pageLimits.MaxOffset,
+			"hint":      "look up a specific player with /api/rank?username=X or /api/search, or narrow the query instead of paging this deep",
+		})
+		return 0, 0, false
+	}
+	return page, pageSize, true
+}
+
+// pageLink returns the current request's URL pointing at another page
+func pageLink(c *gin.Context, page, pageSize int) string {
+	u := *c.Request.URL
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	query.Set("pageSize", strconv.Itoa(pageSize))
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
+
+// addPagination adds totalPages, hasNext/hasPrev and next/prev links to a
+// list response, repeating the links in a Link header
+func addPagination(response gin.H, c *gin.Context, page, pageSize, total int) {
+	totalPages := (total + pageSize - 1) / pageSize
+	hasNext := page < totalPages
+	hasPrev := page > 1
+
+	links := gin.H{}
+	if hasNext {
+		links["next"] = pageLink(c, page+1, pageSize)
+	}
+	if hasPrev {
+		// A page past the end links back to the last real page
+		prev := page - 1
+		if prev > totalPages && totalPages > 0 {
+			prev = totalPages
+		}
+		links["prev"] = pageLink(c, prev, pageSize)
+	}
+
+	response["page"] = page
+	response["pageSize"] = pageSize
+	response["totalPages"] = totalPages
+	response["hasNext"] = hasNext
+	response["hasPrev"] = hasPrev
+	response["links"] = links
+	setLinkHeader(c, links)
+}
+
+// setListHeaders reports a list's total size and the board version in headers,
+// so clients can poll with HEAD instead of fetching pages
+func setListHeaders(c *gin.Context, total int, version uint64) {
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.Header("X-Board-Version", strconv.FormatUint(version, 10))
+}
+
+// pageOf returns the slice of items on the given page
+func pageOf[T any](items []T, page, pageSize int) []T {
+	start := (page - 1) * pageSize
+	if start >= len(items) {
+		return []T{}
+	}
+	end := start + pageSize
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
@@ -0,0 +1,60 @@
+package main
+
+import "math"
+
+// assignPercentiles sets each user's percentile (share of the board ranked
+// strictly below them) and a 0-100 score normalized against the current
+// rating spread, where 100 is always the best rating. It runs as part of
+// re-ranking, after ranks are assigned. Unranked users get neither.
+func (lm *LeaderboardManager) assignPercentiles() {
+	for _, user := range lm.sortedUsers[lm.rankedCount:] {
+		user.Percentile, user.NormalizedScore = 0, 0
+	}
+	ranked := lm.ranked()
+	n := len(ranked)
+	if n == 0 {
+		return
+	}
+
+	minRating, maxRating := ranked[0].Rating, ranked[0].Rating
+	for _, user := range ranked {
+		if user.Rating < minRating {
+			minRating = user.Rating
+		}
+		if user.Rating > maxRating {
+			maxRating = user.Rating
+		}
+	}
+	spread := float64(maxRating) - float64(minRating)
+
+	// Walk tie groups from the bottom so tied users share a percentile
+	behind := 0
+	for end := n - 1; end >= 0; {
+		start := end
+		for start > 0 && ranked[start-1].Rank == ranked[end].Rank {
+			start--
+		}
+
+		percentile := roundTo(100*float64(behind)/float64(n), 2)
+		for _, user := range ranked[start : end+1] {
+			user.Percentile = percentile
+			user.NormalizedScore = 100
+			if spread > 0 {
+				normalized := 100 * (float64(user.Rating) - float64(minRating)) / spread
+				if lm.config.LowerIsBetter {
+					normalized = 100 - normalized
+				}
+				user.NormalizedScore = roundTo(normalized, 2)
+			}
+		}
+
+		behind += end - start + 1
+		end = start - 1
+	}
+}
+
+// roundTo rounds x to the given number of decimal places
+func roundTo(x float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(x*scale) / scale
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPrefetches bounds the page warm-ups running at once; requests past it
+// simply skip prefetching
+const maxPrefetches = 4
+
+// pageCache holds leaderboard pages, keyed by filter, page, size and whether
+// they came from the rank tree, at the current board version
+var pageCache = newVersionedCache[[]User]()
+
+var prefetchSlots = make(chan struct{}, maxPrefetches)
+
+func pageCacheKey(filter UnrankedFilter, page, pageSize int, paths FeaturePaths) string {
+	return fmt.Sprintf("%s:%d:%d:%t", filter, page, pageSize, paths.RankTree)
+}
+
+// cachedLeaderboardPage serves a leaderboard page from the page cache,
+// filling it on a miss
+func cachedLeaderboardPage(page, pageSize int, filter UnrankedFilter, version uint64, paths FeaturePaths) []User {
+	key := pageCacheKey(filter, page, pageSize, paths)
+	if users, ok := pageCache.get(key, version); ok {
+		return users
+	}
+	users := leaderboard.GetLeaderboard(page, pageSize, filter, paths)
+	pageCache.put(key, version, users)
+	return users
+}
+
+// prefetchAdjacent warms the page cache for the pages either side of the one
+// just served, in the background, so scrolling finds them ready
+func prefetchAdjacent(page, pageSize, total int, filter UnrankedFilter, version uint64, paths FeaturePaths) {
+	select {
+	case prefetchSlots <- struct{}{}:
+	default:
+		return
+	}
+	go func() {
+		defer func() { <-prefetchSlots }()
+		for _, adjacent := range []int{page + 1, page - 1} {
+			if adjacent < 1 || (adjacent-1)*pageSize >= total {
+				continue
+			}
+			if _, ok := pageCache.get(pageCacheKey(filter, adjacent, pageSize, paths), version); !ok {
+				cachedLeaderboardPage(adjacent, pageSize, filter, version, paths)
+			}
+		}
+	}()
+}
+
+// setLinkHeader mirrors a list response's next/prev links in an RFC 8288
+// Link header, so clients and proxies can follow them without the body
+func setLinkHeader(c *gin.Context, links gin.H) {
+	header := ""
+	for _, rel := range []string{"next", "prev"} {
+		if link, ok := links[rel]; ok {
+			if header != "" {
+				header += ", "
+			}
+			header += fmt.Sprintf(`<%s>; rel="%s"`, link, rel)
+		}
+	}
+	if header != "" {
+		c.Header("Link", header)
+	}
+}
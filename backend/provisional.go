@@ -0,0 +1,27 @@
+package main
+
+// activity is how much a user has played towards the minimum: games played
+// or rating updates, whichever is higher, so a game reported both ways
+// counts once
+func (u *User) activity() int {
+	return max(u.GamesPlayed, u.Updates)
+}
+
+// updateProvisional keeps users below the board's minimum activity out of
+// the ranking as provisional, and ranks them once they reach it. Other
+// unranked reasons are left alone. lm.mu must be held and the caller marks
+// the change.
+func (lm *LeaderboardManager) updateProvisional(user *User) {
+	if lm.config.MinGames == 0 {
+		return
+	}
+	provisional := user.activity() < lm.config.MinGames
+	switch {
+	case provisional && user.Unranked == "":
+		lm.rankOut(user)
+		user.Unranked = UnrankedProvisional
+	case !provisional && user.Unranked == UnrankedProvisional:
+		lm.rankIn(user)
+		user.Unranked = ""
+	}
+}
@@ -0,0 +1,613 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxDevicesPerUser bounds the device tokens one user may register
+	maxDevicesPerUser = 10
+	// maxDeviceToken bounds the length of a device token
+	maxDeviceToken = 4096
+	// pushQueueSize is how many undelivered pushes may wait before new ones are dropped
+	pushQueueSize = 1000
+	// pushTokenLifetime is how long a provider auth token is reused;
+	// APNs rejects tokens older than an hour and FCM issues them for one
+	pushTokenLifetime = 50 * time.Minute
+)
+
+// errDeviceGone means the provider no longer knows a device token, so it
+// should be forgotten
+var errDeviceGone = errors.New("device token is no longer registered")
+
+var pushClient = &http.Client{Timeout: notifierTimeout}
+
+// PushDevice is a device registered for a user's push notifications
+type PushDevice struct {
+	Platform     string    `json:"platform"`
+	Token        string    `json:"token"`
+	RegisteredAt time.Time `json:"registeredAt"`
+}
+
+// pushProvider delivers a notification to one device token
+type pushProvider interface {
+	send(token, title, body string) error
+}
+
+// jwtSign builds a signed JWT from a header and claims
+func jwtSign(header, claims any, sign func(digest []byte) ([]byte, error)) (string, error) {
+	encode := func(v any) (string, error) {
+		raw, err := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(raw), err
+	}
+	h, err := encode(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := encode(claims)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256([]byte(h + "." + c))
+	signature, err := sign(digest[:])
+	if err != nil {
+		return "", err
+	}
+	return h + "." + c + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parsePrivateKey reads a PEM-encoded PKCS #8 private key
+func parsePrivateKey(pemData []byte) (any, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM private key found")
+	}
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+// cachedToken reuses a provider auth token until it nears expiry
+type cachedToken struct {
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (ct *cachedToken) get(refresh func() (string, time.Time, error)) (string, error) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if ct.token != "" && time.Now().Before(ct.expires) {
+		return ct.token, nil
+	}
+	token, expires, err := refresh()
+	if err != nil {
+		return "", err
+	}
+	ct.token, ct.expires = token, expires
+	return token, nil
+}
+
+// fcmProvider sends through the Firebase Cloud Messaging HTTP v1 API,
+// authenticating as a service account
+type fcmProvider struct {
+	projectID   string
+	clientEmail string
+	tokenURI    string
+	key         *rsa.PrivateKey
+	auth        cachedToken
+}
+
+func newFCMProvider(serviceAccountFile string) (*fcmProvider, error) {
+	raw, err := os.ReadFile(serviceAccountFile)
+	if err != nil {
+		return nil, err
+	}
+	var account struct {
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(raw, &account); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", serviceAccountFile, err)
+	}
+	if account.ProjectID == "" || account.ClientEmail == "" {
+		return nil, fmt.Errorf("%s is not a service account key", serviceAccountFile)
+	}
+	key, err := parsePrivateKey([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("service account key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("service account key is not an RSA key")
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &fcmProvider{projectID: account.ProjectID, clientEmail: account.ClientEmail, tokenURI: account.TokenURI, key: rsaKey}, nil
+}
+
+// accessToken exchanges a signed service account assertion for an OAuth token
+func (p *fcmProvider) accessToken() (string, time.Time, error) {
+	now := time.Now()
+	assertion, err := jwtSign(
+		map[string]string{"alg": "RS256", "typ": "JWT"},
+		map[string]any{
+			"iss":   p.clientEmail,
+			"scope": "https://www.googleapis.com/auth/firebase.messaging",
+			"aud":   p.tokenURI,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		},
+		func(digest []byte) ([]byte, error) {
+			return rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest)
+		},
+	)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	resp, err := pushClient.PostForm(p.tokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", time.Time{}, fmt.Errorf("FCM token exchange returned %s", resp.Status)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", time.Time{}, err
+	}
+	return token.AccessToken, now.Add(pushTokenLifetime), nil
+}
+
+func (p *fcmProvider) send(token, title, body string) error {
+	accessToken, err := p.auth.get(p.accessToken)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(map[string]any{
+		"message": map[string]any{
+			"token":        token,
+			"notification": map[string]string{"title": title, "body": body},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost,
+		"https://fcm.googleapis.com/v1/projects/"+p.projectID+"/messages:send", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == 404:
+		return errDeviceGone
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("FCM returned %s", resp.Status)
+	}
+	return nil
+}
+
+// apnsProvider sends through Apple's push service with token-based auth
+type apnsProvider struct {
+	host     string
+	keyID    string
+	teamID   string
+	bundleID string
+	key      *ecdsa.PrivateKey
+	auth     cachedToken
+}
+
+// APNSConfig identifies the signing key and app for APNs
+type APNSConfig struct {
+	KeyFile  string `json:"keyFile"`
+	KeyID    string `json:"keyId"`
+	TeamID   string `json:"teamId"`
+	BundleID string `json:"bundleId"`
+	Sandbox  bool   `json:"sandbox,omitempty"`
+}
+
+func newAPNSProvider(cfg APNSConfig) (*apnsProvider, error) {
+	if cfg.KeyFile == "" || cfg.KeyID == "" || cfg.TeamID == "" || cfg.BundleID == "" {
+		return nil, fmt.Errorf("apns needs keyFile, keyId, teamId and bundleId")
+	}
+	raw, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parsePrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("apns key: %w", err)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("apns key is not an EC key")
+	}
+	host := "https://api.push.apple.com"
+	if cfg.Sandbox {
+		host = "https://api.sandbox.push.apple.com"
+	}
+	return &apnsProvider{host: host, keyID: cfg.KeyID, teamID: cfg.TeamID, bundleID: cfg.BundleID, key: ecKey}, nil
+}
+
+// providerToken signs the ES256 JWT APNs accepts as a bearer token
+func (p *apnsProvider) providerToken() (string, time.Time, error) {
+	now := time.Now()
+	token, err := jwtSign(
+		map[string]string{"alg": "ES256", "kid": p.keyID},
+		map[string]any{"iss": p.teamID, "iat": now.Unix()},
+		func(digest []byte) ([]byte, error) {
+			r, s, err := ecdsa.Sign(rand.Reader, p.key, digest)
+			if err != nil {
+				return nil, err
+			}
+			// JWS wants the raw 64-byte r||s form rather than ASN.1
+			signature := make([]byte, 64)
+			r.FillBytes(signature[:32])
+			s.FillBytes(signature[32:])
+			return signature, nil
+		},
+	)
+	return token, now.Add(pushTokenLifetime), err
+}
+
+func (p *apnsProvider) send(token, title, body string) error {
+	providerToken, err := p.auth.get(p.providerToken)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(map[string]any{
+		"aps": map[string]any{"alert": map[string]string{"title": title, "body": body}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.host+"/3/device/"+url.PathEscape(token), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+providerToken)
+	req.Header.Set("apns-topic", p.bundleID)
+	req.Header.Set("apns-push-type", "alert")
+
+	// APNs only speaks HTTP/2, which the default transport negotiates over TLS
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == 410:
+		return errDeviceGone
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("APNs returned %s", resp.Status)
+	}
+	return nil
+}
+
+// pushWatch is what the last re-rank saw of a user with devices
+type pushWatch struct {
+	tier   int
+	best   int
+	seeded bool
+}
+
+type pushMessage struct {
+	username string
+	device   PushDevice
+	title    string
+	body     string
+}
+
+// PushNotifier pushes rank milestones to the devices users register:
+// entering a tier, losing #1, and beating their own best rating
+type PushNotifier struct {
+	tiers     []int
+	providers map[string]pushProvider
+	queue     chan pushMessage
+
+	mu          sync.Mutex
+	devices     map[string][]PushDevice
+	watch       map[string]*pushWatch
+	leader      string
+	sent        uint64
+	failed      uint64
+	dropped     uint64
+	lastError   string
+	lastErrorAt time.Time
+}
+
+var pushes *PushNotifier
+
+// LoadPush reads a JSON file of the form
+// {"tiers": [1, 10, 100], "fcm": {...}, "apns": {...}}
+func LoadPush(path string) (*PushNotifier, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Tiers []int `json:"tiers"`
+		FCM   *struct {
+			ServiceAccountFile string `json:"serviceAccountFile"`
+		} `json:"fcm"`
+		APNS *APNSConfig `json:"apns"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	p := &PushNotifier{
+		tiers:     file.Tiers,
+		providers: make(map[string]pushProvider),
+		queue:     make(chan pushMessage, pushQueueSize),
+		devices:   make(map[string][]PushDevice),
+		watch:     make(map[string]*pushWatch),
+	}
+	if len(p.tiers) == 0 {
+		p.tiers = []int{1, 10, 100}
+	}
+	sort.Ints(p.tiers)
+	if p.tiers[0] < 1 {
+		return nil, fmt.Errorf("push tiers must be ranks of at least 1")
+	}
+	if file.FCM != nil {
+		if p.providers["fcm"], err = newFCMProvider(file.FCM.ServiceAccountFile); err != nil {
+			return nil, fmt.Errorf("fcm: %w", err)
+		}
+	}
+	if file.APNS != nil {
+		if p.providers["apns"], err = newAPNSProvider(*file.APNS); err != nil {
+			return nil, fmt.Errorf("apns: %w", err)
+		}
+	}
+	if len(p.providers) == 0 {
+		return nil, fmt.Errorf("push needs fcm, apns or both")
+	}
+	go p.run()
+	return p, nil
+}
+
+// tierOf returns the index of the best tier a user is in, or len(tiers)
+// when outside all of them
+func (p *PushNotifier) tierOf(user *User) int {
+	if user.Unranked != "" {
+		return len(p.tiers)
+	}
+	return sort.SearchInts(p.tiers, user.Rank)
+}
+
+// checkPushes pushes milestones for users with registered devices. It runs
+// after every rerank, after checkLeader; lm.mu must be held. The first check
+// after a user registers only takes note of where they stand.
+func (lm *LeaderboardManager) checkPushes() {
+	p := pushes
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.leader != "" && p.leader != lm.leader && p.watch[p.leader] != nil {
+		p.queueLocked(p.leader, "You lost #1",
+			fmt.Sprintf("%s overtook you for #1 on the leaderboard", lm.leader))
+	}
+	p.leader = lm.leader
+
+	for username, watch := range p.watch {
+		user, exists := lm.users[username]
+		if !exists {
+			continue
+		}
+		tier := p.tierOf(user)
+		better := user.Rating > watch.best
+		if lm.config.LowerIsBetter {
+			better = user.Rating < watch.best
+		}
+		if watch.seeded {
+			if tier < watch.tier {
+				title := fmt.Sprintf("You're in the top %d", p.tiers[tier])
+				if user.Rank == 1 {
+					title = "You're #1"
+				}
+				p.queueLocked(username, title, fmt.Sprintf("You climbed to #%d with a rating of %s", user.Rank, lm.FormatRating(user.Rating)))
+			}
+			if better {
+				p.queueLocked(username, "New personal best",
+					fmt.Sprintf("Your rating reached %s, your best yet", lm.FormatRating(user.Rating)))
+			}
+		}
+		if !watch.seeded || better {
+			watch.best = user.Rating
+		}
+		watch.tier = tier
+		watch.seeded = true
+	}
+}
+
+// queueLocked queues a push to every device of a user; p.mu must be held
+func (p *PushNotifier) queueLocked(username, title, body string) {
+	for _, device := range p.devices[username] {
+		select {
+		case p.queue <- pushMessage{username: username, device: device, title: title, body: body}:
+		default:
+			p.dropped++
+		}
+	}
+}
+
+func (p *PushNotifier) run() {
+	for msg := range p.queue {
+		err := p.providers[msg.device.Platform].send(msg.device.Token, msg.title, msg.body)
+		if errors.Is(err, errDeviceGone) {
+			p.unregister(msg.username, msg.device.Token)
+			continue
+		}
+		if err != nil {
+			log.Printf("⚠️  %s push failed: %v", msg.device.Platform, err)
+		}
+
+		p.mu.Lock()
+		if err != nil {
+			p.failed++
+			p.lastError = fmt.Sprintf("%s: %v", msg.device.Platform, err)
+			p.lastErrorAt = time.Now()
+		} else {
+			p.sent++
+			p.lastError = ""
+		}
+		p.mu.Unlock()
+	}
+}
+
+// register adds a device for a user, replacing an earlier registration of
+// the same token
+func (p *PushNotifier) register(username string, device PushDevice) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	devices := p.devices[username]
+	for i, existing := range devices {
+		if existing.Token == device.Token {
+			devices[i] = device
+			return nil
+		}
+	}
+	if len(devices) >= maxDevicesPerUser {
+		return fmt.Errorf("at most %d devices may be registered per user", maxDevicesPerUser)
+	}
+	p.devices[username] = append(devices, device)
+	if p.watch[username] == nil {
+		p.watch[username] = &pushWatch{}
+	}
+	return nil
+}
+
+// unregister removes a device, reporting whether it was registered
+func (p *PushNotifier) unregister(username, token string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	devices := p.devices[username]
+	for i, device := range devices {
+		if device.Token != token {
+			continue
+		}
+		devices = append(devices[:i], devices[i+1:]...)
+		if len(devices) == 0 {
+			delete(p.devices, username)
+			delete(p.watch, username)
+		} else {
+			p.devices[username] = devices
+		}
+		return true
+	}
+	return false
+}
+
+// health reports on push delivery: degraded while the latest push failed or
+// pushes are being dropped for a full queue
+func (p *PushNotifier) health() DependencyStatus {
+	if p == nil {
+		return DependencyStatus{Status: DependencyDisabled}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := DependencyStatus{
+		Status: DependencyOK,
+		Detail: fmt.Sprintf("%d user(s) with devices, %d sent, %d failed, %d dropped", len(p.devices), p.sent, p.failed, p.dropped),
+	}
+	if p.lastError != "" || len(p.queue) == cap(p.queue) {
+		status.Status = DependencyDegraded
+	}
+	if p.lastError != "" {
+		at := p.lastErrorAt
+		status.LastError, status.LastErrorAt = p.lastError, &at
+	}
+	return status
+}
+
+// Handler: Register a device for a user's rank milestone pushes. Only the
+// admin token may do this, since pushes reveal the user's rank changes; an
+// app backend registers devices once it has authenticated its user.
+func registerDevice(c *gin.Context) {
+	if pushes == nil {
+		respond(c, 404, gin.H{"error": "push notifications are not configured"})
+		return
+	}
+	var req struct {
+		Platform string `json:"platform" binding:"required"`
+		Token    string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+	req.Platform = strings.ToLower(req.Platform)
+	if pushes.providers[req.Platform] == nil {
+		respond(c, 400, gin.H{"error": fmt.Sprintf("platform %q is not configured", req.Platform)})
+		return
+	}
+	if len(req.Token) > maxDeviceToken {
+		respond(c, 400, gin.H{"error": "device token is too long"})
+		return
+	}
+
+	username := c.Param("username")
+	if _, ok := leaderboard.GetRank(username, features.For(clientID(c))); !ok {
+		respond(c, 404, gin.H{"error": "user not found"})
+		return
+	}
+	device := PushDevice{Platform: req.Platform, Token: req.Token, RegisteredAt: time.Now()}
+	if err := pushes.register(username, device); err != nil {
+		respond(c, 409, gin.H{"error": err.Error()})
+		return
+	}
+	respond(c, 201, device)
+}
+
+// Handler: Stop pushing to a device
+func unregisterDevice(c *gin.Context) {
+	if pushes == nil {
+		respond(c, 404, gin.H{"error": "push notifications are not configured"})
+		return
+	}
+	if !pushes.unregister(c.Param("username"), c.Param("token")) {
+		respond(c, 404, gin.H{"error": "device not registered"})
+		return
+	}
+	c.Status(204)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EventRankChanges fires once per interval with everyone whose rank moved.
+// It is too frequent for chat channels, so sinks only get it when they list
+// it explicitly, and it stays off /feed.xml.
+const EventRankChanges EventType = "rank_changes"
+
+const (
+	// maxRankMoves is how many moves one summary lists; a single big rating
+	// change can shift thousands of users by one place
+	maxRankMoves = 1000
+	// rankSummaryHistory is how many summaries /api/rank-changes keeps
+	rankSummaryHistory = 60
+)
+
+// RankMove is one user's rank at the start and end of a summary interval;
+// a rank of 0 means unranked or not on the board
+type RankMove struct {
+	Username string `json:"username"`
+	OldRank  int    `json:"oldRank"`
+	NewRank  int    `json:"newRank"`
+}
+
+// RankChangeSummary lists the rank moves of one interval, biggest first
+type RankChangeSummary struct {
+	Seq       uint64     `json:"seq"`
+	From      time.Time  `json:"from"`
+	To        time.Time  `json:"to"`
+	Moved     int        `json:"moved"`
+	Truncated bool       `json:"truncated,omitempty"`
+	Changes   []RankMove `json:"changes"`
+}
+
+// rankMoves accumulates rank changes across re-ranks until the next summary
+type rankMoves struct {
+	moves map[string]*RankMove
+	since time.Time
+}
+
+// noteRankMove records a user's rank changing during a re-rank; lm.mu must
+// be held. It is a no-op unless summaries are on.
+func (lm *LeaderboardManager) noteRankMove(user *User, oldRank int) {
+	if lm.rankMoves == nil || oldRank == user.Rank {
+		return
+	}
+	if move, ok := lm.rankMoves.moves[user.Username]; ok {
+		move.NewRank = user.Rank
+		return
+	}
+	lm.rankMoves.moves[user.Username] = &RankMove{Username: user.Username, OldRank: oldRank, NewRank: user.Rank}
+}
+
+// takeRankMoves re-ranks and hands back the moves since the last call,
+// leaving out users who ended where they started; lm.mu must be held
+func (lm *LeaderboardManager) takeRankMoves(now time.Time) RankChangeSummary {
+	lm.recalculateRanks()
+	summary := RankChangeSummary{From: lm.rankMoves.since, To: now, Changes: make([]RankMove, 0)}
+	for _, move := range lm.rankMoves.moves {
+		if move.OldRank != move.NewRank {
+			summary.Changes = append(summary.Changes, *move)
+		}
+	}
+	lm.rankMoves = &rankMoves{moves: make(map[string]*RankMove), since: now}
+
+	summary.Moved = len(summary.Changes)
+	sort.Slice(summary.Changes, func(i, j int) bool {
+		a, b := summary.Changes[i], summary.Changes[j]
+		if da, db := abs(a.OldRank-a.NewRank), abs(b.OldRank-b.NewRank); da != db {
+			return da > db
+		}
+		return a.Username < b.Username
+	})
+	if len(summary.Changes) > maxRankMoves {
+		summary.Changes = summary.Changes[:maxRankMoves]
+		summary.Truncated = true
+	}
+	return summary
+}
+
+// rankSummaries keeps the latest summaries for polling consumers
+type rankSummaries struct {
+	mu        sync.Mutex
+	summaries []RankChangeSummary
+	seq       uint64
+	interval  time.Duration
+}
+
+var rankChanges = &rankSummaries{}
+
+func (rs *rankSummaries) add(summary RankChangeSummary) RankChangeSummary {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.seq++
+	summary.Seq = rs.seq
+	rs.summaries = append(rs.summaries, summary)
+	if extra := len(rs.summaries) - rankSummaryHistory; extra > 0 {
+		rs.summaries = rs.summaries[extra:]
+	}
+	return summary
+}
+
+// after returns the kept summaries with a sequence number above seq, oldest first
+func (rs *rankSummaries) after(seq uint64) ([]RankChangeSummary, uint64) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	after := make([]RankChangeSummary, 0)
+	for _, summary := range rs.summaries {
+		if summary.Seq > seq {
+			after = append(after, summary)
+		}
+	}
+	return after, rs.seq
+}
+
+// SummarizeRankChanges runs a ranking pass every interval and publishes a
+// rank_changes event listing who moved since the last one. Intervals where
+// nobody moved publish nothing.
+func (lm *LeaderboardManager) SummarizeRankChanges(interval time.Duration) {
+	lm.mu.Lock()
+	lm.rankMoves = &rankMoves{moves: make(map[string]*RankMove), since: time.Now()}
+	lm.mu.Unlock()
+	rankChanges.interval = interval
+
+	job := backgroundJobs.register("rank change summaries", interval)
+	ticker := time.NewTicker(interval)
+	go func() {
+		for now := range ticker.C {
+			lm.mu.Lock()
+			summary := lm.takeRankMoves(now)
+			lm.mu.Unlock()
+			job.ran(now)
+			if summary.Moved == 0 {
+				continue
+			}
+			summary = rankChanges.add(summary)
+			notifications.Publish(EventRankChanges, fmt.Sprintf("🔀 %d user(s) changed rank", summary.Moved))
+		}
+	}()
+	log.Printf("🔀 Summarizing rank changes every %s", interval)
+}
+
+// Handler: Rank change summaries after a sequence number, for polling
+func getRankChanges(c *gin.Context) {
+	if rankChanges.interval == 0 {
+		respond(c, 404, gin.H{"error": "rank change summaries are not enabled"})
+		return
+	}
+	var after uint64
+	if s := c.Query("after"); s != "" {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			respond(c, 400, gin.H{"error": "after must be a summary sequence number"})
+			return
+		}
+		after = n
+	}
+	summaries, latest := rankChanges.after(after)
+	respond(c, 200, gin.H{
+		"summaries": summaries,
+		"latest":    latest,
+		"interval":  rankChanges.interval.String(),
+	})
+}
@@ -0,0 +1,273 @@
+package main
+
+import "math/rand"
+
+// rankNode is one ranked user in the rank tree. It keeps the values of the
+// board's sort keys as they were when the user was inserted, so the user can
+// be found again after those values change.
+type rankNode struct {
+	user        *User
+	key         []int
+	priority    uint32
+	size        int
+	left, right *rankNode
+	// minRating and maxRating cover the node's whole subtree
+	minRating, maxRating int
+}
+
+// rankTree is an order-statistic treap of the ranked users in board order.
+// Inserts, removals and rank lookups are O(log n), so a user's rank and any
+// page of the board are available without re-sorting everyone. It holds
+// the same users as the running aggregates: rankIn adds to it and rankOut
+// takes out.
+type rankTree struct {
+	ordering []SortKey
+	root     *rankNode
+	nodes    map[*User]*rankNode
+}
+
+func newRankTree(ordering []SortKey) *rankTree {
+	return &rankTree{ordering: ordering, nodes: make(map[*User]*rankNode)}
+}
+
+// keyOf reads a user's current sort key values
+func (t *rankTree) keyOf(user *User) []int {
+	key := make([]int, len(t.ordering))
+	for i, sortKey := range t.ordering {
+		key[i] = scoreValue(user, sortKey.Field)
+	}
+	return key
+}
+
+// compareKeys orders two keys like BoardConfig.compareUsers: negative when
+// a ranks ahead of b, 0 when tied
+func (t *rankTree) compareKeys(a, b []int) int {
+	for i, sortKey := range t.ordering {
+		if a[i] == b[i] {
+			continue
+		}
+		if (a[i] > b[i]) != sortKey.Ascending {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// before reports whether node n comes before key and username in board
+// order; username keeps fully tied users in a stable order, as in re-ranking
+func (t *rankTree) before(n *rankNode, key []int, username string) bool {
+	if cmp := t.compareKeys(n.key, key); cmp != 0 {
+		return cmp < 0
+	}
+	return n.user.Username < username
+}
+
+func (n *rankNode) update() {
+	n.size, n.minRating, n.maxRating = 1, n.user.Rating, n.user.Rating
+	for _, child := range []*rankNode{n.left, n.right} {
+		if child == nil {
+			continue
+		}
+		n.size += child.size
+		n.minRating = min(n.minRating, child.minRating)
+		n.maxRating = max(n.maxRating, child.maxRating)
+	}
+}
+
+func sizeOf(n *rankNode) int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+// split divides a subtree into the nodes before key and username and the rest
+func (t *rankTree) split(n *rankNode, key []int, username string) (*rankNode, *rankNode) {
+	if n == nil {
+		return nil, nil
+	}
+	if t.before(n, key, username) {
+		nRight, right := t.split(n.right, key, username)
+		n.right = nRight
+		n.update()
+		return n, right
+	}
+	left, nLeft := t.split(n.left, key, username)
+	n.left = nLeft
+	n.update()
+	return left, n
+}
+
+// merge joins two subtrees where every node of a comes before every node of b
+func merge(a, b *rankNode) *rankNode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.priority > b.priority {
+		a.right = merge(a.right, b)
+		a.update()
+		return a
+	}
+	b.left = merge(a, b.left)
+	b.update()
+	return b
+}
+
+// insert adds a ranked user; users already in the tree are left alone
+func (t *rankTree) insert(user *User) {
+	if _, ok := t.nodes[user]; ok {
+		return
+	}
+	n := &rankNode{user: user, key: t.keyOf(user), priority: rand.Uint32()}
+	n.update()
+	left, right := t.split(t.root, n.key, user.Username)
+	t.root = merge(merge(left, n), right)
+	t.nodes[user] = n
+}
+
+// remove takes a user out, finding them by the key they were inserted with
+func (t *rankTree) remove(user *User) {
+	n, ok := t.nodes[user]
+	if !ok {
+		return
+	}
+	delete(t.nodes, user)
+	t.root = t.removeFrom(t.root, n)
+}
+
+func (t *rankTree) removeFrom(at, n *rankNode) *rankNode {
+	if at == nil {
+		return nil
+	}
+	switch {
+	case at == n:
+		return merge(at.left, at.right)
+	case t.before(at, n.key, n.user.Username):
+		at.right = t.removeFrom(at.right, n)
+	default:
+		at.left = t.removeFrom(at.left, n)
+	}
+	at.update()
+	return at
+}
+
+// reposition moves a ranked user whose sort key values changed
+func (t *rankTree) reposition(user *User) {
+	if _, ok := t.nodes[user]; !ok {
+		return
+	}
+	t.remove(user)
+	t.insert(user)
+}
+
+// has reports whether a user is in the tree, i.e. ranked
+func (t *rankTree) has(user *User) bool {
+	_, ok := t.nodes[user]
+	return ok
+}
+
+// len is the number of ranked users
+func (t *rankTree) len() int {
+	return sizeOf(t.root)
+}
+
+// countAhead counts users strictly ahead of key; tied users don't count
+func (t *rankTree) countAhead(key []int) int {
+	count := 0
+	for n := t.root; n != nil; {
+		if t.compareKeys(n.key, key) < 0 {
+			count += sizeOf(n.left) + 1
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+	return count
+}
+
+// countBehind counts users strictly behind key
+func (t *rankTree) countBehind(key []int) int {
+	count := 0
+	for n := t.root; n != nil; {
+		if t.compareKeys(n.key, key) > 0 {
+			count += sizeOf(n.right) + 1
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return count
+}
+
+// rank returns a ranked user's rank, shared with anyone tied, or 0 if the
+// user isn't in the tree
+func (t *rankTree) rank(user *User) int {
+	n, ok := t.nodes[user]
+	if !ok {
+		return 0
+	}
+	return t.countAhead(n.key) + 1
+}
+
+// slice returns up to limit users in board order, starting at offset
+func (t *rankTree) slice(offset, limit int) []*User {
+	users := make([]*User, 0, max(0, min(limit, t.len()-offset)))
+	var walk func(n *rankNode, offset int)
+	walk = func(n *rankNode, offset int) {
+		if n == nil || len(users) == limit {
+			return
+		}
+		leftSize := sizeOf(n.left)
+		if offset < leftSize {
+			walk(n.left, offset)
+		}
+		if len(users) < limit && offset <= leftSize {
+			users = append(users, n.user)
+		}
+		walk(n.right, max(0, offset-leftSize-1))
+	}
+	walk(t.root, offset)
+	return users
+}
+
+// ratingRange returns the users whose rating lies in [low, high], in board
+// order. Subtrees whose ratings all fall outside the range are skipped, so on
+// boards ordered by rating only the band itself is visited.
+func (t *rankTree) ratingRange(low, high int) []*User {
+	users := make([]*User, 0)
+	var walk func(n *rankNode)
+	walk = func(n *rankNode) {
+		if n == nil || n.maxRating < low || n.minRating > high {
+			return
+		}
+		walk(n.left)
+		if n.user.Rating >= low && n.user.Rating <= high {
+			users = append(users, n.user)
+		}
+		walk(n.right)
+	}
+	walk(t.root)
+	return users
+}
+
+// placed is a user snapshot with rank, percentile and normalized score
+// computed from the tree rather than the last re-rank
+func (t *rankTree) placed(user *User, lowerIsBetter bool) User {
+	n := t.nodes[user]
+	placed := user.snapshot()
+	placed.Rank = t.countAhead(n.key) + 1
+	placed.Percentile = roundTo(100*float64(t.countBehind(n.key))/float64(t.len()), 2)
+	placed.NormalizedScore = 100
+	if spread := float64(t.root.maxRating) - float64(t.root.minRating); spread > 0 {
+		normalized := 100 * (float64(user.Rating) - float64(t.root.minRating)) / spread
+		if lowerIsBetter {
+			normalized = 100 - normalized
+		}
+		placed.NormalizedScore = roundTo(normalized, 2)
+	}
+	return placed
+}
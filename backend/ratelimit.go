@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitWindow is the fixed window each client's request count covers
+const rateLimitWindow = time.Minute
+
+// RateLimiter counts events per key (a client, or a user being written to)
+// in fixed windows aligned to the clock. All counters are dropped when a
+// window ends, so memory stays bounded by the keys seen in one window.
+type RateLimiter struct {
+	mu          sync.Mutex
+	limit       int
+	windowStart time.Time
+	counts      map[string]int
+}
+
+// NewRateLimiter allows limit requests per client per window
+func NewRateLimiter(limit int) *RateLimiter {
+	return &RateLimiter{limit: limit, counts: make(map[string]int)}
+}
+
+// Allow counts one event and reports whether it fits in the key's quota,
+// along with how many are left and when the window resets
+func (rl *RateLimiter) Allow(key string, now time.Time) (bool, int, time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if start := now.Truncate(rateLimitWindow); !start.Equal(rl.windowStart) {
+		rl.windowStart = start
+		rl.counts = make(map[string]int)
+	}
+	reset := rl.windowStart.Add(rateLimitWindow)
+
+	if rl.counts[key] >= rl.limit {
+		return false, 0, reset
+	}
+	rl.counts[key]++
+	return true, rl.limit - rl.counts[key], reset
+}
+
+var errUserWriteLimited = errors.New("too many updates for this user, try again next minute")
+
+// LimitUserWrites caps how many updates each user may receive per minute;
+// 0 removes the limit. Excess updates are rejected before touching the board.
+func (lm *LeaderboardManager) LimitUserWrites(perMinute int) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	lm.writeLimiter = nil
+	if perMinute > 0 {
+		lm.writeLimiter = NewRateLimiter(perMinute)
+	}
+}
+
+// rateLimitPerMinute is how many requests a client may make per minute; 0 disables limiting
+var rateLimitPerMinute = 0
+
+// limitRate enforces the per-client limit and reports it in X-RateLimit-*
+// headers on every response, so clients can throttle themselves
+func limitRate(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		allowed, remaining, reset := limiter.Allow(clientID(c), now)
+		resetIn := int(math.Ceil(reset.Sub(now).Seconds()))
+
+		c.Header("X-RateLimit-Limit", fmt.Sprint(limiter.limit))
+		c.Header("X-RateLimit-Remaining", fmt.Sprint(remaining))
+		c.Header("X-RateLimit-Reset", fmt.Sprint(resetIn))
+		if !allowed {
+			c.Header("Retry-After", fmt.Sprint(resetIn))
+			respond(c, 429, gin.H{"error": fmt.Sprintf("rate limit of %d requests per minute exceeded", limiter.limit)})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
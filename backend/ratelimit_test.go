@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	const limit = 3
+	previous := rateLimitPerMinute
+	rateLimitPerMinute = limit
+	t.Cleanup(func() { rateLimitPerMinute = previous })
+	ts := newTestServer(t, DefaultBoardConfig())
+
+	stats := func(apiKey, clientName string) request {
+		return request{method: http.MethodGet, path: "/api/stats", headers: map[string]string{"X-API-Key": apiKey, "X-Client-Name": clientName}}
+	}
+
+	t.Run("limit per client", func(t *testing.T) {
+		ts := ts.in(t)
+		for i := 0; i < limit; i++ {
+			recorder := ts.do(stats("key-a", "app"))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("request %d: got status %d, want 200", i+1, recorder.Code)
+			}
+			if remaining := recorder.Header().Get("X-RateLimit-Remaining"); remaining != fmt.Sprint(limit-i-1) {
+				t.Errorf("request %d: X-RateLimit-Remaining is %q, want %d", i+1, remaining, limit-i-1)
+			}
+		}
+		recorder := ts.do(stats("key-a", "app"))
+		if recorder.Code != http.StatusTooManyRequests {
+			t.Fatalf("request over the limit: got status %d, want 429", recorder.Code)
+		}
+		if recorder.Header().Get("Retry-After") == "" {
+			t.Error("429 response has no Retry-After header")
+		}
+	})
+
+	t.Run("client name does not reset the limit", func(t *testing.T) {
+		ts := ts.in(t)
+		for i := 0; i < limit; i++ {
+			ts.expect(stats("key-a", fmt.Sprintf("app-%d", i)), http.StatusTooManyRequests)
+		}
+	})
+
+	t.Run("other clients have their own limit", func(t *testing.T) {
+		ts.in(t).expect(stats("key-b", "app"), http.StatusOK)
+	})
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxRegionDepth allows country, state and city
+	maxRegionDepth = 3
+	// maxRegionIndexes caps how many regions keep a materialized index; the
+	// least recently queried is dropped to make room
+	maxRegionIndexes = 64
+)
+
+// ParseRegion normalizes a region path such as "IN/Karnataka/Bengaluru".
+// The first level is a country code; empty clears the region.
+func ParseRegion(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	levels := strings.Split(s, "/")
+	if len(levels) > maxRegionDepth {
+		return "", fmt.Errorf("region %q is deeper than country/state/city", s)
+	}
+	for i, level := range levels {
+		levels[i] = strings.TrimSpace(level)
+		if levels[i] == "" {
+			return "", fmt.Errorf("region %q has an empty level", s)
+		}
+	}
+	country, err := ParseCountry(levels[0])
+	if err != nil {
+		return "", err
+	}
+	levels[0] = country
+	return strings.Join(levels, "/"), nil
+}
+
+// regionKey is the case-insensitive form regions are matched by
+func regionKey(path string) string {
+	return strings.ToLower(path)
+}
+
+// regionPath is where a user sits in the hierarchy: their region, or just
+// their country when no finer region is set
+func (u *User) regionPath() string {
+	if u.Region != "" {
+		return u.Region
+	}
+	return u.Country
+}
+
+// regionContains reports whether a region path lies in the scope, at any depth
+func regionContains(scopeKey, path string) bool {
+	key := regionKey(path)
+	return key == scopeKey || strings.HasPrefix(key, scopeKey+"/")
+}
+
+// regionIndex holds the members of one region. Membership is maintained as
+// users move; the member order is re-derived from global ranks at most once
+// per board version.
+type regionIndex struct {
+	members     map[*User]struct{}
+	sorted      []*User
+	sortedAt    uint64
+	rankedCount int
+	lastUsed    time.Time
+}
+
+// regionIndexes are only materialized for regions somebody has queried
+type regionIndexes map[string]*regionIndex
+
+// moveRegion updates every materialized index a user enters or leaves when
+// their region path changes; lm.mu must be held
+func (lm *LeaderboardManager) moveRegion(user *User, from, to string) {
+	for key, idx := range lm.regions {
+		wasIn := from != "" && regionContains(key, from)
+		isIn := to != "" && regionContains(key, to)
+		switch {
+		case wasIn && !isIn:
+			delete(idx.members, user)
+		case isIn && !wasIn:
+			idx.members[user] = struct{}{}
+		default:
+			continue
+		}
+		idx.sorted = nil
+	}
+}
+
+// regionIndex returns a region's index in board order, materializing it with
+// one scan of the board on first use; lm.mu must be held and ranks current
+func (lm *LeaderboardManager) regionIndex(key string) *regionIndex {
+	idx, exists := lm.regions[key]
+	if !exists {
+		if len(lm.regions) >= maxRegionIndexes {
+			lm.evictRegionIndex()
+		}
+		idx = &regionIndex{members: make(map[*User]struct{})}
+		for _, user := range lm.users {
+			if path := user.regionPath(); path != "" && regionContains(key, path) {
+				idx.members[user] = struct{}{}
+			}
+		}
+		lm.regions[key] = idx
+	}
+	idx.lastUsed = time.Now()
+
+	if version := lm.Version(); idx.sorted == nil || idx.sortedAt != version {
+		idx.sorted = make([]*User, 0, len(idx.members))
+		idx.rankedCount = 0
+		for user := range idx.members {
+			idx.sorted = append(idx.sorted, user)
+			if user.Unranked == "" {
+				idx.rankedCount++
+			}
+		}
+		sort.Slice(idx.sorted, func(i, j int) bool {
+			a, b := idx.sorted[i], idx.sorted[j]
+			if a.Rank != b.Rank {
+				return sortableRank(a.Rank) < sortableRank(b.Rank)
+			}
+			return a.Username < b.Username
+		})
+		idx.sortedAt = version
+	}
+	return idx
+}
+
+// evictRegionIndex drops the least recently queried region index
+func (lm *LeaderboardManager) evictRegionIndex() {
+	oldest := ""
+	for key, idx := range lm.regions {
+		if oldest == "" || idx.lastUsed.Before(lm.regions[oldest].lastUsed) {
+			oldest = key
+		}
+	}
+	delete(lm.regions, oldest)
+}
+
+// SetRegion places a user in a region. The region's first level becomes the
+// user's country, so the country rollup follows; clearing the region keeps
+// the country.
+func (lm *LeaderboardManager) SetRegion(username, region string) (User, bool) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.flushPendingLocked()
+
+	user, exists := lm.users[username]
+	if !exists {
+		return User{}, false
+	}
+	from := user.regionPath()
+	user.Region = region
+	if country, _, _ := strings.Cut(region, "/"); country != "" {
+		lm.setCountryLocked(user, country)
+	}
+	lm.moveRegion(user, from, user.regionPath())
+	lm.persist(OpPlacement, user, 0, time.Now())
+	lm.markChanged()
+	return user.snapshot(), true
+}
+
+// RegionalUser is a user with their rank inside the queried region
+type RegionalUser struct {
+	User
+	RegionRank int `json:"regionRank,omitempty"`
+}
+
+// GetRegionalLeaderboard returns a page of a region's users in board order,
+// with their rank inside the region, and how many users the filter selects
+func (lm *LeaderboardManager) GetRegionalLeaderboard(region string, page, pageSize int, filter UnrankedFilter) ([]RegionalUser, int) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.recalculateRanks()
+
+	idx := lm.regionIndex(regionKey(region))
+	users, offset := idx.sorted[:idx.rankedCount], 0
+	switch filter {
+	case UnrankedInclude:
+		users = idx.sorted
+	case UnrankedOnly:
+		users, offset = idx.sorted[idx.rankedCount:], idx.rankedCount
+	}
+
+	entries := pageOf(users, page, pageSize)
+	result := make([]RegionalUser, len(entries))
+	start := (page - 1) * pageSize
+	for i, user := range entries {
+		result[i] = RegionalUser{User: user.snapshot()}
+		if user.Unranked == "" {
+			result[i].RegionRank = idx.regionRank(offset + start + i)
+		}
+	}
+	return result, len(users)
+}
+
+// regionRank is the rank of the user at position i of the sorted members;
+// users tied on the board share a regional rank too
+func (idx *regionIndex) regionRank(i int) int {
+	for i > 0 && idx.sorted[i-1].Rank == idx.sorted[i].Rank {
+		i--
+	}
+	return i + 1
+}
+
+// getRegionalLeaderboard serves /api/leaderboard scoped with ?region=
+func getRegionalLeaderboard(c *gin.Context, page, pageSize int, filter UnrankedFilter) {
+	region, err := ParseRegion(c.Query("region"))
+	if err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	version := leaderboard.Version()
+	users, total := leaderboard.GetRegionalLeaderboard(region, page, pageSize, filter)
+	setListHeaders(c, total, version)
+
+	response := gin.H{
+		"users":      users,
+		"totalUsers": total,
+		"region":     region,
+		"ordering":   leaderboard.Ordering(),
+		"display":    leaderboard.Display(),
+	}
+	addPagination(response, c, page, pageSize, total)
+	respond(c, 200, response)
+}
+
+// Handler: Set the region a user plays in
+func setUserRegion(c *gin.Context) {
+	var req struct {
+		Region string `json:"region"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, 400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	region, err := ParseRegion(req.Region)
+	if err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := leaderboard.SetRegion(c.Param("username"), region)
+	if !ok {
+		respond(c, 404, gin.H{"error": "user not found"})
+		return
+	}
+	auditLog.Record(c, "user.region", user.Username, gin.H{"region": region})
+	respond(c, 200, user)
+}
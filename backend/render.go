@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// responseFormat picks the response encoding: an explicit ?format= wins,
+// otherwise the Accept header is negotiated, defaulting to JSON
+func responseFormat(c *gin.Context) string {
+	switch c.Query("format") {
+	case "json":
+		return binding.MIMEJSON
+	case "xml":
+		return binding.MIMEXML
+	case "cbor":
+		return mimeCBOR
+	}
+	return negotiateFormat(c.GetHeader("Accept"))
+}
+
+// negotiateFormat weighs an Accept header's q-values. XML or CBOR is only
+// chosen when it is the client's top preference and outranks JSON, so
+// browsers, which prefer text/html and only then XML, still get JSON.
+func negotiateFormat(accept string) string {
+	if accept == "" {
+		return binding.MIMEJSON
+	}
+	weights := acceptWeights(accept)
+	top := 0.0
+	for _, q := range weights {
+		top = math.Max(top, q)
+	}
+
+	best, bestQ := binding.MIMEJSON, acceptWeight(weights, binding.MIMEJSON)
+	for _, offer := range []struct{ mime, as string }{
+		{binding.MIMEXML, binding.MIMEXML},
+		{binding.MIMEXML2, binding.MIMEXML},
+		{mimeCBOR, mimeCBOR},
+	} {
+		// Only an explicit listing counts: */* is JSON's to take
+		q, listed := weights[offer.mime]
+		if listed && q > 0 && q == top && q > bestQ {
+			best, bestQ = offer.as, q
+		}
+	}
+	return best
+}
+
+// acceptWeights maps each media range in an Accept header to its q-value
+func acceptWeights(accept string) map[string]float64 {
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mime := strings.ToLower(strings.TrimSpace(params[0]))
+		if mime == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil && parsed >= 0 && parsed <= 1 {
+					q = parsed
+				}
+			}
+		}
+		if existing, ok := weights[mime]; !ok || q > existing {
+			weights[mime] = q
+		}
+	}
+	return weights
+}
+
+// acceptWeight is the q-value a media type gets: its own listing, else its
+// type/*, else */*, else 0
+func acceptWeight(weights map[string]float64, mime string) float64 {
+	if q, ok := weights[mime]; ok {
+		return q
+	}
+	major, _, _ := strings.Cut(mime, "/")
+	if q, ok := weights[major+"/*"]; ok {
+		return q
+	}
+	return weights["*/*"]
+}
+
+// respond writes obj in the negotiated format. Handlers call this instead of
+// c.JSON so every read endpoint supports each format without duplication.
+func respond(c *gin.Context, code int, obj any) {
+	switch responseFormat(c) {
+	case binding.MIMEXML:
+		c.Render(code, xmlResponse{data: obj})
+	case mimeCBOR:
+		c.Render(code, cborResponse{data: obj})
+	default:
+		c.JSON(code, obj)
+	}
+}
+
+// jsonValue converts obj to its generic JSON form (maps, slices, strings,
+// json.Number, bools and nil), so alternative encodings keep the exact field
+// names and shapes of the JSON responses
+func jsonValue(obj any) (any, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// xmlResponse renders any JSON-encodable value as XML with the same field
+// names as the JSON form: objects become elements named by their keys and
+// arrays become repeated <item> elements, all under a <response> root
+type xmlResponse struct {
+	data any
+}
+
+func (r xmlResponse) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+}
+
+func (r xmlResponse) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+
+	value, err := jsonValue(r.data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	if err := encodeXMLValue(encoder, "response", value); err != nil {
+		return err
+	}
+	return encoder.Flush()
+}
+
+// encodeXMLValue writes one decoded JSON value as an element
+func encodeXMLValue(e *xml.Encoder, name string, value any) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !isXMLName(name) {
+		// Keys such as custom score fields may not be valid element names
+		start = xml.StartElement{
+			Name: xml.Name{Local: "entry"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}},
+		}
+	}
+	if value == nil {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "null"}, Value: "true"})
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := encodeXMLValue(e, key, v[key]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err := encodeXMLValue(e, "item", item); err != nil {
+				return err
+			}
+		}
+	case json.Number:
+		if err := e.EncodeToken(xml.CharData(v.String())); err != nil {
+			return err
+		}
+	case string:
+		if err := e.EncodeToken(xml.CharData(v)); err != nil {
+			return err
+		}
+	case bool:
+		text := "false"
+		if v {
+			text = "true"
+		}
+		if err := e.EncodeToken(xml.CharData(text)); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// isXMLName reports whether s can be used as an XML element name as-is
+func isXMLName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if r == '_' || unicode.IsLetter(r) || (i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r))) {
+			continue
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// replicationFlushEvery is how often local rating changes are sent to peers
+	replicationFlushEvery = time.Second
+	// maxReplicationBacklog is how many users' changes may wait for an
+	// unreachable peer before changes to further users are dropped
+	maxReplicationBacklog = 100000
+	// maxReplicationBatch bounds the changes sent or accepted in one request
+	maxReplicationBatch = 5000
+)
+
+var replicationClient = &http.Client{Timeout: 10 * time.Second}
+
+// ConflictResolution decides which of two rating changes to a user wins
+type ConflictResolution string
+
+const (
+	// ConflictLatest keeps the most recent change, breaking timestamp ties
+	// by region name so every region picks the same winner
+	ConflictLatest ConflictResolution = "latest"
+	// ConflictMax keeps the best rating any region has seen. Regions only
+	// converge if local writes never lower a rating, so it suits best-score
+	// boards.
+	ConflictMax ConflictResolution = "max"
+)
+
+// ParseConflictResolution parses a --conflict-resolution value
+func ParseConflictResolution(s string) (ConflictResolution, error) {
+	switch cr := ConflictResolution(s); cr {
+	case ConflictLatest, ConflictMax:
+		return cr, nil
+	}
+	return "", fmt.Errorf("unknown conflict resolution %q (expected latest or max)", s)
+}
+
+// ReplicatedOp is the kind of change a ReplicatedUpdate carries
+type ReplicatedOp string
+
+const (
+	// ReplicatedRating sets a user's rating, creating the user if needed.
+	// Peers that predate ops send it as the empty op.
+	ReplicatedRating ReplicatedOp = "rating"
+	// ReplicatedDelete tombstones a user. It beats any rating change, so
+	// a rating racing a delete can't keep the user alive in some regions.
+	ReplicatedDelete ReplicatedOp = "delete"
+	// ReplicatedRestore brings a tombstoned user back at the given rating
+	ReplicatedRestore ReplicatedOp = "restore"
+	// ReplicatedRemove deletes a user outright
+	ReplicatedRemove ReplicatedOp = "remove"
+)
+
+// ReplicatedUpdate is one change to a user exchanged between regions
+type ReplicatedUpdate struct {
+	Op       ReplicatedOp `json:"op,omitempty"`
+	Username string       `json:"username"`
+	Rating   int          `json:"rating"`
+	At       time.Time    `json:"at"`
+	Region   string       `json:"region"`
+}
+
+// isRating reports whether the update is a rating change
+func (u ReplicatedUpdate) isRating() bool {
+	return u.Op == "" || u.Op == ReplicatedRating
+}
+
+// replicationBatch is the body of POST /api/internal/replicate
+type replicationBatch struct {
+	Region  string             `json:"region"`
+	Updates []ReplicatedUpdate `json:"updates"`
+}
+
+// replicationPeer is another region and the changes it has yet to receive
+type replicationPeer struct {
+	url         string
+	backlog     map[string]ReplicatedUpdate
+	sent        uint64
+	dropped     uint64
+	lastSentAt  time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// Replicator keeps regions in sync active-active: each region serves reads
+// and writes locally, sends its own rating changes to every peer, and
+// applies theirs under a deterministic conflict rule so all regions
+// converge. Peers form a full mesh; changes are never forwarded on.
+type Replicator struct {
+	region     string
+	secret     string
+	resolution ConflictResolution
+	lowerWins  bool
+
+	mu       sync.Mutex
+	peers    []*replicationPeer
+	winners  map[string]ReplicatedUpdate
+	received uint64
+	rejected uint64
+}
+
+var replication *Replicator
+
+// NewReplicator sets up replication to the given peer base URLs
+func NewReplicator(region string, peers []string, secret string, resolution ConflictResolution, config BoardConfig) (*Replicator, error) {
+	if region == "" {
+		return nil, fmt.Errorf("--region-id is required with --peers")
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("--replication-secret is required with --peers")
+	}
+	r := &Replicator{
+		region:     region,
+		secret:     secret,
+		resolution: resolution,
+		lowerWins:  config.LowerIsBetter,
+		winners:    make(map[string]ReplicatedUpdate),
+	}
+	for _, peer := range peers {
+		peer = strings.TrimSuffix(strings.TrimSpace(peer), "/")
+		if !strings.HasPrefix(peer, "http://") && !strings.HasPrefix(peer, "https://") {
+			return nil, fmt.Errorf("peer %q must be an http:// or https:// URL", peer)
+		}
+		r.peers = append(r.peers, &replicationPeer{url: peer, backlog: make(map[string]ReplicatedUpdate)})
+	}
+	return r, nil
+}
+
+// wins reports whether a should replace b under the conflict rule. Deletes
+// beat rating changes whatever their times; everything else goes by the
+// configured rule.
+func (r *Replicator) wins(a, b ReplicatedUpdate) bool {
+	switch {
+	case a.Op == ReplicatedDelete && b.isRating():
+		return true
+	case a.isRating() && b.Op == ReplicatedDelete:
+		return false
+	case r.resolution == ConflictMax && a.isRating() && b.isRating() && a.Rating != b.Rating:
+		return (a.Rating < b.Rating) == r.lowerWins
+	}
+	if !a.At.Equal(b.At) {
+		return a.At.After(b.At)
+	}
+	return a.Region > b.Region
+}
+
+// record queues a local change for every peer; lm.mu must be held. A local
+// change always applies here, so it is stamped after the change it replaces
+// even when this region's clock is behind, or peers would reject it and
+// regions would diverge.
+func (r *Replicator) record(op ReplicatedOp, username string, rating int, at time.Time) {
+	update := ReplicatedUpdate{Op: op, Username: username, Rating: rating, At: at, Region: r.region}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if current, ok := r.winners[username]; ok && !update.At.After(current.At) {
+		update.At = current.At.Add(time.Nanosecond)
+	}
+	r.winners[username] = update
+	for _, peer := range r.peers {
+		if _, queued := peer.backlog[username]; !queued && len(peer.backlog) >= maxReplicationBacklog {
+			peer.dropped++
+			continue
+		}
+		// A peer only needs the latest change per user, but a rating change
+		// must not hide the restore before it; the restore takes its rating
+		if queued, ok := peer.backlog[username]; ok && queued.Op == ReplicatedRestore && update.isRating() {
+			queued.Rating, queued.At = update.Rating, update.At
+			peer.backlog[username] = queued
+			continue
+		}
+		peer.backlog[username] = update
+	}
+}
+
+// accept reports whether a remote change beats what this region holds,
+// taking note of it if so
+func (r *Replicator) accept(update ReplicatedUpdate) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received++
+	if current, ok := r.winners[update.Username]; ok && !r.wins(update, current) {
+		r.rejected++
+		return false
+	}
+	r.winners[update.Username] = update
+	return true
+}
+
+// Run sends queued changes to each peer every replicationFlushEvery
+func (r *Replicator) Run() {
+	job := backgroundJobs.register("replication", replicationFlushEvery)
+	go func() {
+		ticker := time.NewTicker(replicationFlushEvery)
+		for now := range ticker.C {
+			for _, peer := range r.peers {
+				r.flush(peer)
+			}
+			job.ran(now)
+		}
+	}()
+	dependencies.register("replication", r.health)
+	log.Printf("🌍 Replicating region %s with %d peer(s), %s wins conflicts", r.region, len(r.peers), r.resolution)
+}
+
+// flush sends up to a batch of a peer's backlog, keeping it queued on failure
+func (r *Replicator) flush(peer *replicationPeer) {
+	r.mu.Lock()
+	batch := replicationBatch{Region: r.region}
+	for _, update := range peer.backlog {
+		if len(batch.Updates) == maxReplicationBatch {
+			break
+		}
+		batch.Updates = append(batch.Updates, update)
+	}
+	r.mu.Unlock()
+	if len(batch.Updates) == 0 {
+		return
+	}
+
+	err := r.send(peer.url, batch)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		peer.lastError, peer.lastErrorAt = err.Error(), time.Now()
+		return
+	}
+	for _, update := range batch.Updates {
+		// Leave changes that were superseded while the batch was in flight
+		if peer.backlog[update.Username] == update {
+			delete(peer.backlog, update.Username)
+		}
+	}
+	peer.sent += uint64(len(batch.Updates))
+	peer.lastSentAt, peer.lastError = time.Now(), ""
+}
+
+func (r *Replicator) send(peerURL string, batch replicationBatch) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, peerURL+"/api/internal/replicate", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Replication-Secret", r.secret)
+	resp, err := replicationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("peer returned %s", resp.Status)
+	}
+	return nil
+}
+
+// replicateLocked queues a local change for peer regions, unless replication
+// is off or the change came from a peer; lm.mu must be held
+func (lm *LeaderboardManager) replicateLocked(op ReplicatedOp, username string, rating int, at time.Time) {
+	if replication != nil && !lm.replicating {
+		replication.record(op, username, rating, at)
+	}
+}
+
+// ApplyReplicated applies changes from another region, returning how many
+// won their conflicts. Rating changes to deleted users are ignored; unknown
+// users are created.
+func (lm *LeaderboardManager) ApplyReplicated(updates []ReplicatedUpdate) int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	// Applied changes must not be queued for peers again
+	lm.replicating = true
+	defer func() { lm.replicating = false }()
+
+	applied := 0
+	for _, update := range updates {
+		_, deleted := lm.tombstones[update.Username]
+		if (deleted && update.Op != ReplicatedRestore) || !replication.accept(update) {
+			continue
+		}
+		user, exists := lm.users[update.Username]
+		switch update.Op {
+		case ReplicatedDelete, ReplicatedRemove:
+			if exists {
+				if update.Op == ReplicatedDelete {
+					lm.tombstoneLocked(user, update.At)
+				} else {
+					lm.removeLocked(user)
+				}
+				lm.markChanged()
+				applied++
+			}
+			continue
+		case ReplicatedRestore:
+			if user := lm.restoreTombstoneLocked(update.Username); user != nil {
+				if rating := lm.config.clampRating(update.Rating); rating != user.Rating {
+					lm.setRating(user, rating)
+					lm.recordRating(user, rating, update.At)
+				}
+				lm.markChanged()
+				applied++
+			}
+			continue
+		}
+
+		rating := lm.config.clampRating(update.Rating)
+		if !exists {
+			if lm.addUserLocked(update.Username, rating) != nil {
+				continue
+			}
+			lm.users[update.Username].LastActive = update.At
+			applied++
+			continue
+		}
+		// The remote rating supersedes any local one still waiting to flush
+		delete(lm.pending, user)
+		lm.setRating(user, rating)
+		user.LastActive = update.At
+		user.Updates++
+		lm.updateProvisional(user)
+		lm.recordRating(user, rating, update.At)
+		lm.markChanged()
+		applied++
+	}
+	return applied
+}
+
+// ReplicationPeerStatus is how sending to one peer is going
+type ReplicationPeerStatus struct {
+	URL         string     `json:"url"`
+	Backlog     int        `json:"backlog"`
+	Sent        uint64     `json:"sent"`
+	Dropped     uint64     `json:"dropped"`
+	LastSentAt  *time.Time `json:"lastSentAt,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// ReplicationStatus describes this region's replication
+type ReplicationStatus struct {
+	Region     string                  `json:"region"`
+	Resolution ConflictResolution      `json:"resolution"`
+	Peers      []ReplicationPeerStatus `json:"peers"`
+	Received   uint64                  `json:"received"`
+	Rejected   uint64                  `json:"rejected"`
+}
+
+// Status returns per-peer backlogs and how many remote changes lost conflicts
+func (r *Replicator) Status() ReplicationStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := ReplicationStatus{Region: r.region, Resolution: r.resolution, Received: r.received, Rejected: r.rejected}
+	for _, peer := range r.peers {
+		ps := ReplicationPeerStatus{URL: peer.url, Backlog: len(peer.backlog), Sent: peer.sent, Dropped: peer.dropped, LastError: peer.lastError}
+		if !peer.lastSentAt.IsZero() {
+			at := peer.lastSentAt
+			ps.LastSentAt = &at
+		}
+		if peer.lastError != "" {
+			at := peer.lastErrorAt
+			ps.LastErrorAt = &at
+		}
+		status.Peers = append(status.Peers, ps)
+	}
+	sort.Slice(status.Peers, func(i, j int) bool { return status.Peers[i].URL < status.Peers[j].URL })
+	return status
+}
+
+// health is degraded while any peer is unreachable or dropping changes
+func (r *Replicator) health() DependencyStatus {
+	status := r.Status()
+	health := DependencyStatus{Status: DependencyOK, Detail: fmt.Sprintf("region %s, %d peer(s)", status.Region, len(status.Peers))}
+	for _, peer := range status.Peers {
+		if peer.LastError != "" || peer.Dropped > 0 {
+			health.Status = DependencyDegraded
+		}
+		if peer.LastError != "" {
+			health.LastError, health.LastErrorAt = peer.URL+": "+peer.LastError, peer.LastErrorAt
+		}
+	}
+	return health
+}
+
+// Handler: Accept user changes from a peer region
+func receiveReplication(c *gin.Context) {
+	if replication == nil {
+		respond(c, 404, gin.H{"error": "replication is not configured"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Replication-Secret")), []byte(replication.secret)) != 1 {
+		respond(c, 401, gin.H{"error": "invalid replication secret"})
+		return
+	}
+	// Peers keep their backlog and retry, so frozen regions catch up afterwards
+	if respondFrozen(c) {
+		return
+	}
+	var batch replicationBatch
+	if err := c.ShouldBindJSON(&batch); err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+	if len(batch.Updates) > maxReplicationBatch {
+		respond(c, 413, gin.H{"error": fmt.Sprintf("at most %d updates per batch", maxReplicationBatch)})
+		return
+	}
+	for _, update := range batch.Updates {
+		if update.Username == "" || update.Region == "" || update.At.IsZero() {
+			respond(c, 400, gin.H{"error": "every update needs a username, region and time"})
+			return
+		}
+	}
+	applied := leaderboard.ApplyReplicated(batch.Updates)
+	respond(c, 200, gin.H{"received": len(batch.Updates), "applied": applied})
+}
+
+// Handler: Replication status for this region
+func getReplication(c *gin.Context) {
+	if replication == nil {
+		respond(c, 404, gin.H{"error": "replication is not configured"})
+		return
+	}
+	respond(c, 200, replication.Status())
+}
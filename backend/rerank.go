@@ -0,0 +1,194 @@
+package main
+
+import (
+	"hash/maphash"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parallelThreshold is the board size from which full sorts and index
+// rebuilds are split across CPUs; below it the goroutine overhead isn't worth it
+const parallelThreshold = 50000
+
+// sortUsers sorts users in place, in parallel on large boards
+func sortUsers(users []*User, less func(a, b *User) bool) {
+	workers := runtime.GOMAXPROCS(0)
+	if len(users) < parallelThreshold || workers < 2 {
+		sort.Slice(users, func(i, j int) bool { return less(users[i], users[j]) })
+		return
+	}
+	parallelSort(users, less, workers)
+}
+
+// parallelSort sorts one chunk per worker concurrently, then merges
+// neighbouring runs pairwise, each round's merges also running concurrently
+func parallelSort(users []*User, less func(a, b *User) bool, workers int) {
+	chunk := (len(users) + workers - 1) / workers
+	bounds := make([]int, 0, workers+1)
+	for start := 0; start < len(users); start += chunk {
+		bounds = append(bounds, start)
+	}
+	bounds = append(bounds, len(users))
+
+	var wg sync.WaitGroup
+	for i := 0; i+1 < len(bounds); i++ {
+		run := users[bounds[i]:bounds[i+1]]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sort.Slice(run, func(i, j int) bool { return less(run[i], run[j]) })
+		}()
+	}
+	wg.Wait()
+
+	src, dst := users, make([]*User, len(users))
+	for len(bounds) > 2 {
+		merged := make([]int, 0, len(bounds)/2+1)
+		for i := 0; i+1 < len(bounds); i += 2 {
+			lo := bounds[i]
+			merged = append(merged, lo)
+			if i+2 >= len(bounds) {
+				// Odd run out: carry it into the next round unchanged
+				copy(dst[lo:bounds[i+1]], src[lo:bounds[i+1]])
+				continue
+			}
+			mid, hi := bounds[i+1], bounds[i+2]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				mergeRuns(dst[lo:hi], src[lo:mid], src[mid:hi], less)
+			}()
+		}
+		wg.Wait()
+		bounds = append(merged, len(users))
+		src, dst = dst, src
+	}
+	if &src[0] != &users[0] {
+		copy(users, src)
+	}
+}
+
+// mergeRuns merges two sorted runs into out, keeping equal elements in order
+func mergeRuns(out, a, b []*User, less func(a, b *User) bool) {
+	i, j, k := 0, 0, 0
+	for i < len(a) && j < len(b) {
+		if less(b[j], a[i]) {
+			out[k] = b[j]
+			j++
+		} else {
+			out[k] = a[i]
+			i++
+		}
+		k++
+	}
+	k += copy(out[k:], a[i:])
+	copy(out[k:], b[j:])
+}
+
+// gramPosting is one user's entry in one trigram's posting list
+type gramPosting struct {
+	gram string
+	user *User
+}
+
+// rebuildParallel re-indexes users with one worker per CPU in two passes.
+// First each worker extracts the trigrams of its own range of users, once per
+// user, and routes each posting to the worker that owns the trigram's hash.
+// Then each worker builds the postings it owns, so the partial indexes never
+// overlap and combining them only copies map headers.
+func (si *searchIndex) rebuildParallel(users []*User) {
+	workers := runtime.GOMAXPROCS(0)
+	if len(users) < parallelThreshold || workers < 2 {
+		si.rebuild(users)
+		return
+	}
+
+	seed := maphash.MakeSeed()
+	chunk := (len(users) + workers - 1) / workers
+	// routed[from][to] holds the postings worker from found for worker to
+	routed := make([][][]gramPosting, workers)
+	var wg sync.WaitGroup
+	for w := range routed {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			outbox := make([][]gramPosting, workers)
+			for _, user := range users[min(w*chunk, len(users)):min((w+1)*chunk, len(users))] {
+				for _, gram := range trigrams(strings.ToLower(user.Username)) {
+					owner := maphash.String(seed, gram) % uint64(workers)
+					outbox[owner] = append(outbox[owner], gramPosting{gram: gram, user: user})
+				}
+			}
+			routed[w] = outbox
+		}(w)
+	}
+	wg.Wait()
+
+	parts := make([]map[string]map[*User]struct{}, workers)
+	for w := range parts {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			part := make(map[string]map[*User]struct{})
+			for _, outbox := range routed {
+				for _, p := range outbox[w] {
+					posting, exists := part[p.gram]
+					if !exists {
+						posting = make(map[*User]struct{})
+						part[p.gram] = posting
+					}
+					posting[p.user] = struct{}{}
+				}
+			}
+			parts[w] = part
+		}(w)
+	}
+	wg.Wait()
+
+	grams := make(map[string]map[*User]struct{})
+	for _, part := range parts {
+		for gram, posting := range part {
+			grams[gram] = posting
+		}
+	}
+	si.mu.Lock()
+	si.grams = grams
+	si.mu.Unlock()
+}
+
+// rLockRanked takes the read lock with ranks up to date, taking the write
+// lock only when a re-rank is actually due. With a background ranking pass
+// running, reads never re-rank and see ranks at most one pass old.
+func (lm *LeaderboardManager) rLockRanked() {
+	lm.mu.RLock()
+	if !lm.needsRerank || lm.rankEvery > 0 {
+		return
+	}
+	lm.mu.RUnlock()
+	lm.mu.Lock()
+	lm.recalculateRanks()
+	lm.mu.Unlock()
+	lm.mu.RLock()
+}
+
+// RankEvery re-ranks the board in the background at a fixed interval, so
+// reads under heavy write load stop contending for the write lock
+func (lm *LeaderboardManager) RankEvery(interval time.Duration) {
+	lm.mu.Lock()
+	lm.rankEvery = interval
+	lm.mu.Unlock()
+
+	job := backgroundJobs.register("ranking", interval)
+	ticker := time.NewTicker(interval)
+	go func() {
+		for now := range ticker.C {
+			lm.mu.Lock()
+			lm.recalculateRanks()
+			lm.mu.Unlock()
+			job.ran(now)
+		}
+	}()
+}
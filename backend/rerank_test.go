@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func TestRebuildParallelMatchesRebuild(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	users := make([]*User, parallelThreshold+123)
+	for i := range users {
+		users[i] = &User{Username: fmt.Sprintf("Player_%d", i*7919)}
+	}
+	serial, parallel := newSearchIndex(), newSearchIndex()
+	serial.rebuild(users)
+	parallel.rebuildParallel(users)
+
+	if len(parallel.grams) != len(serial.grams) {
+		t.Fatalf("parallel rebuild has %d trigrams, serial has %d", len(parallel.grams), len(serial.grams))
+	}
+	for gram, posting := range serial.grams {
+		other := parallel.grams[gram]
+		if len(other) != len(posting) {
+			t.Fatalf("trigram %q: parallel posting has %d users, serial has %d", gram, len(other), len(posting))
+		}
+		for user := range posting {
+			if _, ok := other[user]; !ok {
+				t.Fatalf("trigram %q: parallel posting is missing %s", gram, user.Username)
+			}
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRestoreSample caps how many individual changes a restore report lists
+const maxRestoreSample = 100
+
+// errRestoreNeedsStorage is returned by RestoreBoard on an in-memory board
+var errRestoreNeedsStorage = errors.New("restoring the board replays its stored snapshots and update log, so it needs --data-dir")
+
+// What a board restore does to one user
+const (
+	RestoreChanged  = "changed"
+	RestoreReturned = "restored"
+	RestoreRemoved  = "removed"
+)
+
+// UserRestore is one user's change in a board restore
+type UserRestore struct {
+	Username string `json:"username"`
+	// Action is "changed" for a user whose standing is put back, "restored"
+	// for one deleted since and brought back, and "removed" for one who
+	// joined since and is deleted
+	Action string `json:"action"`
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+}
+
+// BoardRestore reports what restoring the board to a point in time changes
+type BoardRestore struct {
+	DryRun bool `json:"dryRun"`
+	// SnapshotAt is when the snapshot the restore replayed from was taken;
+	// null means the update log was replayed from the first update
+	SnapshotAt *time.Time `json:"snapshotAt"`
+	// Replayed is how many logged updates were applied on top of it
+	Replayed  int `json:"replayed"`
+	Changed   int `json:"changed"`
+	Unchanged int `json:"unchanged"`
+	Restored  int `json:"restored"`
+	// Removed users are soft-deleted, so each can still be restored
+	Removed int           `json:"removed"`
+	Sample  []UserRestore `json:"sample"`
+}
+
+// RestoreBoard puts the whole board back as it was at the target. It
+// rebuilds that board from the newest kept snapshot the target covers plus
+// the logged updates up to the target, then brings every user's rating,
+// games, scores, placement, tags and ranking in line with it. Users deleted
+// since come back and users who joined since are soft-deleted. Every change
+// is logged like any other write. With dryRun it only reports what would
+// change.
+func (lm *LeaderboardManager) RestoreBoard(target RollbackTarget, dryRun bool) (BoardRestore, error) {
+	if lm.storage == nil {
+		return BoardRestore{}, errRestoreNeedsStorage
+	}
+	snapshot, updates, err := lm.storage.LoadAt(target)
+	if err != nil {
+		return BoardRestore{}, err
+	}
+	replayed := 0
+	for replayed < len(updates) && target.coversPoint(updates[replayed].At, updates[replayed].Version) {
+		replayed++
+	}
+
+	past := NewLeaderboardManager(lm.config)
+	// Rebuilding the past board must not reach peer regions
+	past.replicating = true
+	past.mu.Lock()
+	past.loadStoredLocked(snapshot, updates[:replayed])
+	past.mu.Unlock()
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if !dryRun {
+		if freeze.active() {
+			return BoardRestore{}, errBoardFrozen
+		}
+		lm.flushPendingLocked()
+	}
+
+	report := BoardRestore{DryRun: dryRun, Replayed: replayed, Sample: make([]UserRestore, 0)}
+	if snapshot != nil {
+		report.SnapshotAt = &snapshot.TakenAt
+	}
+	note := func(username, action string, from, to int) {
+		if len(report.Sample) < maxRestoreSample {
+			report.Sample = append(report.Sample, UserRestore{Username: username, Action: action, From: from, To: to})
+		}
+	}
+
+	now := time.Now()
+	for username, user := range lm.users {
+		if _, existed := past.users[username]; existed {
+			continue
+		}
+		report.Removed++
+		note(username, RestoreRemoved, lm.currentRating(user), lm.currentRating(user))
+		if !dryRun {
+			lm.tombstoneLocked(user, now)
+		}
+	}
+	for username, saved := range past.users {
+		user, exists := lm.users[username]
+		switch {
+		case exists && sameStanding(lm.currentRating(user), user, saved):
+			report.Unchanged++
+			continue
+		case exists:
+			report.Changed++
+			note(username, RestoreChanged, lm.currentRating(user), saved.Rating)
+		default:
+			report.Restored++
+			from := 0
+			if ts, deleted := lm.tombstones[username]; deleted {
+				from = ts.user.Rating
+			}
+			note(username, RestoreReturned, from, saved.Rating)
+		}
+		if dryRun {
+			continue
+		}
+		if !exists {
+			if user = lm.restoreTombstoneLocked(username); user == nil {
+				lm.addUserLocked(username, saved.Rating)
+				user = lm.users[username]
+			}
+		}
+		lm.matchUserLocked(user, saved, now)
+	}
+	sort.Slice(report.Sample, func(i, j int) bool { return report.Sample[i].Username < report.Sample[j].Username })
+
+	if !dryRun && report.Changed+report.Restored+report.Removed > 0 {
+		lm.markChanged()
+		lm.recalculateRanks()
+	}
+	return report, nil
+}
+
+// sameStanding reports whether a user, at the given rating, already matches
+// a rebuilt one in everything a restore puts back
+func sameStanding(rating int, user, saved *User) bool {
+	return rating == saved.Rating &&
+		user.GamesPlayed == saved.GamesPlayed && user.Wins == saved.Wins &&
+		maps.Equal(user.Scores, saved.Scores) &&
+		user.Country == saved.Country && user.Region == saved.Region &&
+		slices.Equal(user.Tags, saved.Tags) &&
+		user.Unranked == saved.Unranked
+}
+
+// matchUserLocked brings a user's standing in line with a rebuilt one,
+// logging each part that changes; lm.mu must be held and the caller marks
+// the change
+func (lm *LeaderboardManager) matchUserLocked(user, saved *User, at time.Time) {
+	if user.Rating != saved.Rating {
+		lm.setRating(user, saved.Rating)
+		lm.recordRating(user, saved.Rating, at)
+	}
+	if user.GamesPlayed != saved.GamesPlayed || user.Wins != saved.Wins {
+		user.GamesPlayed, user.Wins = saved.GamesPlayed, saved.Wins
+		lm.rankTree.reposition(user)
+		lm.persist(OpGame, user, 0, at)
+	}
+	if !maps.Equal(user.Scores, saved.Scores) {
+		user.Scores = maps.Clone(saved.Scores)
+		lm.rankTree.reposition(user)
+		lm.persist(OpScores, user, 0, at)
+	}
+	if user.Country != saved.Country || user.Region != saved.Region {
+		from := user.regionPath()
+		lm.setCountryLocked(user, saved.Country)
+		user.Region = saved.Region
+		lm.moveRegion(user, from, user.regionPath())
+		lm.persist(OpPlacement, user, 0, at)
+	}
+	if !slices.Equal(user.Tags, saved.Tags) {
+		user.Tags = slices.Clone(saved.Tags)
+		lm.persist(OpTags, user, 0, at)
+	}
+	lm.setUnrankedLocked(user, saved.Unranked)
+	lm.updateProvisional(user)
+}
+
+// Handler: Restore the whole board to a timestamp or board version
+func restoreBoard(c *gin.Context) {
+	to := c.Query("to")
+	if to == "" {
+		respond(c, 400, gin.H{"error": "query parameter 'to' is required"})
+		return
+	}
+	target, err := ParseRollbackTarget(to)
+	if err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	dryRun, ok := isDryRun(c)
+	if !ok {
+		return
+	}
+	report, err := leaderboard.RestoreBoard(target, dryRun)
+	switch {
+	case err == errBoardFrozen:
+		respondFrozen(c)
+		return
+	case err == errRestoreNeedsStorage || err == errNotRetained:
+		respond(c, 409, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		respond(c, 500, gin.H{"error": err.Error()})
+		return
+	}
+	if !dryRun {
+		auditLog.Record(c, "board.restore", "*", gin.H{
+			"to":       to,
+			"replayed": report.Replayed,
+			"changed":  report.Changed,
+			"restored": report.Restored,
+			"removed":  report.Removed,
+		})
+	}
+	respond(c, 200, report)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// snapshotBoard snapshots the test server's board
+func snapshotBoard(t *testing.T) {
+	t.Helper()
+	if err := leaderboard.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestoreBoard(t *testing.T) {
+	for _, engine := range []StorageEngine{StorageFile, StorageBolt} {
+		t.Run(string(engine), func(t *testing.T) {
+			ts := newTestServer(t, DefaultBoardConfig())
+			dir := attachTestStorage(t, engine, 3)
+			ts.createUsers(map[string]int{"ann": 1200, "ben": 1300, "cat": 1100})
+			snapshotBoard(t)
+			version := leaderboard.Version()
+
+			// A bad import and other changes after the target, on both
+			// sides of a later snapshot
+			ts.createUsers(map[string]int{"dan": 4000, "eve": 3900})
+			ts.expect(request{method: http.MethodPut, path: "/api/users/ann/rating", body: gin.H{"rating": 2000}, admin: true}, http.StatusOK)
+			ts.expect(request{method: http.MethodDelete, path: "/api/admin/users/ben", admin: true}, http.StatusOK)
+			snapshotBoard(t)
+			ts.expect(request{method: http.MethodPut, path: "/api/users/cat/rating", body: gin.H{"rating": 1500}, admin: true}, http.StatusOK)
+
+			board := func(want ...string) func(t *testing.T, body map[string]any) {
+				return func(t *testing.T, body map[string]any) {
+					if got := usernames(t, body["users"]); !equalStrings(got, want) {
+						t.Errorf("board is %v, want %v", got, want)
+					}
+				}
+			}
+			restore := fmt.Sprintf("/api/admin/restore?to=%d", version)
+			ts.run([]step{
+				{
+					name:    "dry run",
+					request: request{method: http.MethodPost, path: restore + "&dryRun=1", admin: true},
+					status:  http.StatusOK,
+					check: func(t *testing.T, body map[string]any) {
+						for field, want := range map[string]int{"changed": 2, "restored": 1, "removed": 2, "unchanged": 0} {
+							if got := number(t, body, field); got != want {
+								t.Errorf("%s is %d, want %d", field, got, want)
+							}
+						}
+					},
+				},
+				{
+					name:    "dry run changed nothing",
+					request: request{method: http.MethodGet, path: "/api/leaderboard"},
+					status:  http.StatusOK,
+					check:   board("dan", "eve", "ann", "cat"),
+				},
+				{
+					name:    "restore",
+					request: request{method: http.MethodPost, path: restore, admin: true},
+					status:  http.StatusOK,
+				},
+				{
+					name:    "board is as it was",
+					request: request{method: http.MethodGet, path: "/api/leaderboard"},
+					status:  http.StatusOK,
+					check: func(t *testing.T, body map[string]any) {
+						board("ben", "ann", "cat")(t, body)
+						for i, want := range []int{1300, 1200, 1100} {
+							if got := number(t, body["users"].([]any)[i], "rating"); got != want {
+								t.Errorf("user %d has rating %d, want %d", i+1, got, want)
+							}
+						}
+					},
+				},
+				{
+					name:    "imported users can still be restored",
+					request: request{method: http.MethodGet, path: "/api/admin/users/deleted", admin: true},
+					status:  http.StatusOK,
+					check: func(t *testing.T, body map[string]any) {
+						if got := number(t, body, "count"); got != 2 {
+							t.Errorf("%d deleted users, want dan and eve", got)
+						}
+					},
+				},
+				{
+					name:    "restoring again changes nothing",
+					request: request{method: http.MethodPost, path: restore + "&dryRun=true", admin: true},
+					status:  http.StatusOK,
+					check: func(t *testing.T, body map[string]any) {
+						if got := number(t, body, "unchanged"); got != 3 {
+							t.Errorf("%d users unchanged, want 3", got)
+						}
+					},
+				},
+			})
+
+			// The restore is logged like any other write
+			leaderboard.storage.Close()
+			restarted, storage := openStoredBoard(t, DefaultBoardConfig(), engine, dir, 3)
+			defer storage.Close()
+			for username, want := range map[string]int{"ann": 1200, "ben": 1300, "cat": 1100} {
+				if info, ok := restarted.GetRank(username, features.For("")); !ok || info.Rating != want {
+					t.Errorf("%s came back as %+v after a restart, want rating %d", username, info, want)
+				}
+			}
+			if deleted := restarted.DeletedUsers(); len(deleted) != 2 {
+				t.Errorf("%d deleted users after a restart, want 2", len(deleted))
+			}
+		})
+	}
+}
+
+func TestRestoreBeyondKeptSnapshots(t *testing.T) {
+	ts := newTestServer(t, DefaultBoardConfig())
+	attachTestStorage(t, StorageBolt, 2)
+	ts.createUsers(map[string]int{"ann": 1200})
+	snapshotBoard(t)
+	version := leaderboard.Version()
+	for rating := 1300; rating <= 1500; rating += 100 {
+		ts.expect(request{method: http.MethodPut, path: "/api/users/ann/rating", body: gin.H{"rating": rating}, admin: true}, http.StatusOK)
+		snapshotBoard(t)
+	}
+	ts.expect(request{method: http.MethodPost, path: fmt.Sprintf("/api/admin/restore?to=%d", version), admin: true}, http.StatusConflict)
+}
+
+func TestRestoreNeedsStorage(t *testing.T) {
+	ts := newTestServer(t, DefaultBoardConfig())
+	ts.createUsers(map[string]int{"ann": 1200})
+	ts.expect(request{method: http.MethodPost, path: "/api/admin/restore?to=1", admin: true}, http.StatusConflict)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// retentionPurgeInterval is how often expired history and audit entries are purged
+const retentionPurgeInterval = 10 * time.Minute
+
+// RetentionPolicy sets how long history is kept. A zero duration keeps
+// entries until the per-user or log size cap pushes them out.
+type RetentionPolicy struct {
+	RatingHistory time.Duration
+	AuditLog      time.Duration
+}
+
+var retention RetentionPolicy
+
+// ParseRetention reads a retention period such as 90d, 36h or 0
+func ParseRetention(s string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid retention %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid retention %q (use e.g. 90d or 36h)", s)
+	}
+	return d, nil
+}
+
+// describeRetention renders a retention period for logs and stats
+func describeRetention(d time.Duration) string {
+	if d == 0 {
+		return "until capped"
+	}
+	return d.String()
+}
+
+// PurgeStats counts what the retention job has removed
+type PurgeStats struct {
+	Runs                 uint64     `json:"runs"`
+	LastRun              *time.Time `json:"lastRun"`
+	RatingEntriesPurged  uint64     `json:"ratingEntriesPurged"`
+	AuditEntriesPurged   uint64     `json:"auditEntriesPurged"`
+	LastRatingEntries    int        `json:"lastRatingEntries"`
+	LastAuditEntries     int        `json:"lastAuditEntries"`
+	RatingHistoryKeptFor string     `json:"ratingHistoryKeptFor"`
+	AuditLogKeptFor      string     `json:"auditLogKeptFor"`
+}
+
+type retentionStats struct {
+	mu    sync.Mutex
+	stats PurgeStats
+}
+
+var purgeStats = &retentionStats{}
+
+// Stats returns the purge counters
+func (rs *retentionStats) Stats() PurgeStats {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.stats
+}
+
+// PurgeRatingHistory drops rating entries older than cutoff. Each user keeps
+// at least their latest entry, which is their current rating.
+func (lm *LeaderboardManager) PurgeRatingHistory(cutoff time.Time) int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	purged := 0
+	for _, rl := range lm.ratingHistory {
+		drop := 0
+		for drop < len(rl.entries)-1 && rl.entries[drop].At.Before(cutoff) {
+			drop++
+		}
+		if drop > 0 {
+			rl.entries = rl.entries[drop:]
+			rl.trimmed = true
+			purged += drop
+		}
+		rl.purgeRollups(cutoff)
+	}
+	return purged
+}
+
+// Purge drops audit entries older than cutoff
+func (al *AuditLog) Purge(cutoff time.Time) int {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	drop := 0
+	for drop < len(al.entries) && al.entries[drop].Time.Before(cutoff) {
+		drop++
+	}
+	al.entries = al.entries[drop:]
+	return drop
+}
+
+// EnforceRetention purges expired history on a schedule
+func (lm *LeaderboardManager) EnforceRetention(policy RetentionPolicy) {
+	purgeStats.stats.RatingHistoryKeptFor = describeRetention(policy.RatingHistory)
+	purgeStats.stats.AuditLogKeptFor = describeRetention(policy.AuditLog)
+	if policy.RatingHistory == 0 && policy.AuditLog == 0 {
+		return
+	}
+
+	job := backgroundJobs.register("retention purge", retentionPurgeInterval)
+	purge := func(now time.Time) {
+		ratings, audits := 0, 0
+		if policy.RatingHistory > 0 {
+			ratings = lm.PurgeRatingHistory(now.Add(-policy.RatingHistory))
+		}
+		if policy.AuditLog > 0 {
+			audits = auditLog.Purge(now.Add(-policy.AuditLog))
+		}
+
+		purgeStats.mu.Lock()
+		stats := &purgeStats.stats
+		stats.Runs++
+		stats.LastRun = &now
+		stats.RatingEntriesPurged += uint64(ratings)
+		stats.AuditEntriesPurged += uint64(audits)
+		stats.LastRatingEntries = ratings
+		stats.LastAuditEntries = audits
+		purgeStats.mu.Unlock()
+
+		job.ran(now)
+		if ratings > 0 || audits > 0 {
+			log.Printf("🧹 Retention purge removed %d rating entries and %d audit entries", ratings, audits)
+		}
+	}
+
+	ticker := time.NewTicker(retentionPurgeInterval)
+	go func() {
+		for now := range ticker.C {
+			purge(now)
+		}
+	}()
+	log.Printf("🧹 Keeping rating history for %s and audit entries for %s",
+		describeRetention(policy.RatingHistory), describeRetention(policy.AuditLog))
+}
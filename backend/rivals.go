@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRivalRange        = 100
+	defaultRivalLimit        = 10
+	maxRivalLimit            = 50
+	defaultRivalActiveWindow = 7 * 24 * time.Hour
+)
+
+// Rival is a user with a rating close to another user's
+type Rival struct {
+	User
+	RatingDiff int `json:"ratingDiff"`
+}
+
+// ratingBand returns the ranked users whose rating lies in [low, high]. It
+// reads the rank tree, which is current even while the re-ranked list waits
+// for the next --rank-interval, rather than binary searching that list.
+func (lm *LeaderboardManager) ratingBand(low, high int) []*User {
+	return lm.rankTree.ratingRange(low, high)
+}
+
+// Rivals returns up to limit users active within the window whose rating is
+// within ratingRange of the user's, closest first
+func (lm *LeaderboardManager) Rivals(username string, ratingRange, limit int, activeWithin time.Duration) ([]Rival, bool) {
+	if !lm.MightExist(username) {
+		return nil, false
+	}
+
+	lm.rLockRanked()
+	defer lm.mu.RUnlock()
+
+	user, exists := lm.users[username]
+	if !exists {
+		return nil, false
+	}
+
+	activeSince := time.Now().Add(-activeWithin)
+	low, high := addSaturating(user.Rating, -ratingRange), addSaturating(user.Rating, ratingRange)
+	rivals := make([]Rival, 0)
+	for _, candidate := range lm.ratingBand(low, high) {
+		if candidate == user || candidate.LastActive.Before(activeSince) {
+			continue
+		}
+		diff := candidate.Rating - user.Rating
+		rivals = append(rivals, Rival{User: candidate.snapshot(), RatingDiff: diff})
+	}
+
+	sort.SliceStable(rivals, func(i, j int) bool {
+		return abs(rivals[i].RatingDiff) < abs(rivals[j].RatingDiff)
+	})
+	if len(rivals) > limit {
+		rivals = rivals[:limit]
+	}
+	return rivals, true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Handler: Get evenly matched rivals for a user
+func getUserRivals(c *gin.Context) {
+	ratingRange := defaultRivalRange
+	if r := c.Query("range"); r != "" {
+		fmt.Sscanf(r, "%d", &ratingRange)
+	}
+	if ratingRange < 0 {
+		ratingRange = defaultRivalRange
+	}
+
+	limit := defaultRivalLimit
+	if l := c.Query("limit"); l != "" {
+		fmt.Sscanf(l, "%d", &limit)
+	}
+	if limit < 1 || limit > maxRivalLimit {
+		limit = defaultRivalLimit
+	}
+
+	activeWithin := defaultRivalActiveWindow
+	if a := c.Query("activeWithin"); a != "" {
+		d, err := time.ParseDuration(a)
+		if err != nil || d <= 0 {
+			respond(c, 400, gin.H{"error": "activeWithin must be a positive duration such as 24h"})
+			return
+		}
+		activeWithin = d
+	}
+
+	rivals, ok := leaderboard.Rivals(c.Param("username"), ratingRange, limit, activeWithin)
+	if !ok {
+		respond(c, 404, gin.H{"error": "user not found"})
+		return
+	}
+
+	respond(c, 200, gin.H{
+		"rivals": rivals,
+		"range":  ratingRange,
+		"count":  len(rivals),
+	})
+}
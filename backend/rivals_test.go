@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRivalsBetweenReranks(t *testing.T) {
+	ts := newTestServer(t, DefaultBoardConfig())
+	ts.createUsers(map[string]int{"ann": 1000, "ben": 1100, "cat": 1200, "dan": 1300, "eve": 1400})
+	ts.expect(request{method: http.MethodGet, path: "/api/leaderboard"}, http.StatusOK)
+
+	// As under --rank-interval, but without the background job: the ranked
+	// list keeps its order from the last re-rank while ratings move on
+	leaderboard.mu.Lock()
+	leaderboard.rankEvery = time.Hour
+	leaderboard.mu.Unlock()
+
+	ts.run([]step{
+		{
+			name:    "eve drops next to ann",
+			request: request{method: http.MethodPut, path: "/api/users/eve/rating", body: gin.H{"rating": 1050}, admin: true},
+			status:  http.StatusOK,
+		},
+		{
+			name:    "dan climbs away",
+			request: request{method: http.MethodPut, path: "/api/users/dan/rating", body: gin.H{"rating": 3000}, admin: true},
+			status:  http.StatusOK,
+		},
+		{
+			name:    "rivals use current ratings",
+			request: request{method: http.MethodGet, path: "/api/users/ann/rivals?range=100"},
+			status:  http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				want := []string{"eve", "ben"}
+				if got := usernames(t, body["rivals"]); !equalStrings(got, want) {
+					t.Errorf("ann's rivals are %v, want %v", got, want)
+				}
+			},
+		},
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// RatingRollup summarizes a user's ratings over one hour or day
+type RatingRollup struct {
+	Start time.Time `json:"start"`
+	Min   int       `json:"min"`
+	Max   int       `json:"max"`
+	Avg   float64   `json:"avg"`
+	// Close is the rating held at the end of the period
+	Close   int `json:"close"`
+	Updates int `json:"updates"`
+	sum     int
+}
+
+// rollupResolution is one level of downsampled rating history
+type rollupResolution struct {
+	name  string
+	width time.Duration
+	keep  int
+}
+
+// rollupResolutions keep a week of hourly and a year of daily rollups,
+// far beyond the raw history, at a bounded size per user
+var rollupResolutions = []rollupResolution{
+	{name: "hour", width: time.Hour, keep: 7 * 24},
+	{name: "day", width: 24 * time.Hour, keep: 365},
+}
+
+// ParseRollupResolution finds a resolution by name; "raw" (or empty) returns nil
+func ParseRollupResolution(s string) (*rollupResolution, error) {
+	if s == "" || s == "raw" {
+		return nil, nil
+	}
+	for i := range rollupResolutions {
+		if rollupResolutions[i].name == s {
+			return &rollupResolutions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("resolution must be raw, hour or day")
+}
+
+// addRollups folds a rating into each resolution's current period
+func (rl *ratingLog) addRollups(rating int, at time.Time) {
+	if rl.rollups == nil {
+		rl.rollups = make(map[string][]RatingRollup, len(rollupResolutions))
+	}
+	for _, res := range rollupResolutions {
+		rollups := rl.rollups[res.name]
+		start := at.UTC().Truncate(res.width)
+		if n := len(rollups); n == 0 || !rollups[n-1].Start.Equal(start) {
+			rollups = append(rollups, RatingRollup{Start: start, Min: rating, Max: rating})
+			if extra := len(rollups) - res.keep; extra > 0 {
+				rollups = rollups[extra:]
+			}
+			rl.rollups[res.name] = rollups
+		}
+
+		r := &rollups[len(rollups)-1]
+		r.Min = min(r.Min, rating)
+		r.Max = max(r.Max, rating)
+		r.Close = rating
+		r.Updates++
+		r.sum += rating
+		r.Avg = roundTo(float64(r.sum)/float64(r.Updates), 2)
+	}
+}
+
+// purgeRollups drops periods that ended before the cutoff, keeping each
+// resolution's latest period
+func (rl *ratingLog) purgeRollups(cutoff time.Time) {
+	for _, res := range rollupResolutions {
+		rollups := rl.rollups[res.name]
+		if len(rollups) == 0 {
+			continue
+		}
+		drop := 0
+		for drop < len(rollups)-1 && rollups[drop].Start.Add(res.width).Before(cutoff) {
+			drop++
+		}
+		rl.rollups[res.name] = rollups[drop:]
+	}
+}
+
+// RatingRollups returns a user's rating history downsampled to a resolution, oldest first
+func (lm *LeaderboardManager) RatingRollups(username string, res *rollupResolution) ([]RatingRollup, bool) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	if _, exists := lm.users[username]; !exists {
+		return nil, false
+	}
+	rollups := make([]RatingRollup, 0)
+	if rl, ok := lm.ratingHistory[username]; ok {
+		rollups = append(rollups, rl.rollups[res.name]...)
+	}
+	return rollups, true
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// minExportEvery keeps scheduled exports from hammering the board
+const minExportEvery = time.Minute
+
+var uploadClient = &http.Client{Timeout: 5 * time.Minute}
+
+// ExportSchedule is one recurring export from the --export-schedule file
+type ExportSchedule struct {
+	Name string `json:"name"`
+	// Every is how often to export, e.g. 1h or 1d
+	Every string `json:"every"`
+	// Format is csv or ndjson
+	Format string `json:"format"`
+	// View exports a saved view instead of the whole board
+	View string `json:"view,omitempty"`
+	// Destination is an s3://bucket/key, gs://bucket/key or file:///path
+	// template; {name}, {date}, {time}, {timestamp}, {version} and {format}
+	// are filled in on each run
+	Destination string `json:"destination"`
+
+	every time.Duration
+	dest  exportDestination
+	key   string
+
+	mu        sync.Mutex
+	runs      uint64
+	lastRun   time.Time
+	lastKey   string
+	lastError string
+	errorAt   time.Time
+}
+
+// LoadExportSchedules reads a JSON file of the form {"exports": [...]}
+func LoadExportSchedules(path string) ([]*ExportSchedule, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Exports []*ExportSchedule `json:"exports"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for i, es := range file.Exports {
+		if err := es.validate(); err != nil {
+			return nil, fmt.Errorf("export %d: %w", i, err)
+		}
+		if seen[es.Name] {
+			return nil, fmt.Errorf("export %q is listed twice", es.Name)
+		}
+		seen[es.Name] = true
+	}
+	return file.Exports, nil
+}
+
+func (es *ExportSchedule) validate() error {
+	if es.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	every, err := ParseRetention(es.Every)
+	if err != nil || every < minExportEvery {
+		return fmt.Errorf("every must be a duration of at least %s, e.g. 1h or 1d", minExportEvery)
+	}
+	es.every = every
+	if es.Format == "" {
+		es.Format = "ndjson"
+	}
+	if es.Format != "csv" && es.Format != "ndjson" {
+		return fmt.Errorf("format must be csv or ndjson")
+	}
+	es.dest, es.key, err = parseDestination(es.Destination)
+	return err
+}
+
+// exportDestination stores a finished export under a key
+type exportDestination interface {
+	put(key string, body []byte, contentType string) error
+}
+
+// parseDestination splits a destination URI into where to store and the
+// key template
+func parseDestination(uri string) (exportDestination, string, error) {
+	scheme, rest, found := strings.Cut(uri, "://")
+	if !found {
+		return nil, "", fmt.Errorf("destination %q needs a scheme: s3://, gs:// or file://", uri)
+	}
+	if scheme == "file" {
+		if rest == "" {
+			return nil, "", fmt.Errorf("destination %q has no path", uri)
+		}
+		return fileDestination{}, rest, nil
+	}
+
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" || key == "" {
+		return nil, "", fmt.Errorf("destination %q needs a bucket and a key", uri)
+	}
+	dest := &objectStore{bucket: bucket}
+	switch scheme {
+	case "s3":
+		dest.region = envOr("AWS_REGION", "us-east-1")
+		dest.endpoint = envOr("S3_ENDPOINT", "https://s3."+dest.region+".amazonaws.com")
+		dest.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		dest.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		dest.sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	case "gs":
+		// Cloud Storage's XML API accepts the same signed requests with HMAC keys
+		dest.region = "auto"
+		dest.endpoint = "https://storage.googleapis.com"
+		dest.accessKey = os.Getenv("GCS_HMAC_ACCESS_KEY")
+		dest.secretKey = os.Getenv("GCS_HMAC_SECRET")
+	default:
+		return nil, "", fmt.Errorf("unknown destination scheme %q (expected s3, gs or file)", scheme)
+	}
+	if dest.accessKey == "" || dest.secretKey == "" {
+		return nil, "", fmt.Errorf("no credentials for %s:// destinations in the environment", scheme)
+	}
+	return dest, key, nil
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// fileDestination writes exports to the local filesystem
+type fileDestination struct{}
+
+func (fileDestination) put(path string, body []byte, contentType string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Write aside and rename, so readers never see a partial export
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// objectStore uploads to S3 or an S3-compatible store with path-style,
+// SigV4-signed PUTs
+type objectStore struct {
+	endpoint     string
+	region       string
+	bucket       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+func (s *objectStore) put(key string, body []byte, contentType string) error {
+	path := "/" + awsEscape(s.bucket) + "/" + awsEscape(key)
+	req, err := http.NewRequest(http.MethodPut, strings.TrimSuffix(s.endpoint, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	s.sign(req, path, body, contentType, time.Now().UTC())
+
+	resp, err := uploadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("upload to %s returned %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+// sign adds AWS Signature Version 4 headers to a request
+func (s *objectStore) sign(req *http.Request, path string, body []byte, contentType string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	headers := [][2]string{
+		{"content-type", contentType},
+		{"host", req.URL.Host},
+		{"x-amz-content-sha256", payloadHash},
+		{"x-amz-date", amzDate},
+	}
+	if s.sessionToken != "" {
+		headers = append(headers, [2]string{"x-amz-security-token", s.sessionToken})
+	}
+	var canonicalHeaders strings.Builder
+	names := make([]string, len(headers))
+	for i, h := range headers {
+		if h[0] != "host" {
+			req.Header.Set(h[0], h[1])
+		}
+		canonicalHeaders.WriteString(h[0] + ":" + h[1] + "\n")
+		names[i] = h[0]
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{req.Method, path, "", canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	signingKey := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{date, s.region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscape percent-encodes a key the way SigV4 expects: everything except
+// unreserved characters and slashes
+func awsEscape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// renderKey fills in a destination template for one run
+func (es *ExportSchedule) renderKey(now time.Time, version uint64) string {
+	now = now.UTC()
+	return strings.NewReplacer(
+		"{name}", es.Name,
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("150405"),
+		"{timestamp}", strconv.FormatInt(now.Unix(), 10),
+		"{version}", strconv.FormatUint(version, 10),
+		"{format}", es.Format,
+	).Replace(es.key)
+}
+
+// encodeExport renders users in an export format
+func encodeExport(users []User, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if format == "csv" {
+		writer := csv.NewWriter(&buf)
+		writer.Write(csvHeader)
+		for _, user := range users {
+			writer.Write(csvRecord(user))
+		}
+		writer.Flush()
+		return buf.Bytes(), "text/csv", writer.Error()
+	}
+	encoder := json.NewEncoder(&buf)
+	for _, user := range users {
+		if err := encoder.Encode(user); err != nil {
+			return nil, "", err
+		}
+	}
+	return buf.Bytes(), "application/x-ndjson", nil
+}
+
+// run exports once and records the outcome
+func (es *ExportSchedule) run(now time.Time) error {
+	var users []User
+	version := leaderboard.Version()
+	if es.View != "" {
+		view, ok := views.get(es.View)
+		if !ok {
+			return es.record(now, "", fmt.Errorf("view %q not found", es.View))
+		}
+		users = leaderboard.ViewUsers(view)
+	} else {
+		users, version = leaderboard.AllUsers()
+	}
+
+	body, contentType, err := encodeExport(users, es.Format)
+	if err != nil {
+		return es.record(now, "", err)
+	}
+	key := es.renderKey(now, version)
+	return es.record(now, key, es.dest.put(key, body, contentType))
+}
+
+func (es *ExportSchedule) record(now time.Time, key string, err error) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.runs++
+	es.lastRun = now
+	if err != nil {
+		es.lastError, es.errorAt = err.Error(), now
+		log.Printf("⚠️  Scheduled export %s failed: %v", es.Name, err)
+		return err
+	}
+	es.lastKey, es.lastError = key, ""
+	return nil
+}
+
+// ScheduledExportStatus is how a scheduled export has been doing
+type ScheduledExportStatus struct {
+	Name      string     `json:"name"`
+	Every     string     `json:"every"`
+	Format    string     `json:"format"`
+	View      string     `json:"view,omitempty"`
+	Runs      uint64     `json:"runs"`
+	LastRun   *time.Time `json:"lastRun,omitempty"`
+	LastKey   string     `json:"lastKey,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+	ErrorAt   *time.Time `json:"errorAt,omitempty"`
+}
+
+func (es *ExportSchedule) status() ScheduledExportStatus {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	status := ScheduledExportStatus{
+		Name:      es.Name,
+		Every:     es.every.String(),
+		Format:    es.Format,
+		View:      es.View,
+		Runs:      es.runs,
+		LastKey:   es.lastKey,
+		LastError: es.lastError,
+	}
+	if es.runs > 0 {
+		lastRun := es.lastRun
+		status.LastRun = &lastRun
+	}
+	if es.lastError != "" {
+		errorAt := es.errorAt
+		status.ErrorAt = &errorAt
+	}
+	return status
+}
+
+var scheduledExports []*ExportSchedule
+
+// RunExportSchedules starts each scheduled export on its own ticker and
+// reports them as a dependency, degraded while any last run failed
+func RunExportSchedules(schedules []*ExportSchedule) {
+	scheduledExports = schedules
+	for _, es := range schedules {
+		es := es
+		job := backgroundJobs.register("export "+es.Name, es.every)
+		ticker := time.NewTicker(es.every)
+		go func() {
+			for now := range ticker.C {
+				es.run(now)
+				job.ran(now)
+			}
+		}()
+	}
+
+	dependencies.register("scheduled exports", func() DependencyStatus {
+		status := DependencyStatus{Status: DependencyOK, Detail: fmt.Sprintf("%d export(s)", len(schedules))}
+		for _, es := range schedules {
+			if s := es.status(); s.LastError != "" {
+				status.Status = DependencyDegraded
+				status.LastError = s.Name + ": " + s.LastError
+				status.LastErrorAt = s.ErrorAt
+			}
+		}
+		return status
+	})
+	log.Printf("📤 Running %d scheduled export(s)", len(schedules))
+}
+
+// Handler: List scheduled exports and how their last runs went
+func getScheduledExports(c *gin.Context) {
+	statuses := make([]ScheduledExportStatus, len(scheduledExports))
+	for i, es := range scheduledExports {
+		statuses[i] = es.status()
+	}
+	respond(c, 200, gin.H{"exports": statuses, "count": len(statuses)})
+}
+
+// Handler: Run a scheduled export now
+func runScheduledExport(c *gin.Context) {
+	for _, es := range scheduledExports {
+		if es.Name != c.Param("name") {
+			continue
+		}
+		if err := es.run(time.Now()); err != nil {
+			respond(c, 502, gin.H{"error": err.Error()})
+			return
+		}
+		auditLog.Record(c, "export.run", es.Name, nil)
+		respond(c, 200, es.status())
+		return
+	}
+	respond(c, 404, gin.H{"error": "scheduled export not found"})
+}
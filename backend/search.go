@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MatchType describes how well a username matched a search term
+type MatchType string
+
+const (
+	MatchExact     MatchType = "exact"
+	MatchPrefix    MatchType = "prefix"
+	MatchSubstring MatchType = "substring"
+)
+
+// matchPriority orders match types from best to worst
+var matchPriority = map[MatchType]int{
+	MatchExact:     0,
+	MatchPrefix:    1,
+	MatchSubstring: 2,
+}
+
+// SearchResult is a user matched by a search, with the matched byte range
+// of the username so clients can highlight it
+type SearchResult struct {
+	User
+	MatchType  MatchType `json:"matchType"`
+	MatchStart int       `json:"matchStart"`
+	MatchEnd   int       `json:"matchEnd"`
+}
+
+// matchUsername finds a case-insensitive match of searchLower in username.
+// Offsets refer to the original username bytes, even when lowercasing a
+// character changes its encoded length.
+func matchUsername(username, searchLower string) (MatchType, int, int, bool) {
+	lowered := make([]byte, 0, len(username))
+	offsets := make([]int, 0, len(username)+1)
+	for i, r := range username {
+		before := len(lowered)
+		lowered = utf8.AppendRune(lowered, unicode.ToLower(r))
+		for j := before; j < len(lowered); j++ {
+			offsets = append(offsets, i)
+		}
+	}
+	offsets = append(offsets, len(username))
+
+	index := strings.Index(string(lowered), searchLower)
+	if index < 0 {
+		return "", 0, 0, false
+	}
+
+	start, end := offsets[index], offsets[index+len(searchLower)]
+	switch {
+	case start == 0 && end == len(username):
+		return MatchExact, start, end, true
+	case start == 0:
+		return MatchPrefix, start, end, true
+	}
+	return MatchSubstring, start, end, true
+}
+
+// sortByRelevance orders results exact > prefix > substring, keeping board order within each group
+func sortByRelevance(results []SearchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return matchPriority[results[i].MatchType] < matchPriority[results[j].MatchType]
+	})
+}
+
+// MatchRegex marks results found by an admin regex search
+const MatchRegex MatchType = "regex"
+
+const (
+	// maxRegexLength caps the length of admin regex patterns
+	maxRegexLength = 256
+	// maxRegexProgramSize caps the compiled size of admin regex patterns
+	maxRegexProgramSize = 2000
+	// regexSearchTimeout bounds how long a regex sweep may scan the board
+	regexSearchTimeout = 2 * time.Second
+)
+
+// compileSearchRegex compiles an admin search pattern, rejecting patterns that
+// are too long or expand into very large programs (e.g. deeply nested repeats)
+func compileSearchRegex(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > maxRegexLength {
+		return nil, fmt.Errorf("pattern is longer than %d characters", maxRegexLength)
+	}
+
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+	if len(prog.Inst) > maxRegexProgramSize {
+		return nil, fmt.Errorf("pattern is too complex")
+	}
+
+	return regexp.Compile(pattern)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// bleveNameField is the document field holding a lowercased username
+const bleveNameField = "name"
+
+// bleveIndex keeps usernames in an in-memory bleve index, one document per
+// user keyed by username, and answers substring searches with a wildcard
+// query over the lowercased names. Hits come back as document IDs, which
+// users maps back to the indexed users.
+type bleveIndex struct {
+	mu    sync.RWMutex
+	index bleve.Index
+	users map[string]*User
+}
+
+func newBleveIndex() *bleveIndex {
+	return &bleveIndex{index: newBleveMemIndex(), users: make(map[string]*User)}
+}
+
+// newBleveMemIndex creates an empty in-memory index with the username as a
+// single unanalyzed keyword, so each name is one term
+func newBleveMemIndex() bleve.Index {
+	name := bleve.NewKeywordFieldMapping()
+	name.Store = false
+	name.IncludeInAll = false
+	name.IncludeTermVectors = false
+	name.DocValues = false
+	doc := bleve.NewDocumentStaticMapping()
+	doc.AddFieldMappingsAt(bleveNameField, name)
+	indexMapping := bleve.NewIndexMapping()
+	indexMapping.DefaultMapping = doc
+
+	index, err := bleve.NewMemOnly(indexMapping)
+	if err != nil {
+		// Only an invalid mapping fails here, and the mapping is fixed
+		panic(err)
+	}
+	return index
+}
+
+// bleveDocument is the document a user is indexed as
+func bleveDocument(user *User) map[string]interface{} {
+	return map[string]interface{}{bleveNameField: strings.ToLower(user.Username)}
+}
+
+// add indexes a user's username, replacing any user indexed under it
+func (bi *bleveIndex) add(user *User) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	if err := bi.index.Index(user.Username, bleveDocument(user)); err != nil {
+		log.Printf("⚠️  Indexing %s for search failed: %v", user.Username, err)
+		return
+	}
+	bi.users[user.Username] = user
+}
+
+// remove drops a user from the index, unless a newer user with the same
+// name has replaced them
+func (bi *bleveIndex) remove(user *User) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	if bi.users[user.Username] != user {
+		return
+	}
+	if err := bi.index.Delete(user.Username); err != nil {
+		log.Printf("⚠️  Removing %s from search failed: %v", user.Username, err)
+	}
+	delete(bi.users, user.Username)
+}
+
+// reindex builds a fresh index of every user in one batch and swaps it in
+func (bi *bleveIndex) reindex(users []*User) {
+	index := newBleveMemIndex()
+	batch := index.NewBatch()
+	byName := make(map[string]*User, len(users))
+	for _, user := range users {
+		if err := batch.Index(user.Username, bleveDocument(user)); err != nil {
+			log.Printf("⚠️  Indexing %s for search failed: %v", user.Username, err)
+			continue
+		}
+		byName[user.Username] = user
+	}
+	if err := index.Batch(batch); err != nil {
+		log.Printf("⚠️  Rebuilding the search index failed: %v", err)
+		index.Close()
+		return
+	}
+
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	bi.index.Close()
+	bi.index, bi.users = index, byName
+}
+
+// size returns the number of indexed usernames, each a single term
+func (bi *bleveIndex) size() int {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+	return len(bi.users)
+}
+
+// candidates returns the users whose lowercased usernames contain the term.
+// It reports false for an empty term, or one holding the wildcard
+// characters * or ?, which the caller has to scan for instead.
+func (bi *bleveIndex) candidates(searchLower string) ([]*User, bool) {
+	if searchLower == "" || strings.ContainsAny(searchLower, "*?") {
+		return nil, false
+	}
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+
+	query := bleve.NewWildcardQuery("*" + searchLower + "*")
+	query.SetField(bleveNameField)
+	result, err := bi.index.Search(bleve.NewSearchRequestOptions(query, len(bi.users), 0, false))
+	if err != nil {
+		// Terms whose pattern is too large for the index fall back to a scan
+		return nil, false
+	}
+	users := make([]*User, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		if user, ok := bi.users[hit.ID]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, true
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// trigramSize is the length in bytes of the n-grams the search index uses
+const trigramSize = 3
+
+// SearchEngine names a usernameIndex implementation for --search-index
+type SearchEngine string
+
+const (
+	// SearchTrigram indexes usernames in the built-in trigram index
+	SearchTrigram SearchEngine = "trigram"
+	// SearchBleve indexes usernames in an in-memory bleve index
+	SearchBleve SearchEngine = "bleve"
+)
+
+// ParseSearchEngine validates a --search-index value
+func ParseSearchEngine(s string) (SearchEngine, error) {
+	switch engine := SearchEngine(s); engine {
+	case SearchTrigram, SearchBleve:
+		return engine, nil
+	}
+	return "", fmt.Errorf("unknown search index %q (expected %q or %q)", s, SearchTrigram, SearchBleve)
+}
+
+// usernameIndex narrows username substring searches to a candidate set.
+// Implementations keep their own lock, so lookups don't wait on the
+// leaderboard lock; writers still hold that too, keeping the index in step
+// with the board.
+type usernameIndex interface {
+	// add indexes a user's username
+	add(user *User)
+	// remove drops a user from the index
+	remove(user *User)
+	// reindex discards the index and indexes every user from scratch
+	reindex(users []*User)
+	// size returns the number of distinct terms in the index
+	size() int
+	// candidates returns the users whose usernames may contain the
+	// lowercased term, reporting false when the caller has to scan instead
+	candidates(searchLower string) ([]*User, bool)
+}
+
+// newUsernameIndex returns an empty index of the engine; the zero engine
+// is the trigram index
+func newUsernameIndex(engine SearchEngine) usernameIndex {
+	if engine == SearchBleve {
+		return newBleveIndex()
+	}
+	return newSearchIndex()
+}
+
+// searchIndex maps every lowercase byte trigram of a username to the users
+// containing it, so substring searches only verify a small candidate set
+// instead of scanning the whole board.
+type searchIndex struct {
+	mu    sync.RWMutex
+	grams map[string]map[*User]struct{}
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{grams: make(map[string]map[*User]struct{})}
+}
+
+// trigrams returns the distinct trigrams of an already lowercased string
+func trigrams(lowered string) []string {
+	if len(lowered) < trigramSize {
+		return nil
+	}
+	seen := make(map[string]struct{}, len(lowered))
+	grams := make([]string, 0, len(lowered))
+	for i := 0; i+trigramSize <= len(lowered); i++ {
+		gram := lowered[i : i+trigramSize]
+		if _, dup := seen[gram]; !dup {
+			seen[gram] = struct{}{}
+			grams = append(grams, gram)
+		}
+	}
+	return grams
+}
+
+// add indexes a user's username
+func (si *searchIndex) add(user *User) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	si.addLocked(user)
+}
+
+func (si *searchIndex) addLocked(user *User) {
+	for _, gram := range trigrams(strings.ToLower(user.Username)) {
+		posting, exists := si.grams[gram]
+		if !exists {
+			posting = make(map[*User]struct{})
+			si.grams[gram] = posting
+		}
+		posting[user] = struct{}{}
+	}
+}
+
+// remove drops a user from the index, forgetting trigrams nobody else uses
+func (si *searchIndex) remove(user *User) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	for _, gram := range trigrams(strings.ToLower(user.Username)) {
+		posting := si.grams[gram]
+		delete(posting, user)
+		if len(posting) == 0 {
+			delete(si.grams, gram)
+		}
+	}
+}
+
+// rebuild discards the index and re-indexes every user from scratch
+func (si *searchIndex) rebuild(users []*User) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	si.grams = make(map[string]map[*User]struct{})
+	for _, user := range users {
+		si.addLocked(user)
+	}
+}
+
+// reindex rebuilds the index in parallel
+func (si *searchIndex) reindex(users []*User) {
+	si.rebuildParallel(users)
+}
+
+// size returns the number of distinct trigrams in the index
+func (si *searchIndex) size() int {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	return len(si.grams)
+}
+
+// candidates returns the users whose usernames contain every trigram of the
+// lowercased term. It reports false when the term is too short to use the
+// index and the caller has to scan.
+func (si *searchIndex) candidates(searchLower string) ([]*User, bool) {
+	grams := trigrams(searchLower)
+	if len(grams) == 0 {
+		return nil, false
+	}
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+
+	// Intersect starting from the rarest trigram
+	postings := make([]map[*User]struct{}, 0, len(grams))
+	for _, gram := range grams {
+		posting := si.grams[gram]
+		if len(posting) == 0 {
+			return []*User{}, true
+		}
+		postings = append(postings, posting)
+	}
+	sort.Slice(postings, func(i, j int) bool {
+		return len(postings[i]) < len(postings[j])
+	})
+
+	users := make([]*User, 0, len(postings[0]))
+	for user := range postings[0] {
+		inAll := true
+		for _, posting := range postings[1:] {
+			if _, ok := posting[user]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			users = append(users, user)
+		}
+	}
+	return users, true
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxStreamedResults is the hard cap on results per streamed search response
+	maxStreamedResults = 10000
+	// streamChunkSize is how many results are gathered per lock acquisition and flushed together
+	streamChunkSize = 500
+)
+
+// searchCursor is the position of a result in relevance order: match type,
+// then rank, then username. Continuing after it skips everything already sent.
+// Results can shift if ratings change between requests.
+type searchCursor struct {
+	Priority int    `json:"p"`
+	Rank     int    `json:"r"`
+	Username string `json:"u"`
+}
+
+func cursorOf(result SearchResult) searchCursor {
+	return searchCursor{
+		Priority: matchPriority[result.MatchType],
+		Rank:     sortableRank(result.Rank),
+		Username: result.Username,
+	}
+}
+
+// before reports whether a sorts ahead of b in relevance order
+func (a searchCursor) before(b searchCursor) bool {
+	if a.Priority != b.Priority {
+		return a.Priority < b.Priority
+	}
+	if a.Rank != b.Rank {
+		return a.Rank < b.Rank
+	}
+	return a.Username < b.Username
+}
+
+func (a searchCursor) encode() string {
+	raw, _ := json.Marshal(a)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeSearchCursor(s string) (*searchCursor, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+	var cursor searchCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, false
+	}
+	return &cursor, true
+}
+
+// SearchUserAfter returns up to limit search results that come after the
+// cursor in relevance order, and whether more remain. Only the returned
+// results are copied, so large result sets can be streamed in chunks.
+func (lm *LeaderboardManager) SearchUserAfter(searchTerm string, after *searchCursor, limit int, paths FeaturePaths) ([]SearchResult, bool) {
+	lm.rLockRanked()
+	defer lm.mu.RUnlock()
+
+	type match struct {
+		user       *User
+		key        searchCursor
+		matchType  MatchType
+		start, end int
+	}
+
+	searchLower := strings.ToLower(searchTerm)
+	matches := make([]match, 0)
+	for _, user := range lm.searchCandidates(searchLower, paths) {
+		matchType, start, end, ok := matchUsername(user.Username, searchLower)
+		if !ok {
+			continue
+		}
+		key := searchCursor{Priority: matchPriority[matchType], Rank: sortableRank(user.Rank), Username: user.Username}
+		if after != nil && !after.before(key) {
+			continue
+		}
+		matches = append(matches, match{user: user, key: key, matchType: matchType, start: start, end: end})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].key.before(matches[j].key)
+	})
+	more := len(matches) > limit
+	if more {
+		matches = matches[:limit]
+	}
+
+	results := make([]SearchResult, len(matches))
+	for i, m := range matches {
+		results[i] = SearchResult{
+			User:       m.user.snapshot(),
+			MatchType:  m.matchType,
+			MatchStart: m.start,
+			MatchEnd:   m.end,
+		}
+	}
+	return results, more
+}
+
+// streamSearchResults writes search results as NDJSON, one result per line,
+// flushing after each chunk. The final line is a trailer object with the
+// number of results streamed and, when the cap was hit, a cursor to continue.
+func streamSearchResults(c *gin.Context, query string) {
+	var after *searchCursor
+	if cursor := c.Query("cursor"); cursor != "" {
+		var ok bool
+		if after, ok = decodeSearchCursor(cursor); !ok {
+			respond(c, 400, gin.H{"error": "invalid cursor"})
+			return
+		}
+	}
+
+	paths := features.For(clientID(c))
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(200)
+	encoder := json.NewEncoder(c.Writer)
+
+	streamed := 0
+	more := true
+	for more && streamed < maxStreamedResults && !expired(c) {
+		chunk := streamChunkSize
+		if remaining := maxStreamedResults - streamed; remaining < chunk {
+			chunk = remaining
+		}
+
+		var results []SearchResult
+		results, more = leaderboard.SearchUserAfter(query, after, chunk, paths)
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+
+		streamed += len(results)
+		if len(results) > 0 {
+			last := cursorOf(results[len(results)-1])
+			after = &last
+		}
+	}
+
+	trailer := gin.H{"streamed": streamed, "hasMore": more}
+	if expired(c) {
+		trailer["timedOut"] = true
+	}
+	if more && after != nil {
+		trailer["cursor"] = after.encode()
+	}
+	encoder.Encode(trailer)
+}
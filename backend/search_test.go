@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"testing"
+)
+
+func TestSearchOrdering(t *testing.T) {
+	for _, engine := range []SearchEngine{SearchTrigram, SearchBleve} {
+		t.Run(string(engine), func(t *testing.T) {
+			config := DefaultBoardConfig()
+			config.SearchEngine = engine
+			testSearchOrdering(t, newTestServer(t, config))
+		})
+	}
+}
+
+func testSearchOrdering(t *testing.T, ts *testServer) {
+	ts.createUsers(map[string]int{
+		"ace":    1000,
+		"acer":   1500,
+		"aceman": 1700,
+		"acex":   1200,
+		"bace":   1800,
+		"xace":   1100,
+		"space":  1300,
+		"zed":    2000,
+	})
+	// Exact match first, then prefixes, then substrings, each by rating
+	want := []string{"ace", "aceman", "acer", "acex", "bace", "space", "xace"}
+
+	for _, percent := range []int{100, 0} {
+		t.Run(fmt.Sprintf("search index at %d%%", percent), func(t *testing.T) {
+			previous := features
+			features = NewFeatureFlags()
+			features.Set(FeatureSearchIndex, percent)
+			t.Cleanup(func() { features = previous })
+			ts := ts.in(t)
+
+			// Repeated searches must agree, or pages would shift between calls
+			for i := 0; i < 5; i++ {
+				body := ts.expect(request{method: http.MethodGet, path: "/api/search?q=ace"}, http.StatusOK)
+				if got := usernames(t, body["results"]); !equalStrings(got, want) {
+					t.Fatalf("search %d returned %v, want %v", i+1, got, want)
+				}
+			}
+
+			var paged []string
+			for page := 1; page <= 4; page++ {
+				body := ts.expect(request{method: http.MethodGet, path: fmt.Sprintf("/api/search?q=ace&pageSize=2&page=%d", page)}, http.StatusOK)
+				paged = append(paged, usernames(t, body["results"])...)
+			}
+			if !equalStrings(paged, want) {
+				t.Errorf("pages of 2 returned %v, want %v", paged, want)
+			}
+		})
+	}
+}
+
+func TestBleveIndexFollowsBoard(t *testing.T) {
+	index := newBleveIndex()
+	names := func(users []*User) []string {
+		got := make([]string, len(users))
+		for i, user := range users {
+			got[i] = user.Username
+		}
+		sort.Strings(got)
+		return got
+	}
+	expect := func(term string, want ...string) {
+		t.Helper()
+		users, ok := index.candidates(term)
+		if !ok {
+			t.Fatalf("index didn't answer %q", term)
+		}
+		if got := names(users); !equalStrings(got, want) {
+			t.Fatalf("%q matched %v, want %v", term, got, want)
+		}
+	}
+
+	ace, bace := &User{Username: "Ace"}, &User{Username: "bACE"}
+	index.add(ace)
+	index.add(bace)
+	expect("ace", "Ace", "bACE")
+	expect("ba", "bACE")
+
+	// Replacing a user indexes the new one; removing the old one after
+	// must not take the name out
+	replacement := &User{Username: "Ace"}
+	index.add(replacement)
+	index.remove(ace)
+	if users, _ := index.candidates("ace"); len(users) != 2 || (users[0] != replacement && users[1] != replacement) {
+		t.Fatalf("after replacing Ace the index holds %v", names(users))
+	}
+	index.remove(bace)
+	expect("ace", "Ace")
+
+	index.reindex([]*User{bace})
+	expect("ace", "bACE")
+	if size := index.size(); size != 1 {
+		t.Errorf("rebuilt index has %d terms, want 1", size)
+	}
+
+	for _, term := range []string{"", "a*", "a?e"} {
+		if _, ok := index.candidates(term); ok {
+			t.Errorf("index answered %q, which has to be scanned", term)
+		}
+	}
+}
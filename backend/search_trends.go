@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"hash/maphash"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// countMinSketch estimates how often each term was seen in fixed memory.
+// Estimates never undercount; collisions can only inflate them.
+type countMinSketch struct {
+	seeds  []maphash.Seed
+	counts [][]uint32
+}
+
+func newCountMinSketch(depth, width int) *countMinSketch {
+	cms := &countMinSketch{
+		seeds:  make([]maphash.Seed, depth),
+		counts: make([][]uint32, depth),
+	}
+	for i := range cms.counts {
+		cms.seeds[i] = maphash.MakeSeed()
+		cms.counts[i] = make([]uint32, width)
+	}
+	return cms
+}
+
+// add counts one occurrence of term and returns its new estimate
+func (cms *countMinSketch) add(term string) uint32 {
+	estimate := ^uint32(0)
+	for i, row := range cms.counts {
+		slot := maphash.String(cms.seeds[i], term) % uint64(len(row))
+		if row[slot] < ^uint32(0) {
+			row[slot]++
+		}
+		if row[slot] < estimate {
+			estimate = row[slot]
+		}
+	}
+	return estimate
+}
+
+// SearchTerm is a search query and its estimated number of occurrences
+type SearchTerm struct {
+	Term  string `json:"term"`
+	Count uint32 `json:"count"`
+}
+
+// SearchTrends tracks the most searched terms with a count-min sketch
+// plus a small candidate set of the current heavy hitters
+type SearchTrends struct {
+	mu       sync.Mutex
+	sketch   *countMinSketch
+	top      map[string]uint32
+	capacity int
+	total    uint64
+}
+
+// NewSearchTrends creates a tracker that remembers up to capacity top terms
+func NewSearchTrends(capacity int) *SearchTrends {
+	return &SearchTrends{
+		sketch:   newCountMinSketch(4, 4096),
+		top:      make(map[string]uint32),
+		capacity: capacity,
+	}
+}
+
+// Record counts one search for term
+func (st *SearchTrends) Record(term string) {
+	term = strings.ToLower(strings.TrimSpace(term))
+	if term == "" {
+		return
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.total++
+	estimate := st.sketch.add(term)
+	if _, tracked := st.top[term]; tracked || len(st.top) < st.capacity {
+		st.top[term] = estimate
+		return
+	}
+
+	// Replace the weakest candidate if this term has overtaken it
+	minTerm, minCount := "", ^uint32(0)
+	for t, count := range st.top {
+		if count < minCount {
+			minTerm, minCount = t, count
+		}
+	}
+	if estimate > minCount {
+		delete(st.top, minTerm)
+		st.top[term] = estimate
+	}
+}
+
+// Top returns the most searched terms, most frequent first
+func (st *SearchTrends) Top(limit int) ([]SearchTerm, uint64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	terms := make([]SearchTerm, 0, len(st.top))
+	for term, count := range st.top {
+		terms = append(terms, SearchTerm{Term: term, Count: count})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Count == terms[j].Count {
+			return terms[i].Term < terms[j].Term
+		}
+		return terms[i].Count > terms[j].Count
+	})
+	if len(terms) > limit {
+		terms = terms[:limit]
+	}
+	return terms, st.total
+}
+
+var searchTrends = NewSearchTrends(100)
+
+// Handler: Get the most searched terms
+func getTopSearches(c *gin.Context) {
+	limit := 20
+	if l := c.Query("limit"); l != "" {
+		fmt.Sscanf(l, "%d", &limit)
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	terms, total := searchTrends.Top(limit)
+	respond(c, 200, gin.H{
+		"terms":         terms,
+		"count":         len(terms),
+		"totalSearches": total,
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServerConfig controls how the HTTP listener is set up
+type ServerConfig struct {
+	Addr string
+	// TLSCert and TLSKey enable HTTPS, which also negotiates HTTP/2 via ALPN
+	TLSCert string
+	TLSKey  string
+	// H2C serves cleartext HTTP/2 for internal clients that skip TLS
+	H2C bool
+}
+
+// Validate checks that TLS is either fully configured or not at all
+func (sc ServerConfig) Validate() error {
+	if (sc.TLSCert == "") != (sc.TLSKey == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be set together")
+	}
+	return nil
+}
+
+// TLS reports whether the server terminates TLS itself
+func (sc ServerConfig) TLS() bool {
+	return sc.TLSCert != ""
+}
+
+// URL is the base address printed at startup
+func (sc ServerConfig) URL() string {
+	scheme := "http"
+	if sc.TLS() {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://localhost%s", scheme, sc.Addr)
+}
+
+var serverConfig = ServerConfig{Addr: ":8080"}
+
+// shutdownTimeout is how long in-flight requests get to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// newServer wraps the router in an http.Server. Go's server speaks HTTP/2
+// automatically over TLS; h2c needs gin's cleartext upgrade handler.
+func newServer(router *gin.Engine, sc ServerConfig) *http.Server {
+	router.UseH2C = sc.H2C && !sc.TLS()
+	return &http.Server{
+		Addr:              sc.Addr,
+		Handler:           router.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+}
+
+// listen serves until the server fails or is shut down
+func listen(server *http.Server, sc ServerConfig) error {
+	var err error
+	if sc.TLS() {
+		err = server.ListenAndServeTLS(sc.TLSCert, sc.TLSKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
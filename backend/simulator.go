@@ -0,0 +1,95 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// simulatorCheckEvery is how often the simulator re-assesses load
+	simulatorCheckEvery = time.Second
+	// simulatorThrottleFactor is how much a throttled simulator slows down
+	simulatorThrottleFactor = 4
+)
+
+// simulatorLatencyBudget is the average API latency above which the
+// simulator pauses; past half of it the simulator throttles
+var simulatorLatencyBudget = 200 * time.Millisecond
+
+// SimulatorState is whether the score simulator is generating updates
+type SimulatorState string
+
+// Simulator states; a throttled simulator sends a quarter of its updates
+const (
+	SimulatorRunning   SimulatorState = "running"
+	SimulatorThrottled SimulatorState = "throttled"
+	SimulatorPaused    SimulatorState = "paused"
+	SimulatorStopped   SimulatorState = "stopped"
+)
+
+// simulatorGovernor backs the simulator off while real traffic is heavy:
+// throttled when the API slows or fills half its in-flight slots, paused
+// when requests queue or latency exceeds the budget, and back to full rate
+// once load drops
+type simulatorGovernor struct {
+	mu        sync.Mutex
+	state     SimulatorState
+	since     time.Time
+	checkedAt time.Time
+	ticks     uint64
+}
+
+var simulator = &simulatorGovernor{}
+
+// assessLoad decides the state from the load shedder's view of the API
+func assessLoad() SimulatorState {
+	if loadShedder == nil {
+		return SimulatorRunning
+	}
+	stats, latency := loadShedder.Stats(), loadShedder.Latency()
+	switch {
+	case stats.Queued > 0 || latency > simulatorLatencyBudget:
+		return SimulatorPaused
+	case latency > simulatorLatencyBudget/2 || (stats.MaxInFlight > 0 && 2*stats.InFlight >= stats.MaxInFlight):
+		return SimulatorThrottled
+	}
+	return SimulatorRunning
+}
+
+// allow reports whether the tick at now should generate an update
+func (g *simulatorGovernor) allow(now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if now.Sub(g.checkedAt) >= simulatorCheckEvery {
+		g.checkedAt = now
+		g.set(assessLoad(), now)
+	}
+	g.ticks++
+	switch g.state {
+	case SimulatorPaused:
+		return false
+	case SimulatorThrottled:
+		return g.ticks%simulatorThrottleFactor == 0
+	}
+	return true
+}
+
+// set changes state, logging transitions; g.mu must be held
+func (g *simulatorGovernor) set(state SimulatorState, now time.Time) {
+	if state == g.state {
+		return
+	}
+	if g.state != "" {
+		log.Printf("🔄 Score simulator %s (was %s for %s)", state, g.state, now.Sub(g.since).Round(time.Second))
+	}
+	g.state, g.since = state, now
+}
+
+// status returns the current state and when it began
+func (g *simulatorGovernor) status() (SimulatorState, time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.state, g.since
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slackMaxSkew rejects signed requests older than this, to stop replays
+const slackMaxSkew = 5 * time.Minute
+
+// slackSigningSecret verifies slash-command requests; the endpoint is disabled without it
+var slackSigningSecret string
+
+// verifySlackSignature checks X-Slack-Signature against the raw request body
+func verifySlackSignature(c *gin.Context, body []byte) bool {
+	timestamp := c.GetHeader("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if skew := time.Since(time.Unix(seconds, 0)); skew > slackMaxSkew || skew < -slackMaxSkew {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(slackSigningSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(c.GetHeader("X-Slack-Signature")))
+}
+
+func slackSection(text string) gin.H {
+	return gin.H{"type": "section", "text": gin.H{"type": "mrkdwn", "text": text}}
+}
+
+func slackReply(blocks ...gin.H) gin.H {
+	return gin.H{"response_type": "in_channel", "blocks": blocks}
+}
+
+// slackError is only shown to the user who ran the command
+func slackError(text string) gin.H {
+	return gin.H{"response_type": "ephemeral", "text": text}
+}
+
+// slackTop renders the top 10 as blocks
+func slackTop() gin.H {
+	lines := make([]string, 0, 10)
+	for _, user := range leaderboard.GetLeaderboard(1, 10, UnrankedExclude, features.For("")) {
+		lines = append(lines, fmt.Sprintf("*#%d* %s — %s", user.Rank, user.Username, leaderboard.FormatRating(user.Rating)))
+	}
+	return slackReply(
+		gin.H{"type": "header", "text": gin.H{"type": "plain_text", "text": "🏆 Top 10"}},
+		slackSection(strings.Join(lines, "\n")),
+	)
+}
+
+// slackRank renders one user's standing as blocks
+func slackRank(username string) gin.H {
+	if username == "" {
+		return slackError("Usage: /rank <username>")
+	}
+	info, ok := leaderboard.GetRank(username, features.For(""))
+	if !ok {
+		return slackError(fmt.Sprintf("No player named %s on the board.", username))
+	}
+	return slackReply(gin.H{
+		"type": "section",
+		"text": gin.H{"type": "mrkdwn", "text": fmt.Sprintf("*%s*", info.Username)},
+		"fields": []gin.H{
+			{"type": "mrkdwn", "text": "*Rank*\n" + info.standing()},
+			{"type": "mrkdwn", "text": fmt.Sprintf("*Rating*\n%s", leaderboard.FormatRating(info.Rating))},
+		},
+	})
+}
+
+// Handler: Slack slash commands /top and /rank <username>
+func slackCommand(c *gin.Context) {
+	if slackSigningSecret == "" {
+		c.JSON(404, gin.H{"error": "slack integration is not configured"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "could not read request body"})
+		return
+	}
+	if !verifySlackSignature(c, body) {
+		c.JSON(401, gin.H{"error": "invalid request signature"})
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid form body"})
+		return
+	}
+
+	switch command := form.Get("command"); command {
+	case "/top":
+		c.JSON(200, slackTop())
+	case "/rank":
+		c.JSON(200, slackRank(strings.TrimPrefix(strings.TrimSpace(form.Get("text")), "@")))
+	default:
+		c.JSON(200, slackError(fmt.Sprintf("Unknown command %s", command)))
+	}
+}
@@ -0,0 +1,948 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateOp is the kind of change a StoredUpdate records
+type UpdateOp string
+
+const (
+	// OpRating sets a user's rating, creating the user if needed
+	OpRating UpdateOp = "rating"
+	// OpDelete soft-deletes a user into a tombstone
+	OpDelete UpdateOp = "delete"
+	// OpRestore brings a soft-deleted user back
+	OpRestore UpdateOp = "restore"
+	// OpRemove deletes a user outright
+	OpRemove UpdateOp = "remove"
+	// OpGame sets a user's games played and wins
+	OpGame UpdateOp = "game"
+	// OpScores sets a user's extra score fields
+	OpScores UpdateOp = "scores"
+	// OpPlacement sets a user's country and region
+	OpPlacement UpdateOp = "placement"
+	// OpTags sets a user's tags
+	OpTags UpdateOp = "tags"
+	// OpUnranked takes a user out of the ranking, or back in when empty
+	OpUnranked UpdateOp = "unranked"
+	// OpContribution records a score that counts towards a user's rating
+	// for the board's score window; Rating holds its value
+	OpContribution UpdateOp = "contribution"
+	// OpExpire drops the contributions made before Before; the rating and
+	// ranking changes it caused are logged separately
+	OpExpire UpdateOp = "expire"
+)
+
+// StoredUpdate is one change appended to storage between snapshots. Seq
+// increases with every update, so a snapshot can say which ones it covers,
+// and Version is the board version the change produced. Only the fields
+// the op changes are set, each to its new value.
+type StoredUpdate struct {
+	Seq         uint64         `json:"seq"`
+	Version     uint64         `json:"version,omitempty"`
+	Op          UpdateOp       `json:"op"`
+	Username    string         `json:"username"`
+	Rating      int            `json:"rating,omitempty"`
+	Updates     int            `json:"updates,omitempty"`
+	GamesPlayed int            `json:"gamesPlayed,omitempty"`
+	Wins        int            `json:"wins,omitempty"`
+	Scores      map[string]int `json:"scores,omitempty"`
+	Country     string         `json:"country,omitempty"`
+	Region      string         `json:"region,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	Unranked    UnrankedReason `json:"unranked,omitempty"`
+	Before      time.Time      `json:"before,omitempty"`
+	At          time.Time      `json:"at"`
+}
+
+// StoredTombstone is a soft-deleted user kept in a snapshot
+type StoredTombstone struct {
+	User      User      `json:"user"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// StoredHistory is one user's rating history kept in a snapshot
+type StoredHistory struct {
+	Entries []RatingEntry             `json:"entries"`
+	Trimmed bool                      `json:"trimmed,omitempty"`
+	Rollups map[string][]StoredRollup `json:"rollups,omitempty"`
+}
+
+// StoredRollup is a rollup period with the running sum its average comes from
+type StoredRollup struct {
+	RatingRollup
+	Sum int `json:"sum"`
+}
+
+// StoredContribution is a score still inside the board's score window
+type StoredContribution struct {
+	Username string    `json:"username"`
+	Value    int       `json:"value"`
+	At       time.Time `json:"at"`
+}
+
+// BoardSnapshot is the whole board at a point in time. It includes every
+// update up to LastSeq, each user's rating history and the contributions
+// still inside the score window. Rank samples for velocity stats are not
+// kept; they are taken again from the live ranks after a restart.
+type BoardSnapshot struct {
+	// Format is the layout version the snapshot was written in, and
+	// Checksum the SHA-256 of its JSON encoding with Checksum left empty.
+	// Snapshots from before either was recorded have format 0.
+	Format        int                      `json:"format,omitempty"`
+	Checksum      string                   `json:"checksum,omitempty"`
+	LastSeq       uint64                   `json:"lastSeq"`
+	Version       uint64                   `json:"version,omitempty"`
+	TakenAt       time.Time                `json:"takenAt"`
+	Users         []User                   `json:"users"`
+	Tombstones    []StoredTombstone        `json:"tombstones"`
+	History       map[string]StoredHistory `json:"history,omitempty"`
+	Contributions []StoredContribution     `json:"contributions,omitempty"`
+}
+
+// Storage keeps the board across restarts: periodic snapshots plus the
+// updates appended since the latest one. A few older snapshots, and the
+// updates since the oldest, are kept for point-in-time restores.
+type Storage interface {
+	// Load returns the latest snapshot, if any, and the updates after it in order
+	Load() (*BoardSnapshot, []StoredUpdate, error)
+	// LoadAt returns the newest kept snapshot the target covers and the
+	// updates after it in order. The snapshot is nil when the log still
+	// starts at the first update; errNotRetained means nothing kept reaches
+	// back to the target.
+	LoadAt(target RollbackTarget) (*BoardSnapshot, []StoredUpdate, error)
+	// Save writes a snapshot, retires the oldest kept one and drops the
+	// updates no kept snapshot needs
+	Save(snapshot *BoardSnapshot) error
+	// AppendUpdate records one update; it may be buffered until Flush
+	AppendUpdate(update StoredUpdate) error
+	// Flush makes appended updates durable
+	Flush() error
+	Close() error
+}
+
+const (
+	snapshotFile = "snapshot.json"
+	updatesFile  = "updates.log"
+	archiveDir   = "snapshots"
+	// storageFlushEvery is how often appended updates are synced to disk;
+	// a crash loses at most this much
+	storageFlushEvery = time.Second
+)
+
+// errNotRetained is returned by LoadAt for targets older than anything kept
+var errNotRetained = errors.New("no kept snapshot reaches back to that point")
+
+// snapshotFormat is the layout version snapshots are written in
+const snapshotFormat = 1
+
+// errBadSnapshot wraps the reasons a stored snapshot is refused
+var errBadSnapshot = errors.New("snapshot failed verification")
+
+// sum returns the checksum of a snapshot's contents
+func (s *BoardSnapshot) sum() (string, error) {
+	unsealed := *s
+	unsealed.Checksum = ""
+	hash := sha256.New()
+	if err := json.NewEncoder(hash).Encode(&unsealed); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// seal stamps a snapshot with the current format and its checksum
+func (s *BoardSnapshot) seal() error {
+	s.Format = snapshotFormat
+	sum, err := s.sum()
+	s.Checksum = sum
+	return err
+}
+
+// verify refuses a stored snapshot in a format this server doesn't know or
+// whose contents no longer match its checksum. Snapshots from before
+// checksums were recorded have nothing to check.
+func (s *BoardSnapshot) verify() error {
+	if s.Format > snapshotFormat {
+		return fmt.Errorf("%w: it is in format %d, newer than the %d this server reads", errBadSnapshot, s.Format, snapshotFormat)
+	}
+	if s.Format == 0 {
+		return nil
+	}
+	sum, err := s.sum()
+	if err != nil {
+		return err
+	}
+	if sum != s.Checksum {
+		return fmt.Errorf("%w: its contents hash to %s but it was saved as %s, so it is corrupt", errBadSnapshot, sum, s.Checksum)
+	}
+	return nil
+}
+
+// StorageEngine names a Storage implementation for --storage
+type StorageEngine string
+
+const (
+	// StorageBolt keeps the board in a BoltDB file
+	StorageBolt StorageEngine = "bolt"
+	// StorageFile keeps the board in a JSON snapshot and an NDJSON log
+	StorageFile StorageEngine = "file"
+)
+
+// ParseStorageEngine validates a --storage value
+func ParseStorageEngine(s string) (StorageEngine, error) {
+	switch engine := StorageEngine(s); engine {
+	case StorageBolt, StorageFile:
+		return engine, nil
+	}
+	return "", fmt.Errorf("unknown storage engine %q (expected %q or %q)", s, StorageBolt, StorageFile)
+}
+
+// OpenStorage opens the board's storage in dir with the given engine,
+// keeping the latest keep snapshots
+func OpenStorage(engine StorageEngine, dir string, keep int) (Storage, error) {
+	if engine == StorageFile {
+		return OpenFileStorage(dir, keep)
+	}
+	return OpenBoltStorage(dir, keep)
+}
+
+// fileStorage keeps a JSON snapshot and an NDJSON update log in a
+// directory. Replaced snapshots move to archiveDir, named by their LastSeq.
+type fileStorage struct {
+	dir  string
+	keep int
+
+	// saving serializes snapshots and restores reading the archive
+	saving sync.Mutex
+	// latest is the LastSeq of the snapshot in snapshotFile
+	latest uint64
+
+	mu      sync.Mutex
+	updates *os.File
+	w       *bufio.Writer
+}
+
+// OpenFileStorage opens, creating if needed, a storage directory
+func OpenFileStorage(dir string, keep int) (*fileStorage, error) {
+	if err := os.MkdirAll(filepath.Join(dir, archiveDir), 0o755); err != nil {
+		return nil, err
+	}
+	fs := &fileStorage{dir: dir, keep: max(keep, 1)}
+	if err := fs.openUpdates(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *fileStorage) openUpdates() error {
+	f, err := os.OpenFile(filepath.Join(fs.dir, updatesFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	fs.updates, fs.w = f, bufio.NewWriter(f)
+	return nil
+}
+
+func (fs *fileStorage) Load() (*BoardSnapshot, []StoredUpdate, error) {
+	snapshot, err := readSnapshotFile(filepath.Join(fs.dir, snapshotFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		snapshot = nil
+	case err != nil:
+		return nil, nil, err
+	}
+
+	var after uint64
+	if snapshot != nil {
+		after = snapshot.LastSeq
+	}
+	fs.saving.Lock()
+	fs.latest = after
+	fs.saving.Unlock()
+	updates, err := fs.readUpdates(after)
+	return snapshot, updates, err
+}
+
+// readSnapshotFile reads one snapshot file
+func readSnapshotFile(path string) (*BoardSnapshot, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &BoardSnapshot{}
+	if err := json.Unmarshal(raw, snapshot); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filepath.Base(path), err)
+	}
+	if err := snapshot.verify(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filepath.Base(path), err)
+	}
+	return snapshot, nil
+}
+
+// archivePath is where the snapshot covering updates up to seq is kept
+func (fs *fileStorage) archivePath(seq uint64) string {
+	return filepath.Join(fs.dir, archiveDir, fmt.Sprintf("%020d.json", seq))
+}
+
+// archived lists the LastSeq of every archived snapshot, oldest first
+func (fs *fileStorage) archived() ([]uint64, error) {
+	entries, err := os.ReadDir(filepath.Join(fs.dir, archiveDir))
+	if err != nil {
+		return nil, err
+	}
+	seqs := make([]uint64, 0, len(entries))
+	for _, entry := range entries {
+		var seq uint64
+		if _, err := fmt.Sscanf(entry.Name(), "%020d.json", &seq); err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	// Zero-padded names already list in sequence order
+	return seqs, nil
+}
+
+func (fs *fileStorage) LoadAt(target RollbackTarget) (*BoardSnapshot, []StoredUpdate, error) {
+	fs.saving.Lock()
+	defer fs.saving.Unlock()
+
+	seqs, err := fs.archived()
+	if err != nil {
+		return nil, nil, err
+	}
+	paths := make([]string, 0, len(seqs)+1)
+	for _, seq := range seqs {
+		paths = append(paths, fs.archivePath(seq))
+	}
+	paths = append(paths, filepath.Join(fs.dir, snapshotFile))
+
+	var snapshot *BoardSnapshot
+	for i := len(paths) - 1; i >= 0 && snapshot == nil; i-- {
+		candidate, err := readSnapshotFile(paths[i])
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if target.coversSnapshot(candidate) {
+			snapshot = candidate
+		}
+	}
+
+	var after uint64
+	if snapshot != nil {
+		after = snapshot.LastSeq
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.w.Flush(); err != nil {
+		return nil, nil, err
+	}
+	updates, err := fs.readUpdates(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	if snapshot == nil && len(updates) > 0 && updates[0].Seq != 1 {
+		return nil, nil, errNotRetained
+	}
+	if snapshot == nil && len(updates) == 0 && (fs.latest > 0 || len(seqs) > 0) {
+		return nil, nil, errNotRetained
+	}
+	return snapshot, updates, nil
+}
+
+// readUpdates reads the logged updates after a sequence number. A torn last
+// line from a crash mid-write ends the log rather than failing the load.
+func (fs *fileStorage) readUpdates(after uint64) ([]StoredUpdate, error) {
+	f, err := os.Open(filepath.Join(fs.dir, updatesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	updates := make([]StoredUpdate, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var update StoredUpdate
+		if err := json.Unmarshal(scanner.Bytes(), &update); err != nil {
+			log.Printf("⚠️  Ignoring %s from line %d on: %v", updatesFile, line, err)
+			break
+		}
+		if update.Seq > after {
+			updates = append(updates, update)
+		}
+	}
+	return updates, scanner.Err()
+}
+
+func (fs *fileStorage) AppendUpdate(update StoredUpdate) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return json.NewEncoder(fs.w).Encode(update)
+}
+
+func (fs *fileStorage) Flush() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.w.Flush(); err != nil {
+		return err
+	}
+	return fs.updates.Sync()
+}
+
+// Save moves the old snapshot into the archive and writes the new one in its
+// place, drops archived snapshots past the kept count, then rewrites the log
+// with only the updates after the oldest snapshot still kept
+func (fs *fileStorage) Save(snapshot *BoardSnapshot) error {
+	fs.saving.Lock()
+	defer fs.saving.Unlock()
+
+	path := filepath.Join(fs.dir, snapshotFile)
+	if fs.keep > 1 {
+		if err := os.Rename(path, fs.archivePath(fs.latest)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := writeFileAtomic(path, func(w *bufio.Writer) error {
+		return json.NewEncoder(w).Encode(snapshot)
+	}); err != nil {
+		return err
+	}
+	fs.latest = snapshot.LastSeq
+
+	seqs, err := fs.archived()
+	if err != nil {
+		return err
+	}
+	if extra := len(seqs) - (fs.keep - 1); extra > 0 {
+		for _, seq := range seqs[:extra] {
+			if err := os.Remove(fs.archivePath(seq)); err != nil {
+				return err
+			}
+		}
+		seqs = seqs[extra:]
+	}
+	oldest := snapshot.LastSeq
+	if len(seqs) > 0 {
+		oldest = seqs[0]
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.w.Flush(); err != nil {
+		return err
+	}
+	remaining, err := fs.readUpdates(oldest)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(fs.dir, updatesFile), func(w *bufio.Writer) error {
+		enc := json.NewEncoder(w)
+		for _, update := range remaining {
+			if err := enc.Encode(update); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	fs.updates.Close()
+	return fs.openUpdates()
+}
+
+func (fs *fileStorage) Close() error {
+	if err := fs.Flush(); err != nil {
+		return err
+	}
+	return fs.updates.Close()
+}
+
+// writeFileAtomic writes a file through a temporary one, so readers and
+// restarts only ever see the old or the new contents
+func writeFileAtomic(path string, write func(w *bufio.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	if err := write(w); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// storageStatus tracks how persisting the board is going, for health checks
+type storageStatus struct {
+	mu             sync.Mutex
+	detail         string
+	lastSnapshotAt time.Time
+	lastError      string
+	lastErrorAt    time.Time
+}
+
+var persistence = &storageStatus{detail: "in-memory"}
+
+func (s *storageStatus) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError, s.lastErrorAt = err.Error(), time.Now()
+}
+
+func (s *storageStatus) snapshotted(at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSnapshotAt, s.lastError = at, ""
+}
+
+// health is degraded after a failed write until the next snapshot succeeds
+func (s *storageStatus) health() DependencyStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := DependencyStatus{Status: DependencyOK, Detail: s.detail}
+	if !s.lastSnapshotAt.IsZero() {
+		status.Detail += ", last snapshot " + s.lastSnapshotAt.Format(time.RFC3339)
+	}
+	if s.lastError != "" {
+		at := s.lastErrorAt
+		status.Status, status.LastError, status.LastErrorAt = DependencyDegraded, s.lastError, &at
+	}
+	return status
+}
+
+// persist appends an update to storage, if the board has any; lm.mu must be
+// held. The update carries the user's current values for what the op
+// changes, except the rating, which may still be waiting to flush.
+func (lm *LeaderboardManager) persist(op UpdateOp, user *User, rating int, at time.Time) {
+	if lm.storage == nil {
+		return
+	}
+	update := StoredUpdate{Op: op, Username: user.Username, At: at}
+	switch op {
+	case OpRating:
+		update.Rating, update.Updates = rating, user.Updates
+	case OpContribution:
+		update.Rating = rating
+	case OpGame:
+		update.GamesPlayed, update.Wins = user.GamesPlayed, user.Wins
+	case OpScores:
+		update.Scores = user.snapshot().Scores
+	case OpPlacement:
+		update.Country, update.Region = user.Country, user.Region
+	case OpTags:
+		update.Tags = append([]string(nil), user.Tags...)
+	case OpUnranked:
+		update.Unranked = user.Unranked
+	}
+	lm.appendStoredLocked(update)
+}
+
+// appendStoredLocked numbers an update and appends it to storage; lm.mu
+// must be held and the board must have storage
+func (lm *LeaderboardManager) appendStoredLocked(update StoredUpdate) {
+	lm.storageSeq++
+	update.Seq, update.Version = lm.storageSeq, lm.Version()+1
+	if err := lm.storage.AppendUpdate(update); err != nil {
+		persistence.fail(err)
+	}
+	if lm.compactDueLocked() {
+		select {
+		case lm.compactSoon <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// compactDueLocked reports whether the log has grown past compactAfter
+// since the latest snapshot; lm.mu must be held
+func (lm *LeaderboardManager) compactDueLocked() bool {
+	return lm.compactAfter > 0 && lm.storageSeq-lm.snapshotSeq >= uint64(lm.compactAfter)
+}
+
+// AttachStorage loads the board from storage and then records every change
+// to it. It must run before anything else writes to the board.
+func (lm *LeaderboardManager) AttachStorage(storage Storage, detail string) error {
+	snapshot, updates, err := storage.Load()
+	if err != nil {
+		return err
+	}
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.loadStoredLocked(snapshot, updates)
+	lm.storage = storage
+	if snapshot != nil {
+		lm.snapshotSeq = snapshot.LastSeq
+	}
+	persistence.detail = detail
+
+	if snapshot != nil || len(updates) > 0 {
+		log.Printf("💾 Loaded %d users from %s (%d update(s) replayed)", len(lm.users), detail, len(updates))
+	}
+	return nil
+}
+
+// loadStoredLocked builds the board from a snapshot, if any, and the
+// updates after it; lm.mu must be held and the board must not have storage
+// yet, so nothing is logged again
+func (lm *LeaderboardManager) loadStoredLocked(snapshot *BoardSnapshot, updates []StoredUpdate) {
+	if snapshot != nil {
+		for _, saved := range snapshot.Users {
+			lm.loadUserLocked(saved)
+		}
+		for _, ts := range snapshot.Tombstones {
+			if user := lm.loadUserLocked(ts.User); user != nil {
+				lm.tombstoneLocked(user, ts.DeletedAt)
+			}
+		}
+		// Snapshots from before history was kept leave the joining entries
+		if snapshot.History != nil {
+			lm.ratingHistory = make(map[string]*ratingLog, len(snapshot.History))
+			for username, saved := range snapshot.History {
+				lm.ratingHistory[username] = saved.ratingLog()
+			}
+		}
+		for _, saved := range snapshot.Contributions {
+			lm.loadContributionLocked(saved.Username, saved.Value, saved.At)
+		}
+		lm.storageSeq = snapshot.LastSeq
+		lm.version.Store(max(lm.Version(), snapshot.Version))
+	}
+	for _, update := range updates {
+		lm.replayLocked(update)
+		lm.storageSeq = update.Seq
+		lm.version.Store(max(lm.Version(), update.Version))
+	}
+	lm.markChanged()
+}
+
+// loadUserLocked puts a user from a snapshot back on the board; lm.mu must be held
+func (lm *LeaderboardManager) loadUserLocked(saved User) *User {
+	if lm.addUserLocked(saved.Username, saved.Rating) != nil {
+		return nil
+	}
+	user := lm.users[saved.Username]
+	user.GamesPlayed, user.Wins, user.Updates = saved.GamesPlayed, saved.Wins, saved.Updates
+	user.Tags, user.Scores = saved.Tags, saved.Scores
+	user.LastActive = saved.LastActive
+	lm.rankTree.reposition(user)
+
+	from := user.regionPath()
+	lm.setCountryLocked(user, saved.Country)
+	user.Region = saved.Region
+	lm.moveRegion(user, from, user.regionPath())
+
+	lm.updateProvisional(user)
+	if saved.Unranked != "" {
+		lm.setUnrankedLocked(user, saved.Unranked)
+	}
+	return user
+}
+
+// ratingLog rebuilds the in-memory history from a snapshot
+func (saved StoredHistory) ratingLog() *ratingLog {
+	rl := &ratingLog{entries: saved.Entries, trimmed: saved.Trimmed}
+	if saved.Rollups != nil {
+		rl.rollups = make(map[string][]RatingRollup, len(saved.Rollups))
+		for name, stored := range saved.Rollups {
+			rollups := make([]RatingRollup, len(stored))
+			for i, r := range stored {
+				rollups[i] = r.RatingRollup
+				rollups[i].sum = r.Sum
+			}
+			rl.rollups[name] = rollups
+		}
+	}
+	return rl
+}
+
+// storedHistory is the snapshot form of a user's rating history
+func (rl *ratingLog) storedHistory() StoredHistory {
+	saved := StoredHistory{Entries: append([]RatingEntry(nil), rl.entries...), Trimmed: rl.trimmed}
+	if rl.rollups != nil {
+		saved.Rollups = make(map[string][]StoredRollup, len(rl.rollups))
+		for name, rollups := range rl.rollups {
+			stored := make([]StoredRollup, len(rollups))
+			for i, r := range rollups {
+				stored[i] = StoredRollup{RatingRollup: r, Sum: r.sum}
+			}
+			saved.Rollups[name] = stored
+		}
+	}
+	return saved
+}
+
+// loadContributionLocked queues a contribution from storage for a user on
+// the board or in a tombstone; lm.mu must be held
+func (lm *LeaderboardManager) loadContributionLocked(username string, value int, at time.Time) {
+	user, exists := lm.users[username]
+	if !exists {
+		ts, deleted := lm.tombstones[username]
+		if !deleted {
+			return
+		}
+		user = ts.user
+	}
+	lm.contributions.queue = append(lm.contributions.queue, contribution{user: user, value: value, at: at})
+	lm.contributions.live[user]++
+}
+
+// replayLocked applies one logged update; lm.mu must be held
+func (lm *LeaderboardManager) replayLocked(update StoredUpdate) {
+	user, exists := lm.users[update.Username]
+	switch update.Op {
+	case OpRating:
+		if !exists {
+			if lm.addUserLocked(update.Username, update.Rating) != nil {
+				return
+			}
+			user = lm.users[update.Username]
+			// The logged update is the joining entry, not the one just made
+			delete(lm.ratingHistory, user.Username)
+		}
+		delete(lm.pending, user)
+		lm.setRating(user, update.Rating)
+		user.Updates, user.LastActive = update.Updates, update.At
+		lm.updateProvisional(user)
+		entry := RatingEntry{Rating: update.Rating, At: update.At, Version: update.Version}
+		if entry.Version == 0 {
+			// Logged before updates carried versions
+			entry.Version = lm.Version() + 1
+		}
+		lm.appendRating(user.Username, entry)
+		return
+	case OpContribution:
+		lm.loadContributionLocked(update.Username, update.Rating, update.At)
+		return
+	case OpExpire:
+		lm.dropContributionsLocked(update.Before)
+		return
+	case OpDelete:
+		if exists {
+			lm.tombstoneLocked(user, update.At)
+		}
+	case OpRestore:
+		lm.restoreTombstoneLocked(update.Username)
+	case OpRemove:
+		if exists {
+			lm.removeLocked(user)
+		}
+	}
+	if !exists {
+		return
+	}
+	switch update.Op {
+	case OpGame:
+		user.GamesPlayed, user.Wins, user.LastActive = update.GamesPlayed, update.Wins, update.At
+		lm.rankTree.reposition(user)
+		lm.updateProvisional(user)
+	case OpScores:
+		user.Scores, user.LastActive = update.Scores, update.At
+		lm.rankTree.reposition(user)
+	case OpPlacement:
+		from := user.regionPath()
+		lm.setCountryLocked(user, update.Country)
+		user.Region = update.Region
+		lm.moveRegion(user, from, user.regionPath())
+	case OpTags:
+		user.Tags = update.Tags
+	case OpUnranked:
+		lm.setUnrankedLocked(user, update.Unranked)
+		lm.updateProvisional(user)
+	}
+}
+
+// errCompactNeedsStorage is returned by Compact on an in-memory board
+var errCompactNeedsStorage = errors.New("compacting folds the update log into a snapshot, so it needs --data-dir")
+
+// Compaction reports a snapshot taken to fold in the update log
+type Compaction struct {
+	SnapshotAt time.Time `json:"snapshotAt"`
+	Version    uint64    `json:"version"`
+	// Folded is how many updates logged since the previous snapshot the
+	// new one holds; the log keeps only those the kept snapshots need
+	Folded uint64 `json:"folded"`
+}
+
+// Snapshot writes the whole board to storage, if it has any, and compacts
+// the update log
+func (lm *LeaderboardManager) Snapshot() error {
+	if _, err := lm.Compact(); err != errCompactNeedsStorage {
+		return err
+	}
+	return nil
+}
+
+// Compact snapshots the board and drops the logged updates no kept
+// snapshot needs, retiring the oldest snapshot past --keep-snapshots
+func (lm *LeaderboardManager) Compact() (Compaction, error) {
+	lm.mu.Lock()
+	if lm.storage == nil {
+		lm.mu.Unlock()
+		return Compaction{}, errCompactNeedsStorage
+	}
+	// Coalesced ratings are already in the log, so they must be in the snapshot too
+	lm.flushPendingLocked()
+	snapshot := &BoardSnapshot{
+		LastSeq:       lm.storageSeq,
+		Version:       lm.Version(),
+		TakenAt:       time.Now(),
+		Users:         make([]User, 0, len(lm.users)),
+		Tombstones:    make([]StoredTombstone, 0, len(lm.tombstones)),
+		History:       make(map[string]StoredHistory, len(lm.ratingHistory)),
+		Contributions: make([]StoredContribution, 0, len(lm.contributions.queue)),
+	}
+	for _, user := range lm.users {
+		snapshot.Users = append(snapshot.Users, user.snapshot())
+	}
+	for _, ts := range lm.tombstones {
+		snapshot.Tombstones = append(snapshot.Tombstones, StoredTombstone{User: ts.user.snapshot(), DeletedAt: ts.deletedAt})
+	}
+	for username, rl := range lm.ratingHistory {
+		snapshot.History[username] = rl.storedHistory()
+	}
+	for _, c := range lm.contributions.queue {
+		snapshot.Contributions = append(snapshot.Contributions, StoredContribution{Username: c.user.Username, Value: c.value, At: c.at})
+	}
+	storage := lm.storage
+	lm.mu.Unlock()
+
+	// Every engine reads users back in name order, which the checksum covers
+	sort.Slice(snapshot.Users, func(i, j int) bool { return snapshot.Users[i].Username < snapshot.Users[j].Username })
+	sort.Slice(snapshot.Tombstones, func(i, j int) bool {
+		return snapshot.Tombstones[i].User.Username < snapshot.Tombstones[j].User.Username
+	})
+	if err := snapshot.seal(); err != nil {
+		return Compaction{}, err
+	}
+	if err := storage.Save(snapshot); err != nil {
+		persistence.fail(err)
+		return Compaction{}, err
+	}
+	persistence.snapshotted(snapshot.TakenAt)
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	compaction := Compaction{SnapshotAt: snapshot.TakenAt, Version: snapshot.Version}
+	// A concurrent compaction may already have saved a newer snapshot
+	if snapshot.LastSeq > lm.snapshotSeq {
+		compaction.Folded = snapshot.LastSeq - lm.snapshotSeq
+		lm.snapshotSeq = snapshot.LastSeq
+	}
+	return compaction, nil
+}
+
+// PersistEvery syncs appended updates every storageFlushEvery and snapshots
+// the board every interval, or as soon as compactAfter updates (if not 0)
+// have been logged since the last snapshot
+func (lm *LeaderboardManager) PersistEvery(interval time.Duration, compactAfter int) {
+	lm.mu.Lock()
+	lm.compactAfter = compactAfter
+	lm.compactSoon = make(chan struct{}, 1)
+	lm.mu.Unlock()
+
+	flushJob := backgroundJobs.register("storage flush", storageFlushEvery)
+	flushTicker := time.NewTicker(storageFlushEvery)
+	go func() {
+		for now := range flushTicker.C {
+			if err := lm.storage.Flush(); err != nil {
+				persistence.fail(err)
+			}
+			flushJob.ran(now)
+		}
+	}()
+
+	snapshotJob := backgroundJobs.register("snapshot", interval)
+	snapshotTicker := time.NewTicker(interval)
+	go func() {
+		for {
+			var now time.Time
+			select {
+			case now = <-snapshotTicker.C:
+			case <-lm.compactSoon:
+				lm.mu.RLock()
+				due := lm.compactDueLocked()
+				lm.mu.RUnlock()
+				// A snapshot since the request may already have folded the log
+				if !due {
+					continue
+				}
+				now = time.Now()
+			}
+			if err := lm.Snapshot(); err != nil {
+				log.Printf("⚠️  Snapshot failed: %v", err)
+			}
+			snapshotJob.ran(now)
+		}
+	}()
+	log.Printf("💾 Snapshotting the board every %s", interval)
+}
+
+// CloseStorage takes a final snapshot and closes storage, on shutdown
+func (lm *LeaderboardManager) CloseStorage() {
+	if lm.storage == nil {
+		return
+	}
+	if err := lm.Snapshot(); err != nil {
+		log.Printf("⚠️  Final snapshot failed: %v", err)
+	}
+	if err := lm.storage.Close(); err != nil {
+		log.Printf("⚠️  Closing storage failed: %v", err)
+	}
+}
+
+// Handler: Snapshot the board now and compact the update log
+func compactStorage(c *gin.Context) {
+	start := time.Now()
+	compaction, err := leaderboard.Compact()
+	switch {
+	case err == errCompactNeedsStorage:
+		respond(c, 409, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		respond(c, 500, gin.H{"error": err.Error()})
+		return
+	}
+	auditLog.Record(c, "storage.compact", "*", gin.H{"folded": compaction.Folded, "version": compaction.Version})
+	respond(c, 200, gin.H{
+		"snapshotAt": compaction.SnapshotAt,
+		"version":    compaction.Version,
+		"folded":     compaction.Folded,
+		"durationMs": time.Since(start).Milliseconds(),
+	})
+}
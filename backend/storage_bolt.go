@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const boltFile = "board.db"
+
+var (
+	boltMeta          = []byte("meta")
+	boltUsers         = []byte("users")
+	boltTombstones    = []byte("tombstones")
+	boltHistory       = []byte("history")
+	boltContributions = []byte("contributions")
+	boltUpdates       = []byte("updates")
+	boltArchive       = []byte("archive")
+
+	// boltSnapshotBuckets are replaced whole by every snapshot
+	boltSnapshotBuckets = [][]byte{boltUsers, boltTombstones, boltHistory, boltContributions}
+
+	boltLastSeq  = []byte("lastSeq")
+	boltVersion  = []byte("version")
+	boltTakenAt  = []byte("takenAt")
+	boltFormat   = []byte("format")
+	boltChecksum = []byte("checksum")
+)
+
+// boltStorage keeps the board in a BoltDB file: one bucket each of users,
+// tombstones, rating histories and score contributions, one of updates keyed
+// by sequence number, and an archive of replaced snapshots keyed by their
+// LastSeq. Appended updates
+// are buffered and committed in one transaction per Flush, since every Bolt
+// commit syncs the file.
+type boltStorage struct {
+	db   *bolt.DB
+	keep int
+
+	mu      sync.Mutex
+	pending []StoredUpdate
+}
+
+// OpenBoltStorage opens, creating if needed, a BoltDB file in dir
+func OpenBoltStorage(dir string, keep int) (*boltStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filepath.Join(dir, boltFile), 0o644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", boltFile, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range append([][]byte{boltMeta, boltUpdates, boltArchive}, boltSnapshotBuckets...) {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStorage{db: db, keep: max(keep, 1)}, nil
+}
+
+// seqKey encodes a sequence number so keys sort in sequence order
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+func (bs *boltStorage) Load() (*BoardSnapshot, []StoredUpdate, error) {
+	var snapshot *BoardSnapshot
+	var updates []StoredUpdate
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		var err error
+		if snapshot, err = readBoltSnapshot(tx); err != nil {
+			return err
+		}
+		updates, err = readBoltUpdates(tx, snapshot)
+		return err
+	})
+	return snapshot, updates, err
+}
+
+// readBoltSnapshot reads the latest snapshot, or nil if there is none
+func readBoltSnapshot(tx *bolt.Tx) (*BoardSnapshot, error) {
+	meta := tx.Bucket(boltMeta)
+	raw := meta.Get(boltLastSeq)
+	if raw == nil {
+		return nil, nil
+	}
+	snapshot := &BoardSnapshot{
+		LastSeq:    binary.BigEndian.Uint64(raw),
+		Checksum:   string(meta.Get(boltChecksum)),
+		Users:      make([]User, 0),
+		Tombstones: make([]StoredTombstone, 0),
+	}
+	if err := snapshot.TakenAt.UnmarshalBinary(meta.Get(boltTakenAt)); err != nil {
+		return nil, err
+	}
+	if raw := meta.Get(boltVersion); raw != nil {
+		snapshot.Version = binary.BigEndian.Uint64(raw)
+	}
+	if raw := meta.Get(boltFormat); raw != nil {
+		snapshot.Format = int(binary.BigEndian.Uint64(raw))
+	}
+	err := tx.Bucket(boltUsers).ForEach(func(_, v []byte) error {
+		var user User
+		if err := json.Unmarshal(v, &user); err != nil {
+			return err
+		}
+		snapshot.Users = append(snapshot.Users, user)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Bucket(boltTombstones).ForEach(func(_, v []byte) error {
+		var ts StoredTombstone
+		if err := json.Unmarshal(v, &ts); err != nil {
+			return err
+		}
+		snapshot.Tombstones = append(snapshot.Tombstones, ts)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Bucket(boltHistory).ForEach(func(k, v []byte) error {
+		var history StoredHistory
+		if err := json.Unmarshal(v, &history); err != nil {
+			return err
+		}
+		if snapshot.History == nil {
+			snapshot.History = make(map[string]StoredHistory)
+		}
+		snapshot.History[string(k)] = history
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Bucket(boltContributions).ForEach(func(_, v []byte) error {
+		var c StoredContribution
+		if err := json.Unmarshal(v, &c); err != nil {
+			return err
+		}
+		snapshot.Contributions = append(snapshot.Contributions, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := snapshot.verify(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", boltFile, err)
+	}
+	return snapshot, nil
+}
+
+// readBoltUpdates reads the updates after a snapshot, or all of them after nil
+func readBoltUpdates(tx *bolt.Tx, snapshot *BoardSnapshot) ([]StoredUpdate, error) {
+	var after uint64
+	if snapshot != nil {
+		after = snapshot.LastSeq
+	}
+	updates := make([]StoredUpdate, 0)
+	cursor := tx.Bucket(boltUpdates).Cursor()
+	for k, v := cursor.Seek(seqKey(after + 1)); k != nil; k, v = cursor.Next() {
+		var update StoredUpdate
+		if err := json.Unmarshal(v, &update); err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+func (bs *boltStorage) LoadAt(target RollbackTarget) (*BoardSnapshot, []StoredUpdate, error) {
+	if err := bs.Flush(); err != nil {
+		return nil, nil, err
+	}
+	var snapshot *BoardSnapshot
+	var updates []StoredUpdate
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		latest, err := readBoltSnapshot(tx)
+		if err != nil {
+			return err
+		}
+		archived := tx.Bucket(boltArchive).Cursor()
+		switch {
+		case latest != nil && target.coversSnapshot(latest):
+			snapshot = latest
+		default:
+			for k, v := archived.Last(); k != nil && snapshot == nil; k, v = archived.Prev() {
+				candidate := &BoardSnapshot{}
+				if err := json.Unmarshal(v, candidate); err != nil {
+					return err
+				}
+				if err := candidate.verify(); err != nil {
+					return fmt.Errorf("reading archived snapshot %d: %w", candidate.LastSeq, err)
+				}
+				if target.coversSnapshot(candidate) {
+					snapshot = candidate
+				}
+			}
+		}
+
+		if updates, err = readBoltUpdates(tx, snapshot); err != nil {
+			return err
+		}
+		if snapshot != nil {
+			return nil
+		}
+		// Without a snapshot the log must start at the very first update
+		first, _ := tx.Bucket(boltUpdates).Cursor().First()
+		if first == nil && latest == nil {
+			return nil
+		}
+		if first == nil || binary.BigEndian.Uint64(first) != 1 {
+			return errNotRetained
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot, updates, nil
+}
+
+func (bs *boltStorage) AppendUpdate(update StoredUpdate) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.pending = append(bs.pending, update)
+	return nil
+}
+
+// putPendingLocked writes the buffered updates in tx; bs.mu must be held
+func (bs *boltStorage) putPendingLocked(tx *bolt.Tx) error {
+	bucket := tx.Bucket(boltUpdates)
+	for _, update := range bs.pending {
+		raw, err := json.Marshal(update)
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(seqKey(update.Seq), raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bs *boltStorage) Flush() error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if len(bs.pending) == 0 {
+		return nil
+	}
+	if err := bs.db.Update(bs.putPendingLocked); err != nil {
+		return err
+	}
+	bs.pending = nil
+	return nil
+}
+
+// Save archives the snapshot it replaces, replaces the stored snapshot
+// buckets, drops archived snapshots past the kept count and drops the
+// updates no kept snapshot needs, all in one transaction
+func (bs *boltStorage) Save(snapshot *BoardSnapshot) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		if err := bs.putPendingLocked(tx); err != nil {
+			return err
+		}
+		archive := tx.Bucket(boltArchive)
+		if bs.keep > 1 {
+			previous, err := readBoltSnapshot(tx)
+			if err != nil {
+				return err
+			}
+			if previous != nil {
+				raw, err := json.Marshal(previous)
+				if err != nil {
+					return err
+				}
+				if err := archive.Put(seqKey(previous.LastSeq), raw); err != nil {
+					return err
+				}
+			}
+		}
+		// Deleting under a cursor skips keys, so collect them first
+		archived := make([][]byte, 0)
+		archiveCursor := archive.Cursor()
+		for k, _ := archiveCursor.First(); k != nil; k, _ = archiveCursor.Next() {
+			archived = append(archived, k)
+		}
+		extra := max(len(archived)-(bs.keep-1), 0)
+		oldest := snapshot.LastSeq
+		if extra < len(archived) {
+			oldest = binary.BigEndian.Uint64(archived[extra])
+		}
+		for _, k := range archived[:extra] {
+			if err := archive.Delete(k); err != nil {
+				return err
+			}
+		}
+		for _, name := range boltSnapshotBuckets {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		users, err := tx.CreateBucket(boltUsers)
+		if err != nil {
+			return err
+		}
+		for _, user := range snapshot.Users {
+			raw, err := json.Marshal(user)
+			if err != nil {
+				return err
+			}
+			if err := users.Put([]byte(user.Username), raw); err != nil {
+				return err
+			}
+		}
+		tombstones, err := tx.CreateBucket(boltTombstones)
+		if err != nil {
+			return err
+		}
+		for _, ts := range snapshot.Tombstones {
+			raw, err := json.Marshal(ts)
+			if err != nil {
+				return err
+			}
+			if err := tombstones.Put([]byte(ts.User.Username), raw); err != nil {
+				return err
+			}
+		}
+		history, err := tx.CreateBucket(boltHistory)
+		if err != nil {
+			return err
+		}
+		for username, saved := range snapshot.History {
+			raw, err := json.Marshal(saved)
+			if err != nil {
+				return err
+			}
+			if err := history.Put([]byte(username), raw); err != nil {
+				return err
+			}
+		}
+		// Keyed by position, so they load in the order they expire
+		contributions, err := tx.CreateBucket(boltContributions)
+		if err != nil {
+			return err
+		}
+		for i, c := range snapshot.Contributions {
+			raw, err := json.Marshal(c)
+			if err != nil {
+				return err
+			}
+			if err := contributions.Put(seqKey(uint64(i)), raw); err != nil {
+				return err
+			}
+		}
+
+		// Deleting under a cursor skips keys, so collect them first
+		updates := tx.Bucket(boltUpdates)
+		covered := make([][]byte, 0)
+		cursor := updates.Cursor()
+		for k, _ := cursor.First(); k != nil && binary.BigEndian.Uint64(k) <= oldest; k, _ = cursor.Next() {
+			covered = append(covered, k)
+		}
+		for _, k := range covered {
+			if err := updates.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		takenAt, err := snapshot.TakenAt.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		meta := tx.Bucket(boltMeta)
+		if err := meta.Put(boltTakenAt, takenAt); err != nil {
+			return err
+		}
+		if err := meta.Put(boltVersion, seqKey(snapshot.Version)); err != nil {
+			return err
+		}
+		if err := meta.Put(boltFormat, seqKey(uint64(snapshot.Format))); err != nil {
+			return err
+		}
+		if err := meta.Put(boltChecksum, []byte(snapshot.Checksum)); err != nil {
+			return err
+		}
+		return meta.Put(boltLastSeq, seqKey(snapshot.LastSeq))
+	})
+	if err != nil {
+		return err
+	}
+	bs.pending = nil
+	return nil
+}
+
+func (bs *boltStorage) Close() error {
+	if err := bs.Flush(); err != nil {
+		return err
+	}
+	return bs.db.Close()
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// openStoredBoard loads a board from the storage in dir
+func openStoredBoard(t *testing.T, config BoardConfig, engine StorageEngine, dir string, keep int) (*LeaderboardManager, Storage) {
+	t.Helper()
+	storage, err := OpenStorage(engine, dir, keep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	board := NewLeaderboardManager(config)
+	if err := board.AttachStorage(storage, string(engine)); err != nil {
+		t.Fatal(err)
+	}
+	return board, storage
+}
+
+// attachTestStorage gives the test server's board storage in a temporary
+// directory, closed when the test ends, and returns the directory
+func attachTestStorage(t *testing.T, engine StorageEngine, keep int) string {
+	t.Helper()
+	dir := t.TempDir()
+	storage, err := OpenStorage(engine, dir, keep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Closing twice is harmless; tests that restart close it themselves
+	t.Cleanup(func() { storage.Close() })
+	if err := leaderboard.AttachStorage(storage, string(engine)); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRestartKeepsBoard(t *testing.T) {
+	config := DefaultBoardConfig()
+	config.ScoreMode = ScoreModeCumulative
+	config.ScoreWindow = time.Hour
+
+	for _, engine := range []StorageEngine{StorageFile, StorageBolt} {
+		t.Run(string(engine), func(t *testing.T) {
+			dir := t.TempDir()
+			board, storage := openStoredBoard(t, config, engine, dir, 1)
+			for username, rating := range map[string]int{"ann": 1200, "ben": 1000, "cat": 1100} {
+				if err := board.AddUser(username, rating); err != nil {
+					t.Fatal(err)
+				}
+			}
+			board.UpdateRating("ann", 1300)
+			board.UpdateRating("ann", 1400)
+			board.SubmitScore("ben", 50)
+			if err := board.Snapshot(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Everything from here on is only in the update log
+			board.UpdateRating("ann", 1500)
+			board.SubmitScore("ben", 30)
+			if expired := board.ExpireScores(time.Now().Add(config.ScoreWindow + time.Second)); expired != 2 {
+				t.Fatalf("expired %d contributions, want 2", expired)
+			}
+			board.SubmitScore("ben", 20)
+			if _, err := board.DeleteUser("cat"); err != nil {
+				t.Fatal(err)
+			}
+			history, _ := board.RatingHistory("ann")
+			version := board.Version()
+			if err := storage.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			restarted, storage := openStoredBoard(t, config, engine, dir, 1)
+			defer storage.Close()
+
+			for username, want := range map[string]int{"ann": 1500, "ben": 1020} {
+				if info, ok := restarted.GetRank(username, features.For("")); !ok || info.Rating != want {
+					t.Errorf("%s came back as %+v, want rating %d", username, info, want)
+				}
+			}
+			if deleted := restarted.DeletedUsers(); len(deleted) != 1 || deleted[0].Username != "cat" {
+				t.Errorf("deleted users after restart are %+v, want cat", deleted)
+			}
+			if restarted.Version() <= version {
+				t.Errorf("board version went from %d to %d across the restart", version, restarted.Version())
+			}
+
+			restored, _ := restarted.RatingHistory("ann")
+			if len(restored) != len(history) {
+				t.Fatalf("ann's history has %d entries after restart, want %d", len(restored), len(history))
+			}
+			for i := range history {
+				if restored[i].Rating != history[i].Rating || restored[i].Version != history[i].Version || !restored[i].At.Equal(history[i].At) {
+					t.Errorf("history entry %d is %+v after restart, want %+v", i, restored[i], history[i])
+				}
+			}
+
+			// Only the last score is still in the window, and the expired
+			// ones must not be taken off again
+			if expired := restarted.ExpireScores(time.Now().Add(config.ScoreWindow + time.Second)); expired != 1 {
+				t.Errorf("expired %d contributions after restart, want 1", expired)
+			}
+			if info, _ := restarted.GetRank("ben", features.For("")); info.Rating != 1000 {
+				t.Errorf("ben's rating is %d once every score expired, want 1000", info.Rating)
+			}
+		})
+	}
+}
+
+func TestCompactStorage(t *testing.T) {
+	ts := newTestServer(t, DefaultBoardConfig())
+	compact := request{method: http.MethodPost, path: "/api/admin/storage/compact", admin: true}
+	ts.expect(compact, http.StatusConflict)
+
+	for _, engine := range []StorageEngine{StorageFile, StorageBolt} {
+		t.Run(string(engine), func(t *testing.T) {
+			ts := newTestServer(t, DefaultBoardConfig()).in(t)
+			attachTestStorage(t, engine, 1)
+			ts.createUsers(map[string]int{"ann": 1200, "ben": 1000, "cat": 1100})
+			logged := leaderboard.storageSeq
+
+			body := ts.expect(compact, http.StatusOK)
+			if folded := number(t, body, "folded"); folded != int(logged) {
+				t.Errorf("compaction folded %v updates, want %d", folded, logged)
+			}
+			snapshot, updates, err := leaderboard.storage.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(updates) != 0 || snapshot == nil || len(snapshot.Users) != 3 {
+				t.Errorf("after compacting, storage holds %d updates and snapshot %+v", len(updates), snapshot)
+			}
+			if body := ts.expect(compact, http.StatusOK); number(t, body, "folded") != 0 {
+				t.Errorf("compacting again folded %v updates, want 0", body["folded"])
+			}
+		})
+	}
+}
+
+func TestCompactAfter(t *testing.T) {
+	newTestServer(t, DefaultBoardConfig())
+	attachTestStorage(t, StorageFile, 1)
+	leaderboard.compactAfter = 3
+	leaderboard.compactSoon = make(chan struct{}, 1)
+
+	for i, username := range []string{"ann", "ben", "cat"} {
+		select {
+		case <-leaderboard.compactSoon:
+			t.Fatalf("compaction requested after %d updates, want 3", i)
+		default:
+		}
+		if err := leaderboard.AddUser(username, 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-leaderboard.compactSoon:
+	default:
+		t.Fatal("no compaction requested after 3 updates")
+	}
+
+	if _, err := leaderboard.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	leaderboard.mu.RLock()
+	defer leaderboard.mu.RUnlock()
+	if leaderboard.compactDueLocked() {
+		t.Error("compaction still due right after compacting")
+	}
+}
+
+// tamperStoredUser rewrites ann's rating in the latest snapshot on disk,
+// leaving its checksum as it was
+func tamperStoredUser(t *testing.T, engine StorageEngine, dir string) {
+	t.Helper()
+	tamper := func(raw []byte) []byte {
+		tampered := bytes.Replace(raw, []byte(`"username":"ann","rating":1200`), []byte(`"username":"ann","rating":1300`), 1)
+		if bytes.Equal(tampered, raw) {
+			t.Fatalf("ann's rating not found in %s", raw)
+		}
+		return tampered
+	}
+	if engine == StorageFile {
+		path := filepath.Join(dir, snapshotFile)
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, tamper(raw), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	db, err := bolt.Open(filepath.Join(dir, boltFile), 0o644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		users := tx.Bucket(boltUsers)
+		return users.Put([]byte("ann"), tamper(users.Get([]byte("ann"))))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCorruptSnapshotRefused(t *testing.T) {
+	for _, engine := range []StorageEngine{StorageFile, StorageBolt} {
+		t.Run(string(engine), func(t *testing.T) {
+			dir := t.TempDir()
+			board, storage := openStoredBoard(t, DefaultBoardConfig(), engine, dir, 1)
+			if err := board.AddUser("ann", 1200); err != nil {
+				t.Fatal(err)
+			}
+			if err := board.Snapshot(); err != nil {
+				t.Fatal(err)
+			}
+			if err := storage.Close(); err != nil {
+				t.Fatal(err)
+			}
+			tamperStoredUser(t, engine, dir)
+
+			storage, err := OpenStorage(engine, dir, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer storage.Close()
+			err = NewLeaderboardManager(DefaultBoardConfig()).AttachStorage(storage, string(engine))
+			if !errors.Is(err, errBadSnapshot) || !strings.Contains(err.Error(), "corrupt") {
+				t.Fatalf("loading a tampered snapshot gave %v, want it refused as corrupt", err)
+			}
+		})
+	}
+}
+
+func TestSnapshotFormats(t *testing.T) {
+	for _, c := range []struct {
+		format int
+		loads  bool
+	}{
+		// Written before snapshots carried a format or checksum
+		{format: 0, loads: true},
+		{format: snapshotFormat + 1, loads: false},
+	} {
+		dir := t.TempDir()
+		raw, err := json.Marshal(&BoardSnapshot{Format: c.format, LastSeq: 1, TakenAt: time.Now(), Users: []User{{Username: "ann", Rating: 1200}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, snapshotFile), raw, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		storage, err := OpenStorage(StorageFile, dir, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = NewLeaderboardManager(DefaultBoardConfig()).AttachStorage(storage, "file")
+		storage.Close()
+		if loaded := err == nil; loaded != c.loads {
+			t.Errorf("format %d: loading gave %v, want loaded %v", c.format, err, c.loads)
+		}
+	}
+}
+
+func TestVerifyStorage(t *testing.T) {
+	ts := newTestServer(t, DefaultBoardConfig())
+	verify := request{method: http.MethodGet, path: "/api/admin/storage/verify", admin: true}
+	ts.expect(verify, http.StatusConflict)
+
+	for _, engine := range []StorageEngine{StorageFile, StorageBolt} {
+		t.Run(string(engine), func(t *testing.T) {
+			ts := newTestServer(t, DefaultBoardConfig()).in(t)
+			dir := attachTestStorage(t, engine, 1)
+			ts.createUsers(map[string]int{"ann": 1200, "ben": 1000, "cat": 1100})
+			if err := leaderboard.Snapshot(); err != nil {
+				t.Fatal(err)
+			}
+			leaderboard.UpdateRating("ben", 1250)
+			if _, err := leaderboard.DeleteUser("cat"); err != nil {
+				t.Fatal(err)
+			}
+
+			body := ts.expect(verify, http.StatusOK)
+			if body["ok"] != true || number(t, body, "users") != 2 || number(t, body, "replayed") == 0 {
+				t.Fatalf("verifying an intact board gave %v", body)
+			}
+
+			// A change that never reached storage shows up as a mismatch
+			leaderboard.users["ben"].Wins = 5
+			body = ts.expect(verify, http.StatusOK)
+			if sample := body["sample"].([]any); body["ok"] != false || len(sample) != 1 ||
+				sample[0].(map[string]any)["username"] != "ben" || sample[0].(map[string]any)["problem"] != MismatchChanged {
+				t.Fatalf("verifying after an unstored change gave %v", body)
+			}
+			leaderboard.users["ben"].Wins = 0
+
+			if engine == StorageFile {
+				tamperStoredUser(t, engine, dir)
+				body = ts.expect(verify, http.StatusOK)
+				if body["ok"] != false || !strings.Contains(body["error"].(string), "corrupt") {
+					t.Fatalf("verifying a tampered snapshot gave %v", body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errVerifyNeedsStorage is returned by VerifyStorage on an in-memory board
+var errVerifyNeedsStorage = errors.New("verifying compares the stored snapshot and update log with the board, so it needs --data-dir")
+
+// What a storage check found wrong with one user
+const (
+	MismatchChanged = "changed"
+	MismatchMissing = "missing"
+	MismatchExtra   = "extra"
+)
+
+// StorageMismatch is a user the stored board disagrees with the live one on
+type StorageMismatch struct {
+	Username string `json:"username"`
+	// Problem is "changed" for a user stored with a different standing,
+	// "missing" for one on the live board but not on disk, and "extra" for
+	// one on disk but not on the live board
+	Problem string `json:"problem"`
+	// Deleted is set when the mismatch is in the deleted users
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// StorageVerification reports how the board on disk compares with memory
+type StorageVerification struct {
+	OK bool `json:"ok"`
+	// Error is why the stored snapshot was refused, when it was
+	Error string `json:"error,omitempty"`
+	// SnapshotAt is when the latest snapshot was taken; null means the
+	// board is stored as the update log alone
+	SnapshotAt *time.Time `json:"snapshotAt"`
+	Format     int        `json:"format"`
+	// Replayed is how many logged updates were applied on top of it
+	Replayed   int               `json:"replayed"`
+	Users      int               `json:"users"`
+	Mismatched int               `json:"mismatched"`
+	Sample     []StorageMismatch `json:"sample"`
+}
+
+// VerifyStorage reads the latest snapshot back from disk, checking its
+// format and checksum, replays the update log onto it and compares the
+// result with the live board. Writes wait while it runs, so both sides
+// hold the same updates.
+func (lm *LeaderboardManager) VerifyStorage() (StorageVerification, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if lm.storage == nil {
+		return StorageVerification{}, errVerifyNeedsStorage
+	}
+	// Coalesced ratings are already in the log, so the board must hold them too
+	lm.flushPendingLocked()
+	if err := lm.storage.Flush(); err != nil {
+		return StorageVerification{}, err
+	}
+
+	report := StorageVerification{Users: len(lm.users), Sample: make([]StorageMismatch, 0)}
+	snapshot, updates, err := lm.storage.Load()
+	if errors.Is(err, errBadSnapshot) {
+		report.Error = err.Error()
+		return report, nil
+	}
+	if err != nil {
+		return StorageVerification{}, err
+	}
+	if snapshot != nil {
+		report.SnapshotAt, report.Format = &snapshot.TakenAt, snapshot.Format
+	}
+	report.Replayed = len(updates)
+
+	stored := NewLeaderboardManager(lm.config)
+	// Rebuilding the stored board must not reach peer regions
+	stored.replicating = true
+	stored.loadStoredLocked(snapshot, updates)
+
+	note := func(username, problem string, deleted bool) {
+		report.Mismatched++
+		if len(report.Sample) < maxRestoreSample {
+			report.Sample = append(report.Sample, StorageMismatch{Username: username, Problem: problem, Deleted: deleted})
+		}
+	}
+	for username, user := range lm.users {
+		saved, exists := stored.users[username]
+		switch {
+		case !exists:
+			note(username, MismatchMissing, false)
+		case !sameStanding(user.Rating, user, saved):
+			note(username, MismatchChanged, false)
+		}
+	}
+	for username := range stored.users {
+		if _, exists := lm.users[username]; !exists {
+			note(username, MismatchExtra, false)
+		}
+	}
+	for username := range lm.tombstones {
+		if _, exists := stored.tombstones[username]; !exists {
+			note(username, MismatchMissing, true)
+		}
+	}
+	for username := range stored.tombstones {
+		if _, exists := lm.tombstones[username]; !exists {
+			note(username, MismatchExtra, true)
+		}
+	}
+	sort.Slice(report.Sample, func(i, j int) bool { return report.Sample[i].Username < report.Sample[j].Username })
+	report.OK = report.Mismatched == 0
+	return report, nil
+}
+
+// Handler: Check the stored board against the live one
+func verifyStorage(c *gin.Context) {
+	report, err := leaderboard.VerifyStorage()
+	switch {
+	case err == errVerifyNeedsStorage:
+		respond(c, 409, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		respond(c, 500, gin.H{"error": err.Error()})
+		return
+	}
+	respond(c, 200, report)
+}
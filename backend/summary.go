@@ -0,0 +1,142 @@
+package main
+
+import (
+	"math"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ratingMoments keeps running power sums of all ratings so the mean,
+// standard deviation and skew can be read at any time without a scan, plus
+// a coarse histogram for estimating deep ranks and ranking by band
+type ratingMoments struct {
+	count     float64
+	sum       float64
+	sumSq     float64
+	sumCube   float64
+	histogram ratingHistogram
+}
+
+func (m *ratingMoments) add(rating int) {
+	x := float64(rating)
+	m.count++
+	m.sum += x
+	m.sumSq += x * x
+	m.sumCube += x * x * x
+	m.histogram.add(rating)
+}
+
+func (m *ratingMoments) remove(rating int) {
+	x := float64(rating)
+	m.count--
+	m.sum -= x
+	m.sumSq -= x * x
+	m.sumCube -= x * x * x
+	m.histogram.remove(rating)
+}
+
+// RatingSummary describes the current rating distribution
+type RatingSummary struct {
+	Count    int     `json:"count"`
+	Mean     float64 `json:"mean"`
+	StdDev   float64 `json:"stdDev"`
+	Skewness float64 `json:"skewness"`
+}
+
+// summary derives population mean, standard deviation and skewness from the power sums
+func (m *ratingMoments) summary() RatingSummary {
+	if m.count == 0 {
+		return RatingSummary{}
+	}
+
+	mean := m.sum / m.count
+	variance := math.Max(m.sumSq/m.count-mean*mean, 0)
+	stdDev := math.Sqrt(variance)
+
+	skewness := 0.0
+	if stdDev > 0 {
+		thirdMoment := m.sumCube/m.count - 3*mean*variance - mean*mean*mean
+		skewness = thirdMoment / (variance * stdDev)
+	}
+
+	return RatingSummary{
+		Count:    int(m.count),
+		Mean:     roundTo(mean, 2),
+		StdDev:   roundTo(stdDev, 2),
+		Skewness: roundTo(skewness, 4),
+	}
+}
+
+// zScore returns how many standard deviations a rating lies from the mean
+func (m *ratingMoments) zScore(rating int) float64 {
+	s := m.summary()
+	if s.StdDev == 0 {
+		return 0
+	}
+	return roundTo((float64(rating)-m.sum/m.count)/s.StdDev, 4)
+}
+
+// rankIn adds a ranked user to the running aggregates: the rating moments,
+// the country rollup and the rank tree. rankOut takes them back out.
+// Unranked users aren't part of any.
+func (lm *LeaderboardManager) rankIn(user *User) {
+	lm.touchLive(user)
+	lm.moments.add(user.Rating)
+	lm.countries.add(user)
+	lm.rankTree.insert(user)
+}
+
+func (lm *LeaderboardManager) rankOut(user *User) {
+	lm.touchLive(user)
+	lm.moments.remove(user.Rating)
+	lm.countries.remove(user)
+	lm.rankTree.remove(user)
+}
+
+// setRating changes a user's rating and keeps the running aggregates in step
+func (lm *LeaderboardManager) setRating(user *User, rating int) {
+	if user.Unranked != "" {
+		user.Rating = rating
+		return
+	}
+	lm.rankOut(user)
+	user.Rating = rating
+	lm.rankIn(user)
+}
+
+// RatingSummary returns the mean, standard deviation and skew of all ratings
+func (lm *LeaderboardManager) RatingSummary() RatingSummary {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	return lm.moments.summary()
+}
+
+// UserProfile is a user plus where their rating sits in the distribution
+type UserProfile struct {
+	User
+	ZScore float64 `json:"zScore"`
+}
+
+// GetProfile returns a user's profile with an up-to-date rank and z-score
+func (lm *LeaderboardManager) GetProfile(username string, paths FeaturePaths) (UserProfile, bool) {
+	if !lm.MightExist(username) {
+		return UserProfile{}, false
+	}
+
+	lm.rLockPlacing(paths)
+	defer lm.mu.RUnlock()
+
+	user, exists := lm.users[username]
+	if !exists {
+		return UserProfile{}, false
+	}
+	return UserProfile{
+		User:   lm.placedUser(user, paths),
+		ZScore: lm.moments.zScore(user.Rating),
+	}, true
+}
+
+// Handler: Get rating distribution summary
+func getStatsSummary(c *gin.Context) {
+	respond(c, 200, leaderboard.RatingSummary())
+}
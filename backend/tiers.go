@@ -0,0 +1,66 @@
+package main
+
+import "fmt"
+
+// histogramWidth is the bucket width of the board's running rating
+// histogram: the rank band on banded boards, otherwise the estimate width
+func (cfg BoardConfig) histogramWidth() int {
+	if cfg.RankBand > 0 {
+		return cfg.RankBand
+	}
+	return approxBucketWidth
+}
+
+// validateRankBand checks that banded ranking can apply to the board's ordering
+func (cfg BoardConfig) validateRankBand() error {
+	if cfg.RankBand < 0 {
+		return fmt.Errorf("rank band must not be negative")
+	}
+	if cfg.RankBand > 0 && cfg.SortKeys[0].Field != RatingField {
+		return fmt.Errorf("rank bands need rating as the first sort key")
+	}
+	return nil
+}
+
+// bandRank counts the users in better bands; everyone in a band shares its rank
+func (h ratingHistogram) bandRank(rating int, lowerIsBetter bool) int {
+	own := h.bucket(rating)
+	ahead := 0
+	for bucket, count := range h.counts {
+		if bucket != own && (bucket > own) != lowerIsBetter {
+			ahead += count
+		}
+	}
+	return ahead + 1
+}
+
+// band describes the band a rating falls in and how many users share it
+func (h ratingHistogram) band(rating int) *Bucket {
+	bucket := h.bucket(rating)
+	return &Bucket{Min: bucket * h.width, Max: (bucket + 1) * h.width, Count: h.counts[bucket]}
+}
+
+// rankBoundary reports whether b starts a new rank after a in board order.
+// On banded boards ranks only change between bands.
+func (lm *LeaderboardManager) rankBoundary(a, b *User) bool {
+	if lm.config.RankBand > 0 {
+		return lm.moments.histogram.bucket(a.Rating) != lm.moments.histogram.bucket(b.Rating)
+	}
+	return lm.config.compareUsers(a, b) != 0
+}
+
+// bandRankInfo reads a user's rank straight from the band counters, so rank
+// lookups on banded boards never wait for a re-rank; lm.mu must be held
+func (lm *LeaderboardManager) bandRankInfo(user *User) RankInfo {
+	info := RankInfo{
+		Username:   user.Username,
+		Rating:     user.Rating,
+		TotalUsers: int(lm.moments.count),
+		Unranked:   user.Unranked,
+	}
+	if user.Unranked == "" {
+		info.Rank = lm.moments.histogram.bandRank(user.Rating, lm.config.LowerIsBetter)
+		info.Band = lm.moments.histogram.band(user.Rating)
+	}
+	return info
+}
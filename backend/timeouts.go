@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteTimeouts bounds how long a request may run. Routes without an override
+// use Default; a zero duration disables the timeout.
+type RouteTimeouts struct {
+	Default time.Duration
+	Routes  map[string]time.Duration
+}
+
+// Validate checks that no timeout is negative
+func (rt RouteTimeouts) Validate() error {
+	if rt.Default < 0 {
+		return fmt.Errorf("request timeout must not be negative")
+	}
+	for route, d := range rt.Routes {
+		if d < 0 {
+			return fmt.Errorf("timeout for %s must not be negative", route)
+		}
+	}
+	return nil
+}
+
+// For returns the timeout for a registered route path
+func (rt RouteTimeouts) For(route string) time.Duration {
+	if d, ok := rt.Routes[route]; ok {
+		return d
+	}
+	return rt.Default
+}
+
+var routeTimeouts = RouteTimeouts{
+	Default: 2 * time.Second,
+	Routes: map[string]time.Duration{
+		"/api/admin/export": 30 * time.Second,
+		// Live connections stay open for as long as the client wants
+		"/ws/leaderboard": 0,
+	},
+}
+
+// requestTimeouts gives each request a context that is cancelled when its
+// route's timeout passes. Long-running handlers watch the context and stop
+// early; if a handler gave up without writing anything, the client gets a 503.
+func requestTimeouts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := routeTimeouts.For(c.FullPath())
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		if ctx.Err() == context.DeadlineExceeded && !c.Writer.Written() {
+			respond(c, 503, gin.H{"error": fmt.Sprintf("request timed out after %s", timeout)})
+		}
+	}
+}
+
+// expired reports whether the request's context has been cancelled
+func expired(c *gin.Context) bool {
+	return c.Request.Context().Err() != nil
+}
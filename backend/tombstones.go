@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tombstoneGrace is how long a deleted user can be restored before being purged
+var tombstoneGrace = 30 * 24 * time.Hour
+
+var errNameReserved = errors.New("username belongs to a recently deleted user")
+
+// tombstone keeps a deleted user off the board but recoverable, and holds
+// their name so nobody else can take it during the grace period
+type tombstone struct {
+	user      *User
+	deletedAt time.Time
+}
+
+// DeletedUser describes a tombstoned user
+type DeletedUser struct {
+	Username  string    `json:"username"`
+	Rating    int       `json:"rating"`
+	DeletedAt time.Time `json:"deletedAt"`
+	PurgeAt   time.Time `json:"purgeAt"`
+}
+
+// DeleteUser tombstones a user: they leave the rankings and search at once,
+// while their record and rating history are kept until the grace period ends
+func (lm *LeaderboardManager) DeleteUser(username string) (DeletedUser, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if freeze.active() {
+		return DeletedUser{}, errBoardFrozen
+	}
+	user, exists := lm.users[username]
+	if !exists {
+		return DeletedUser{}, errUserNotFound
+	}
+	ts := lm.tombstoneLocked(user, time.Now())
+	lm.markChanged()
+	return ts.describe(), nil
+}
+
+// tombstoneLocked takes a user off the board into a tombstone; lm.mu must be
+// held and the caller marks the change
+func (lm *LeaderboardManager) tombstoneLocked(user *User, at time.Time) *tombstone {
+	lm.unlinkUser(user)
+	ts := &tombstone{user: user, deletedAt: at}
+	lm.tombstones[user.Username] = ts
+	lm.persist(OpDelete, user, 0, at)
+	lm.replicateLocked(ReplicatedDelete, user.Username, 0, at)
+	return ts
+}
+
+func (ts *tombstone) describe() DeletedUser {
+	return DeletedUser{
+		Username:  ts.user.Username,
+		Rating:    ts.user.Rating,
+		DeletedAt: ts.deletedAt,
+		PurgeAt:   ts.deletedAt.Add(tombstoneGrace),
+	}
+}
+
+// RestoreUser brings a tombstoned user back onto the board as they were
+func (lm *LeaderboardManager) RestoreUser(username string) (User, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if freeze.active() {
+		return User{}, errBoardFrozen
+	}
+	user := lm.restoreTombstoneLocked(username)
+	if user == nil {
+		return User{}, errUserNotFound
+	}
+	lm.markChanged()
+	lm.recalculateRanks()
+	return user.snapshot(), nil
+}
+
+// restoreTombstoneLocked puts a tombstoned user back, returning nil if there
+// is no such tombstone; lm.mu must be held and the caller marks the change
+func (lm *LeaderboardManager) restoreTombstoneLocked(username string) *User {
+	ts, deleted := lm.tombstones[username]
+	if !deleted {
+		return nil
+	}
+	delete(lm.tombstones, username)
+
+	user := ts.user
+	lm.users[username] = user
+	lm.usernameLower[strings.ToLower(username)] = username
+	lm.appendSorted(user)
+	lm.searchIndex.add(user)
+	lm.moveRegion(user, "", user.regionPath())
+	if user.Unranked == "" {
+		lm.rankIn(user)
+	}
+	// The filter may have been rebuilt without the name while it was deleted
+	if !lm.knownNames.Load().add(username) {
+		lm.rebuildNameFilter()
+	}
+	now := time.Now()
+	lm.persist(OpRestore, user, 0, now)
+	lm.replicateLocked(ReplicatedRestore, username, user.Rating, now)
+	return user
+}
+
+// DeletedUsers lists tombstoned users, most recently deleted first
+func (lm *LeaderboardManager) DeletedUsers() []DeletedUser {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	deleted := make([]DeletedUser, 0, len(lm.tombstones))
+	for _, ts := range lm.tombstones {
+		deleted = append(deleted, ts.describe())
+	}
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].DeletedAt.After(deleted[j].DeletedAt) })
+	return deleted
+}
+
+// PurgeTombstones permanently removes users deleted before the cutoff,
+// along with their rating history, and frees their names
+func (lm *LeaderboardManager) PurgeTombstones(cutoff time.Time) int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	purged := 0
+	for username, ts := range lm.tombstones {
+		if ts.deletedAt.Before(cutoff) {
+			delete(lm.tombstones, username)
+			delete(lm.ratingHistory, username)
+			purged++
+		}
+	}
+	return purged
+}
+
+// PurgeDeletedUsers hard-deletes expired tombstones on a schedule
+func (lm *LeaderboardManager) PurgeDeletedUsers() {
+	job := backgroundJobs.register("tombstone purge", retentionPurgeInterval)
+	ticker := time.NewTicker(retentionPurgeInterval)
+	go func() {
+		for now := range ticker.C {
+			if purged := lm.PurgeTombstones(now.Add(-tombstoneGrace)); purged > 0 {
+				log.Printf("🪦 Purged %d deleted users past their grace period", purged)
+			}
+			job.ran(now)
+		}
+	}()
+}
+
+// Handler: Soft-delete a user
+func deleteUser(c *gin.Context) {
+	deleted, err := leaderboard.DeleteUser(c.Param("username"))
+	if respondUserWriteError(c, err) {
+		return
+	}
+	auditLog.Record(c, "user.delete", deleted.Username, gin.H{"rating": deleted.Rating, "purgeAt": deleted.PurgeAt})
+	respond(c, 200, deleted)
+}
+
+// Handler: Restore a soft-deleted user
+func restoreUser(c *gin.Context) {
+	user, err := leaderboard.RestoreUser(c.Param("username"))
+	if err == errUserNotFound {
+		respond(c, 404, gin.H{"error": "no deleted user with that name"})
+		return
+	}
+	if respondUserWriteError(c, err) {
+		return
+	}
+	auditLog.Record(c, "user.restore", user.Username, gin.H{"rating": user.Rating})
+	respond(c, 200, user)
+}
+
+// Handler: List soft-deleted users awaiting purge
+func getDeletedUsers(c *gin.Context) {
+	deleted := leaderboard.DeletedUsers()
+	respond(c, 200, gin.H{"users": deleted, "count": len(deleted)})
+}
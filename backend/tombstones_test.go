@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRestoreAfterNameFilterRebuild(t *testing.T) {
+	ts := newTestServer(t, DefaultBoardConfig())
+	ts.createUsers(map[string]int{"ann": 1200})
+	ts.expect(request{method: http.MethodDelete, path: "/api/admin/users/ann", admin: true}, http.StatusOK)
+
+	// Outgrow the name filter so it is rebuilt while ann is deleted
+	filter := leaderboard.knownNames.Load()
+	for i := 0; leaderboard.knownNames.Load() == filter; i++ {
+		if err := leaderboard.AddUser(fmt.Sprintf("filler_%d", i), 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if leaderboard.MightExist("ann") {
+		t.Skip("ann is a false positive in the rebuilt filter")
+	}
+
+	ts.run([]step{
+		{
+			name:    "restore",
+			request: request{method: http.MethodPost, path: "/api/admin/users/ann/restore", admin: true},
+			status:  http.StatusOK,
+		},
+		{
+			name:    "rank",
+			request: request{method: http.MethodGet, path: "/api/rank?username=ann"},
+			status:  http.StatusOK,
+		},
+		{
+			name:    "profile",
+			request: request{method: http.MethodGet, path: "/api/users/ann"},
+			status:  http.StatusOK,
+		},
+	})
+}
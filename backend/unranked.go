@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UnrankedReason says why a user is kept out of the ranking. Unranked users
+// stay on the board and in search, but get no rank or percentile and don't
+// count towards anyone else's rank or the rating statistics.
+type UnrankedReason string
+
+const (
+	// UnrankedProvisional marks a user who hasn't played enough to be ranked yet
+	UnrankedProvisional UnrankedReason = "provisional"
+	// UnrankedDecayed marks a user whose rating lapsed through inactivity
+	UnrankedDecayed UnrankedReason = "decayed"
+	// UnrankedBanned marks a user removed from the ranking by an admin
+	UnrankedBanned UnrankedReason = "banned"
+)
+
+// ParseUnrankedReason validates an unranked reason
+func ParseUnrankedReason(s string) (UnrankedReason, error) {
+	switch UnrankedReason(s) {
+	case UnrankedProvisional, UnrankedDecayed, UnrankedBanned:
+		return UnrankedReason(s), nil
+	}
+	return "", fmt.Errorf("unknown unranked reason %q (expected %q, %q or %q)", s, UnrankedProvisional, UnrankedDecayed, UnrankedBanned)
+}
+
+// UnrankedFilter selects which users a read returns
+type UnrankedFilter string
+
+const (
+	// UnrankedExclude returns ranked users only; the default
+	UnrankedExclude UnrankedFilter = "exclude"
+	// UnrankedInclude returns ranked users followed by unranked ones
+	UnrankedInclude UnrankedFilter = "include"
+	// UnrankedOnly returns unranked users only
+	UnrankedOnly UnrankedFilter = "only"
+)
+
+// ParseUnrankedFilter validates an unranked filter; empty means exclude
+func ParseUnrankedFilter(s string) (UnrankedFilter, error) {
+	switch UnrankedFilter(s) {
+	case "":
+		return UnrankedExclude, nil
+	case UnrankedExclude, UnrankedInclude, UnrankedOnly:
+		return UnrankedFilter(s), nil
+	}
+	return "", fmt.Errorf("unknown unranked filter %q (expected %q, %q or %q)", s, UnrankedExclude, UnrankedInclude, UnrankedOnly)
+}
+
+// unrankedFilterParam reads the unranked query parameter, responding with a
+// 400 and returning false when it is invalid
+func unrankedFilterParam(c *gin.Context) (UnrankedFilter, bool) {
+	filter, err := ParseUnrankedFilter(c.Query("unranked"))
+	if err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return filter, true
+}
+
+// ranked returns the ranked users in board order. Re-ranking keeps them
+// ahead of every unranked user in sortedUsers; lm.mu must be held.
+func (lm *LeaderboardManager) ranked() []*User {
+	return lm.sortedUsers[:lm.rankedCount]
+}
+
+// view returns the part of the board a filter selects; lm.mu must be held
+func (lm *LeaderboardManager) view(filter UnrankedFilter) []*User {
+	switch filter {
+	case UnrankedInclude:
+		return lm.sortedUsers
+	case UnrankedOnly:
+		return lm.sortedUsers[lm.rankedCount:]
+	}
+	return lm.ranked()
+}
+
+// CountUsers returns how many users a filter selects
+func (lm *LeaderboardManager) CountUsers(filter UnrankedFilter) int {
+	lm.rLockRanked()
+	defer lm.mu.RUnlock()
+	return len(lm.view(filter))
+}
+
+// SetUnranked takes a user out of the ranking for the given reason, or
+// ranks them again when reason is empty
+func (lm *LeaderboardManager) SetUnranked(username string, reason UnrankedReason) (User, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if freeze.active() {
+		return User{}, errBoardFrozen
+	}
+	user, exists := lm.users[username]
+	if !exists {
+		return User{}, errUserNotFound
+	}
+	lm.flushPendingLocked()
+	if lm.setUnrankedLocked(user, reason) {
+		lm.markChanged()
+		lm.recalculateRanks()
+	}
+	return user.snapshot(), nil
+}
+
+// setUnrankedLocked moves a user in or out of the ranking and reports whether
+// anything changed; lm.mu must be held and the caller marks the change
+func (lm *LeaderboardManager) setUnrankedLocked(user *User, reason UnrankedReason) bool {
+	if user.Unranked == reason {
+		return false
+	}
+	switch {
+	case user.Unranked == "":
+		lm.rankOut(user)
+	case reason == "":
+		lm.rankIn(user)
+	}
+	user.Unranked = reason
+	lm.persist(OpUnranked, user, 0, time.Now())
+	return true
+}
+
+// sortableRank orders unranked users (rank 0) after every ranked one
+func sortableRank(rank int) int {
+	if rank == 0 {
+		return math.MaxInt32
+	}
+	return rank
+}
+
+// standing renders a rank for chat replies, e.g. "#3 of 1000"
+func (info RankInfo) standing() string {
+	if info.Unranked != "" {
+		return fmt.Sprintf("unranked (%s)", info.Unranked)
+	}
+	return fmt.Sprintf("#%d of %d", info.Rank, info.TotalUsers)
+}
+
+// Handler: Take a user out of the ranking
+func unrankUser(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, 400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	reason, err := ParseUnrankedReason(req.Reason)
+	if err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	dryRun, ok := isDryRun(c)
+	if !ok {
+		return
+	}
+	if dryRun {
+		respondUnrankedPreview(c, reason)
+		return
+	}
+	user, err := leaderboard.SetUnranked(c.Param("username"), reason)
+	if respondUserWriteError(c, err) {
+		return
+	}
+	auditLog.Record(c, "user.unrank", user.Username, gin.H{"reason": reason})
+	respond(c, 200, user)
+}
+
+// Handler: Put an unranked user back in the ranking
+func rerankUser(c *gin.Context) {
+	dryRun, ok := isDryRun(c)
+	if !ok {
+		return
+	}
+	if dryRun {
+		respondUnrankedPreview(c, "")
+		return
+	}
+	user, err := leaderboard.SetUnranked(c.Param("username"), "")
+	if respondUserWriteError(c, err) {
+		return
+	}
+	auditLog.Record(c, "user.rank", user.Username, nil)
+	respond(c, 200, user)
+}
+
+// respondUnrankedPreview reports the rank change an unrank or rerank would make
+func respondUnrankedPreview(c *gin.Context, reason UnrankedReason) {
+	change, ok := leaderboard.PreviewUnranked(c.Param("username"), reason)
+	if !ok {
+		respond(c, 404, gin.H{"error": "user not found"})
+		return
+	}
+	respond(c, 200, gin.H{"dryRun": true, "change": change})
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errUserExists = errors.New("user already exists")
+
+// usernameSuggestions is how many alternatives a name conflict offers
+const usernameSuggestions = 3
+
+// CreateUser adds a user under a name nobody holds, reporting the rank they
+// join at. Unlike AddUser it never replaces an existing user. With dryRun it
+// only reports what would happen.
+func (lm *LeaderboardManager) CreateUser(username string, rating int, dryRun bool) (RatingChange, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if !dryRun && freeze.active() {
+		return RatingChange{}, errBoardFrozen
+	}
+	if _, exists := lm.users[username]; exists {
+		return RatingChange{}, errUserExists
+	}
+	if _, deleted := lm.tombstones[username]; deleted {
+		return RatingChange{}, errNameReserved
+	}
+
+	rating = lm.config.clampRating(rating)
+	if dryRun {
+		joining := &User{Username: username, Rating: rating}
+		lm.previewProvisional(joining)
+		return RatingChange{Username: username, NewRating: rating, NewRank: lm.projectedRank(joining)}, nil
+	}
+	if err := lm.addUserLocked(username, rating); err != nil {
+		return RatingChange{}, err
+	}
+	return RatingChange{Username: username, NewRating: rating, NewRank: lm.currentRank(lm.users[username])}, nil
+}
+
+// SetUserRating is UpdateRating reporting the rating and rank before and
+// after. With dryRun it only reports the change, without counting towards
+// the user's write limit.
+func (lm *LeaderboardManager) SetUserRating(username string, rating int, dryRun bool) (RatingChange, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	var user *User
+	if dryRun {
+		var exists bool
+		if user, exists = lm.users[username]; !exists {
+			return RatingChange{}, errUserNotFound
+		}
+	} else {
+		var err error
+		if user, err = lm.writableUser(username); err != nil {
+			return RatingChange{}, err
+		}
+		lm.flushPendingLocked()
+	}
+
+	changed := user.snapshot()
+	changed.Rating = lm.config.clampRating(rating)
+	changed.Updates++
+	lm.previewProvisional(&changed)
+	change := lm.preview(user, &changed)
+	if !dryRun {
+		lm.applyRating(user, changed.Rating)
+	}
+	return change, nil
+}
+
+// RemoveUser deletes a user outright: unlike DeleteUser there is no
+// tombstone, the rating history goes with them and the name is free at once
+func (lm *LeaderboardManager) RemoveUser(username string) (User, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if freeze.active() {
+		return User{}, errBoardFrozen
+	}
+	user, exists := lm.users[username]
+	if !exists {
+		return User{}, errUserNotFound
+	}
+	removed := user.snapshot()
+	lm.removeLocked(user)
+	lm.markChanged()
+	return removed, nil
+}
+
+// removeLocked deletes a user and their rating history outright; lm.mu
+// must be held and the caller marks the change
+func (lm *LeaderboardManager) removeLocked(user *User) {
+	now := time.Now()
+	lm.unlinkUser(user)
+	delete(lm.ratingHistory, user.Username)
+	lm.persist(OpRemove, user, 0, now)
+	lm.replicateLocked(ReplicatedRemove, user.Username, 0, now)
+}
+
+// SuggestUsernames offers names close to a taken one that nobody holds,
+// not even in another case or as a deleted user: name2, name_2026, and so on
+func (lm *LeaderboardManager) SuggestUsernames(username string) []string {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	suggestions := make([]string, 0, usernameSuggestions)
+	offer := func(base, suffix string) {
+		if len(suggestions) == usernameSuggestions {
+			return
+		}
+		if extra := len(base) + len(suffix) - maxUsernameLength; extra > 0 {
+			base = base[:len(base)-extra]
+		}
+		name := base + suffix
+		if _, taken := lm.usernameLower[strings.ToLower(name)]; taken {
+			return
+		}
+		if _, deleted := lm.tombstones[name]; deleted {
+			return
+		}
+		for _, offered := range suggestions {
+			if offered == name {
+				return
+			}
+		}
+		suggestions = append(suggestions, name)
+	}
+
+	year := strconv.Itoa(time.Now().Year())
+	for n := 2; n < 100 && len(suggestions) < usernameSuggestions; n++ {
+		offer(username, strconv.Itoa(n))
+		if n == 2 {
+			offer(username, "_"+year)
+		}
+		offer(username, "_"+strconv.Itoa(n))
+	}
+	return suggestions
+}
+
+// respondUserWriteError maps errors from user writes to status codes,
+// reporting whether there was one
+func respondUserWriteError(c *gin.Context, err error) bool {
+	switch err {
+	case nil:
+		return false
+	case errUserNotFound:
+		respond(c, 404, gin.H{"error": err.Error()})
+	case errUserExists, errNameReserved:
+		respond(c, 409, gin.H{"error": err.Error()})
+	case errBoardFrozen:
+		respondFrozen(c)
+	case errUserWriteLimited:
+		respond(c, 429, gin.H{"error": err.Error()})
+	default:
+		respond(c, 500, gin.H{"error": err.Error()})
+	}
+	return true
+}
+
+// Handler: Add a user to the board
+func createUser(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Rating   *int   `json:"rating" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, 400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	username := strings.TrimSpace(req.Username)
+	if username == "" || len(username) > maxUsernameLength || strings.Contains(username, "/") {
+		respond(c, 400, gin.H{"error": fmt.Sprintf("username must be 1 to %d characters and contain no '/'", maxUsernameLength)})
+		return
+	}
+
+	dryRun, ok := isDryRun(c)
+	if !ok {
+		return
+	}
+	change, err := leaderboard.CreateUser(username, *req.Rating, dryRun)
+	if err == errUserExists || err == errNameReserved {
+		respond(c, 409, gin.H{"error": err.Error(), "suggestions": leaderboard.SuggestUsernames(username)})
+		return
+	}
+	if respondUserWriteError(c, err) {
+		return
+	}
+	if dryRun {
+		respond(c, 200, gin.H{"dryRun": true, "change": change})
+		return
+	}
+	auditLog.Record(c, "user.create", change.Username, gin.H{"rating": change.NewRating})
+	respond(c, 201, gin.H{"dryRun": false, "change": change})
+}
+
+// Handler: Set a user's rating
+func setUserRating(c *gin.Context) {
+	var req struct {
+		Rating *int `json:"rating" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, 400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+
+	dryRun, ok := isDryRun(c)
+	if !ok {
+		return
+	}
+	change, err := leaderboard.SetUserRating(c.Param("username"), *req.Rating, dryRun)
+	if respondUserWriteError(c, err) {
+		return
+	}
+	if !dryRun {
+		auditLog.Record(c, "user.rating", change.Username, gin.H{"from": change.OldRating, "to": change.NewRating})
+	}
+	respond(c, 200, gin.H{"dryRun": dryRun, "change": change})
+}
+
+// Handler: Set the score fields a composite board orders by, e.g. time
+func setUserScores(c *gin.Context) {
+	var req struct {
+		Scores map[string]int `json:"scores" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, 400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	if len(req.Scores) == 0 {
+		respond(c, 400, gin.H{"error": "scores must set at least one field"})
+		return
+	}
+	for field := range req.Scores {
+		// Games and wins are counted from finished games, never set directly
+		if field == GamesPlayedField || field == WinsField || field == "" {
+			respond(c, 400, gin.H{"error": fmt.Sprintf("score field %q can't be set", field)})
+			return
+		}
+	}
+
+	username := c.Param("username")
+	if respondUserWriteError(c, leaderboard.UpdateScores(username, req.Scores)) {
+		return
+	}
+	auditLog.Record(c, "user.scores", username, gin.H{"scores": req.Scores})
+	profile, ok := leaderboard.GetProfile(username, features.For(clientID(c)))
+	if !ok {
+		respond(c, 404, gin.H{"error": "user not found"})
+		return
+	}
+	respond(c, 200, profile)
+}
+
+// Handler: Delete a user. Like the admin delete this tombstones them, so
+// they can be restored during the grace period; ?purge=true removes them
+// for good and frees the name at once.
+func removeUser(c *gin.Context) {
+	purge, err := strconv.ParseBool(c.DefaultQuery("purge", "false"))
+	if err != nil {
+		respond(c, 400, gin.H{"error": "purge must be true or false"})
+		return
+	}
+	if !purge {
+		deleteUser(c)
+		return
+	}
+
+	removed, err := leaderboard.RemoveUser(c.Param("username"))
+	if respondUserWriteError(c, err) {
+		return
+	}
+	auditLog.Record(c, "user.remove", removed.Username, gin.H{"rating": removed.Rating})
+	c.Status(204)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUserLifecycle(t *testing.T) {
+	ts := newTestServer(t, DefaultBoardConfig())
+	ts.createUsers(map[string]int{"bob": 1500})
+
+	change := func(body map[string]any) map[string]any {
+		return body["change"].(map[string]any)
+	}
+	ts.run([]step{
+		{
+			name:    "create needs the admin token",
+			request: request{method: http.MethodPost, path: "/api/users", body: gin.H{"username": "alice", "rating": 1200}},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "create",
+			request: request{method: http.MethodPost, path: "/api/users", body: gin.H{"username": "alice", "rating": 1200}, admin: true},
+			status:  http.StatusCreated,
+			check: func(t *testing.T, body map[string]any) {
+				if rank := number(t, change(body), "newRank"); rank != 2 {
+					t.Errorf("alice joined at rank %d, want 2", rank)
+				}
+			},
+		},
+		{
+			name:    "create a taken name",
+			request: request{method: http.MethodPost, path: "/api/users", body: gin.H{"username": "alice", "rating": 1000}, admin: true},
+			status:  http.StatusConflict,
+			check: func(t *testing.T, body map[string]any) {
+				if suggestions, _ := body["suggestions"].([]any); len(suggestions) == 0 {
+					t.Errorf("conflict offered no suggestions: %v", body)
+				}
+			},
+		},
+		{
+			name:    "set rating needs the admin token",
+			request: request{method: http.MethodPut, path: "/api/users/alice/rating", body: gin.H{"rating": 1800}},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "dry-run set rating",
+			request: request{method: http.MethodPut, path: "/api/users/alice/rating?dryRun=true", body: gin.H{"rating": 1800}, admin: true},
+			status:  http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				if from, to := number(t, change(body), "oldRank"), number(t, change(body), "newRank"); from != 2 || to != 1 {
+					t.Errorf("dry run moved alice from %d to %d, want 2 to 1", from, to)
+				}
+			},
+		},
+		{
+			name:    "dry run changed nothing",
+			request: request{method: http.MethodGet, path: "/api/users/alice"},
+			status:  http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				if rating := number(t, body, "rating"); rating != 1200 {
+					t.Errorf("alice's rating is %d after a dry run, want 1200", rating)
+				}
+			},
+		},
+		{
+			name:    "set rating",
+			request: request{method: http.MethodPut, path: "/api/users/alice/rating", body: gin.H{"rating": 1800}, admin: true},
+			status:  http.StatusOK,
+		},
+		{
+			name:    "new rating and rank are served",
+			request: request{method: http.MethodGet, path: "/api/users/alice"},
+			status:  http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				if rating, rank := number(t, body, "rating"), number(t, body, "rank"); rating != 1800 || rank != 1 {
+					t.Errorf("alice has rating %d at rank %d, want 1800 at rank 1", rating, rank)
+				}
+			},
+		},
+		{
+			name:    "set an unknown user's rating",
+			request: request{method: http.MethodPut, path: "/api/users/carol/rating", body: gin.H{"rating": 1800}, admin: true},
+			status:  http.StatusNotFound,
+		},
+		{
+			name:    "delete needs the admin token",
+			request: request{method: http.MethodDelete, path: "/api/users/alice"},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "delete",
+			request: request{method: http.MethodDelete, path: "/api/users/alice", admin: true},
+			status:  http.StatusOK,
+		},
+		{
+			name:    "deleted user is gone",
+			request: request{method: http.MethodGet, path: "/api/users/alice"},
+			status:  http.StatusNotFound,
+		},
+		{
+			name:    "remaining user moves up",
+			request: request{method: http.MethodGet, path: "/api/users/bob"},
+			status:  http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				if rank := number(t, body, "rank"); rank != 1 {
+					t.Errorf("bob is at rank %d, want 1", rank)
+				}
+			},
+		},
+		{
+			name:    "deleted user is listed for restore",
+			request: request{method: http.MethodGet, path: "/api/admin/users/deleted", admin: true},
+			status:  http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				if got := usernames(t, body["users"]); !equalStrings(got, []string{"alice"}) {
+					t.Errorf("deleted users are %v, want [alice]", got)
+				}
+			},
+		},
+		{
+			name:    "name is held while deleted",
+			request: request{method: http.MethodPost, path: "/api/users", body: gin.H{"username": "alice", "rating": 1000}, admin: true},
+			status:  http.StatusConflict,
+		},
+		{
+			name:    "purge takes a boolean",
+			request: request{method: http.MethodDelete, path: "/api/users/bob?purge=soon", admin: true},
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "purge",
+			request: request{method: http.MethodDelete, path: "/api/users/bob?purge=true", admin: true},
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "purged user can't be restored",
+			request: request{method: http.MethodPost, path: "/api/admin/users/bob/restore", admin: true},
+			status:  http.StatusNotFound,
+		},
+		{
+			name:    "purged name is free again",
+			request: request{method: http.MethodPost, path: "/api/users", body: gin.H{"username": "bob", "rating": 1000}, admin: true},
+			status:  http.StatusCreated,
+		},
+	})
+}
+
+func TestSetUserScores(t *testing.T) {
+	// A speedrun board: fastest time first
+	config := DefaultBoardConfig()
+	config.SortKeys = []SortKey{{Field: "time", Ascending: true}}
+	ts := newTestServer(t, config)
+	ts.createUsers(map[string]int{"ann": 1000, "ben": 1000, "cat": 1000})
+
+	scores := func(username string, time int) step {
+		return step{
+			name:    "set " + username + "'s time",
+			request: request{method: http.MethodPut, path: "/api/users/" + username + "/scores", body: gin.H{"scores": gin.H{"time": time}}, admin: true},
+			status:  http.StatusOK,
+		}
+	}
+	ts.run([]step{
+		{
+			name:    "needs the admin token",
+			request: request{method: http.MethodPut, path: "/api/users/ann/scores", body: gin.H{"scores": gin.H{"time": 90}}},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "games are counted, not set",
+			request: request{method: http.MethodPut, path: "/api/users/ann/scores", body: gin.H{"scores": gin.H{"gamesPlayed": 90}}, admin: true},
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "unknown user",
+			request: request{method: http.MethodPut, path: "/api/users/dan/scores", body: gin.H{"scores": gin.H{"time": 90}}, admin: true},
+			status:  http.StatusNotFound,
+		},
+		scores("ann", 95),
+		scores("ben", 80),
+		scores("cat", 120),
+		{
+			name:    "board is ordered by time",
+			request: request{method: http.MethodGet, path: "/api/leaderboard"},
+			status:  http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				want := []string{"ben", "ann", "cat"}
+				if got := usernames(t, body["users"]); !equalStrings(got, want) {
+					t.Errorf("board is %v, want %v", got, want)
+				}
+			},
+		},
+	})
+}
+
+func TestDryRunSpellings(t *testing.T) {
+	ts := newTestServer(t, DefaultBoardConfig())
+	ts.createUsers(map[string]int{"ann": 1200})
+
+	for query, dryRun := range map[string]bool{
+		"?dryRun=true":  true,
+		"?dryRun=1":     true,
+		"?dryRun=TRUE":  true,
+		"?dryRun=false": false,
+		"?dryRun=0":     false,
+		"":              false,
+	} {
+		body := ts.expect(request{method: http.MethodPut, path: "/api/users/ann/rating" + query, body: gin.H{"rating": 1300}, admin: true}, http.StatusOK)
+		if got := body["dryRun"]; got != dryRun {
+			t.Errorf("%q: dryRun is %v, want %v", query, got, dryRun)
+		}
+	}
+
+	// A value that isn't a boolean is neither a write nor a preview
+	for _, query := range []string{"?dryRun=yes", "?dryRun=", "?dryRun=maybe"} {
+		ts.expect(request{method: http.MethodPut, path: "/api/users/ann/rating" + query, body: gin.H{"rating": 1400}, admin: true}, http.StatusBadRequest)
+	}
+	body := ts.expect(request{method: http.MethodGet, path: "/api/users/ann"}, http.StatusOK)
+	if rating := number(t, body, "rating"); rating != 1300 {
+		t.Errorf("ann's rating is %d after rejected requests, want 1300", rating)
+	}
+}
+
+func TestDryRunLeavesCoalescedRatings(t *testing.T) {
+	ts := newTestServer(t, DefaultBoardConfig())
+	ts.createUsers(map[string]int{"ann": 1200, "ben": 1300})
+	// Coalesce writes with no flush ticker, so only the test flushes
+	leaderboard.pending = make(map[*User]int)
+
+	created := leaderboard.Version()
+	ts.expect(request{method: http.MethodPut, path: "/api/users/ann/rating", body: gin.H{"rating": 1500}, admin: true}, http.StatusOK)
+	version := leaderboard.Version()
+
+	oldRating := func(t *testing.T, change any, field string) {
+		if old := number(t, change, field); old != 1500 {
+			t.Errorf("preview reports an old rating of %d, want the parked 1500", old)
+		}
+	}
+	ts.run([]step{
+		{
+			name:    "preview a rating",
+			request: request{method: http.MethodPut, path: "/api/users/ann/rating?dryRun=true", body: gin.H{"rating": 1600}, admin: true},
+			status:  http.StatusOK,
+			check:   func(t *testing.T, body map[string]any) { oldRating(t, body["change"], "oldRating") },
+		},
+		{
+			name:    "preview unranking",
+			request: request{method: http.MethodPut, path: "/api/admin/users/ann/unranked?dryRun=true", body: gin.H{"reason": "banned"}, admin: true},
+			status:  http.StatusOK,
+			check:   func(t *testing.T, body map[string]any) { oldRating(t, body["change"], "oldRating") },
+		},
+		{
+			name:    "preview a rollback",
+			request: request{method: http.MethodPost, path: fmt.Sprintf("/api/admin/users/ann/rollback?to=%d&dryRun=true", created), admin: true},
+			status:  http.StatusOK,
+			check:   func(t *testing.T, body map[string]any) { oldRating(t, body, "previousRating") },
+		},
+	})
+	if len(leaderboard.pending) != 1 || leaderboard.Version() != version {
+		t.Errorf("previews flushed the parked rating: %d pending, version %d, want 1 pending at version %d", len(leaderboard.pending), leaderboard.Version(), version)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rankHistoryRetention is how long rank samples are kept for velocity stats
+const rankHistoryRetention = 24 * time.Hour
+
+// rankTimeline records every user's rank at fixed sampling intervals.
+// All users share one list of sample times; each user's ranks line up with
+// the tail of that list, so users added later simply have fewer samples.
+type rankTimeline struct {
+	times []time.Time
+	ranks map[string][]int32
+}
+
+func newRankTimeline() *rankTimeline {
+	return &rankTimeline{
+		times: make([]time.Time, 0),
+		ranks: make(map[string][]int32),
+	}
+}
+
+// record appends one sample for every user and drops samples past retention
+func (t *rankTimeline) record(now time.Time, users []*User) {
+	t.times = append(t.times, now)
+	for _, user := range users {
+		t.ranks[user.Username] = append(t.ranks[user.Username], int32(user.Rank))
+	}
+
+	// Forget users missing from this sample, even when others joined in
+	// their place: a series with a gap would no longer line up with times
+	present := make(map[string]bool, len(users))
+	for _, user := range users {
+		present[user.Username] = true
+	}
+	for username := range t.ranks {
+		if !present[username] {
+			delete(t.ranks, username)
+		}
+	}
+
+	cut := 0
+	for cut < len(t.times)-1 && now.Sub(t.times[cut]) > rankHistoryRetention {
+		cut++
+	}
+	if cut == 0 {
+		return
+	}
+	t.times = t.times[cut:]
+	for username, ranks := range t.ranks {
+		if extra := len(ranks) - len(t.times); extra > 0 {
+			t.ranks[username] = ranks[extra:]
+		}
+	}
+}
+
+// rankSince returns the user's oldest recorded rank taken at or after since
+func (t *rankTimeline) rankSince(username string, since time.Time) (int, time.Time, bool) {
+	ranks := t.ranks[username]
+	if len(ranks) == 0 {
+		return 0, time.Time{}, false
+	}
+
+	offset := len(t.times) - len(ranks)
+	i := sort.Search(len(t.times), func(i int) bool {
+		return !t.times[i].Before(since)
+	})
+	if i < offset {
+		i = offset
+	}
+	if i == len(t.times) {
+		i = len(t.times) - 1
+	}
+	return int(ranks[i-offset]), t.times[i], true
+}
+
+// RankChange is how far a user moved over a window; positive means they climbed
+type RankChange struct {
+	Change int       `json:"change"`
+	Since  time.Time `json:"since"`
+}
+
+// RankVelocity summarizes a user's recent rank movement
+type RankVelocity struct {
+	Username string      `json:"username"`
+	Rank     int         `json:"rank"`
+	LastHour *RankChange `json:"lastHour"`
+	LastDay  *RankChange `json:"lastDay"`
+}
+
+// Climber is an entry on the fastest climbers board
+type Climber struct {
+	Username string    `json:"username"`
+	Rank     int       `json:"rank"`
+	Rating   int       `json:"rating"`
+	Change   int       `json:"change"`
+	Since    time.Time `json:"since"`
+}
+
+// TrackRankHistory samples every user's rank at a fixed interval
+func (lm *LeaderboardManager) TrackRankHistory(interval time.Duration) {
+	job := backgroundJobs.register("rank history", interval)
+	sample := func(now time.Time) {
+		lm.mu.Lock()
+		lm.recalculateRanks()
+		lm.rankHistory.record(now, lm.ranked())
+		lm.mu.Unlock()
+		job.ran(now)
+	}
+	sample(time.Now())
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for now := range ticker.C {
+			sample(now)
+		}
+	}()
+	log.Printf("📈 Sampling ranks every %s for velocity stats", interval)
+}
+
+// rankChangeLocked computes a user's change from a point in time to their
+// current rank
+func (lm *LeaderboardManager) rankChangeLocked(user *User, rank int, since time.Time) *RankChange {
+	oldRank, at, ok := lm.rankHistory.rankSince(user.Username, since)
+	if !ok {
+		return nil
+	}
+	return &RankChange{Change: oldRank - rank, Since: at}
+}
+
+// RankVelocity returns how many ranks a user gained or lost over the last hour and day
+func (lm *LeaderboardManager) RankVelocity(username string, paths FeaturePaths) (RankVelocity, bool) {
+	if !lm.MightExist(username) {
+		return RankVelocity{}, false
+	}
+
+	lm.rLockPlacing(paths)
+	defer lm.mu.RUnlock()
+
+	user, exists := lm.users[username]
+	if !exists {
+		return RankVelocity{}, false
+	}
+
+	now := time.Now()
+	rank := lm.placedUser(user, paths).Rank
+	return RankVelocity{
+		Username: user.Username,
+		Rank:     rank,
+		LastHour: lm.rankChangeLocked(user, rank, now.Add(-time.Hour)),
+		LastDay:  lm.rankChangeLocked(user, rank, now.Add(-24*time.Hour)),
+	}, true
+}
+
+// TopClimbers returns the users who gained the most ranks over the window
+func (lm *LeaderboardManager) TopClimbers(window time.Duration, limit int) []Climber {
+	return lm.topMovers(window, limit, false)
+}
+
+// TopChurn returns the users whose rank moved the most over the window, up or down
+func (lm *LeaderboardManager) TopChurn(window time.Duration, limit int) []Climber {
+	return lm.topMovers(window, limit, true)
+}
+
+// topMovers ranks users by rank change over the window: gains only, or the
+// size of the move in either direction when both is set
+func (lm *LeaderboardManager) topMovers(window time.Duration, limit int, both bool) []Climber {
+	lm.rLockRanked()
+	defer lm.mu.RUnlock()
+
+	since := time.Now().Add(-window)
+	climbers := make([]Climber, 0)
+	for _, user := range lm.ranked() {
+		change := lm.rankChangeLocked(user, user.Rank, since)
+		if change == nil || change.Change == 0 || (change.Change < 0 && !both) {
+			continue
+		}
+		climbers = append(climbers, Climber{
+			Username: user.Username,
+			Rank:     user.Rank,
+			Rating:   user.Rating,
+			Change:   change.Change,
+			Since:    change.Since,
+		})
+	}
+
+	sort.SliceStable(climbers, func(i, j int) bool {
+		if both {
+			return abs(climbers[i].Change) > abs(climbers[j].Change)
+		}
+		return climbers[i].Change > climbers[j].Change
+	})
+	if len(climbers) > limit {
+		climbers = climbers[:limit]
+	}
+	return climbers
+}
+
+// Handler: Get a user's rank velocity
+func getUserVelocity(c *gin.Context) {
+	velocity, ok := leaderboard.RankVelocity(c.Param("username"), features.For(clientID(c)))
+	if !ok {
+		respond(c, 404, gin.H{"error": "user not found"})
+		return
+	}
+	respond(c, 200, velocity)
+}
+
+// Handler: Get the fastest climbers
+func getTopClimbers(c *gin.Context) {
+	window := time.Hour
+	switch c.DefaultQuery("window", "hour") {
+	case "hour":
+	case "day":
+		window = 24 * time.Hour
+	default:
+		respond(c, 400, gin.H{"error": "window must be 'hour' or 'day'"})
+		return
+	}
+
+	limit := 10
+	if l := c.Query("limit"); l != "" {
+		fmt.Sscanf(l, "%d", &limit)
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	climbers := leaderboard.TopClimbers(window, limit)
+	respond(c, 200, gin.H{
+		"climbers": climbers,
+		"window":   c.DefaultQuery("window", "hour"),
+		"count":    len(climbers),
+	})
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRankTimelineDropsDepartedUsers(t *testing.T) {
+	timeline := newRankTimeline()
+	start := time.Now()
+	ann, ben, cat := &User{Username: "ann", Rank: 1}, &User{Username: "ben", Rank: 2}, &User{Username: "cat", Rank: 2}
+
+	timeline.record(start, []*User{ann, ben})
+	// ben leaves and cat joins between samples, so the count doesn't change
+	timeline.record(start.Add(time.Minute), []*User{ann, cat})
+	ben.Rank = 3
+	timeline.record(start.Add(2*time.Minute), []*User{ann, cat, ben})
+
+	if _, ok := timeline.ranks["ben"]; !ok {
+		t.Fatal("ben has no series after rejoining")
+	}
+	if len(timeline.ranks["ben"]) != 1 {
+		t.Errorf("ben has %d samples, want only the one since rejoining", len(timeline.ranks["ben"]))
+	}
+	rank, at, ok := timeline.rankSince("ben", start)
+	if !ok || rank != 3 || !at.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("ben's earliest rank is %d at %s, want 3 at the last sample", rank, at)
+	}
+}
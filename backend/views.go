@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxViewLimit caps how many users a saved view holds
+	maxViewLimit = 10000
+	// maxSavedViews caps how many views can be saved
+	maxSavedViews = 100
+	// viewActivityTTL is how long a view filtering on activity is cached,
+	// since its matches change with the clock as well as the board
+	viewActivityTTL = time.Minute
+)
+
+var viewName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// SavedView is a named filter and ordering that dashboards can reference
+type SavedView struct {
+	Name string `json:"name"`
+	// Filter is a filter expression as accepted by ?filter=
+	Filter string `json:"filter,omitempty"`
+	// Sort orders the view; empty keeps board order
+	Sort     []SortKey      `json:"sort,omitempty"`
+	Limit    int            `json:"limit"`
+	Unranked UnrankedFilter `json:"unranked"`
+	Revision int            `json:"revision"`
+	SavedAt  time.Time      `json:"savedAt"`
+
+	expr *FilterExpr
+}
+
+// savedViews holds views by name
+type savedViews struct {
+	mu    sync.RWMutex
+	views map[string]*SavedView
+}
+
+var views = &savedViews{views: make(map[string]*SavedView)}
+
+// viewCache holds each view's users at the current board version
+var viewCache = newVersionedCache[[]User]()
+
+// save stores a view, replacing any view of the same name
+func (sv *savedViews) save(view *SavedView) error {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	previous, exists := sv.views[view.Name]
+	if !exists && len(sv.views) >= maxSavedViews {
+		return fmt.Errorf("at most %d views can be saved", maxSavedViews)
+	}
+	view.Revision = 1
+	if exists {
+		view.Revision = previous.Revision + 1
+	}
+	view.SavedAt = time.Now()
+	sv.views[view.Name] = view
+	return nil
+}
+
+func (sv *savedViews) remove(name string) (*SavedView, bool) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	view, exists := sv.views[name]
+	delete(sv.views, name)
+	return view, exists
+}
+
+func (sv *savedViews) get(name string) (*SavedView, bool) {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	view, ok := sv.views[name]
+	return view, ok
+}
+
+// list returns every view sorted by name
+func (sv *savedViews) list() []SavedView {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	list := make([]SavedView, 0, len(sv.views))
+	for _, view := range sv.views {
+		list = append(list, *view)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// cacheKey identifies a view's result: a changed view gets a new revision,
+// and a view filtering on activity also expires with the clock
+func (view *SavedView) cacheKey() string {
+	key := fmt.Sprintf("%s#%d", view.Name, view.Revision)
+	if view.expr != nil && view.expr.timeDependent() {
+		key += fmt.Sprintf("@%d", time.Now().Truncate(viewActivityTTL).Unix())
+	}
+	return key
+}
+
+// ViewUsers returns the users a saved view selects, up to its limit
+func (lm *LeaderboardManager) ViewUsers(view *SavedView) []User {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.recalculateRanks()
+
+	candidates := lm.view(view.Unranked)
+	if view.expr != nil {
+		candidates = lm.candidates(view.expr, view.Unranked)
+	}
+
+	now := time.Now()
+	matched := make([]*User, 0, min(len(candidates), view.Limit))
+	for _, user := range candidates {
+		if view.expr != nil && !view.expr.Matches(user, now) {
+			continue
+		}
+		matched = append(matched, user)
+		// In board order the first matches are the top ones
+		if len(view.Sort) == 0 && len(matched) == view.Limit {
+			break
+		}
+	}
+	if len(view.Sort) > 0 {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return compareByKeys(view.Sort, matched[i], matched[j]) < 0
+		})
+		matched = matched[:min(len(matched), view.Limit)]
+	}
+
+	users := make([]User, len(matched))
+	for i, user := range matched {
+		users[i] = user.snapshot()
+	}
+	return users
+}
+
+// Handler: Save a named view
+func saveView(c *gin.Context) {
+	name := c.Param("name")
+	if !viewName.MatchString(name) {
+		respond(c, 400, gin.H{"error": "view names are 1-64 lowercase letters, digits, '-' or '_'"})
+		return
+	}
+	var req struct {
+		Filter   string `json:"filter"`
+		Sort     string `json:"sort"`
+		Limit    int    `json:"limit"`
+		Unranked string `json:"unranked"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respond(c, 400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+
+	view := &SavedView{Name: name, Filter: strings.TrimSpace(req.Filter), Limit: req.Limit}
+	var err error
+	if view.Filter != "" {
+		if view.expr, err = ParseFilterExpr(view.Filter); err != nil {
+			respond(c, 400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Sort != "" {
+		if view.Sort, err = ParseSortKeys(req.Sort); err != nil {
+			respond(c, 400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if view.Unranked, err = ParseUnrankedFilter(req.Unranked); err != nil {
+		respond(c, 400, gin.H{"error": err.Error()})
+		return
+	}
+	if view.Limit == 0 {
+		view.Limit = maxViewLimit
+	}
+	if view.Limit < 0 || view.Limit > maxViewLimit {
+		respond(c, 400, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxViewLimit)})
+		return
+	}
+
+	if err := views.save(view); err != nil {
+		respond(c, 409, gin.H{"error": err.Error()})
+		return
+	}
+	auditLog.Record(c, "view.save", name, gin.H{"filter": view.Filter, "sort": req.Sort, "limit": view.Limit, "revision": view.Revision})
+	respond(c, 200, view)
+}
+
+// Handler: Delete a saved view
+func deleteView(c *gin.Context) {
+	view, ok := views.remove(c.Param("name"))
+	if !ok {
+		respond(c, 404, gin.H{"error": "view not found"})
+		return
+	}
+	auditLog.Record(c, "view.delete", view.Name, gin.H{"revision": view.Revision})
+	respond(c, 200, view)
+}
+
+// Handler: List saved views
+func listViews(c *gin.Context) {
+	list := views.list()
+	respond(c, 200, gin.H{"views": list, "count": len(list)})
+}
+
+// Handler: Get a page of a saved view
+func getView(c *gin.Context) {
+	view, ok := views.get(c.Param("name"))
+	if !ok {
+		respond(c, 404, gin.H{"error": "view not found"})
+		return
+	}
+	page, pageSize, ok := parsePageParams(c)
+	if !ok {
+		return
+	}
+
+	version := leaderboard.Version()
+	key := view.cacheKey()
+	users, cached := viewCache.get(key, version)
+	if !cached {
+		users = leaderboard.ViewUsers(view)
+		viewCache.put(key, version, users)
+	}
+	setListHeaders(c, len(users), version)
+
+	response := gin.H{
+		"view":       view,
+		"users":      pageOf(users, page, pageSize),
+		"totalUsers": len(users),
+		"display":    leaderboard.Display(),
+	}
+	addPagination(response, c, page, pageSize, len(users))
+	respond(c, 200, response)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// hllPrecision gives 2^14 registers: 16KB per day, ~0.8% standard error
+	hllPrecision = 14
+	// visitorDaysKept is how many days of unique visitor counts are retained
+	visitorDaysKept = 7
+)
+
+// hyperLogLog estimates the number of distinct items added to it
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+// add records one item by its 64-bit hash
+func (h *hyperLogLog) add(hash uint64) {
+	index := hash >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// estimate returns the approximate number of distinct items
+func (h *hyperLogLog) estimate() uint64 {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// Linear counting is more accurate while many registers are still empty
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// DailyVisitors is the approximate number of unique clients seen on one day
+type DailyVisitors struct {
+	Day   string `json:"day"`
+	Count uint64 `json:"count"`
+}
+
+// VisitorStats counts approximate unique clients per day without storing who they are
+type VisitorStats struct {
+	mu   sync.Mutex
+	seed maphash.Seed
+	days map[string]*hyperLogLog
+}
+
+// NewVisitorStats creates an empty visitor tracker
+func NewVisitorStats() *VisitorStats {
+	return &VisitorStats{
+		seed: maphash.MakeSeed(),
+		days: make(map[string]*hyperLogLog),
+	}
+}
+
+// Record counts a client identifier as seen at the given time
+func (vs *VisitorStats) Record(clientID string, at time.Time) {
+	day := at.UTC().Format("2006-01-02")
+	hash := maphash.String(vs.seed, clientID)
+
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	hll, exists := vs.days[day]
+	if !exists {
+		hll = newHyperLogLog()
+		vs.days[day] = hll
+		vs.pruneLocked()
+	}
+	hll.add(hash)
+}
+
+// pruneLocked drops the oldest days beyond the retention window
+func (vs *VisitorStats) pruneLocked() {
+	if len(vs.days) <= visitorDaysKept {
+		return
+	}
+	days := make([]string, 0, len(vs.days))
+	for day := range vs.days {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	for _, day := range days[:len(days)-visitorDaysKept] {
+		delete(vs.days, day)
+	}
+}
+
+// Daily returns the unique visitor estimate for each retained day, newest first
+func (vs *VisitorStats) Daily() []DailyVisitors {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	result := make([]DailyVisitors, 0, len(vs.days))
+	for day, hll := range vs.days {
+		result = append(result, DailyVisitors{Day: day, Count: hll.estimate()})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Day > result[j].Day
+	})
+	return result
+}
+
+var visitorStats = NewVisitorStats()
+
+// clientID identifies the caller: its API key if given, otherwise its IP
+func clientID(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	return c.ClientIP()
+}
+
+// trackVisitors records each request's client
+func trackVisitors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		visitorStats.Record(clientID(c), time.Now())
+		c.Next()
+	}
+}